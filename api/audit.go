@@ -0,0 +1,114 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
+	"github.com/e-inwork-com/go-user-service/internal/validator"
+	"github.com/google/uuid"
+	"github.com/tomasen/realip"
+)
+
+// audit Function to record an event of the account of the user with the IP
+// and the user agent of the request, the actor is nil when it is unknown.
+// A failed record is logged, it doesn't fail the request
+func (app *Application) audit(r *http.Request, eventType string, userID uuid.UUID, actorID *uuid.UUID, details string) {
+	event := &data.AuditEvent{
+		UserID:    userID,
+		ActorID:   actorID,
+		Type:      eventType,
+		Details:   details,
+		IP:        realip.FromRequest(r),
+		UserAgent: r.UserAgent(),
+	}
+
+	err := app.Models.AuditEvents.Insert(event)
+	if err != nil {
+		app.Logger.PrintError(err, map[string]string{
+			"user_id": userID.String(),
+			"type":    eventType,
+		})
+	}
+}
+
+// listOwnAuditEventsHandler Function to list the audit events of the current user
+func (app *Application) listOwnAuditEventsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	app.listAuditEvents(w, r, user.ID)
+}
+
+// listUserAuditEventsHandler Function to list the audit events of a user by the ID param,
+// it requires the "users:admin" permission
+func (app *Application) listUserAuditEventsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	app.listAuditEvents(w, r, id)
+}
+
+// listAuditEvents Function to send a page of the audit events of the user,
+// the newest first, filtered by type_t, ip_t, created_after_dt and created_before_dt
+func (app *Application) listAuditEvents(w http.ResponseWriter, r *http.Request, userID uuid.UUID) {
+	input := data.AuditEventFilters{UserID: userID}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Type = app.readString(qs, "type_t", "")
+	input.IP = app.readString(qs, "ip_t", "")
+	input.CreatedAfter = app.readTime(qs, "created_after_dt", v)
+	input.CreatedBefore = app.readTime(qs, "created_before_dt", v)
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = "-created_at_dt"
+	input.Filters.SortSafelist = data.AuditEventSortSafelist
+
+	if data.ValidateAuditEventFilters(v, input); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	events, metadata, err := app.Models.AuditEvents.GetAll(input)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"audit_events": events, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// pruneAuditEvents Function to delete the audit events older than the retention
+// every interval until the stop channel is closed, they are kept without a retention
+func (app *Application) pruneAuditEvents(stop <-chan struct{}) {
+	if app.Config.Audit.Retention <= 0 {
+		return
+	}
+
+	interval := app.Config.Audit.PruneInterval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	for {
+		err := app.Models.AuditEvents.DeleteBefore(time.Now().Add(-app.Config.Audit.Retention))
+		if err != nil {
+			app.Logger.PrintError(err, nil)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
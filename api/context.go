@@ -9,7 +9,10 @@ import (
 
 type contextKey string
 
-const userContextKey = contextKey("user")
+const (
+	userContextKey   = contextKey("user")
+	claimsContextKey = contextKey("claims")
+)
 
 func (app *Application) contextSetUser(r *http.Request, user *data.User) *http.Request {
 	ctx := context.WithValue(r.Context(), userContextKey, user)
@@ -24,3 +27,17 @@ func (app *Application) contextGetUser(r *http.Request) *data.User {
 
 	return user
 }
+
+func (app *Application) contextSetClaims(r *http.Request, claims *Claims) *http.Request {
+	ctx := context.WithValue(r.Context(), claimsContextKey, claims)
+	return r.WithContext(ctx)
+}
+
+func (app *Application) contextGetClaims(r *http.Request) *Claims {
+	claims, ok := r.Context().Value(claimsContextKey).(*Claims)
+	if !ok {
+		panic("missing claims value in request context")
+	}
+
+	return claims
+}
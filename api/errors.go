@@ -1,8 +1,15 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
 )
 
 func (app *Application) logError(r *http.Request, err error) {
@@ -23,12 +30,40 @@ func (app *Application) errorResponse(w http.ResponseWriter, r *http.Request, st
 }
 
 func (app *Application) serverErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
-	app.logError(r, err)
+	// The errors translated by the data layer have their own responses
+	switch {
+	case errors.Is(err, data.ErrValueTooLong):
+		app.valueTooLongResponse(w, r)
+		return
+	case errors.Is(err, data.ErrRetryable), errors.Is(err, data.ErrTimeout):
+		app.logError(r, err)
+		app.serviceUnavailableResponse(w, r)
+		return
+	}
+
+	// A query cancelled with the request isn't an error of the server
+	if !errors.Is(err, context.Canceled) || r.Context().Err() == nil {
+		app.logError(r, err)
+	}
 
 	message := "the server encountered a problem and could not process your request"
 	app.errorResponse(w, r, http.StatusInternalServerError, message)
 }
 
+// serviceUnavailableResponse Function to ask the client to send the request again,
+// after a conflict of the transactions or a timeout of the database
+func (app *Application) serviceUnavailableResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Retry-After", "1")
+
+	message := "the server is temporarily unable to process your request, please try again"
+	app.errorResponse(w, r, http.StatusServiceUnavailable, message)
+}
+
+func (app *Application) valueTooLongResponse(w http.ResponseWriter, r *http.Request) {
+	message := "a value of the request is too long to be stored"
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, message)
+}
+
 func (app *Application) notFoundResponse(w http.ResponseWriter, r *http.Request) {
 	message := "the requested resource could not be found"
 	app.errorResponse(w, r, http.StatusNotFound, message)
@@ -57,6 +92,15 @@ func (app *Application) rateLimitExceededResponse(w http.ResponseWriter, r *http
 	app.errorResponse(w, r, http.StatusTooManyRequests, message)
 }
 
+// tooManyLoginAttemptsResponse Function to send the time before the next login,
+// the response is the same whether the account exists or not
+func (app *Application) tooManyLoginAttemptsResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+
+	message := "too many failed login attempts, please try again later"
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
+
 func (app *Application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
 	message := "invalid authentication credentials"
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
@@ -69,6 +113,16 @@ func (app *Application) invalidAuthenticationTokenResponse(w http.ResponseWriter
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
 }
 
+func (app *Application) invalidRefreshTokenResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid, expired or revoked refresh token"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (app *Application) invalidDownloadLinkResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid or expired download link"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
 func (app *Application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
 	message := "you must be authenticated to access this resource"
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
@@ -83,3 +137,8 @@ func (app *Application) notPermittedResponse(w http.ResponseWriter, r *http.Requ
 	message := "your user account doesn't have the necessary permissions to access this resource"
 	app.errorResponse(w, r, http.StatusForbidden, message)
 }
+
+func (app *Application) mfaAlreadyEnabledResponse(w http.ResponseWriter, r *http.Request) {
+	message := "two-factor authentication is already enabled"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
@@ -0,0 +1,198 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
+	"github.com/e-inwork-com/go-user-service/internal/export"
+	"github.com/google/uuid"
+)
+
+// ScopeExport is the scope of the sealed token of a download link,
+// its subject is the ID of the export
+const ScopeExport = "export"
+
+// exportStatus is an export with its download link once it is ready
+type exportStatus struct {
+	*data.Export
+	Version           int        `json:"version"`
+	DownloadURL       string     `json:"download_url_t,omitempty"`
+	DownloadURLExpiry *time.Time `json:"download_url_expiry_dt,omitempty"`
+}
+
+// createExportHandler Function to export the personal data of the current user,
+// the archive is generated in the background and its status is on the Location
+func (app *Application) createExportHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	// Remove the archives nobody can download anymore
+	err := app.Models.Exports.DeleteExpired(time.Now())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	userExport := &data.Export{
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(app.Config.Exports.TTL),
+	}
+
+	err = app.Models.Exports.Insert(userExport)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.background(func() {
+		app.generateExport(userExport)
+	})
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/service/users/me/exports/%s", userExport.ID))
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"export": exportStatus{Export: userExport, Version: export.Version}}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// generateExport Function to build the archive of an export,
+// the export is failed if the archive can't be built
+func (app *Application) generateExport(userExport *data.Export) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	archive, err := export.Build(ctx, app.Models, userExport.UserID)
+	if err == nil {
+		var document []byte
+
+		document, err = archive.Marshal()
+		if err == nil {
+			err = app.Models.Exports.Complete(userExport.ID, document)
+		}
+	}
+
+	if err != nil {
+		app.Logger.PrintError(err, map[string]string{
+			"export_id": userExport.ID.String(),
+		})
+
+		err = app.Models.Exports.Fail(userExport.ID)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"export_id": userExport.ID.String(),
+			})
+		}
+	}
+}
+
+// getExportHandler Function to get the status of an export of the current user,
+// a ready export has a download link that expires after a short time
+func (app *Application) getExportHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	userExport, err := app.Models.Exports.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if userExport.IsExpired() {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	status := exportStatus{Export: userExport, Version: export.Version}
+
+	if userExport.Status == data.ExportReady {
+		token, expiry, err := app.createDownloadToken(userExport)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		status.DownloadURL = fmt.Sprintf("/service/users/me/exports/%s/download?token=%s", userExport.ID, token)
+		status.DownloadURLExpiry = &expiry
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"export": status}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createDownloadToken Function to seal the token of the download link of an export,
+// the link expires before the export
+func (app *Application) createDownloadToken(userExport *data.Export) (string, time.Time, error) {
+	issuedAt := time.Now()
+
+	expirationTime := issuedAt.Add(app.Config.Exports.LinkTTL)
+	if expirationTime.After(userExport.ExpiresAt) {
+		expirationTime = userExport.ExpiresAt
+	}
+
+	claims := &sealedClaims{
+		ID:        uuid.NewString(),
+		UserID:    userExport.UserID,
+		Scope:     ScopeExport,
+		Subject:   userExport.ID.String(),
+		IssuedAt:  issuedAt,
+		ExpiresAt: expirationTime,
+	}
+
+	token, err := app.sealToken(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return token, expirationTime, nil
+}
+
+// downloadExportHandler Function to download the archive of an export with the
+// token of its download link, the link works without the authentication header
+func (app *Application) downloadExportHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	claims, ok := app.openToken(r.URL.Query().Get("token"), ScopeExport)
+	if !ok || claims.Subject != id.String() {
+		app.invalidDownloadLinkResponse(w, r)
+		return
+	}
+
+	archive, err := app.Models.Exports.GetArchive(id, claims.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="user-export-%s.json"`, id))
+	w.Header().Set("Cache-Control", "no-store")
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(archive)
+}
@@ -9,6 +9,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 
@@ -141,6 +142,43 @@ func (app *Application) readInt(qs url.Values, key string, defaultValue int, v *
 	return i
 }
 
+// readBool returns nil if the key isn't in the query string
+func (app *Application) readBool(qs url.Values, key string, v *validator.Validator) *bool {
+	s := qs.Get(key)
+
+	if s == "" {
+		return nil
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return nil
+	}
+
+	return &b
+}
+
+// readTime reads a RFC 3339 time or a date, it returns nil if the key isn't in the query string
+func (app *Application) readTime(qs url.Values, key string, v *validator.Validator) *time.Time {
+	s := qs.Get(key)
+
+	if s == "" {
+		return nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t, err = time.Parse("2006-01-02", s)
+		if err != nil {
+			v.AddError(key, "must be a RFC 3339 time or a date (2006-01-02)")
+			return nil
+		}
+	}
+
+	return &t
+}
+
 func (app *Application) background(fn func()) {
 	app.wg.Add(1)
 
@@ -157,3 +195,17 @@ func (app *Application) background(fn func()) {
 		fn()
 	}()
 }
+
+// sendEmail Function to send an email in the background,
+// the pending emails are sent before the server is stopped
+func (app *Application) sendEmail(recipient string, templateFile string, data map[string]interface{}) {
+	app.background(func() {
+		err := app.Mailer.Send(recipient, templateFile, data)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"recipient": recipient,
+				"template":  templateFile,
+			})
+		}
+	})
+}
@@ -0,0 +1,418 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
+	"github.com/e-inwork-com/go-user-service/internal/totp"
+	"github.com/e-inwork-com/go-user-service/internal/validator"
+	"github.com/google/uuid"
+)
+
+// mfaMaxAttempts is the number of wrong codes after which a "mfa" token
+// is revoked, the password has to be sent again for a new one
+const mfaMaxAttempts = 3
+
+// writeMFAToken Function to send a short-lived opaque token that is
+// exchanged with a TOTP or a recovery code for an access token
+func (app *Application) writeMFAToken(w http.ResponseWriter, r *http.Request, user *data.User) {
+	issuedAt := time.Now()
+	expirationTime := issuedAt.Add(5 * time.Minute)
+
+	claims := &sealedClaims{
+		ID:        uuid.NewString(),
+		UserID:    user.ID,
+		Scope:     ScopeMFA,
+		IssuedAt:  issuedAt,
+		ExpiresAt: expirationTime,
+	}
+
+	token, err := app.sealToken(claims)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{
+		"mfa_required":        true,
+		"mfa_token":           token,
+		"mfa_token_expiry_dt": expirationTime,
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// checkTOTPCode Function to check a code against the secret of the enrollment,
+// a code is accepted only once
+func (app *Application) checkTOTPCode(enrollment *data.TOTP, code string) (bool, error) {
+	secret, err := app.Cipher.Decrypt(enrollment.SecretCiphertext)
+	if err != nil {
+		return false, err
+	}
+
+	step, ok := totp.Validate(string(secret), code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	return app.Models.TOTP.UseStep(enrollment, step)
+}
+
+// createTOTPHandler Function to start the TOTP enrollment of the current user
+func (app *Application) createTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	enrollment, err := app.Models.TOTP.GetByUserID(user.ID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if enrollment != nil && enrollment.Enabled {
+		app.mfaAlreadyEnabledResponse(w, r)
+		return
+	}
+
+	// Create a new secret, and store it encrypted
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	ciphertext, err := app.Cipher.Encrypt([]byte(secret))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	enrollment = &data.TOTP{
+		UserID:           user.ID,
+		SecretCiphertext: ciphertext,
+	}
+
+	err = app.Models.TOTP.Upsert(enrollment)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// The secret is only shown once, the URI is meant for a QR code
+	env := envelope{
+		"secret":      secret,
+		"otpauth_uri": totp.URI(app.Config.Mfa.Issuer, user.Email, secret),
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// confirmTOTPHandler Function to enable TOTP with a first code from the authenticator,
+// the recovery codes are sent back once
+func (app *Application) confirmTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if v.Check(input.Code != "", "code", "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	enrollment, err := app.Models.TOTP.GetByUserID(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if enrollment.Enabled {
+		app.mfaAlreadyEnabledResponse(w, r)
+		return
+	}
+
+	ok, err := app.checkTOTPCode(enrollment, input.Code)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !ok {
+		v.AddError("code", "invalid or expired code")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Create the recovery codes, only the hashes are stored
+	codes, err := data.GenerateRecoveryCodes(10)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.Models.RecoveryCodes.Replace(user.ID, codes)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.Models.TOTP.Enable(enrollment)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"recovery_codes": codes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// disableTOTPHandler Function to disable TOTP, it requires the current password
+// and a code from the authenticator or a recovery code
+func (app *Application) disableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		CurrentPassword string `json:"current_password"`
+		Code            string `json:"code"`
+		RecoveryCode    string `json:"recovery_code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.CurrentPassword != "", "current_password", "must be provided")
+	v.Check(input.Code != "" || input.RecoveryCode != "", "code", "a code or a recovery code must be provided")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.confirmPassword(w, r, user, input.CurrentPassword, "current_password") {
+		return
+	}
+
+	enrollment, err := app.Models.TOTP.GetByUserID(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	ok, err := app.checkSecondFactor(enrollment, input.Code, input.RecoveryCode)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !ok {
+		v.AddError("code", "invalid or expired code")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.Models.TOTP.Delete(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.Models.RecoveryCodes.Replace(user.ID, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "two-factor authentication has been disabled"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// checkSecondFactor Function to check a TOTP code, or a recovery code if no code is sent
+func (app *Application) checkSecondFactor(enrollment *data.TOTP, code string, recoveryCode string) (bool, error) {
+	if code != "" {
+		return app.checkTOTPCode(enrollment, code)
+	}
+
+	return app.Models.RecoveryCodes.Use(enrollment.UserID, recoveryCode)
+}
+
+// createMFAAuthenticationTokenHandler Function to exchange a "mfa" token
+// and a TOTP code or a recovery code for an access token
+func (app *Application) createMFAAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.MFAToken != "", "mfa_token", "must be provided")
+	v.Check(input.Code != "" || input.RecoveryCode != "", "code", "a code or a recovery code must be provided")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Open the "mfa" token
+	claims, ok := app.openToken(input.MFAToken, ScopeMFA)
+	if !ok {
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	// The "mfa" token can only be exchanged once
+	revoked, err := app.Models.RevokedTokens.Exists(claims.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if revoked {
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	user, err := app.Models.Users.GetByID(r.Context(), claims.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidCredentialsResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Reject a "mfa" token issued before the user logged out everywhere,
+	// or before the password or the email was changed
+	if claims.IssuedAt.Before(user.TokensValidAfter) {
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	// The codes are guessed on the lockout of the account like the passwords,
+	// the code is counted as a failure until it is checked
+	wait, err := app.Lockout.Attempt(user.Email)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if wait > 0 {
+		app.tooManyLoginAttemptsResponse(w, r, wait)
+		return
+	}
+
+	enrollment, err := app.Models.TOTP.GetByUserID(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidCredentialsResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	ok, err = app.checkSecondFactor(enrollment, input.Code, input.RecoveryCode)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !ok {
+		app.failedMFAResponse(w, r, user, claims)
+		return
+	}
+
+	err = app.Models.RevokedTokens.Insert(claims.ID, user.ID, claims.ExpiresAt)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Forget the failed logins of the account and of the "mfa" token
+	err = app.Lockout.Reset(user.Email)
+	if err == nil {
+		err = app.Lockout.Reset(mfaLockoutKey(claims))
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.audit(r, data.AuditLoginSucceeded, user.ID, &user.ID, "mfa")
+
+	// Send an access token with a refresh token of a new token family
+	app.writeAuthenticationTokens(w, r, user, uuid.New(), data.AuditTokenIssued)
+}
+
+// mfaLockoutKey returns the key of the failed codes of a "mfa" token in the lockout
+func mfaLockoutKey(claims *sealedClaims) string {
+	return "mfa:" + claims.ID
+}
+
+// failedMFAResponse Function to count a wrong code on the lockout of the "mfa" token,
+// the attempt already counted it for the account. The token is revoked after
+// mfaMaxAttempts wrong codes
+func (app *Application) failedMFAResponse(w http.ResponseWriter, r *http.Request, user *data.User, claims *sealedClaims) {
+	_, err := app.Lockout.Fail(mfaLockoutKey(claims))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	failures, err := app.Lockout.Failures(mfaLockoutKey(claims))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if failures >= mfaMaxAttempts {
+		err = app.Models.RevokedTokens.Insert(claims.ID, user.ID, claims.ExpiresAt)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	app.audit(r, data.AuditLoginFailed, user.ID, nil, "mfa")
+	app.invalidCredentialsResponse(w, r)
+}
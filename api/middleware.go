@@ -13,7 +13,7 @@ import (
 	"github.com/e-inwork-com/go-user-service/internal/data"
 
 	"github.com/felixge/httpsnoop"
-	"github.com/golang-jwt/jwt"
+	"github.com/golang-jwt/jwt/v4"
 	"github.com/tomasen/realip"
 	"golang.org/x/time/rate"
 )
@@ -116,12 +116,30 @@ func (app *Application) enableCORS(next http.Handler) http.Handler {
 	})
 }
 
+// expvarInt returns the published variable of the name, or publishes a new one,
+// so the routes can be created more than once in the same process
+func expvarInt(name string) *expvar.Int {
+	if v, ok := expvar.Get(name).(*expvar.Int); ok {
+		return v
+	}
+
+	return expvar.NewInt(name)
+}
+
+func expvarMap(name string) *expvar.Map {
+	if v, ok := expvar.Get(name).(*expvar.Map); ok {
+		return v
+	}
+
+	return expvar.NewMap(name)
+}
+
 func (app *Application) metrics(next http.Handler) http.Handler {
-	totalRequestsReceived := expvar.NewInt("total_requests_received")
-	totalResponsesSent := expvar.NewInt("total_responses_sent")
-	totalProcessingTimeMicroseconds := expvar.NewInt("total_processing_time_μs")
+	totalRequestsReceived := expvarInt("total_requests_received")
+	totalResponsesSent := expvarInt("total_responses_sent")
+	totalProcessingTimeMicroseconds := expvarInt("total_processing_time_μs")
 
-	totalResponsesSentByStatus := expvar.NewMap("total_responses_sent_by_status")
+	totalResponsesSentByStatus := expvarMap("total_responses_sent_by_status")
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
@@ -158,12 +176,11 @@ func (app *Application) authenticate(next http.Handler) http.Handler {
 		tokenString := headerParts[1]
 		claims := &Claims{}
 
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte(app.Config.Auth.Secret), nil
-		})
+		// Verify the token with the key of the "kid" header
+		token, err := jwt.ParseWithClaims(tokenString, claims, app.Keys.Keyfunc)
 
 		if err != nil {
-			if err == jwt.ErrSignatureInvalid {
+			if errors.Is(err, jwt.ErrSignatureInvalid) {
 				app.invalidCredentialsResponse(w, r)
 				return
 			}
@@ -171,12 +188,24 @@ func (app *Application) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
-		if !token.Valid {
+		// Only an access token can authenticate a request
+		if !token.Valid || claims.Scope != "" {
 			app.invalidAuthenticationTokenResponse(w, r)
 			return
 		}
 
-		user, err := app.Models.Users.GetByID(claims.ID)
+		// Reject a token that has been logged out
+		revoked, err := app.Models.RevokedTokens.Exists(claims.RegisteredClaims.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if revoked {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		user, err := app.Models.Users.GetByID(r.Context(), claims.ID)
 		if err != nil {
 			switch {
 			case errors.Is(err, data.ErrRecordNotFound):
@@ -187,7 +216,22 @@ func (app *Application) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
+		// Reject a token issued before the user logged out everywhere,
+		// or before the password or the email was changed
+		if claims.IssuedAt == nil || claims.IssuedAt.Time.Before(user.TokensValidAfter) {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		// Load the permissions of the roles of the user
+		user.Permissions, err = app.Models.Permissions.GetAllForUser(user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
 		r = app.contextSetUser(r, user)
+		r = app.contextSetClaims(r, claims)
 
 		next.ServeHTTP(w, r)
 	})
@@ -208,3 +252,92 @@ func (app *Application) requireAuthenticated(next http.HandlerFunc) http.Handler
 		next.ServeHTTP(w, r)
 	})
 }
+
+// requireActivated Function to check if the authenticated user is activated
+func (app *Application) requireActivated(next http.HandlerFunc) http.HandlerFunc {
+	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		// If the user isn't activated then send an error
+		if !user.Activated {
+			app.inactiveAccountResponse(w, r)
+			return
+		}
+
+		// Run the next function
+		next.ServeHTTP(w, r)
+	})
+
+	return app.requireAuthenticated(fn)
+}
+
+// requirePermission Function to check if the activated user has the permission
+func (app *Application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		// If the user doesn't have the permission then send an error
+		if !user.Permissions.Include(code) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+
+		// Run the next function
+		next.ServeHTTP(w, r)
+	}
+
+	return app.requireActivated(fn)
+}
+
+// requireOwnerOrPermission Function to check if the user of the ID param
+// is the activated user, or if the activated user has the permission
+func (app *Application) requireOwnerOrPermission(code string, next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		id, err := app.readIDParam(r)
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		// If the user isn't the owner and doesn't have the permission then send an error
+		if id != user.ID && !user.Permissions.Include(code) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+
+		// Run the next function
+		next.ServeHTTP(w, r)
+	}
+
+	return app.requireActivated(fn)
+}
+
+// requireAuthenticatedOwnerOrPermission Function to check if the user of the ID param
+// is the authenticated user, who updates the own user before the activation too,
+// or if the activated user has the permission
+func (app *Application) requireAuthenticatedOwnerOrPermission(code string, next http.HandlerFunc) http.HandlerFunc {
+	permitted := app.requirePermission(code, next)
+
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		id, err := app.readIDParam(r)
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		// The owner only needs an authentication
+		if id == user.ID {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Run the next function if the activated user has the permission
+		permitted.ServeHTTP(w, r)
+	}
+
+	return app.requireAuthenticated(fn)
+}
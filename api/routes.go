@@ -3,7 +3,10 @@ package api
 import (
 	"expvar"
 	"net/http"
+	"strings"
 
+	"github.com/e-inwork-com/go-user-service/internal/data"
+	"github.com/google/uuid"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -14,12 +17,79 @@ func (app *Application) Routes() http.Handler {
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
 
 	router.HandlerFunc(http.MethodGet, "/service/users/health", app.healthcheckHandler)
+	router.HandlerFunc(http.MethodGet, "/service/users", app.requirePermission(data.PermissionUsersRead, app.listUsersHandler))
+	router.HandlerFunc(http.MethodGet, "/service/users/search", app.requirePermission(data.PermissionUsersRead, app.searchUsersHandler))
 	router.HandlerFunc(http.MethodPost, "/service/users", app.registerUserHandler)
+	router.HandlerFunc(http.MethodPut, "/service/users/activated", app.activateUserHandler)
+	router.HandlerFunc(http.MethodPost, "/service/users/activation", app.createActivationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/service/users/password-reset", app.createPasswordResetTokenHandler)
+	router.HandlerFunc(http.MethodPut, "/service/users/password", app.updateUserPasswordHandler)
+	router.HandlerFunc(http.MethodPut, "/service/users/email", app.confirmUserEmailHandler)
+	router.HandlerFunc(http.MethodPut, "/service/users/restored", app.restoreUserHandler)
 	router.HandlerFunc(http.MethodPost, "/service/users/authentication", app.createAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/service/users/authentication/refresh", app.refreshAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/service/users/authentication/mfa", app.createMFAAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/service/users/mfa/totp", app.requireActivated(app.createTOTPHandler))
+	router.HandlerFunc(http.MethodPost, "/service/users/mfa/totp/confirm", app.requireActivated(app.confirmTOTPHandler))
+	router.HandlerFunc(http.MethodPost, "/service/users/mfa/totp/disable", app.requireActivated(app.disableTOTPHandler))
+	router.HandlerFunc(http.MethodPost, "/service/users/webauthn/registration", app.requireActivated(app.createWebAuthnRegistrationHandler))
+	router.HandlerFunc(http.MethodPost, "/service/users/webauthn/registration/finish", app.requireActivated(app.finishWebAuthnRegistrationHandler))
+	router.HandlerFunc(http.MethodGet, "/service/users/webauthn/credentials", app.requireActivated(app.listWebAuthnCredentialsHandler))
+	router.HandlerFunc(http.MethodDelete, "/service/users/webauthn/credentials/:id", app.requireActivated(app.deleteWebAuthnCredentialHandler))
+	router.HandlerFunc(http.MethodPost, "/service/users/webauthn/authentication", app.createWebAuthnLoginHandler)
+	router.HandlerFunc(http.MethodPost, "/service/users/webauthn/authentication/finish", app.finishWebAuthnLoginHandler)
+	router.HandlerFunc(http.MethodPost, "/service/users/logout", app.requireAuthenticated(app.logoutHandler))
+	router.HandlerFunc(http.MethodPost, "/service/users/logout/all", app.requireAuthenticated(app.logoutAllHandler))
 	router.HandlerFunc(http.MethodGet, "/service/users/me", app.requireAuthenticated(app.getUserHandler))
-	router.HandlerFunc(http.MethodPatch, "/service/users/:id", app.requireAuthenticated(app.patchUserHandler))
+	router.HandlerFunc(http.MethodGet, "/service/users/me/audit-events", app.requireAuthenticated(app.listOwnAuditEventsHandler))
+	router.HandlerFunc(http.MethodGet, "/service/users/me/export", app.requireAuthenticated(app.createExportHandler))
+	router.HandlerFunc(http.MethodGet, "/service/users/me/exports/:id", app.requireAuthenticated(app.getExportHandler))
+	router.HandlerFunc(http.MethodGet, "/service/users/me/exports/:id/download", app.downloadExportHandler)
+	router.HandlerFunc(http.MethodGet, "/service/users/webhooks", app.requirePermission(data.PermissionUsersAdmin, app.listWebhooksHandler))
+	router.HandlerFunc(http.MethodPost, "/service/users/webhooks", app.requirePermission(data.PermissionUsersAdmin, app.createWebhookHandler))
+	router.HandlerFunc(http.MethodGet, "/service/users/webhooks/:id", app.requirePermission(data.PermissionUsersAdmin, app.getWebhookHandler))
+	router.HandlerFunc(http.MethodPatch, "/service/users/webhooks/:id", app.requirePermission(data.PermissionUsersAdmin, app.updateWebhookHandler))
+	router.HandlerFunc(http.MethodDelete, "/service/users/webhooks/:id", app.requirePermission(data.PermissionUsersAdmin, app.deleteWebhookHandler))
+	router.HandlerFunc(http.MethodGet, "/service/users/webhooks/:id/deliveries", app.requirePermission(data.PermissionUsersAdmin, app.listWebhookDeliveriesHandler))
+	router.HandlerFunc(http.MethodPost, "/service/users/webhooks/:id/deliveries/:delivery_id/replay", app.requirePermission(data.PermissionUsersAdmin, app.replayWebhookDeliveryHandler))
 
 	router.Handler(http.MethodGet, "/service/users/debug/vars", expvar.Handler())
 
-	return app.metrics(app.recoverPanic(app.enableCORS(app.rateLimit(app.authenticate(router)))))
+	router.HandlerFunc(http.MethodGet, "/.well-known/jwks.json", app.jwksHandler)
+
+	// The routes of a user ID have their own router, httprouter
+	// doesn't allow a wildcard next to the static routes of a method
+	idRouter := httprouter.New()
+
+	idRouter.NotFound = http.HandlerFunc(app.notFoundResponse)
+	idRouter.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
+
+	idRouter.HandlerFunc(http.MethodGet, "/service/users/:id", app.requireOwnerOrPermission(data.PermissionUsersRead, app.getUserByIDHandler))
+	idRouter.HandlerFunc(http.MethodPatch, "/service/users/:id", app.requireAuthenticatedOwnerOrPermission(data.PermissionUsersWrite, app.patchUserHandler))
+	idRouter.HandlerFunc(http.MethodDelete, "/service/users/:id", app.requireOwnerOrPermission(data.PermissionUsersAdmin, app.deleteUserHandler))
+	idRouter.HandlerFunc(http.MethodPut, "/service/users/:id/restored", app.requirePermission(data.PermissionUsersAdmin, app.restoreUserByIDHandler))
+	idRouter.HandlerFunc(http.MethodPut, "/service/users/:id/deactivated", app.requirePermission(data.PermissionUsersAdmin, app.deactivateUserHandler))
+	idRouter.HandlerFunc(http.MethodDelete, "/service/users/:id/lockout", app.requirePermission(data.PermissionUsersAdmin, app.unlockUserHandler))
+	idRouter.HandlerFunc(http.MethodGet, "/service/users/:id/audit-events", app.requirePermission(data.PermissionUsersAdmin, app.listUserAuditEventsHandler))
+
+	return app.metrics(app.recoverPanic(app.enableCORS(app.rateLimit(app.authenticate(routeUserID(idRouter, router))))))
+}
+
+// routeUserID Function to send the requests of "/service/users/<uuid>"
+// to the router of the user IDs, and the other requests to the router
+func routeUserID(idRouter http.Handler, router http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rest := strings.TrimPrefix(r.URL.Path, "/service/users/")
+
+		if rest != r.URL.Path {
+			segment := strings.SplitN(rest, "/", 2)[0]
+
+			if _, err := uuid.Parse(segment); err == nil {
+				idRouter.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		router.ServeHTTP(w, r)
+	})
 }
@@ -1,11 +1,29 @@
 package api
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/e-inwork-com/go-user-service/internal/data"
+	"github.com/e-inwork-com/go-user-service/internal/data/memory"
 	"github.com/e-inwork-com/go-user-service/internal/data/mocks"
+	"github.com/e-inwork-com/go-user-service/internal/jsonlog"
+	"github.com/e-inwork-com/go-user-service/internal/lockout"
+	"github.com/e-inwork-com/go-user-service/internal/mailer"
+	"github.com/e-inwork-com/go-user-service/internal/webauthn"
+	"github.com/e-inwork-com/go-user-service/internal/webauthn/virtual"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -21,6 +39,22 @@ func TestRoutes(t *testing.T) {
 	firstToken := app.testFirstToken(t)
 	tBodyUpdateUserForbidden := app.testBodyUpdateUserFobidden(t)
 	secondToken := app.testSecondToken(t)
+	revokedToken := app.testRevokedToken(t)
+	tBodyActivateUser := app.testBodyToken(t, mocks.MockActivationToken())
+	tBodyActivateUserInvalid := app.testBodyToken(t, "INVALIDACTIVATIONTOKENAAAA")
+	tBodyResendActivation := app.testBodyEmail(t, "unknown@doe.com")
+	tBodyPasswordReset := app.testBodyEmail(t, "jon@doe.com")
+	tBodyPasswordResetUnknown := app.testBodyEmail(t, "unknown@doe.com")
+	tBodyResetPassword := app.testBodyResetPassword(t, mocks.MockPasswordResetToken())
+	tBodyResetPasswordInvalid := app.testBodyResetPassword(t, mocks.MockActivationToken())
+	tBodyUpdateUserEmail := app.testBodyUpdateUserEmail(t, "pa55word")
+	tBodyUpdateUserEmailWrongPassword := app.testBodyUpdateUserEmail(t, "wrongpassword")
+	tBodyUpdateUserEmailNoPassword := app.testBodyUpdateUserEmail(t, "")
+	tBodyConfirmEmail := app.testBodyToken(t, mocks.MockEmailChangeToken())
+	tBodyRestoreUser := app.testBodyToken(t, mocks.MockRestoreToken())
+	tBodyRestoreUserInvalid := app.testBodyToken(t, mocks.MockActivationToken())
+	tBodyRefreshToken := app.testBodyRefreshToken(t, mocks.MockRefreshToken())
+	tBodyReusedRefreshToken := app.testBodyRefreshToken(t, mocks.MockUsedRefreshToken())
 
 	tests := []struct {
 		name         string
@@ -40,6 +74,87 @@ func TestRoutes(t *testing.T) {
 			body:         tBodyCreateUser,
 			expectedCode: http.StatusCreated,
 		},
+		{
+			name:         "Activate User",
+			method:       "PUT",
+			urlPath:      "/service/users/activated",
+			contentType:  "application/json",
+			token:        "",
+			body:         tBodyActivateUser,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Activate User Invalid Token",
+			method:       "PUT",
+			urlPath:      "/service/users/activated",
+			contentType:  "application/json",
+			token:        "",
+			body:         tBodyActivateUserInvalid,
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "Restore User",
+			method:       "PUT",
+			urlPath:      "/service/users/restored",
+			contentType:  "application/json",
+			token:        "",
+			body:         tBodyRestoreUser,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Restore User Invalid Token",
+			method:       "PUT",
+			urlPath:      "/service/users/restored",
+			contentType:  "application/json",
+			token:        "",
+			body:         tBodyRestoreUserInvalid,
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "Resend Activation",
+			method:       "POST",
+			urlPath:      "/service/users/activation",
+			contentType:  "application/json",
+			token:        "",
+			body:         tBodyResendActivation,
+			expectedCode: http.StatusAccepted,
+		},
+		{
+			name:         "Request Password Reset",
+			method:       "POST",
+			urlPath:      "/service/users/password-reset",
+			contentType:  "application/json",
+			token:        "",
+			body:         tBodyPasswordReset,
+			expectedCode: http.StatusAccepted,
+		},
+		{
+			name:         "Request Password Reset Unknown Email",
+			method:       "POST",
+			urlPath:      "/service/users/password-reset",
+			contentType:  "application/json",
+			token:        "",
+			body:         tBodyPasswordResetUnknown,
+			expectedCode: http.StatusAccepted,
+		},
+		{
+			name:         "Reset Password",
+			method:       "PUT",
+			urlPath:      "/service/users/password",
+			contentType:  "application/json",
+			token:        "",
+			body:         tBodyResetPassword,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Reset Password Invalid Token",
+			method:       "PUT",
+			urlPath:      "/service/users/password",
+			contentType:  "application/json",
+			token:        "",
+			body:         tBodyResetPasswordInvalid,
+			expectedCode: http.StatusUnprocessableEntity,
+		},
 		{
 			name:         "Login User",
 			method:       "POST",
@@ -49,6 +164,24 @@ func TestRoutes(t *testing.T) {
 			body:         tBodyLoginUser,
 			expectedCode: http.StatusOK,
 		},
+		{
+			name:         "Refresh Token",
+			method:       "POST",
+			urlPath:      "/service/users/authentication/refresh",
+			contentType:  "application/json",
+			token:        "",
+			body:         tBodyRefreshToken,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Refresh Token Reused",
+			method:       "POST",
+			urlPath:      "/service/users/authentication/refresh",
+			contentType:  "application/json",
+			token:        "",
+			body:         tBodyReusedRefreshToken,
+			expectedCode: http.StatusUnauthorized,
+		},
 		{
 			name:         "Update User",
 			method:       "PATCH",
@@ -58,6 +191,42 @@ func TestRoutes(t *testing.T) {
 			body:         tBodyUpdateUser,
 			expectedCode: http.StatusOK,
 		},
+		{
+			name:         "Update User Email",
+			method:       "PATCH",
+			urlPath:      "/service/users/" + mocks.MockFirstUUID().String(),
+			contentType:  "application/json",
+			token:        firstToken,
+			body:         tBodyUpdateUserEmail,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Update User Email Wrong Password",
+			method:       "PATCH",
+			urlPath:      "/service/users/" + mocks.MockFirstUUID().String(),
+			contentType:  "application/json",
+			token:        firstToken,
+			body:         tBodyUpdateUserEmailWrongPassword,
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "Update User Email Without Password",
+			method:       "PATCH",
+			urlPath:      "/service/users/" + mocks.MockFirstUUID().String(),
+			contentType:  "application/json",
+			token:        firstToken,
+			body:         tBodyUpdateUserEmailNoPassword,
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "Confirm Email",
+			method:       "PUT",
+			urlPath:      "/service/users/email",
+			contentType:  "application/json",
+			token:        "",
+			body:         tBodyConfirmEmail,
+			expectedCode: http.StatusOK,
+		},
 		{
 			name:         "Update User Forbidden",
 			method:       "PATCH",
@@ -67,6 +236,42 @@ func TestRoutes(t *testing.T) {
 			body:         tBodyUpdateUserForbidden,
 			expectedCode: http.StatusForbidden,
 		},
+		{
+			name:         "Get User with Revoked Token",
+			method:       "GET",
+			urlPath:      "/service/users/me",
+			contentType:  "",
+			token:        revokedToken,
+			body:         nil,
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "JSON Web Key Set",
+			method:       "GET",
+			urlPath:      "/.well-known/jwks.json",
+			contentType:  "",
+			token:        "",
+			body:         nil,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Logout",
+			method:       "POST",
+			urlPath:      "/service/users/logout",
+			contentType:  "",
+			token:        firstToken,
+			body:         nil,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Logout All",
+			method:       "POST",
+			urlPath:      "/service/users/logout/all",
+			contentType:  "",
+			token:        firstToken,
+			body:         nil,
+			expectedCode: http.StatusOK,
+		},
 	}
 
 	for _, tt := range tests {
@@ -76,3 +281,1377 @@ func TestRoutes(t *testing.T) {
 		})
 	}
 }
+
+func TestMFA(t *testing.T) {
+	app := testApplication(t)
+
+	ts := testServer(t, app.Routes())
+	defer ts.Close()
+
+	firstToken := app.testFirstToken(t)
+	secondToken := app.testSecondToken(t)
+
+	// The second mock user has enabled TOTP
+	var login struct {
+		Token       string `json:"token"`
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+	}
+
+	code, _, body := ts.request(t, "POST", "/service/users/authentication", "application/json", "", app.testBodyLoginSecondUser(t))
+	assert.Equal(t, http.StatusOK, code)
+	assert.Nil(t, json.Unmarshal([]byte(body), &login))
+	assert.True(t, login.MFARequired)
+	assert.Empty(t, login.Token)
+
+	tests := []struct {
+		name         string
+		method       string
+		urlPath      string
+		token        string
+		body         io.Reader
+		expectedCode int
+	}{
+		{
+			name:         "MFA Token Can't Authenticate",
+			method:       "GET",
+			urlPath:      "/service/users/me",
+			token:        login.MFAToken,
+			body:         nil,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "Login with Invalid Code",
+			method:       "POST",
+			urlPath:      "/service/users/authentication/mfa",
+			body:         app.testBodyMFA(t, login.MFAToken, "000000", ""),
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "Login with Code",
+			method:       "POST",
+			urlPath:      "/service/users/authentication/mfa",
+			body:         app.testBodyMFA(t, login.MFAToken, app.testTOTPCode(t), ""),
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Login with Recovery Code",
+			method:       "POST",
+			urlPath:      "/service/users/authentication/mfa",
+			body:         app.testBodyMFA(t, login.MFAToken, "", mocks.MockRecoveryCode()),
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Login with Access Token",
+			method:       "POST",
+			urlPath:      "/service/users/authentication/mfa",
+			body:         app.testBodyMFA(t, secondToken, app.testTOTPCode(t), ""),
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "Enroll TOTP",
+			method:       "POST",
+			urlPath:      "/service/users/mfa/totp",
+			token:        firstToken,
+			body:         nil,
+			expectedCode: http.StatusCreated,
+		},
+		{
+			name:         "Enroll TOTP Already Enabled",
+			method:       "POST",
+			urlPath:      "/service/users/mfa/totp",
+			token:        secondToken,
+			body:         nil,
+			expectedCode: http.StatusConflict,
+		},
+		{
+			name:         "Confirm TOTP Invalid Code",
+			method:       "POST",
+			urlPath:      "/service/users/mfa/totp/confirm",
+			token:        firstToken,
+			body:         app.testBodyCode(t, "000000"),
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actualCode, _, _ := ts.request(t, tt.method, tt.urlPath, "application/json", tt.token, tt.body)
+			assert.Equal(t, tt.expectedCode, actualCode)
+		})
+	}
+
+	t.Run("Confirm TOTP with Code", func(t *testing.T) {
+		var confirm struct {
+			RecoveryCodes []string `json:"recovery_codes"`
+		}
+
+		body := app.testBodyCode(t, app.testTOTPCode(t))
+
+		code, _, response := ts.request(t, "POST", "/service/users/mfa/totp/confirm", "application/json", firstToken, body)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Nil(t, json.Unmarshal([]byte(response), &confirm))
+		assert.Len(t, confirm.RecoveryCodes, 10)
+	})
+
+	t.Run("MFA Token Isn't Signed with the Signing Keys", func(t *testing.T) {
+		// The services that verify the access tokens with the JWKS reject it
+		_, err := jwt.ParseWithClaims(login.MFAToken, &Claims{}, app.Keys.Keyfunc)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Login with MFA Token before Logout All", func(t *testing.T) {
+		code, _, body := ts.request(t, "POST", "/service/users/authentication", "application/json", "", app.testBodyLoginSecondUser(t))
+		assert.Equal(t, http.StatusOK, code)
+		assert.Nil(t, json.Unmarshal([]byte(body), &login))
+
+		users := app.Models.Users
+		app.Models.Users = loggedOutUsers{validAfter: time.Now().Add(time.Minute)}
+		defer func() { app.Models.Users = users }()
+
+		code, _, _ = ts.request(t, "POST", "/service/users/authentication/mfa", "application/json", "", app.testBodyMFA(t, login.MFAToken, app.testTOTPCode(t), ""))
+		assert.Equal(t, http.StatusUnauthorized, code)
+	})
+}
+
+// loggedOutUsers are the mock users logged out everywhere at validAfter
+type loggedOutUsers struct {
+	mocks.UserModel
+	validAfter time.Time
+}
+
+func (m loggedOutUsers) GetByID(ctx context.Context, id uuid.UUID) (*data.User, error) {
+	user, err := m.UserModel.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	user.TokensValidAfter = m.validAfter
+
+	return user, nil
+}
+
+func TestWebAuthn(t *testing.T) {
+	app := testApplication(t)
+
+	ts := testServer(t, app.Routes())
+	defer ts.Close()
+
+	firstToken := app.testFirstToken(t)
+
+	t.Run("Register Passkey", func(t *testing.T) {
+		var options webauthn.CreationOptions
+		sessionToken := app.testWebAuthnOptions(t, ts, "/service/users/webauthn/registration", firstToken, nil, &options)
+		assert.Len(t, options.ExcludeCredentials, 1)
+
+		authenticator, err := virtual.New("localhost", "https://localhost")
+		assert.Nil(t, err)
+
+		credential, err := authenticator.Register(options)
+		assert.Nil(t, err)
+
+		code, _, _ := ts.request(t, "POST", "/service/users/webauthn/registration/finish", "application/json", firstToken, app.testBodyWebAuthn(t, sessionToken, credential))
+		assert.Equal(t, http.StatusCreated, code)
+
+		// The challenge is bound to the user of the session token
+		code, _, _ = ts.request(t, "POST", "/service/users/webauthn/registration/finish", "application/json", app.testSecondToken(t), app.testBodyWebAuthn(t, sessionToken, credential))
+		assert.Equal(t, http.StatusUnprocessableEntity, code)
+	})
+
+	t.Run("Register Passkey Twice", func(t *testing.T) {
+		var options webauthn.CreationOptions
+		sessionToken := app.testWebAuthnOptions(t, ts, "/service/users/webauthn/registration", firstToken, nil, &options)
+
+		credential, err := mocks.MockWebAuthnAuthenticator().Register(options)
+		assert.Nil(t, err)
+
+		code, _, _ := ts.request(t, "POST", "/service/users/webauthn/registration/finish", "application/json", firstToken, app.testBodyWebAuthn(t, sessionToken, credential))
+		assert.Equal(t, http.StatusUnprocessableEntity, code)
+	})
+
+	t.Run("Login with Passkey", func(t *testing.T) {
+		var login struct {
+			Token        string `json:"token"`
+			RefreshToken string `json:"refresh_token"`
+		}
+
+		var options webauthn.RequestOptions
+		sessionToken := app.testWebAuthnOptions(t, ts, "/service/users/webauthn/authentication", "", app.testBodyEmail(t, "jon@doe.com"), &options)
+		assert.Len(t, options.AllowCredentials, 1)
+
+		assertion, err := mocks.MockWebAuthnAuthenticator().Assert(options)
+		assert.Nil(t, err)
+
+		code, _, body := ts.request(t, "POST", "/service/users/webauthn/authentication/finish", "application/json", "", app.testBodyWebAuthn(t, sessionToken, assertion))
+		assert.Equal(t, http.StatusOK, code)
+		assert.Nil(t, json.Unmarshal([]byte(body), &login))
+		assert.NotEmpty(t, login.RefreshToken)
+
+		code, _, _ = ts.request(t, "GET", "/service/users/me", "", login.Token, nil)
+		assert.Equal(t, http.StatusOK, code)
+	})
+
+	t.Run("Login Session Doesn't Disclose the User", func(t *testing.T) {
+		for _, email := range []string{"jon@doe.com", "unknown@doe.com"} {
+			var options webauthn.RequestOptions
+			sessionToken := app.testWebAuthnOptions(t, ts, "/service/users/webauthn/authentication", "", app.testBodyEmail(t, email), &options)
+
+			// The session token is opaque, it isn't a token signed with the access key
+			_, err := jwt.ParseWithClaims(sessionToken, &Claims{}, app.Keys.Keyfunc)
+			assert.NotNil(t, err)
+
+			ciphertext, err := base64.RawURLEncoding.DecodeString(sessionToken)
+			assert.Nil(t, err)
+			assert.NotContains(t, string(ciphertext), mocks.MockFirstUUID().String())
+			assert.NotContains(t, string(ciphertext), uuid.Nil.String())
+		}
+	})
+
+	t.Run("Login with Discoverable Passkey", func(t *testing.T) {
+		var options webauthn.RequestOptions
+		sessionToken := app.testWebAuthnOptions(t, ts, "/service/users/webauthn/authentication", "", bytes.NewReader([]byte(`{}`)), &options)
+		assert.Empty(t, options.AllowCredentials)
+
+		assertion, err := mocks.MockWebAuthnAuthenticator().Assert(options)
+		assert.Nil(t, err)
+
+		code, _, _ := ts.request(t, "POST", "/service/users/webauthn/authentication/finish", "application/json", "", app.testBodyWebAuthn(t, sessionToken, assertion))
+		assert.Equal(t, http.StatusOK, code)
+	})
+
+	t.Run("Login with Passkey of Another User", func(t *testing.T) {
+		var options webauthn.RequestOptions
+		sessionToken := app.testWebAuthnOptions(t, ts, "/service/users/webauthn/authentication", "", app.testBodyEmail(t, "nina@doe.com"), &options)
+		assert.Empty(t, options.AllowCredentials)
+
+		assertion, err := mocks.MockWebAuthnAuthenticator().Assert(options)
+		assert.Nil(t, err)
+
+		code, _, _ := ts.request(t, "POST", "/service/users/webauthn/authentication/finish", "application/json", "", app.testBodyWebAuthn(t, sessionToken, assertion))
+		assert.Equal(t, http.StatusUnauthorized, code)
+	})
+
+	t.Run("Login with Cloned Passkey", func(t *testing.T) {
+		var options webauthn.RequestOptions
+		sessionToken := app.testWebAuthnOptions(t, ts, "/service/users/webauthn/authentication", "", bytes.NewReader([]byte(`{}`)), &options)
+
+		authenticator := mocks.MockWebAuthnAuthenticator()
+		authenticator.SignCount = 1
+
+		assertion, err := authenticator.Assert(options)
+		assert.Nil(t, err)
+
+		code, _, _ := ts.request(t, "POST", "/service/users/webauthn/authentication/finish", "application/json", "", app.testBodyWebAuthn(t, sessionToken, assertion))
+		assert.Equal(t, http.StatusUnauthorized, code)
+	})
+
+	t.Run("Login with Unknown Passkey", func(t *testing.T) {
+		var options webauthn.RequestOptions
+		sessionToken := app.testWebAuthnOptions(t, ts, "/service/users/webauthn/authentication", "", bytes.NewReader([]byte(`{}`)), &options)
+
+		authenticator, err := virtual.New("localhost", "https://localhost")
+		assert.Nil(t, err)
+
+		assertion, err := authenticator.Assert(options)
+		assert.Nil(t, err)
+
+		code, _, _ := ts.request(t, "POST", "/service/users/webauthn/authentication/finish", "application/json", "", app.testBodyWebAuthn(t, sessionToken, assertion))
+		assert.Equal(t, http.StatusUnauthorized, code)
+	})
+
+	t.Run("Login with Another Challenge", func(t *testing.T) {
+		var options webauthn.RequestOptions
+		sessionToken := app.testWebAuthnOptions(t, ts, "/service/users/webauthn/authentication", "", bytes.NewReader([]byte(`{}`)), &options)
+
+		options.Challenge = "bm90IHRoZSBjaGFsbGVuZ2U"
+
+		assertion, err := mocks.MockWebAuthnAuthenticator().Assert(options)
+		assert.Nil(t, err)
+
+		code, _, _ := ts.request(t, "POST", "/service/users/webauthn/authentication/finish", "application/json", "", app.testBodyWebAuthn(t, sessionToken, assertion))
+		assert.Equal(t, http.StatusUnauthorized, code)
+	})
+
+	tests := []struct {
+		name         string
+		method       string
+		urlPath      string
+		token        string
+		expectedCode int
+	}{
+		{
+			name:         "List Passkeys",
+			method:       "GET",
+			urlPath:      "/service/users/webauthn/credentials",
+			token:        firstToken,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "List Passkeys Unauthenticated",
+			method:       "GET",
+			urlPath:      "/service/users/webauthn/credentials",
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "Delete Passkey",
+			method:       "DELETE",
+			urlPath:      "/service/users/webauthn/credentials/" + webauthn.EncodeID(mocks.MockWebAuthnCredentialID()),
+			token:        firstToken,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Delete Passkey of Another User",
+			method:       "DELETE",
+			urlPath:      "/service/users/webauthn/credentials/" + webauthn.EncodeID(mocks.MockWebAuthnCredentialID()),
+			token:        app.testSecondToken(t),
+			expectedCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actualCode, _, _ := ts.request(t, tt.method, tt.urlPath, "", tt.token, nil)
+			assert.Equal(t, tt.expectedCode, actualCode)
+		})
+	}
+}
+
+func TestLockout(t *testing.T) {
+	app := testApplication(t)
+
+	ts := testServer(t, app.Routes())
+	defer ts.Close()
+
+	// The mock application locks an account after 3 failed logins
+	tests := []struct {
+		name         string
+		email        string
+		password     string
+		expectedCode int
+	}{
+		{"First Failed Login", "jon@doe.com", "wrongpa55", http.StatusUnauthorized},
+		{"Second Failed Login", "jon@doe.com", "wrongpa55", http.StatusUnauthorized},
+		{"Third Failed Login", "jon@doe.com", "wrongpa55", http.StatusUnauthorized},
+		{"Login of Locked Account", "jon@doe.com", "pa55word", http.StatusTooManyRequests},
+		{"Login of Another Account", "nina@doe.com", "pa55word", http.StatusOK},
+		{"First Failed Login of Unknown Email", "lee@doe.com", "wrongpa55", http.StatusUnauthorized},
+		{"Second Failed Login of Unknown Email", "lee@doe.com", "wrongpa55", http.StatusUnauthorized},
+		{"Third Failed Login of Unknown Email", "lee@doe.com", "wrongpa55", http.StatusUnauthorized},
+		{"Login of Locked Unknown Email", "lee@doe.com", "wrongpa55", http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, header, _ := ts.request(t, "POST", "/service/users/authentication", "application/json", "", app.testBodyLogin(t, tt.email, tt.password))
+			assert.Equal(t, tt.expectedCode, code)
+
+			if code == http.StatusTooManyRequests {
+				assert.Equal(t, "60", header.Get("Retry-After"))
+			}
+		})
+	}
+
+	t.Run("Login of Unlocked Account", func(t *testing.T) {
+		assert.Nil(t, app.Lockout.Reset("jon@doe.com"))
+
+		code, _, _ := ts.request(t, "POST", "/service/users/authentication", "application/json", "", app.testBodyLogin(t, "jon@doe.com", "pa55word"))
+		assert.Equal(t, http.StatusOK, code)
+	})
+
+	t.Run("Parallel Failed Logins", func(t *testing.T) {
+		codes := make(chan int, 10)
+
+		for i := 0; i < cap(codes); i++ {
+			go func() {
+				rs, err := ts.Client().Post(ts.URL+"/service/users/authentication", "application/json", app.testBodyLogin(t, "kim@doe.com", "wrongpa55"))
+				if err != nil {
+					codes <- 0
+					return
+				}
+				rs.Body.Close()
+
+				codes <- rs.StatusCode
+			}()
+		}
+
+		// Only the threshold of the guesses are checked, whatever their order
+		counts := map[int]int{}
+		for i := 0; i < cap(codes); i++ {
+			counts[<-codes]++
+		}
+
+		assert.Equal(t, 3, counts[http.StatusUnauthorized])
+		assert.Equal(t, 7, counts[http.StatusTooManyRequests])
+	})
+}
+
+func TestMFALockout(t *testing.T) {
+	mfaLogin := func(t *testing.T, app *Application, ts *httpTestServer) string {
+		var login struct {
+			MFAToken string `json:"mfa_token"`
+		}
+
+		code, _, body := ts.request(t, "POST", "/service/users/authentication", "application/json", "", app.testBodyLoginSecondUser(t))
+		assert.Equal(t, http.StatusOK, code)
+		assert.Nil(t, json.Unmarshal([]byte(body), &login))
+		assert.NotEmpty(t, login.MFAToken)
+
+		return login.MFAToken
+	}
+
+	t.Run("MFA Token Revoked after Wrong Codes", func(t *testing.T) {
+		app := testApplication(t)
+		app.Models.RevokedTokens = memory.New().Models().RevokedTokens
+		app.Lockout = lockout.New(lockout.NewMemory(), lockout.Policy{Threshold: 10, Duration: time.Minute})
+
+		ts := testServer(t, app.Routes())
+		defer ts.Close()
+
+		mfaToken := mfaLogin(t, app, ts)
+
+		for i := 0; i < mfaMaxAttempts; i++ {
+			code, _, _ := ts.request(t, "POST", "/service/users/authentication/mfa", "application/json", "", app.testBodyMFA(t, mfaToken, "000000", ""))
+			assert.Equal(t, http.StatusUnauthorized, code)
+		}
+
+		code, _, _ := ts.request(t, "POST", "/service/users/authentication/mfa", "application/json", "", app.testBodyMFA(t, mfaToken, app.testTOTPCode(t), ""))
+		assert.Equal(t, http.StatusUnauthorized, code)
+
+		// A new login gives a new "mfa" token
+		code, _, _ = ts.request(t, "POST", "/service/users/authentication/mfa", "application/json", "", app.testBodyMFA(t, mfaLogin(t, app, ts), app.testTOTPCode(t), ""))
+		assert.Equal(t, http.StatusOK, code)
+	})
+
+	t.Run("Account Locked by Wrong Passwords and Codes", func(t *testing.T) {
+		app := testApplication(t)
+
+		ts := testServer(t, app.Routes())
+		defer ts.Close()
+
+		// The mock application locks an account after 3 failed logins
+		for i := 0; i < 2; i++ {
+			code, _, _ := ts.request(t, "POST", "/service/users/authentication", "application/json", "", app.testBodyLogin(t, "nina@doe.com", "wrongpa55"))
+			assert.Equal(t, http.StatusUnauthorized, code)
+		}
+
+		// The right password doesn't forget the failures before the second factor
+		mfaToken := mfaLogin(t, app, ts)
+
+		code, _, _ := ts.request(t, "POST", "/service/users/authentication/mfa", "application/json", "", app.testBodyMFA(t, mfaToken, "000000", ""))
+		assert.Equal(t, http.StatusUnauthorized, code)
+
+		code, header, _ := ts.request(t, "POST", "/service/users/authentication/mfa", "application/json", "", app.testBodyMFA(t, mfaToken, app.testTOTPCode(t), ""))
+		assert.Equal(t, http.StatusTooManyRequests, code)
+		assert.Equal(t, "60", header.Get("Retry-After"))
+	})
+}
+
+func TestPasswordConfirmationLockout(t *testing.T) {
+	app := testApplication(t)
+
+	ts := testServer(t, app.Routes())
+	defer ts.Close()
+
+	urlPath := "/service/users/" + mocks.MockFirstUUID().String()
+
+	// The mock application locks an account after 3 wrong passwords
+	for i := 0; i < 2; i++ {
+		code, _, _ := ts.request(t, "PATCH", urlPath, "application/json", app.testFirstToken(t), app.testBodyUpdateUserEmail(t, "wrongpa55"))
+		assert.Equal(t, http.StatusUnprocessableEntity, code)
+	}
+
+	code, _, _ := ts.request(t, "DELETE", urlPath, "application/json", app.testFirstToken(t), strings.NewReader(`{"password": "wrongpa55"}`))
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+
+	// The confirmations and the logins are locked out together
+	code, header, _ := ts.request(t, "PATCH", urlPath, "application/json", app.testFirstToken(t), app.testBodyUpdateUserEmail(t, "pa55word"))
+	assert.Equal(t, http.StatusTooManyRequests, code)
+	assert.Equal(t, "60", header.Get("Retry-After"))
+
+	code, _, _ = ts.request(t, "DELETE", urlPath, "application/json", app.testFirstToken(t), strings.NewReader(`{"password": "pa55word"}`))
+	assert.Equal(t, http.StatusTooManyRequests, code)
+
+	code, _, _ = ts.request(t, "POST", "/service/users/authentication", "application/json", "", app.testBodyLoginUser(t))
+	assert.Equal(t, http.StatusTooManyRequests, code)
+
+	// The right password gives back its attempt
+	assert.Nil(t, app.Lockout.Reset("jon@doe.com"))
+
+	code, _, _ = ts.request(t, "PATCH", urlPath, "application/json", app.testFirstToken(t), app.testBodyUpdateUserEmail(t, "pa55word"))
+	assert.Equal(t, http.StatusOK, code)
+
+	failures, err := app.Lockout.Failures("jon@doe.com")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, failures)
+}
+
+func TestOpenLockout(t *testing.T) {
+	var cfg Config
+	cfg.Store = "memory"
+
+	// The failures are kept in memory with the memory store of the service
+	limiter, err := OpenLockout(cfg, nil)
+	assert.Nil(t, err)
+	assert.NotNil(t, limiter)
+
+	// The database store can't be used without a database
+	cfg.Lockout.Store = "database"
+
+	_, err = OpenLockout(cfg, nil)
+	assert.NotNil(t, err)
+
+	cfg.Lockout.Store = "redis"
+
+	_, err = OpenLockout(cfg, nil)
+	assert.NotNil(t, err)
+}
+
+func TestOpenCipher(t *testing.T) {
+	var cfg Config
+	cfg.Auth.Secret = "secret"
+
+	// The key isn't derived from the signing secret
+	_, err := OpenCipher(cfg, CipherTOTP)
+	assert.NotNil(t, err)
+
+	cfg.Mfa.EncryptionKey = base64.StdEncoding.EncodeToString(mocks.MockEncryptionKey())
+
+	totp, err := OpenCipher(cfg, CipherTOTP)
+	assert.Nil(t, err)
+
+	webhooks, err := OpenCipher(cfg, CipherWebhooks)
+	assert.Nil(t, err)
+
+	// The secrets of the webhooks have their own key
+	ciphertext, err := webhooks.Encrypt([]byte("secret"))
+	assert.Nil(t, err)
+
+	_, err = totp.Decrypt(ciphertext)
+	assert.NotNil(t, err)
+}
+
+func TestPermissions(t *testing.T) {
+	app := testApplication(t)
+
+	ts := testServer(t, app.Routes())
+	defer ts.Close()
+
+	firstToken := app.testFirstToken(t)
+	adminToken := app.testAdminToken(t)
+
+	firstUser := "/service/users/" + mocks.MockFirstUUID().String()
+	secondUser := "/service/users/" + mocks.MockSecondUUID().String()
+
+	tests := []struct {
+		name         string
+		method       string
+		urlPath      string
+		token        string
+		body         io.Reader
+		expectedCode int
+	}{
+		{
+			name:         "Get Own User",
+			method:       "GET",
+			urlPath:      firstUser,
+			token:        firstToken,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Get Another User",
+			method:       "GET",
+			urlPath:      secondUser,
+			token:        firstToken,
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "Get Another User as Admin",
+			method:       "GET",
+			urlPath:      secondUser,
+			token:        adminToken,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Get Unknown User as Admin",
+			method:       "GET",
+			urlPath:      "/service/users/" + uuid.NewString(),
+			token:        adminToken,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "Patch Another User as Admin",
+			method:       "PATCH",
+			urlPath:      secondUser,
+			token:        adminToken,
+			body:         app.testBodyUpdateUserFobidden(t),
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Deactivate Another User",
+			method:       "PUT",
+			urlPath:      secondUser + "/deactivated",
+			token:        firstToken,
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "Deactivate Another User as Admin",
+			method:       "PUT",
+			urlPath:      secondUser + "/deactivated",
+			token:        adminToken,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Unlock Another User as Admin",
+			method:       "DELETE",
+			urlPath:      secondUser + "/lockout",
+			token:        adminToken,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Delete Own User without Password",
+			method:       "DELETE",
+			urlPath:      firstUser,
+			token:        firstToken,
+			body:         strings.NewReader(`{}`),
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "Delete Own User with Wrong Password",
+			method:       "DELETE",
+			urlPath:      firstUser,
+			token:        firstToken,
+			body:         strings.NewReader(`{"password": "wrongpassword"}`),
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "Delete Own User",
+			method:       "DELETE",
+			urlPath:      firstUser,
+			token:        firstToken,
+			body:         strings.NewReader(`{"password": "pa55word"}`),
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Delete Another User",
+			method:       "DELETE",
+			urlPath:      secondUser,
+			token:        firstToken,
+			body:         strings.NewReader(`{"password": "pa55word"}`),
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "Delete Another User as Admin",
+			method:       "DELETE",
+			urlPath:      secondUser,
+			token:        adminToken,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Delete Unknown User as Admin",
+			method:       "DELETE",
+			urlPath:      "/service/users/" + uuid.NewString(),
+			token:        adminToken,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "Restore Another User",
+			method:       "PUT",
+			urlPath:      firstUser + "/restored",
+			token:        firstToken,
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "Restore Another User as Admin",
+			method:       "PUT",
+			urlPath:      firstUser + "/restored",
+			token:        adminToken,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Restore Unknown User as Admin",
+			method:       "PUT",
+			urlPath:      "/service/users/" + uuid.NewString() + "/restored",
+			token:        adminToken,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "Get Current User Next to the User IDs",
+			method:       "GET",
+			urlPath:      "/service/users/me",
+			token:        firstToken,
+			expectedCode: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actualCode, _, _ := ts.request(t, tt.method, tt.urlPath, "application/json", tt.token, tt.body)
+			assert.Equal(t, tt.expectedCode, actualCode)
+		})
+	}
+}
+
+func TestListUsers(t *testing.T) {
+	app := testApplication(t)
+
+	ts := testServer(t, app.Routes())
+	defer ts.Close()
+
+	firstToken := app.testFirstToken(t)
+	adminToken := app.testAdminToken(t)
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		token        string
+		expectedCode int
+	}{
+		{"List Users", "/service/users", adminToken, http.StatusOK},
+		{"List Users with Filters", "/service/users?email_t=doe&name=jon&activated_b=true&created_after_dt=2023-01-01&created_before_dt=2023-02-01T00:00:00Z&sort=-email_t&page=2&page_size=10", adminToken, http.StatusOK},
+		{"List Users without Permission", "/service/users", firstToken, http.StatusForbidden},
+		{"List Users Unauthenticated", "/service/users", "", http.StatusUnauthorized},
+		{"List Users with Invalid Sort", "/service/users?sort=password_hash", adminToken, http.StatusUnprocessableEntity},
+		{"List Users with Invalid Page Size", "/service/users?page_size=500", adminToken, http.StatusUnprocessableEntity},
+		{"List Users with Invalid Activated", "/service/users?activated_b=maybe", adminToken, http.StatusUnprocessableEntity},
+		{"List Users with Invalid Date", "/service/users?created_after_dt=yesterday", adminToken, http.StatusUnprocessableEntity},
+		{"List Users with Invalid Pagination", "/service/users?pagination=offset", adminToken, http.StatusUnprocessableEntity},
+		{"List Users with Invalid Cursor", "/service/users?cursor=invalid", adminToken, http.StatusUnprocessableEntity},
+		{"List Users with Invalid Cursor Time", "/service/users?sort=created_at_dt&cursor=" + (&data.Cursor{Sort: "created_at_dt", Value: "x", ID: uuid.New()}).Encode(), adminToken, http.StatusUnprocessableEntity},
+		{"List Users with Invalid Cursor ID", "/service/users?sort=-id&cursor=" + (&data.Cursor{Sort: "-id", Value: "x", ID: uuid.New()}).Encode(), adminToken, http.StatusUnprocessableEntity},
+		{"List Users with Cursor Rejected by the Store", "/service/users?sort=email_t&cursor=" + (&data.Cursor{Sort: "email_t", Value: "a@example.com"}).Encode(), adminToken, http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actualCode, _, _ := ts.request(t, "GET", tt.urlPath, "", tt.token, nil)
+			assert.Equal(t, tt.expectedCode, actualCode)
+		})
+	}
+
+	t.Run("List Users with Page Metadata", func(t *testing.T) {
+		var list struct {
+			Users    []data.User   `json:"users"`
+			Metadata data.Metadata `json:"metadata"`
+		}
+
+		code, _, body := ts.request(t, "GET", "/service/users?email_t=jon", "", adminToken, nil)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Nil(t, json.Unmarshal([]byte(body), &list))
+		assert.Len(t, list.Users, 1)
+		assert.Equal(t, 1, list.Metadata.TotalRecords)
+		assert.Equal(t, 1, list.Metadata.LastPage)
+	})
+
+	t.Run("List Users with Cursors", func(t *testing.T) {
+		var list struct {
+			Users    []data.User   `json:"users"`
+			Metadata data.Metadata `json:"metadata"`
+		}
+
+		code, _, body := ts.request(t, "GET", "/service/users?pagination=cursor&sort=email_t", "", adminToken, nil)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Nil(t, json.Unmarshal([]byte(body), &list))
+		assert.Len(t, list.Users, 1)
+		assert.NotEmpty(t, list.Metadata.NextCursor)
+
+		cursor := list.Metadata.NextCursor
+
+		// The cursor can't be used with another sort
+		code, _, _ = ts.request(t, "GET", "/service/users?sort=last_name_t&cursor="+cursor, "", adminToken, nil)
+		assert.Equal(t, http.StatusUnprocessableEntity, code)
+
+		list.Metadata = data.Metadata{}
+
+		code, _, body = ts.request(t, "GET", "/service/users?sort=email_t&cursor="+cursor, "", adminToken, nil)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Nil(t, json.Unmarshal([]byte(body), &list))
+		assert.Len(t, list.Users, 1)
+		assert.Equal(t, mocks.MockSecondUUID(), list.Users[0].ID)
+		assert.Empty(t, list.Metadata.NextCursor)
+	})
+}
+
+func TestSearchUsers(t *testing.T) {
+	app := testApplication(t)
+
+	ts := testServer(t, app.Routes())
+	defer ts.Close()
+
+	firstToken := app.testFirstToken(t)
+	adminToken := app.testAdminToken(t)
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		token        string
+		expectedCode int
+	}{
+		{"Search Users", "/service/users/search?q=doe", adminToken, http.StatusOK},
+		{"Search Users without Permission", "/service/users/search?q=doe", firstToken, http.StatusForbidden},
+		{"Search Users Unauthenticated", "/service/users/search?q=doe", "", http.StatusUnauthorized},
+		{"Search Users without Query", "/service/users/search", adminToken, http.StatusUnprocessableEntity},
+		{"Search Users with Long Query", "/service/users/search?q=" + strings.Repeat("a", 101), adminToken, http.StatusUnprocessableEntity},
+		{"Search Users with Invalid Sort", "/service/users/search?q=doe&sort=email_t", adminToken, http.StatusUnprocessableEntity},
+		{"Search Users with Invalid Page Size", "/service/users/search?q=doe&page_size=0", adminToken, http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actualCode, _, _ := ts.request(t, "GET", tt.urlPath, "", tt.token, nil)
+			assert.Equal(t, tt.expectedCode, actualCode)
+		})
+	}
+
+	t.Run("Search Users with Scores", func(t *testing.T) {
+		var search struct {
+			Users []struct {
+				ID    uuid.UUID `json:"id"`
+				Email string    `json:"email_t"`
+				Score float64   `json:"score"`
+			} `json:"users"`
+			Metadata data.Metadata `json:"metadata"`
+		}
+
+		code, _, body := ts.request(t, "GET", "/service/users/search?q=nin", "", adminToken, nil)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Nil(t, json.Unmarshal([]byte(body), &search))
+		assert.Len(t, search.Users, 1)
+		assert.Equal(t, mocks.MockSecondUUID(), search.Users[0].ID)
+		assert.Equal(t, "nina@doe.com", search.Users[0].Email)
+		assert.Greater(t, search.Users[0].Score, 0.0)
+		assert.Equal(t, 1, search.Metadata.TotalRecords)
+
+		search.Users = nil
+
+		code, _, body = ts.request(t, "GET", "/service/users/search?q=nobody", "", adminToken, nil)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Nil(t, json.Unmarshal([]byte(body), &search))
+		assert.NotNil(t, search.Users)
+		assert.Empty(t, search.Users)
+	})
+
+	t.Run("Search Users with Pages", func(t *testing.T) {
+		var search struct {
+			Users []struct {
+				ID uuid.UUID `json:"id"`
+			} `json:"users"`
+			Metadata data.Metadata `json:"metadata"`
+		}
+
+		// Both users match, one user on each page
+		code, _, body := ts.request(t, "GET", "/service/users/search?q=doe&page=2&page_size=1", "", adminToken, nil)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Nil(t, json.Unmarshal([]byte(body), &search))
+		assert.Len(t, search.Users, 1)
+		assert.Equal(t, 2, search.Metadata.CurrentPage)
+		assert.Equal(t, 2, search.Metadata.LastPage)
+		assert.Equal(t, 2, search.Metadata.TotalRecords)
+
+		search.Users = nil
+
+		code, _, body = ts.request(t, "GET", "/service/users/search?q=doe&page=3&page_size=1", "", adminToken, nil)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Nil(t, json.Unmarshal([]byte(body), &search))
+		assert.Empty(t, search.Users)
+		assert.Equal(t, 2, search.Metadata.TotalRecords)
+	})
+}
+
+func TestWebhooks(t *testing.T) {
+	app := testApplication(t)
+
+	ts := testServer(t, app.Routes())
+	defer ts.Close()
+
+	firstToken := app.testFirstToken(t)
+	adminToken := app.testAdminToken(t)
+
+	webhook := "/service/users/webhooks/" + mocks.MockWebhookUUID().String()
+	unknownWebhook := "/service/users/webhooks/" + uuid.NewString()
+
+	tests := []struct {
+		name         string
+		method       string
+		urlPath      string
+		token        string
+		body         string
+		expectedCode int
+	}{
+		{"Create Webhook", "POST", "/service/users/webhooks", adminToken, `{"url_t": "https://example.com/webhooks", "events": ["user.created", "user.deleted"]}`, http.StatusCreated},
+		{"Create Webhook with Secret", "POST", "/service/users/webhooks", adminToken, `{"url_t": "https://example.com/webhooks", "events": ["*"], "secret_t": "a-secret-of-the-partner"}`, http.StatusCreated},
+		{"Create Webhook with Short Secret", "POST", "/service/users/webhooks", adminToken, `{"url_t": "https://example.com/webhooks", "events": ["*"], "secret_t": "short"}`, http.StatusUnprocessableEntity},
+		{"Create Webhook with Invalid URL", "POST", "/service/users/webhooks", adminToken, `{"url_t": "ftp://example.com", "events": ["*"]}`, http.StatusUnprocessableEntity},
+		{"Create Webhook with Unknown Event", "POST", "/service/users/webhooks", adminToken, `{"url_t": "https://example.com/webhooks", "events": ["team.created"]}`, http.StatusUnprocessableEntity},
+		{"Create Webhook without Events", "POST", "/service/users/webhooks", adminToken, `{"url_t": "https://example.com/webhooks", "events": []}`, http.StatusUnprocessableEntity},
+		{"Create Webhook without Permission", "POST", "/service/users/webhooks", firstToken, `{"url_t": "https://example.com/webhooks", "events": ["*"]}`, http.StatusForbidden},
+		{"List Webhooks", "GET", "/service/users/webhooks", adminToken, "", http.StatusOK},
+		{"List Webhooks without Permission", "GET", "/service/users/webhooks", firstToken, "", http.StatusForbidden},
+		{"Get Webhook", "GET", webhook, adminToken, "", http.StatusOK},
+		{"Get Unknown Webhook", "GET", unknownWebhook, adminToken, "", http.StatusNotFound},
+		{"Update Webhook", "PATCH", webhook, adminToken, `{"events": ["user.activated"], "active_b": false, "secret_t": "a-new-secret-of-the-partner"}`, http.StatusOK},
+		{"Update Webhook with Invalid URL", "PATCH", webhook, adminToken, `{"url_t": "example.com"}`, http.StatusUnprocessableEntity},
+		{"Update Unknown Webhook", "PATCH", unknownWebhook, adminToken, `{"active_b": false}`, http.StatusNotFound},
+		{"List Webhook Deliveries", "GET", webhook + "/deliveries", adminToken, "", http.StatusOK},
+		{"List Dead Webhook Deliveries", "GET", webhook + "/deliveries?status_t=dead&page_size=5", adminToken, "", http.StatusOK},
+		{"List Webhook Deliveries with Invalid Status", "GET", webhook + "/deliveries?status_t=lost", adminToken, "", http.StatusUnprocessableEntity},
+		{"List Webhook Deliveries of Unknown Webhook", "GET", unknownWebhook + "/deliveries", adminToken, "", http.StatusNotFound},
+		{"Replay Webhook Delivery", "POST", webhook + "/deliveries/1/replay", adminToken, "", http.StatusAccepted},
+		{"Replay Unknown Webhook Delivery", "POST", webhook + "/deliveries/2/replay", adminToken, "", http.StatusNotFound},
+		{"Replay Invalid Webhook Delivery", "POST", webhook + "/deliveries/first/replay", adminToken, "", http.StatusNotFound},
+		{"Replay Webhook Delivery without Permission", "POST", webhook + "/deliveries/1/replay", firstToken, "", http.StatusForbidden},
+		{"Delete Webhook", "DELETE", webhook, adminToken, "", http.StatusOK},
+		{"Delete Unknown Webhook", "DELETE", unknownWebhook, adminToken, "", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader
+			if tt.body != "" {
+				body = strings.NewReader(tt.body)
+			}
+
+			actualCode, _, _ := ts.request(t, tt.method, tt.urlPath, "application/json", tt.token, body)
+			assert.Equal(t, tt.expectedCode, actualCode)
+		})
+	}
+
+	t.Run("Create Webhook Shows the Secret Once", func(t *testing.T) {
+		var created struct {
+			Webhook map[string]interface{} `json:"webhook"`
+			Secret  string                 `json:"secret_t"`
+		}
+
+		code, header, body := ts.request(t, "POST", "/service/users/webhooks", "application/json", adminToken, strings.NewReader(`{"url_t": "https://example.com/webhooks", "events": ["*"]}`))
+		assert.Equal(t, http.StatusCreated, code)
+		assert.Equal(t, webhook, header.Get("Location"))
+		assert.Nil(t, json.Unmarshal([]byte(body), &created))
+		assert.Len(t, created.Secret, 43)
+		assert.NotContains(t, created.Webhook, "secret_t")
+
+		_, _, body = ts.request(t, "GET", webhook, "", adminToken, nil)
+		assert.NotContains(t, body, "secret")
+	})
+}
+
+func TestExports(t *testing.T) {
+	app := testApplication(t)
+
+	ts := testServer(t, app.Routes())
+	defer ts.Close()
+
+	firstToken := app.testFirstToken(t)
+	secondToken := app.testSecondToken(t)
+
+	export := "/service/users/me/exports/" + mocks.MockExportUUID().String()
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		token        string
+		expectedCode int
+	}{
+		{"Export User Data", "/service/users/me/export", firstToken, http.StatusAccepted},
+		{"Export User Data Unauthenticated", "/service/users/me/export", "", http.StatusUnauthorized},
+		{"Get Export", export, firstToken, http.StatusOK},
+		{"Get Export of Another User", export, secondToken, http.StatusNotFound},
+		{"Get Unknown Export", "/service/users/me/exports/" + uuid.NewString(), firstToken, http.StatusNotFound},
+		{"Download Export without Link", export + "/download", "", http.StatusUnauthorized},
+		{"Download Export with Access Token", export + "/download?token=" + firstToken, "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actualCode, _, _ := ts.request(t, "GET", tt.urlPath, "", tt.token, nil)
+			assert.Equal(t, tt.expectedCode, actualCode)
+		})
+	}
+
+	t.Run("Download Export", func(t *testing.T) {
+		var status struct {
+			Export struct {
+				Status      string `json:"status_t"`
+				Version     int    `json:"version"`
+				DownloadURL string `json:"download_url_t"`
+			} `json:"export"`
+		}
+
+		code, _, body := ts.request(t, "GET", export, "", firstToken, nil)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Nil(t, json.Unmarshal([]byte(body), &status))
+		assert.Equal(t, data.ExportReady, status.Export.Status)
+		assert.Equal(t, 1, status.Export.Version)
+
+		code, headers, body := ts.request(t, "GET", status.Export.DownloadURL, "", "", nil)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Contains(t, headers.Get("Content-Disposition"), "attachment")
+		assert.JSONEq(t, `{"version": 1}`, body)
+
+		// The link only downloads its export
+		otherExport := strings.Replace(status.Export.DownloadURL, mocks.MockExportUUID().String(), uuid.NewString(), 1)
+
+		code, _, _ = ts.request(t, "GET", otherExport, "", "", nil)
+		assert.Equal(t, http.StatusUnauthorized, code)
+
+		// The token of the link isn't an access token
+		token := status.Export.DownloadURL[strings.Index(status.Export.DownloadURL, "token=")+len("token="):]
+
+		code, _, _ = ts.request(t, "GET", "/service/users/me", "", token, nil)
+		assert.Equal(t, http.StatusBadRequest, code)
+
+		// It isn't signed with the signing keys published in the JWKS
+		_, err := jwt.ParseWithClaims(token, &Claims{}, app.Keys.Keyfunc)
+		assert.NotNil(t, err)
+	})
+}
+
+func TestAuditEvents(t *testing.T) {
+	app := testApplication(t)
+
+	ts := testServer(t, app.Routes())
+	defer ts.Close()
+
+	firstToken := app.testFirstToken(t)
+	adminToken := app.testAdminToken(t)
+
+	firstEvents := "/service/users/" + mocks.MockFirstUUID().String() + "/audit-events"
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		token        string
+		expectedCode int
+	}{
+		{"List Own Audit Events", "/service/users/me/audit-events", firstToken, http.StatusOK},
+		{"List Own Audit Events Unauthenticated", "/service/users/me/audit-events", "", http.StatusUnauthorized},
+		{"List Own Audit Events by Type", "/service/users/me/audit-events?type_t=login.failed&page=2&page_size=5", firstToken, http.StatusOK},
+		{"List Own Audit Events with Invalid Type", "/service/users/me/audit-events?type_t=login", firstToken, http.StatusUnprocessableEntity},
+		{"List Own Audit Events with Invalid Period", "/service/users/me/audit-events?created_after_dt=2026-02-01&created_before_dt=2026-01-01", firstToken, http.StatusUnprocessableEntity},
+		{"List Own Audit Events with Invalid Page Size", "/service/users/me/audit-events?page_size=1000", firstToken, http.StatusUnprocessableEntity},
+		{"List Audit Events of User", firstEvents + "?ip_t=127.0.0.1&created_after_dt=2026-01-01", adminToken, http.StatusOK},
+		{"List Audit Events of User without Permission", firstEvents, firstToken, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actualCode, _, _ := ts.request(t, "GET", tt.urlPath, "", tt.token, nil)
+			assert.Equal(t, tt.expectedCode, actualCode)
+		})
+	}
+
+	t.Run("List Own Audit Events Body", func(t *testing.T) {
+		var list struct {
+			AuditEvents []data.AuditEvent `json:"audit_events"`
+			Metadata    data.Metadata     `json:"metadata"`
+		}
+
+		code, _, body := ts.request(t, "GET", "/service/users/me/audit-events", "", firstToken, nil)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Nil(t, json.Unmarshal([]byte(body), &list))
+		assert.Len(t, list.AuditEvents, 1)
+		assert.Equal(t, data.AuditLoginSucceeded, list.AuditEvents[0].Type)
+		assert.Equal(t, "127.0.0.1", list.AuditEvents[0].IP)
+		assert.Equal(t, 1, list.Metadata.TotalRecords)
+	})
+}
+
+func TestOutboxWithoutBroker(t *testing.T) {
+	app := testApplication(t)
+	app.Models = memory.New().Models()
+	app.Config.Events.Broker = "none"
+	app.Config.Events.Retention = time.Nanosecond
+
+	broker, err := OpenBroker(app.Config)
+	assert.Nil(t, err)
+	assert.Nil(t, broker)
+
+	assert.Nil(t, app.Models.Users.Insert(context.Background(), &data.User{Email: "lee@doe.com", FirstName: "Lee", LastName: "Doe"}))
+
+	// The event of the user waits for a broker
+	_, err = app.Models.Outbox.Relay(10, func(event *data.Event) error { return errors.New("no broker") })
+	assert.NotNil(t, err)
+
+	stop := make(chan struct{})
+	app.runOutbox(stop)
+
+	// The unpublished events are deleted after the retention
+	assert.Eventually(t, func() bool {
+		published, err := app.Models.Outbox.Relay(10, func(event *data.Event) error { return errors.New("no broker") })
+		return err == nil && published == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	close(stop)
+	app.wg.Wait()
+}
+
+func TestCancelledRequest(t *testing.T) {
+	app := testApplication(t)
+
+	var logs bytes.Buffer
+	app.Logger = jsonlog.New(&logs, jsonlog.LevelInfo)
+
+	token := app.testFirstToken(t)
+
+	t.Run("Get User", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		rq := httptest.NewRequest(http.MethodGet, "/service/users/me", nil)
+		rq.Header.Set("Authorization", "Bearer "+token)
+
+		app.Routes().ServeHTTP(rr, rq)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("Get User with Cancelled Request", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		rr := httptest.NewRecorder()
+		rq := httptest.NewRequest(http.MethodGet, "/service/users/me", nil).WithContext(ctx)
+		rq.Header.Set("Authorization", "Bearer "+token)
+
+		app.Routes().ServeHTTP(rr, rq)
+
+		// The query of the user ends with the request, without logging an error
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+		assert.NotContains(t, logs.String(), "ERROR")
+	})
+}
+
+func TestDataErrors(t *testing.T) {
+	app := testApplication(t)
+
+	var logs bytes.Buffer
+	app.Logger = jsonlog.New(&logs, jsonlog.LevelInfo)
+
+	tests := []struct {
+		name       string
+		err        error
+		status     int
+		retryAfter string
+	}{
+		{"Value Too Long", fmt.Errorf("%w: pq: value too long for type character varying(100)", data.ErrValueTooLong), http.StatusUnprocessableEntity, ""},
+		{"Retryable", fmt.Errorf("%w: pq: could not serialize access", data.ErrRetryable), http.StatusServiceUnavailable, "1"},
+		{"Timeout", fmt.Errorf("%w: pq: canceling statement due to statement timeout", data.ErrTimeout), http.StatusServiceUnavailable, "1"},
+		{"Other", errors.New("pq: connection refused"), http.StatusInternalServerError, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			rq := httptest.NewRequest(http.MethodGet, "/service/users/me", nil)
+
+			app.serverErrorResponse(rr, rq, tt.err)
+
+			assert.Equal(t, tt.status, rr.Code)
+			assert.Equal(t, tt.retryAfter, rr.Header().Get("Retry-After"))
+			assert.NotContains(t, rr.Body.String(), "pq:")
+		})
+	}
+}
+
+func TestStores(t *testing.T) {
+	stores := []struct {
+		name   string
+		models func(t *testing.T) data.Models
+	}{
+		{"Memory", func(t *testing.T) data.Models { return memory.New().Models() }},
+		{"SQLite", testSQLiteModels},
+	}
+
+	for _, store := range stores {
+		t.Run(store.name, func(t *testing.T) {
+			app := testApplication(t)
+			app.Models = store.models(t)
+
+			ts := testServer(t, app.Routes())
+			defer ts.Close()
+
+			var created struct {
+				User data.User `json:"user"`
+			}
+
+			code, _, body := ts.request(t, "POST", "/service/users", "application/json", "", app.testBodyCreateUser(t))
+			assert.Equal(t, http.StatusCreated, code)
+			assert.Nil(t, json.Unmarshal([]byte(body), &created))
+
+			admin := &data.User{Email: "admin@doe.com", FirstName: "Admin", LastName: "Doe", Activated: true}
+			mocks.MockSetPassword(admin)
+			assert.Nil(t, app.Models.Users.Insert(context.Background(), admin))
+			assert.Nil(t, app.Models.Permissions.AddRolesForUser(admin.ID, "admin"))
+
+			userToken := app.testCreateToken(t, created.User.ID)
+			adminToken := app.testCreateToken(t, admin.ID)
+			userPath := "/service/users/" + created.User.ID.String()
+
+			tests := []struct {
+				name         string
+				method       string
+				urlPath      string
+				token        string
+				body         io.Reader
+				expectedCode int
+			}{
+				{"Register User with Duplicate Email", "POST", "/service/users", "", app.testBodyCreateUser(t), http.StatusUnprocessableEntity},
+				{"Register User with Duplicate Email in Uppercase", "POST", "/service/users", "", strings.NewReader(`{"email_t": " JON@Doe.com", "password": "pa55word", "first_name_t": "Jon", "last_name_t": "Doe"}`), http.StatusUnprocessableEntity},
+				{"Login User", "POST", "/service/users/authentication", "", app.testBodyLoginUser(t), http.StatusOK},
+				{"Login User with Email in Uppercase", "POST", "/service/users/authentication", "", strings.NewReader(`{"email_t": "Jon@DOE.com ", "password": "pa55word"}`), http.StatusOK},
+				{"Get User", "GET", "/service/users/me", userToken, nil, http.StatusOK},
+				{"Update Own User before Activation", "PATCH", userPath, userToken, strings.NewReader(`{"last_name_t": "Doe"}`), http.StatusOK},
+				{"Get Own User before Activation", "GET", userPath, userToken, nil, http.StatusForbidden},
+				{"Update User", "PATCH", userPath, adminToken, strings.NewReader(`{"first_name_t": "Nina"}`), http.StatusOK},
+				{"List Users", "GET", "/service/users?sort=-created_at_dt&first_name_t=nin", adminToken, nil, http.StatusOK},
+				{"Search Users", "GET", "/service/users/search?q=nina", adminToken, nil, http.StatusOK},
+				{"Get User Not Found", "GET", "/service/users/" + uuid.NewString(), adminToken, nil, http.StatusNotFound},
+				{"Delete User without Permission", "DELETE", userPath, userToken, nil, http.StatusForbidden},
+				{"Delete User", "DELETE", userPath, adminToken, nil, http.StatusOK},
+				{"Delete User Not Found", "DELETE", userPath, adminToken, nil, http.StatusNotFound},
+				{"Get Deleted User", "GET", userPath, adminToken, nil, http.StatusNotFound},
+				{"Login Deleted User", "POST", "/service/users/authentication", "", app.testBodyLoginUser(t), http.StatusUnauthorized},
+				{"Register User after Delete", "POST", "/service/users", "", app.testBodyCreateUser(t), http.StatusUnprocessableEntity},
+				{"Restore User", "PUT", userPath + "/restored", adminToken, nil, http.StatusOK},
+				{"Restore User Not Deleted", "PUT", userPath + "/restored", adminToken, nil, http.StatusNotFound},
+				{"Get Restored User", "GET", userPath, adminToken, nil, http.StatusOK},
+				{"Delete Restored User", "DELETE", userPath, adminToken, nil, http.StatusOK},
+			}
+
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					contentType := ""
+					if tt.body != nil {
+						contentType = "application/json"
+					}
+
+					actualCode, _, _ := ts.request(t, tt.method, tt.urlPath, contentType, tt.token, tt.body)
+					assert.Equal(t, tt.expectedCode, actualCode)
+				})
+			}
+
+			t.Run("Export User Data", func(t *testing.T) {
+				owner := &data.User{Email: "lee@doe.com", FirstName: "Lee", LastName: "Doe", Activated: true}
+				mocks.MockSetPassword(owner)
+				assert.Nil(t, app.Models.Users.Insert(context.Background(), owner))
+
+				ownerToken := app.testCreateToken(t, owner.ID)
+
+				var status struct {
+					Export struct {
+						Status      string `json:"status_t"`
+						DownloadURL string `json:"download_url_t"`
+					} `json:"export"`
+				}
+
+				code, headers, _ := ts.request(t, "GET", "/service/users/me/export", "", ownerToken, nil)
+				assert.Equal(t, http.StatusAccepted, code)
+
+				// The archive is generated in the background
+				assert.Eventually(t, func() bool {
+					code, _, body := ts.request(t, "GET", headers.Get("Location"), "", ownerToken, nil)
+					return code == http.StatusOK && json.Unmarshal([]byte(body), &status) == nil && status.Export.Status == data.ExportReady
+				}, 5*time.Second, 10*time.Millisecond)
+
+				var archive struct {
+					Version int `json:"version"`
+					User    struct {
+						Email string `json:"email_t"`
+					} `json:"user"`
+				}
+
+				code, _, body := ts.request(t, "GET", status.Export.DownloadURL, "", "", nil)
+				assert.Equal(t, http.StatusOK, code)
+				assert.Nil(t, json.Unmarshal([]byte(body), &archive))
+				assert.Equal(t, 1, archive.Version)
+				assert.Equal(t, "lee@doe.com", archive.User.Email)
+				assert.NotContains(t, body, "password")
+			})
+
+			t.Run("Email the Name of the User", func(t *testing.T) {
+				ann := &data.User{Email: "ann@doe.com", FirstName: "Ann", LastName: "Doe"}
+				mocks.MockSetPassword(ann)
+				assert.Nil(t, app.Models.Users.Insert(context.Background(), ann))
+
+				mailbox := app.Mailer.(*mailer.Memory)
+
+				emails := []struct {
+					urlPath  string
+					template string
+				}{
+					{"/service/users/activation", "user_activation.tmpl"},
+					{"/service/users/password-reset", "user_password_reset.tmpl"},
+				}
+
+				for _, email := range emails {
+					code, _, _ := ts.request(t, "POST", email.urlPath, "application/json", "", strings.NewReader(`{"email_t": "ann@doe.com"}`))
+					assert.Equal(t, http.StatusAccepted, code)
+
+					// The emails are sent in the background
+					assert.Eventually(t, func() bool {
+						message := mailbox.Last("ann@doe.com")
+						return message != nil && message.TemplateFile == email.template
+					}, 5*time.Second, 10*time.Millisecond)
+
+					assert.Contains(t, mailbox.Last("ann@doe.com").PlainBody, "Hi Ann,")
+				}
+			})
+
+			t.Run("Audit Events", func(t *testing.T) {
+				var list struct {
+					AuditEvents []data.AuditEvent `json:"audit_events"`
+				}
+
+				code, _, body := ts.request(t, "GET", userPath+"/audit-events", "", adminToken, nil)
+				assert.Equal(t, http.StatusOK, code)
+				assert.Nil(t, json.Unmarshal([]byte(body), &list))
+
+				// The events are listed the newest first
+				var types []string
+				for _, event := range list.AuditEvents {
+					types = append(types, event.Type)
+				}
+
+				assert.Equal(t, []string{
+					data.AuditUserDeleted,
+					data.AuditUserRestored,
+					data.AuditUserDeleted,
+					data.AuditTokenIssued,
+					data.AuditLoginSucceeded,
+					data.AuditTokenIssued,
+					data.AuditLoginSucceeded,
+				}, types)
+
+				assert.Equal(t, admin.ID, *list.AuditEvents[0].ActorID)
+				assert.Equal(t, "127.0.0.1", list.AuditEvents[0].IP)
+				assert.Equal(t, "Go-http-client/1.1", list.AuditEvents[0].UserAgent)
+
+				// The roles given to the admin are recorded
+				list.AuditEvents = nil
+
+				code, _, body = ts.request(t, "GET", "/service/users/me/audit-events?type_t=role.added", "", adminToken, nil)
+				assert.Equal(t, http.StatusOK, code)
+				assert.Nil(t, json.Unmarshal([]byte(body), &list))
+				assert.Len(t, list.AuditEvents, 1)
+				assert.Equal(t, "admin", list.AuditEvents[0].Details)
+				assert.Nil(t, list.AuditEvents[0].ActorID)
+
+				// The events older than the retention are deleted
+				assert.Nil(t, app.Models.AuditEvents.DeleteBefore(time.Now().Add(time.Minute)))
+
+				code, _, body = ts.request(t, "GET", "/service/users/me/audit-events", "", adminToken, nil)
+				assert.Equal(t, http.StatusOK, code)
+				assert.Nil(t, json.Unmarshal([]byte(body), &list))
+				assert.Empty(t, list.AuditEvents)
+			})
+
+			t.Run("Register User after Purge", func(t *testing.T) {
+				purges, err := app.Models.Users.Purge(context.Background(), time.Now(), 10)
+				assert.Nil(t, err)
+				assert.Len(t, purges, 1)
+
+				code, _, _ := ts.request(t, "POST", "/service/users", "application/json", "", app.testBodyCreateUser(t))
+				assert.Equal(t, http.StatusCreated, code)
+
+				code, _, _ = ts.request(t, "PUT", userPath+"/restored", "", adminToken, nil)
+				assert.Equal(t, http.StatusNotFound, code)
+			})
+		})
+	}
+}
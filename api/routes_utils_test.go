@@ -2,17 +2,25 @@ package api
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/e-inwork-com/go-user-service/internal/data"
 	"github.com/e-inwork-com/go-user-service/internal/data/mocks"
+	"github.com/e-inwork-com/go-user-service/internal/encryption"
 	"github.com/e-inwork-com/go-user-service/internal/jsonlog"
+	"github.com/e-inwork-com/go-user-service/internal/lockout"
+	"github.com/e-inwork-com/go-user-service/internal/mailer"
+	"github.com/e-inwork-com/go-user-service/internal/totp"
+	"github.com/e-inwork-com/go-user-service/internal/webauthn"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/google/uuid"
 )
@@ -21,15 +29,94 @@ func testApplication(t *testing.T) *Application {
 
 	var cfg Config
 	cfg.Auth.Secret = "secret"
+	cfg.Auth.AccessTokenTTL = 15 * time.Minute
+	cfg.Auth.RefreshTokenTTL = 24 * time.Hour
+	cfg.Deletion.GracePeriod = 24 * time.Hour
+	cfg.Exports.TTL = time.Hour
+	cfg.Exports.LinkTTL = time.Minute
+
+	keys, err := OpenKeySet(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cipher, err := encryption.New(mocks.MockEncryptionKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	webhookCipher, err := encryption.NewForPurpose(mocks.MockEncryptionKey(), CipherWebhooks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sessionCipher, err := encryption.NewForPurpose(mocks.MockEncryptionKey(), CipherSessions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	relyingParty := &webauthn.RelyingParty{
+		ID:      "localhost",
+		Name:    "e-inwork",
+		Origins: []string{"https://localhost"},
+	}
 
 	return &Application{
 		Config: cfg,
 		Logger: jsonlog.New(os.Stdout, jsonlog.LevelInfo),
 		Models: data.Models{
-			Users: &mocks.UserModel{},
+			Users:             &mocks.UserModel{},
+			Permissions:       &mocks.PermissionModel{},
+			RefreshTokens:     &mocks.RefreshTokenModel{},
+			RevokedTokens:     &mocks.RevokedTokenModel{},
+			Tokens:            &mocks.TokenModel{},
+			TOTP:              &mocks.TOTPModel{},
+			RecoveryCodes:     &mocks.RecoveryCodeModel{},
+			WebAuthn:          &mocks.WebAuthnCredentialModel{},
+			Search:            &mocks.UserSearchModel{},
+			Outbox:            &mocks.OutboxModel{},
+			Webhooks:          &mocks.WebhookModel{},
+			WebhookDeliveries: &mocks.WebhookDeliveryModel{},
+			Exports:           &mocks.ExportModel{},
+			AuditEvents:       &mocks.AuditEventModel{},
 		},
+		Keys:     keys,
+		Mailer:   mailer.NewMemory(),
+		Cipher:   cipher,
+		WebAuthn: relyingParty,
+		Lockout:  lockout.New(lockout.NewMemory(), lockout.Policy{Threshold: 3, Duration: time.Minute}),
+
+		WebhookCipher: webhookCipher,
+		SessionCipher: sessionCipher,
+	}
+
+}
+
+// testSQLiteModels returns the models of a new SQLite database migrated up
+func testSQLiteModels(t *testing.T) data.Models {
+	var cfg Config
+	cfg.Db.Dsn = "sqlite:" + filepath.Join(t.TempDir(), "user.db")
+	cfg.Db.MaxOpenConn = 25
+	cfg.Db.MaxIdleConn = 25
+	cfg.Db.MaxIdleTime = "15m"
+
+	models, db, err := OpenModels(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := OpenMigrator(cfg, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = migrator.Up(context.Background())
+	if err != nil {
+		t.Fatal(err)
 	}
 
+	return models
 }
 
 type httpTestServer struct {
@@ -69,9 +156,10 @@ func (ts *httpTestServer) request(t *testing.T, method string, urlPath string, c
 }
 
 func (app *Application) testCreateToken(t *testing.T, id uuid.UUID) string {
-	// Set Signing Key from the Config Environment
-	signingKey := []byte(app.Config.Auth.Secret)
+	return app.testCreateTokenWithID(t, id, uuid.NewString())
+}
 
+func (app *Application) testCreateTokenWithID(t *testing.T, id uuid.UUID, jti string) string {
 	// Set an expired time for a week
 	expirationTime := time.Now().Add((24 * 7) * time.Hour)
 
@@ -79,13 +167,14 @@ func (app *Application) testCreateToken(t *testing.T, id uuid.UUID) string {
 	claims := &Claims{
 		ID: id,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 		},
 	}
 
 	// Create a signed token
-	signed := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	token, err := signed.SignedString(signingKey)
+	token, err := app.Keys.Sign(claims)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -107,6 +196,13 @@ func (app *Application) testSecondToken(t *testing.T) string {
 	return app.testCreateToken(t, id)
 }
 
+func (app *Application) testRevokedToken(t *testing.T) string {
+	// Create UUID
+	id := mocks.MockFirstUUID()
+
+	return app.testCreateTokenWithID(t, id, mocks.MockRevokedTokenID())
+}
+
 func (app *Application) testBodyCreateUser(t *testing.T) io.Reader {
 	user := `{"email_t": "jon@doe.com", "password": "pa55word", "first_name_t": "Jon", "last_name_t": "Doe"}`
 	return bytes.NewReader([]byte(user))
@@ -118,7 +214,7 @@ func (app *Application) testBodyLoginUser(t *testing.T) io.Reader {
 }
 
 func (app *Application) testBodyUpdateUser(t *testing.T) io.Reader {
-	user := `{"password": "pa00word", "first_name_t": "Nina"}`
+	user := `{"password": "pa00word", "current_password": "pa55word", "first_name_t": "Nina"}`
 	return bytes.NewReader([]byte(user))
 }
 
@@ -126,3 +222,100 @@ func (app *Application) testBodyUpdateUserFobidden(t *testing.T) io.Reader {
 	user := `{"password": "pa11w0rd", "email_t": "lee@john.com"}`
 	return bytes.NewReader([]byte(user))
 }
+
+func (app *Application) testBodyRefreshToken(t *testing.T, refreshToken string) io.Reader {
+	body := fmt.Sprintf(`{"refresh_token": "%v"}`, refreshToken)
+	return bytes.NewReader([]byte(body))
+}
+
+func (app *Application) testBodyToken(t *testing.T, token string) io.Reader {
+	body := fmt.Sprintf(`{"token": "%v"}`, token)
+	return bytes.NewReader([]byte(body))
+}
+
+func (app *Application) testBodyEmail(t *testing.T, email string) io.Reader {
+	body := fmt.Sprintf(`{"email_t": "%v"}`, email)
+	return bytes.NewReader([]byte(body))
+}
+
+func (app *Application) testBodyResetPassword(t *testing.T, token string) io.Reader {
+	body := fmt.Sprintf(`{"password": "pa22word", "token": "%v"}`, token)
+	return bytes.NewReader([]byte(body))
+}
+
+func (app *Application) testBodyUpdateUserEmail(t *testing.T, currentPassword string) io.Reader {
+	body := fmt.Sprintf(`{"email_t": "lee@doe.com", "current_password": "%v"}`, currentPassword)
+	return bytes.NewReader([]byte(body))
+}
+
+func (app *Application) testBodyLoginSecondUser(t *testing.T) io.Reader {
+	user := `{"email_t": "nina@doe.com", "password": "pa55word"}`
+	return bytes.NewReader([]byte(user))
+}
+
+func (app *Application) testBodyMFA(t *testing.T, mfaToken string, code string, recoveryCode string) io.Reader {
+	body := fmt.Sprintf(`{"mfa_token": "%v", "code": "%v", "recovery_code": "%v"}`, mfaToken, code, recoveryCode)
+	return bytes.NewReader([]byte(body))
+}
+
+func (app *Application) testTOTPCode(t *testing.T) string {
+	code, err := totp.Code(mocks.MockTOTPSecret(), totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return code
+}
+
+func (app *Application) testBodyCode(t *testing.T, code string) io.Reader {
+	body := fmt.Sprintf(`{"code": "%v"}`, code)
+	return bytes.NewReader([]byte(body))
+}
+
+func (app *Application) testWebAuthnOptions(t *testing.T, ts *httpTestServer, urlPath string, token string, body io.Reader, options interface{}) string {
+	var begin struct {
+		PublicKey    json.RawMessage `json:"public_key"`
+		SessionToken string          `json:"session_token"`
+	}
+
+	code, _, response := ts.request(t, "POST", urlPath, "application/json", token, body)
+	if code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %s", code, response)
+	}
+
+	err := json.Unmarshal([]byte(response), &begin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = json.Unmarshal(begin.PublicKey, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return begin.SessionToken
+}
+
+func (app *Application) testBodyWebAuthn(t *testing.T, sessionToken string, credential interface{}) io.Reader {
+	body, err := json.Marshal(map[string]interface{}{
+		"session_token": sessionToken,
+		"credential":    credential,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bytes.NewReader(body)
+}
+
+func (app *Application) testBodyLogin(t *testing.T, email string, password string) io.Reader {
+	body := fmt.Sprintf(`{"email_t": "%v", "password": "%v"}`, email, password)
+	return bytes.NewReader([]byte(body))
+}
+
+func (app *Application) testAdminToken(t *testing.T) string {
+	// Create UUID
+	id := mocks.MockAdminUUID()
+
+	return app.testCreateToken(t, id)
+}
@@ -3,17 +3,33 @@ package api
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/e-inwork-com/go-user-service/internal/data"
+	"github.com/e-inwork-com/go-user-service/internal/data/memory"
+	"github.com/e-inwork-com/go-user-service/internal/encryption"
+	"github.com/e-inwork-com/go-user-service/internal/events"
+	"github.com/e-inwork-com/go-user-service/internal/indexer"
 	"github.com/e-inwork-com/go-user-service/internal/jsonlog"
+	"github.com/e-inwork-com/go-user-service/internal/lockout"
+	"github.com/e-inwork-com/go-user-service/internal/mailer"
+	"github.com/e-inwork-com/go-user-service/internal/migrate"
+	"github.com/e-inwork-com/go-user-service/internal/purge"
+	"github.com/e-inwork-com/go-user-service/internal/signing"
+	"github.com/e-inwork-com/go-user-service/internal/sqlite"
+	"github.com/e-inwork-com/go-user-service/internal/webauthn"
+	"github.com/e-inwork-com/go-user-service/internal/webhooks"
+	"github.com/e-inwork-com/go-user-service/migrations"
 
 	_ "github.com/lib/pq"
 )
@@ -27,15 +43,128 @@ type Config struct {
 	Port int
 	Env  string
 
+	// Store keeps the data of the service in the database of the DSN,
+	// or in memory to run the service without a database
+	Store string
+
 	Db struct {
 		Dsn         string
 		MaxOpenConn int
 		MaxIdleConn int
 		MaxIdleTime string
+
+		// QueryTimeout limits the queries of the users,
+		// they also end when the request is cancelled
+		QueryTimeout time.Duration
+
+		// AutoMigrate applies the migrations on startup
+		AutoMigrate bool
+	}
+
+	Users struct {
+		// CaseSensitiveEmails keeps the case of the local part
+		// of the emails in the identity of the users
+		CaseSensitiveEmails bool
 	}
 
 	Auth struct {
-		Secret string
+		Secret               string
+		SigningMethod        string
+		SigningKeyFile       string
+		VerificationKeyFiles []string
+		AccessTokenTTL       time.Duration
+		RefreshTokenTTL      time.Duration
+	}
+
+	Mfa struct {
+		EncryptionKey string
+		Issuer        string
+	}
+
+	WebAuthn struct {
+		RPID    string
+		RPName  string
+		Origins []string
+	}
+
+	Smtp struct {
+		Host     string
+		Port     int
+		Username string
+		Password string
+		Sender   string
+	}
+
+	Mailer struct {
+		Backend  string
+		Dir      string
+		Attempts int
+		Backoff  time.Duration
+	}
+
+	Lockout struct {
+		Enabled   bool
+		Store     string
+		Threshold int
+		Duration  time.Duration
+		BaseDelay time.Duration
+		MaxDelay  time.Duration
+		Window    time.Duration
+	}
+
+	Indexer struct {
+		Enabled       bool
+		URL           string
+		BatchSize     int
+		FlushInterval time.Duration
+		QueueSize     int
+		CommitWithin  time.Duration
+		Attempts      int
+		Backoff       time.Duration
+		Timeout       time.Duration
+	}
+
+	Events struct {
+		Broker     string
+		WebhookURL string
+		NatsURL    string
+		NatsPrefix string
+		Timeout    time.Duration
+		BatchSize  int
+		Interval   time.Duration
+		MaxBackoff time.Duration
+		Retention  time.Duration
+	}
+
+	Webhooks struct {
+		Workers     int
+		MaxAttempts int
+		Backoff     time.Duration
+		MaxBackoff  time.Duration
+		Timeout     time.Duration
+		Interval    time.Duration
+	}
+
+	// Deletion keeps the deleted users for the grace period, they can be
+	// restored until they are purged with their data
+	Deletion struct {
+		GracePeriod   time.Duration
+		PurgeInterval time.Duration
+		BatchSize     int
+	}
+
+	// Exports keeps the archives of the personal data exports for the TTL,
+	// they are downloaded with links that expire after the LinkTTL
+	Exports struct {
+		TTL     time.Duration
+		LinkTTL time.Duration
+	}
+
+	// Audit keeps the audit events of the accounts for the Retention,
+	// the older events are deleted every PruneInterval
+	Audit struct {
+		Retention     time.Duration
+		PruneInterval time.Duration
 	}
 
 	Limiter struct {
@@ -50,10 +179,25 @@ type Config struct {
 }
 
 type Application struct {
-	Config Config
-	Logger *jsonlog.Logger
-	Models data.Models
-	wg     sync.WaitGroup
+	Config   Config
+	Logger   *jsonlog.Logger
+	Models   data.Models
+	Keys     *signing.KeySet
+	Mailer   mailer.Mailer
+	Cipher   *encryption.Cipher
+	WebAuthn *webauthn.RelyingParty
+	Lockout  *lockout.Limiter
+	Indexer  *indexer.Indexer
+	Events   events.Broker
+
+	// WebhookCipher encrypts the signing secrets of the webhooks,
+	// with a key of its own purpose
+	WebhookCipher *encryption.Cipher
+
+	// SessionCipher seals the claims of the tokens that aren't access tokens
+	SessionCipher *encryption.Cipher
+
+	wg sync.WaitGroup
 }
 
 func (app *Application) Serve() error {
@@ -67,6 +211,46 @@ func (app *Application) Serve() error {
 
 	shutdownError := make(chan error)
 
+	// Stop the background workers on the shutdown
+	stop := make(chan struct{})
+
+	app.runOutbox(stop)
+
+	dispatcher := &webhooks.Dispatcher{
+		Deliveries:  app.Models.WebhookDeliveries,
+		Cipher:      app.WebhookCipher,
+		Client:      &http.Client{Timeout: app.Config.Webhooks.Timeout},
+		Logger:      app.Logger,
+		MaxAttempts: app.Config.Webhooks.MaxAttempts,
+		Backoff:     app.Config.Webhooks.Backoff,
+		MaxBackoff:  app.Config.Webhooks.MaxBackoff,
+		BatchSize:   10,
+		Lease:       10*app.Config.Webhooks.Timeout + time.Minute,
+		Interval:    app.Config.Webhooks.Interval,
+	}
+
+	purger := &purge.Purger{
+		Users:       app.Models.Users,
+		Logger:      app.Logger,
+		GracePeriod: app.Config.Deletion.GracePeriod,
+		BatchSize:   app.Config.Deletion.BatchSize,
+		Interval:    app.Config.Deletion.PurgeInterval,
+	}
+
+	app.background(func() {
+		purger.Run(stop)
+	})
+
+	app.background(func() {
+		app.pruneAuditEvents(stop)
+	})
+
+	for i := 0; i < app.Config.Webhooks.Workers; i++ {
+		app.background(func() {
+			dispatcher.Work(stop)
+		})
+	}
+
 	go func() {
 		quit := make(chan os.Signal, 1)
 		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -88,7 +272,15 @@ func (app *Application) Serve() error {
 			"addr": srv.Addr,
 		})
 
+		close(stop)
+
 		app.wg.Wait()
+
+		// Send the changes of the users still in the queue
+		if app.Indexer != nil {
+			app.Indexer.Close()
+		}
+
 		shutdownError <- nil
 	}()
 
@@ -114,8 +306,83 @@ func (app *Application) Serve() error {
 	return nil
 }
 
+// runOutbox Function to publish the events of the outbox to the broker in the
+// background, without a broker the events are only deleted after the retention
+func (app *Application) runOutbox(stop <-chan struct{}) {
+	if app.Events != nil {
+		relay := &events.Relay{
+			Outbox:     app.Models.Outbox,
+			Broker:     app.Events,
+			Logger:     app.Logger,
+			BatchSize:  app.Config.Events.BatchSize,
+			Interval:   app.Config.Events.Interval,
+			MaxBackoff: app.Config.Events.MaxBackoff,
+			Retention:  app.Config.Events.Retention,
+		}
+
+		app.background(func() {
+			relay.Run(stop)
+		})
+	} else {
+		pruner := &events.Pruner{
+			Outbox:    app.Models.Outbox,
+			Logger:    app.Logger,
+			Retention: app.Config.Events.Retention,
+		}
+
+		app.background(func() {
+			pruner.Run(stop)
+		})
+	}
+}
+
+// OpenModels returns the models of the store of the service,
+// with the connection pool of the database, it is nil in memory
+func OpenModels(cfg Config) (data.Models, *sql.DB, error) {
+	// Every store matches the emails by the same identity
+	data.CaseSensitiveEmails = cfg.Users.CaseSensitiveEmails
+
+	switch cfg.Store {
+	case "", "database", "postgres":
+		db, err := OpenDB(cfg)
+		if err != nil {
+			return data.Models{}, nil, err
+		}
+
+		if driver, _ := dbDriver(cfg.Db.Dsn); driver == sqlite.DriverName {
+			return data.InitSQLiteModels(db, cfg.Db.QueryTimeout), db, nil
+		}
+
+		return data.InitModels(db, cfg.Db.QueryTimeout), db, nil
+	case "memory":
+		return memory.New().Models(), nil, nil
+	default:
+		return data.Models{}, nil, fmt.Errorf("unsupported store %q", cfg.Store)
+	}
+}
+
+// dbDriver returns the driver and the data source of the DSN, a "sqlite:" DSN is the
+// path of a SQLite file, like "sqlite:./user.db", any other DSN is a Postgres database
+func dbDriver(dsn string) (string, string) {
+	if !strings.HasPrefix(dsn, "sqlite:") {
+		return "postgres", dsn
+	}
+
+	path := strings.TrimPrefix(strings.TrimPrefix(dsn, "sqlite:"), "//")
+
+	// The foreign keys delete the data of the users, the transactions lock the
+	// database when they begin, and the writers wait for each other
+	params := "_foreign_keys=on&_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate"
+	if strings.Contains(path, "?") {
+		return sqlite.DriverName, "file:" + path + "&" + params
+	}
+
+	return sqlite.DriverName, "file:" + path + "?" + params
+}
+
+// OpenDB opens the database of the DSN, Postgres or SQLite
 func OpenDB(cfg Config) (*sql.DB, error) {
-	db, err := sql.Open("postgres", cfg.Db.Dsn)
+	db, err := sql.Open(dbDriver(cfg.Db.Dsn))
 	if err != nil {
 		return nil, err
 	}
@@ -140,3 +407,221 @@ func OpenDB(cfg Config) (*sql.DB, error) {
 
 	return db, nil
 }
+
+// OpenMigrator returns the migrator of the embedded migrations
+// of the database of the DSN, Postgres or SQLite
+func OpenMigrator(cfg Config, db *sql.DB) (*migrate.Migrator, error) {
+	driver, _ := dbDriver(cfg.Db.Dsn)
+	if driver == sqlite.DriverName {
+		return migrate.New(db, driver, migrations.SQLite)
+	}
+
+	return migrate.New(db, driver, migrations.Postgres)
+}
+
+// OpenKeySet loads the keys to sign and to verify the JSON Web Tokens,
+// HS256 uses the shared secret, RS256 and EdDSA use the private key file
+func OpenKeySet(cfg Config) (*signing.KeySet, error) {
+	var active *signing.Key
+
+	switch cfg.Auth.SigningMethod {
+	case "", "HS256":
+		if cfg.Auth.Secret == "" {
+			return nil, errors.New("the HS256 signing method requires an authentication secret")
+		}
+		active = signing.NewHMACKey(cfg.Auth.Secret)
+	case "RS256", "EdDSA":
+		key, err := signing.LoadKey(cfg.Auth.SigningKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if key.Method.Alg() != cfg.Auth.SigningMethod {
+			return nil, fmt.Errorf("the signing key is a %s key, not a %s key", key.Method.Alg(), cfg.Auth.SigningMethod)
+		}
+		active = key
+	default:
+		return nil, fmt.Errorf("unsupported signing method %q", cfg.Auth.SigningMethod)
+	}
+
+	var verification []*signing.Key
+
+	for _, path := range cfg.Auth.VerificationKeyFiles {
+		key, err := signing.LoadKey(path)
+		if err != nil {
+			return nil, err
+		}
+		verification = append(verification, key)
+	}
+
+	return signing.NewKeySet(active, verification...)
+}
+
+// OpenMailer creates the mailer of the configured backend,
+// the emails are sent with retries on the "smtp" backend,
+// and written to a directory on the "file" backend
+func OpenMailer(cfg Config, logger *jsonlog.Logger) (mailer.Mailer, error) {
+	var m mailer.Mailer
+
+	switch cfg.Mailer.Backend {
+	case "", "smtp":
+		m = mailer.NewSMTP(cfg.Smtp.Host, cfg.Smtp.Port, cfg.Smtp.Username, cfg.Smtp.Password, cfg.Smtp.Sender)
+	case "file":
+		file, err := mailer.NewFile(cfg.Mailer.Dir, cfg.Smtp.Sender)
+		if err != nil {
+			return nil, err
+		}
+		m = file
+	case "memory":
+		m = mailer.NewMemory()
+	default:
+		return nil, fmt.Errorf("unsupported mailer backend %q", cfg.Mailer.Backend)
+	}
+
+	return mailer.NewRetry(m, cfg.Mailer.Attempts, cfg.Mailer.Backoff, logger), nil
+}
+
+// The purposes of the keys derived from the encryption key,
+// the TOTP secrets are encrypted with the encryption key itself
+const (
+	CipherTOTP     = ""
+	CipherWebhooks = "webhooks"
+	CipherSessions = "sessions"
+)
+
+// OpenCipher creates the cipher of the secrets of the purpose stored in the database,
+// the key is required so the secrets don't depend on the signing secret
+// of the tokens, which is rotated
+func OpenCipher(cfg Config, purpose string) (*encryption.Cipher, error) {
+	if cfg.Mfa.EncryptionKey == "" {
+		return nil, errors.New("an encryption key is required")
+	}
+
+	key, err := base64.StdEncoding.DecodeString(cfg.Mfa.EncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("the encryption key must be base64 encoded: %w", err)
+	}
+
+	if purpose == CipherTOTP {
+		return encryption.New(key)
+	}
+
+	return encryption.NewForPurpose(key, purpose)
+}
+
+// OpenRelyingParty creates the WebAuthn relying party, the origins
+// default to the HTTPS origin of the relying party ID
+func OpenRelyingParty(cfg Config) (*webauthn.RelyingParty, error) {
+	if cfg.WebAuthn.RPID == "" {
+		return nil, errors.New("a WebAuthn relying party ID is required")
+	}
+
+	origins := cfg.WebAuthn.Origins
+	if len(origins) == 0 {
+		origins = []string{"https://" + cfg.WebAuthn.RPID}
+	}
+
+	for _, origin := range origins {
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid WebAuthn origin %q", origin)
+		}
+		if u.Hostname() != cfg.WebAuthn.RPID && !strings.HasSuffix(u.Hostname(), "."+cfg.WebAuthn.RPID) {
+			return nil, fmt.Errorf("the WebAuthn origin %q isn't in the domain of %q", origin, cfg.WebAuthn.RPID)
+		}
+	}
+
+	rp := &webauthn.RelyingParty{
+		ID:      cfg.WebAuthn.RPID,
+		Name:    cfg.WebAuthn.RPName,
+		Origins: origins,
+	}
+
+	return rp, nil
+}
+
+// OpenLockout creates the limiter of the failed logins per account, the failures
+// are counted in the database on the "database" store, so they are shared by
+// the instances of the service, and per instance on the "memory" store
+func OpenLockout(cfg Config, db *sql.DB) (*lockout.Limiter, error) {
+	var store lockout.Store
+
+	// The failed logins are kept in the store of the service by default
+	name := cfg.Lockout.Store
+	if name == "" {
+		name = cfg.Store
+	}
+
+	switch name {
+	case "", "database", "postgres":
+		if db == nil {
+			return nil, fmt.Errorf("the %q lockout store requires a database, the store of the service is %q", name, cfg.Store)
+		}
+		store = lockout.NewPostgres(db)
+	case "memory":
+		store = lockout.NewMemory()
+	default:
+		return nil, fmt.Errorf("unsupported lockout store %q", name)
+	}
+
+	// A zero policy never slows down the logins
+	var policy lockout.Policy
+
+	if cfg.Lockout.Enabled {
+		policy = lockout.Policy{
+			Threshold: cfg.Lockout.Threshold,
+			Duration:  cfg.Lockout.Duration,
+			BaseDelay: cfg.Lockout.BaseDelay,
+			MaxDelay:  cfg.Lockout.MaxDelay,
+			Window:    cfg.Lockout.Window,
+		}
+	}
+
+	return lockout.New(store, policy), nil
+}
+
+// OpenIndexer creates the indexer sending the changes of the users
+// to the Solr collection of the URL, it is nil when it isn't enabled
+func OpenIndexer(cfg Config, logger *jsonlog.Logger) (*indexer.Indexer, error) {
+	if !cfg.Indexer.Enabled {
+		return nil, nil
+	}
+
+	u, err := url.Parse(cfg.Indexer.URL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid indexer URL %q", cfg.Indexer.URL)
+	}
+
+	ix := indexer.New(indexer.Config{
+		URL:           strings.TrimSuffix(cfg.Indexer.URL, "/"),
+		BatchSize:     cfg.Indexer.BatchSize,
+		FlushInterval: cfg.Indexer.FlushInterval,
+		QueueSize:     cfg.Indexer.QueueSize,
+		CommitWithin:  cfg.Indexer.CommitWithin,
+		Attempts:      cfg.Indexer.Attempts,
+		Backoff:       cfg.Indexer.Backoff,
+		Timeout:       cfg.Indexer.Timeout,
+	}, logger)
+
+	return ix, nil
+}
+
+// OpenBroker creates the broker of the events of the users, the events
+// are kept in the outbox until they are published, it is nil on "none"
+func OpenBroker(cfg Config) (events.Broker, error) {
+	switch cfg.Events.Broker {
+	case "", "none":
+		return nil, nil
+	case "webhook":
+		u, err := url.Parse(cfg.Events.WebhookURL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid events webhook URL %q", cfg.Events.WebhookURL)
+		}
+		return events.NewWebhook(cfg.Events.WebhookURL, cfg.Events.Timeout), nil
+	case "nats":
+		return events.NewNATS(cfg.Events.NatsURL, cfg.Events.NatsPrefix, cfg.Events.Timeout)
+	case "memory":
+		return events.NewMemory(), nil
+	default:
+		return nil, fmt.Errorf("unsupported events broker %q", cfg.Events.Broker)
+	}
+}
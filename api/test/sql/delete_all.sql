@@ -1 +1,12 @@
-DELETE FROM users;
\ No newline at end of file
+DELETE FROM user_audit_events;
+DELETE FROM user_exports;
+DELETE FROM users_roles;
+DELETE FROM login_failures;
+DELETE FROM webauthn_credentials;
+DELETE FROM recovery_codes;
+DELETE FROM user_totp;
+DELETE FROM tokens;
+DELETE FROM revoked_tokens;
+DELETE FROM refresh_tokens;
+DELETE FROM users;
+DELETE FROM user_purges;
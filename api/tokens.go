@@ -0,0 +1,418 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
+	"github.com/e-inwork-com/go-user-service/internal/validator"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+)
+
+// createAccessToken Function to create a short-lived JSON Web Token for the user
+func (app *Application) createAccessToken(user *data.User) (string, time.Time, error) {
+	// Set an expired time from the Config
+	issuedAt := time.Now()
+	expirationTime := issuedAt.Add(app.Config.Auth.AccessTokenTTL)
+
+	// Set the ID of the user in the Claim token,
+	// and an unique ID (jti) of the token to revoke it on logout
+	claims := &Claims{
+		ID: user.ID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+			ExpiresAt: jwt.NewNumericDate(expirationTime),
+		},
+	}
+
+	// Create a token signed with the active signing key
+	token, err := app.Keys.Sign(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return token, expirationTime, nil
+}
+
+// writeAuthenticationTokens Function to send an access token and a refresh token
+// that belongs to the given token family, the tokens are audited with the event type
+func (app *Application) writeAuthenticationTokens(w http.ResponseWriter, r *http.Request, user *data.User, familyID uuid.UUID, eventType string) {
+	// Create an access token
+	token, expiry, err := app.createAccessToken(user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Create and store a refresh token
+	refreshToken, err := app.Models.RefreshTokens.New(user.ID, familyID, app.Config.Auth.RefreshTokenTTL)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.audit(r, eventType, user.ID, &user.ID, "family "+familyID.String())
+
+	// Set response with the tokens
+	env := envelope{
+		"token":                   token,
+		"token_expiry_dt":         expiry,
+		"refresh_token":           refreshToken.Plaintext,
+		"refresh_token_expiry_dt": refreshToken.Expiry,
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// refreshAuthenticationTokenHandler Function to exchange a refresh token
+// for a new access token, the refresh token is rotated on every use
+func (app *Application) refreshAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	// The JSON should be match with define input
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Validate the refresh token
+	v := validator.New()
+	if data.ValidateRefreshTokenPlaintext(v, input.RefreshToken); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Get the refresh token from the database
+	refreshToken, err := app.Models.RefreshTokens.GetByPlaintext(input.RefreshToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidRefreshTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if refreshToken.Revoked || refreshToken.IsExpired() {
+		app.invalidRefreshTokenResponse(w, r)
+		return
+	}
+
+	// Mark the refresh token as used, a token that has been used
+	// before means it was stolen, so revoke the whole token family
+	if refreshToken.Used {
+		err = data.ErrRefreshTokenReused
+	} else {
+		err = app.Models.RefreshTokens.MarkUsed(refreshToken)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRefreshTokenReused):
+			app.revokeRefreshTokenFamily(w, r, refreshToken)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Get the owner of the refresh token
+	user, err := app.Models.Users.GetByID(r.Context(), refreshToken.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidRefreshTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Send the new tokens in the same token family
+	app.writeAuthenticationTokens(w, r, user, refreshToken.FamilyID, data.AuditTokenRefreshed)
+}
+
+// revokeRefreshTokenFamily Function to revoke every refresh token
+// issued from the same login after a reused refresh token is detected
+func (app *Application) revokeRefreshTokenFamily(w http.ResponseWriter, r *http.Request, refreshToken *data.RefreshToken) {
+	err := app.Models.RefreshTokens.RevokeFamily(refreshToken.FamilyID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.Logger.PrintInfo("refresh token reused, token family revoked", map[string]string{
+		"user_id":   refreshToken.UserID.String(),
+		"family_id": refreshToken.FamilyID.String(),
+	})
+
+	app.invalidRefreshTokenResponse(w, r)
+}
+
+// logoutHandler Function to revoke the current access token,
+// and the refresh token family of the login if it is sent
+func (app *Application) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	claims := app.contextGetClaims(r)
+
+	var input struct {
+		RefreshToken *string `json:"refresh_token"`
+	}
+
+	// The body is optional
+	if r.ContentLength != 0 {
+		err := app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+
+	// Revoke the refresh token family of the same user
+	if input.RefreshToken != nil {
+		refreshToken, err := app.Models.RefreshTokens.GetByPlaintext(*input.RefreshToken)
+		if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if refreshToken != nil && refreshToken.UserID == user.ID {
+			err = app.Models.RefreshTokens.RevokeFamily(refreshToken.FamilyID)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+	}
+
+	// Revoke the access token until it expires
+	err := app.Models.RevokedTokens.Insert(claims.RegisteredClaims.ID, user.ID, claims.ExpiresAt.Time)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Clean up the revoked tokens that are expired
+	app.background(func() {
+		err := app.Models.RevokedTokens.DeleteExpired()
+		if err != nil {
+			app.Logger.PrintError(err, nil)
+		}
+	})
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "you have been logged out"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// logoutAllHandler Function to revoke every token of the current user
+func (app *Application) logoutAllHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	// Reject every access token issued until now
+	user.RevokeTokens()
+
+	err := app.Models.Users.Update(r.Context(), user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Remove every refresh token of the user
+	err = app.Models.RefreshTokens.DeleteAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "you have been logged out from every session"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// jwksHandler Function to publish the public keys that verify the tokens
+func (app *Application) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	headers := make(http.Header)
+	headers.Set("Cache-Control", "public, max-age=300")
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"keys": app.Keys.JWKS()}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createActivationTokenHandler Function to send a new activation token,
+// the response is the same whether the email exists or not
+func (app *Application) createActivationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email_t"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	env := envelope{"message": "an email will be sent to you containing activation instructions if the account needs to be activated"}
+
+	user, err := app.Models.Users.GetByEmail(r.Context(), input.Email)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if user != nil && !user.Activated {
+		// Replace the previous activation tokens
+		err = app.Models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		token, err := app.Models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		app.sendEmail(user.Email, "user_activation.tmpl", map[string]interface{}{
+			"activationToken": token.Plaintext,
+			"firstName":       user.FirstName,
+		})
+	}
+
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createPasswordResetTokenHandler Function to send a password reset token,
+// the response is the same whether the email exists or not
+func (app *Application) createPasswordResetTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email_t"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	env := envelope{"message": "an email will be sent to you containing password reset instructions if the account exists"}
+
+	user, err := app.Models.Users.GetByEmail(r.Context(), input.Email)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if user != nil {
+		token, err := app.Models.Tokens.New(user.ID, 45*time.Minute, data.ScopePasswordReset)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		app.sendEmail(user.Email, "user_password_reset.tmpl", map[string]interface{}{
+			"passwordResetToken": token.Plaintext,
+			"firstName":          user.FirstName,
+		})
+	}
+
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// sealedClaims are the claims of an opaque token sealed by sealToken. The tokens
+// that aren't access tokens are sealed instead of signed, so the services that
+// verify the access tokens with the JWKS can't take them for access tokens
+type sealedClaims struct {
+	ID     string    `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+	Scope  string    `json:"scope"`
+
+	// Subject is the ID of the export of a download link
+	Subject string `json:"subject,omitempty"`
+
+	// Challenge is the WebAuthn challenge of a ceremony token
+	Challenge string `json:"challenge,omitempty"`
+
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// sealToken Function to encrypt the claims in an opaque token, the token
+// can't be read by the client or verified as a JSON Web Token
+func (app *Application) sealToken(claims *sealedClaims) (string, error) {
+	plaintext, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	ciphertext, err := app.SessionCipher.Encrypt(plaintext)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(ciphertext), nil
+}
+
+// openToken Function to decrypt a token sealed by sealToken,
+// it returns false if the token is invalid, expired or of another scope
+func (app *Application) openToken(token string, scope string) (*sealedClaims, bool) {
+	ciphertext, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, false
+	}
+
+	plaintext, err := app.SessionCipher.Decrypt(ciphertext)
+	if err != nil {
+		return nil, false
+	}
+
+	claims := &sealedClaims{}
+
+	err = json.Unmarshal(plaintext, claims)
+	if err != nil || claims.Scope != scope || time.Now().After(claims.ExpiresAt) {
+		return nil, false
+	}
+
+	return claims, true
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"errors"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/e-inwork-com/go-user-service/internal/data"
@@ -14,9 +15,17 @@ import (
 // Claims define a claim of JSON Web Token
 type Claims struct {
 	ID uuid.UUID `json:"id"`
+
+	// Scope limits the use of the token, an access token doesn't have a scope
+	Scope string `json:"scope,omitempty"`
+
 	jwt.RegisteredClaims
 }
 
+// ScopeMFA is the scope of a sealed token that proves the password was checked,
+// and that is exchanged with a second factor for an access token
+const ScopeMFA = "mfa"
+
 func (app *Application) registerUserHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
 		Email     string `json:"email_t"`
@@ -35,7 +44,7 @@ func (app *Application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		Email:     input.Email,
 		FirstName: input.FirstName,
 		LastName:  input.LastName,
-		Activated: true,
+		Activated: false,
 	}
 
 	err = user.Password.Set(input.Password)
@@ -51,7 +60,7 @@ func (app *Application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = app.Models.Users.Insert(user)
+	err = app.Models.Users.Insert(r.Context(), user)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrDuplicateEmail):
@@ -63,19 +72,172 @@ func (app *Application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	// Create an activation token that expires in 3 days
+	token, err := app.Models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Send the activation token in the background
+	app.sendEmail(user.Email, "user_welcome.tmpl", map[string]interface{}{
+		"activationToken": token.Plaintext,
+		"firstName":       user.FirstName,
+	})
+
 	err = app.writeJSON(w, http.StatusCreated, envelope{"user": user}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
+// activateUserHandler Function to activate a User with an activation token
+func (app *Application) activateUserHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Validate the token
+	v := validator.New()
+
+	if data.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Get the user of the token
+	user, err := app.Models.Users.GetForToken(r.Context(), data.ScopeActivation, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired activation token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Activate the User
+	user.Activated = true
+
+	err = app.Models.Users.Update(r.Context(), user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The activation tokens are single-use
+	err = app.Models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.audit(r, data.AuditUserActivated, user.ID, &user.ID, "")
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateUserPasswordHandler Function to set a new password with a password reset token
+func (app *Application) updateUserPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Password       string `json:"password"`
+		TokenPlaintext string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Validate the new password and the token
+	v := validator.New()
+
+	data.ValidatePasswordPlaintext(v, input.Password)
+	data.ValidateTokenPlaintext(v, input.TokenPlaintext)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Get the user of the token
+	user, err := app.Models.Users.GetForToken(r.Context(), data.ScopePasswordReset, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired password reset token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Set the new password, and log out the existing sessions
+	err = user.Password.Set(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	user.RevokeTokens()
+
+	err = app.Models.Users.Update(r.Context(), user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The password reset tokens are single-use
+	err = app.Models.Tokens.DeleteAllForUser(data.ScopePasswordReset, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.Models.RefreshTokens.DeleteAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.audit(r, data.AuditPasswordChanged, user.ID, &user.ID, "reset")
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "your password was successfully reset"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
 // getUserHandler Function to get a current User
 func (app *Application) getUserHandler(w http.ResponseWriter, r *http.Request) {
 	// Get the current user as the owner of the Profile
 	owner := app.contextGetUser(r)
 
 	// Get user by ID
-	user, err := app.Models.Users.GetByID(owner.ID)
+	user, err := app.Models.Users.GetByID(r.Context(), owner.ID)
 
 	// Check error
 	if err != nil {
@@ -105,7 +267,7 @@ func (app *Application) patchUserHandler(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Get User from the database
-	user, err := app.Models.Users.GetByID(id)
+	user, err := app.Models.Users.GetByID(r.Context(), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -116,22 +278,17 @@ func (app *Application) patchUserHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Get the current user
+	// Get the current user, the owner of the User
+	// or a user with the "users:write" permission
 	owner := app.contextGetUser(r)
 
-	// Check if the User has a related to the owner
-	// Only the Owner of the User can update the own User
-	if user.ID != owner.ID {
-		app.notPermittedResponse(w, r)
-		return
-	}
-
 	// User input
 	var input struct {
-		Email     *string `json:"email_t"`
-		Password  *string `json:"password"`
-		FirstName *string `json:"first_name_t"`
-		LastName  *string `json:"last_name_t"`
+		Email           *string `json:"email_t"`
+		Password        *string `json:"password"`
+		CurrentPassword *string `json:"current_password"`
+		FirstName       *string `json:"first_name_t"`
+		LastName        *string `json:"last_name_t"`
 	}
 
 	// Read JSON from input
@@ -141,18 +298,56 @@ func (app *Application) patchUserHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Assign input email if exist
-	if input.Email != nil {
-		user.Email = *input.Email
+	// Create a Validator
+	v := validator.New()
+
+	// Changing the email or the password requires the current password,
+	// so a stolen token isn't enough to take over the account,
+	// an administrator changes them without the password of the user
+	emailChanged := input.Email != nil && data.CanonicalEmail(*input.Email) != data.CanonicalEmail(user.Email)
+
+	if (emailChanged || input.Password != nil) && user.ID == owner.ID {
+		if input.CurrentPassword == nil || *input.CurrentPassword == "" {
+			v.AddError("current_password", "must be provided to change the email or the password")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		if !app.confirmPassword(w, r, user, *input.CurrentPassword, "current_password") {
+			return
+		}
+	}
+
+	// Keep the new email pending until it is confirmed
+	if emailChanged {
+		if data.ValidateEmail(v, *input.Email); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		_, err = app.Models.Users.GetByEmail(r.Context(), *input.Email)
+		if err == nil {
+			v.AddError("email_t", "a user with this email address already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+		if !errors.Is(err, data.ErrRecordNotFound) {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		user.PendingEmail = *input.Email
 	}
 
-	// Assign input password if exist
+	// Assign input password if exist,
+	// and revoke the tokens issued with the old password
 	if input.Password != nil {
 		err = user.Password.Set(*input.Password)
 		if err != nil {
 			app.serverErrorResponse(w, r, err)
 			return
 		}
+		user.RevokeTokens()
 	}
 
 	// Assign input FirstName if exist
@@ -165,9 +360,6 @@ func (app *Application) patchUserHandler(w http.ResponseWriter, r *http.Request)
 		user.LastName = *input.LastName
 	}
 
-	// Create a Validator
-	v := validator.New()
-
 	// Check if the Profile is valid
 	if data.ValidateUser(v, user); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
@@ -175,7 +367,7 @@ func (app *Application) patchUserHandler(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Update the User
-	err = app.Models.Users.Update(user)
+	err = app.Models.Users.Update(r.Context(), user)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
@@ -186,6 +378,45 @@ func (app *Application) patchUserHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// Remove the refresh tokens issued with the old password
+	if input.Password != nil {
+		err = app.Models.RefreshTokens.DeleteAllForUser(user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		app.audit(r, data.AuditPasswordChanged, user.ID, &owner.ID, "")
+	}
+
+	// Send a confirmation token to the new email,
+	// and let the owner of the current email know about the change
+	if emailChanged {
+		err = app.Models.Tokens.DeleteAllForUser(data.ScopeEmailChange, user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		token, err := app.Models.Tokens.New(user.ID, 24*time.Hour, data.ScopeEmailChange)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		app.sendEmail(user.PendingEmail, "user_email_change.tmpl", map[string]interface{}{
+			"emailChangeToken": token.Plaintext,
+			"firstName":        user.FirstName,
+		})
+
+		app.sendEmail(user.Email, "user_email_change_notice.tmpl", map[string]interface{}{
+			"firstName":    user.FirstName,
+			"pendingEmail": user.PendingEmail,
+		})
+
+		app.audit(r, data.AuditEmailRequested, user.ID, &owner.ID, user.PendingEmail)
+	}
+
 	// Send back the User to the request response
 	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
 	if err != nil {
@@ -193,6 +424,88 @@ func (app *Application) patchUserHandler(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// confirmUserEmailHandler Function to replace the email
+// with the pending email after it is confirmed with a token
+func (app *Application) confirmUserEmailHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Validate the token
+	v := validator.New()
+
+	if data.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Get the user of the token
+	user, err := app.Models.Users.GetForToken(r.Context(), data.ScopeEmailChange, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired email change token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if user.PendingEmail == "" {
+		v.AddError("token", "invalid or expired email change token")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Replace the email, and revoke the tokens issued with the old email
+	previousEmail := user.Email
+
+	user.Email = user.PendingEmail
+	user.PendingEmail = ""
+	user.RevokeTokens()
+
+	err = app.Models.Users.Update(r.Context(), user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateEmail):
+			v.AddError("email_t", "a user with this email address already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The email change tokens are single-use
+	err = app.Models.Tokens.DeleteAllForUser(data.ScopeEmailChange, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.Models.RefreshTokens.DeleteAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.audit(r, data.AuditEmailChanged, user.ID, &user.ID, previousEmail+" -> "+user.Email)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
 // Func to create a JSON Web Token
 func (app *Application) createAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
 	// Sign  in with email & password
@@ -218,12 +531,26 @@ func (app *Application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 
+	// Slow down the password guesses on the account, an email
+	// that doesn't exist is slowed down the same way. The login
+	// is counted as a failure until the password is checked
+	wait, err := app.Lockout.Attempt(input.Email)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if wait > 0 {
+		app.tooManyLoginAttemptsResponse(w, r, wait)
+		return
+	}
+
 	// Get the user by the input email
-	user, err := app.Models.Users.GetByEmail(input.Email)
+	user, err := app.Models.Users.GetByEmail(r.Context(), input.Email)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
-			app.invalidCredentialsResponse(w, r)
+			data.DummyPasswordMatches(input.Password)
+			app.failedLoginResponse(w, r, input.Email, nil)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
@@ -238,34 +565,471 @@ func (app *Application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 	if !match {
-		app.invalidCredentialsResponse(w, r)
+		app.failedLoginResponse(w, r, input.Email, user)
+		return
+	}
+
+	// Ask for a second factor if the user enabled it, the failed
+	// logins are only forgotten once the second factor is checked
+	totp, err := app.Models.TOTP.GetByUserID(user.ID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	// Set Signing Key from the Config Environment
-	signingKey := []byte(app.Config.Auth.Secret)
+	if totp != nil && totp.Enabled {
+		err = app.Lockout.Release(input.Email)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		app.writeMFAToken(w, r, user)
+		return
+	}
+
+	// Forget the failed logins of the account
+	err = app.Lockout.Reset(input.Email)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 
-	// Set an expired time for a week
-	expirationTime := time.Now().Add((24 * 7) * time.Hour)
+	app.audit(r, data.AuditLoginSucceeded, user.ID, &user.ID, "password")
+
+	// Send an access token with a refresh token of a new token family
+	app.writeAuthenticationTokens(w, r, user, uuid.New(), data.AuditTokenIssued)
+}
+
+// failedLoginResponse Function to audit a failed login for the user if the account
+// exists, the response is the same either way. The failure was already counted
+// by the attempt of the email
+func (app *Application) failedLoginResponse(w http.ResponseWriter, r *http.Request, email string, user *data.User) {
+	if user != nil {
+		app.audit(r, data.AuditLoginFailed, user.ID, nil, "password")
+	}
 
-	// Set the ID of the user in the Claim token
-	claims := &Claims{
-		ID: user.ID,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-		},
+	app.invalidCredentialsResponse(w, r)
+}
+
+// confirmPassword Function to check the password of the user before a sensitive change,
+// the guesses count against the same lockout as the logins. It sends the response and
+// returns false if the password is locked out or incorrect
+func (app *Application) confirmPassword(w http.ResponseWriter, r *http.Request, user *data.User, password string, key string) bool {
+	wait, err := app.Lockout.Attempt(user.Email)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+	if wait > 0 {
+		app.tooManyLoginAttemptsResponse(w, r, wait)
+		return false
+	}
+
+	match, err := user.Password.Matches(password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+	if !match {
+		v := validator.New()
+		v.AddError(key, "is incorrect")
+		app.failedValidationResponse(w, r, v.Errors)
+		return false
+	}
+
+	// The confirmation isn't a login, so it only gives back its attempt
+	err = app.Lockout.Release(user.Email)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	return true
+}
+
+// getUserByIDHandler Function to get a user by the ID param,
+// for the owner or a user with the "users:read" permission
+func (app *Application) getUserByIDHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user, err := app.Models.Users.GetByID(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deactivateUserHandler Function to deactivate a user, and to revoke
+// the tokens of the user, it requires the "users:admin" permission
+func (app *Application) deactivateUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user, err := app.Models.Users.GetByID(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user.Activated = false
+	user.RevokeTokens()
+
+	err = app.Models.Users.Update(r.Context(), user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.Models.RefreshTokens.DeleteAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	admin := app.contextGetUser(r)
+	app.audit(r, data.AuditUserDeactivated, user.ID, &admin.ID, "")
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteUserHandler Function to delete a user, the owner confirms it with the password
+// or a user with the "users:admin" permission deletes it. The user is restored
+// during the grace period, then it is purged with the related records
+func (app *Application) deleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user, err := app.Models.Users.GetByID(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The owner confirms the deletion with the password,
+	// so a stolen token isn't enough to delete the account
+	owner := app.contextGetUser(r)
+
+	if user.ID == owner.ID {
+		var input struct {
+			Password string `json:"password"`
+		}
+
+		err = app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		v := validator.New()
+
+		if input.Password == "" {
+			v.AddError("password", "must be provided to delete the user")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		if !app.confirmPassword(w, r, user, input.Password, "password") {
+			return
+		}
+	}
+
+	err = app.Models.Users.Delete(r.Context(), user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, data.AuditUserDeleted, user.ID, &owner.ID, "")
+
+	// Send a token to the owner to restore the user during the grace period
+	if user.ID == owner.ID {
+		token, err := app.Models.Tokens.New(user.ID, app.Config.Deletion.GracePeriod, data.ScopeRestore)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		app.sendEmail(user.Email, "user_restore.tmpl", map[string]interface{}{
+			"firstName":    user.FirstName,
+			"restoreToken": token.Plaintext,
+			"gracePeriod":  app.Config.Deletion.GracePeriod.String(),
+		})
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "user successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// restoreUserHandler Function to restore a deleted user with a restore token,
+// during the grace period of the deletion
+func (app *Application) restoreUserHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Get the deleted user of the token
+	user, err := app.Models.Users.GetForToken(r.Context(), data.ScopeRestore, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired restore token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user, err = app.Models.Users.Restore(r.Context(), user.ID, time.Now().Add(-app.Config.Deletion.GracePeriod))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired restore token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The restore tokens are single-use
+	err = app.Models.Tokens.DeleteAllForUser(data.ScopeRestore, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.audit(r, data.AuditUserRestored, user.ID, &user.ID, "")
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// restoreUserByIDHandler Function to restore a deleted user during the grace period,
+// it requires the "users:admin" permission
+func (app *Application) restoreUserByIDHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user, err := app.Models.Users.Restore(r.Context(), id, time.Now().Add(-app.Config.Deletion.GracePeriod))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.Models.Tokens.DeleteAllForUser(data.ScopeRestore, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	admin := app.contextGetUser(r)
+	app.audit(r, data.AuditUserRestored, user.ID, &admin.ID, "")
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// unlockUserHandler Function to forget the failed logins of a user,
+// it requires the "users:admin" permission
+func (app *Application) unlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user, err := app.Models.Users.GetByID(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.Lockout.Reset(user.Email)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "user successfully unlocked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listUsersHandler Function to list the users with filters, it requires
+// the "users:read" permission. The users are paginated with pages, or with
+// cursors on "pagination=cursor" so a page of a large table is read with an index
+func (app *Application) listUsersHandler(w http.ResponseWriter, r *http.Request) {
+	var input data.UserFilters
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Email = app.readString(qs, "email_t", "")
+	input.Name = app.readString(qs, "name", "")
+	input.Activated = app.readBool(qs, "activated_b", v)
+	input.CreatedAfter = app.readTime(qs, "created_after_dt", v)
+	input.CreatedBefore = app.readTime(qs, "created_before_dt", v)
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "created_at_dt")
+	input.Filters.SortSafelist = data.UserSortSafelist
+
+	pagination := app.readString(qs, "pagination", "page")
+	v.Check(validator.In(pagination, "page", "cursor"), "pagination", "must be page or cursor")
+
+	// A cursor is only sent in the cursor mode
+	if cursor := app.readString(qs, "cursor", ""); cursor != "" {
+		input.Filters.Cursor, _ = data.DecodeCursor(cursor)
+		v.Check(input.Filters.Cursor != nil, "cursor", "invalid cursor")
+		pagination = "cursor"
+	}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	var users []*data.User
+	var metadata data.Metadata
+	var err error
+
+	switch pagination {
+	case "cursor":
+		users, metadata, err = app.Models.Users.GetAllAfter(r.Context(), input)
+	default:
+		users, metadata, err = app.Models.Users.GetAll(r.Context(), input)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidCursor):
+			v.AddError("cursor", "invalid cursor")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"users": users, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// searchUsersHandler Function to search the users by a partial or misspelled
+// name or email, it requires the "users:read" permission. The users are ordered
+// by the relevance score of the match
+func (app *Application) searchUsersHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Query string
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Query = strings.TrimSpace(app.readString(qs, "q", ""))
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-score")
+	input.Filters.SortSafelist = data.UserSearchSortSafelist
+
+	data.ValidateSearchQuery(v, input.Query)
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
 	}
 
-	// Create a signed token
-	signed := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	token, err := signed.SignedString(signingKey)
+	users, metadata, err := app.Models.Search.Search(r.Context(), input.Query, input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	// Set response with a token
-	err = app.writeJSON(w, http.StatusOK, envelope{"token": token}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"users": users, "metadata": metadata}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -0,0 +1,431 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
+	"github.com/e-inwork-com/go-user-service/internal/validator"
+	"github.com/e-inwork-com/go-user-service/internal/webauthn"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+)
+
+// The scopes of the tokens that keep the challenge of a WebAuthn ceremony
+// between the options and the response of the authenticator
+const (
+	ScopeWebAuthnRegistration = "webauthn-registration"
+	ScopeWebAuthnLogin        = "webauthn-login"
+)
+
+// webAuthnCredential is the JSON form of a credential,
+// the ID is base64url encoded as in the WebAuthn API
+type webAuthnCredential struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name_t"`
+	CreatedAt  time.Time  `json:"created_at_dt"`
+	LastUsedAt *time.Time `json:"last_used_at_dt,omitempty"`
+	Transports []string   `json:"transports"`
+}
+
+func newWebAuthnCredential(credential *data.WebAuthnCredential) webAuthnCredential {
+	return webAuthnCredential{
+		ID:         webauthn.EncodeID(credential.ID),
+		Name:       credential.Name,
+		CreatedAt:  credential.CreatedAt,
+		LastUsedAt: credential.LastUsedAt,
+		Transports: credential.Transports,
+	}
+}
+
+func toWebAuthnCredentials(credentials []*data.WebAuthnCredential) []webauthn.Credential {
+	list := make([]webauthn.Credential, 0, len(credentials))
+
+	for _, credential := range credentials {
+		list = append(list, webauthn.Credential{ID: credential.ID, Transports: credential.Transports})
+	}
+
+	return list
+}
+
+// createWebAuthnSessionToken Function to seal the challenge of a ceremony
+// in a short-lived opaque token, so no session is stored on the server
+// and the user of the ceremony isn't disclosed to the client.
+// The user is nil for a login without an email
+func (app *Application) createWebAuthnSessionToken(userID uuid.UUID, scope string, challenge string) (string, error) {
+	issuedAt := time.Now()
+
+	session := &sealedClaims{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		Scope:     scope,
+		Challenge: challenge,
+		IssuedAt:  issuedAt,
+		ExpiresAt: issuedAt.Add(webauthn.Timeout),
+	}
+
+	return app.sealToken(session)
+}
+
+// readWebAuthnSessionToken Function to open a ceremony token,
+// it returns false if the token is invalid, expired or was already used
+func (app *Application) readWebAuthnSessionToken(sessionToken string, scope string) (*sealedClaims, bool, error) {
+	session, ok := app.openToken(sessionToken, scope)
+	if !ok || session.Challenge == "" {
+		return nil, false, nil
+	}
+
+	revoked, err := app.Models.RevokedTokens.Exists(session.ID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return session, !revoked, nil
+}
+
+// createWebAuthnRegistrationHandler Function to start the registration
+// of a passkey or a security key for the current user
+func (app *Application) createWebAuthnRegistrationHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Exclude the credentials of the user, so an authenticator isn't registered twice
+	credentials, err := app.Models.WebAuthn.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	entity := webauthn.User{
+		ID:          user.ID[:],
+		Name:        user.Email,
+		DisplayName: user.FirstName + " " + user.LastName,
+	}
+
+	options := app.WebAuthn.CreationOptions(challenge, entity, toWebAuthnCredentials(credentials))
+
+	sessionToken, err := app.createWebAuthnSessionToken(user.ID, ScopeWebAuthnRegistration, challenge)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"public_key": options, "session_token": sessionToken}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// finishWebAuthnRegistrationHandler Function to verify the new credential
+// created by the authenticator, and to store it for the current user
+func (app *Application) finishWebAuthnRegistrationHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		SessionToken string                         `json:"session_token"`
+		Name         string                         `json:"name_t"`
+		Credential   *webauthn.RegistrationResponse `json:"credential"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.SessionToken != "", "session_token", "must be provided")
+	v.Check(input.Credential != nil, "credential", "must be provided")
+	v.Check(len(input.Name) <= 100, "name_t", "must not be more than 100 bytes long")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	session, ok, err := app.readWebAuthnSessionToken(input.SessionToken, ScopeWebAuthnRegistration)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !ok || session.UserID != user.ID {
+		v.AddError("session_token", "invalid, expired or already used session token")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	verified, err := app.WebAuthn.VerifyRegistration(session.Challenge, input.Credential)
+	if err != nil {
+		v.AddError("credential", err.Error())
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if input.Name == "" {
+		input.Name = "Passkey"
+	}
+
+	credential := &data.WebAuthnCredential{
+		ID:         verified.ID,
+		UserID:     user.ID,
+		Name:       input.Name,
+		PublicKey:  verified.PublicKey,
+		SignCount:  verified.SignCount,
+		AAGUID:     verified.AAGUID,
+		Transports: verified.Transports,
+	}
+
+	err = app.Models.WebAuthn.Insert(credential)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateCredential):
+			v.AddError("credential", "this credential is already registered")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The challenge can only be used once
+	err = app.Models.RevokedTokens.Insert(session.ID, user.ID, session.ExpiresAt)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"credential": newWebAuthnCredential(credential)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listWebAuthnCredentialsHandler Function to list the credentials of the current user
+func (app *Application) listWebAuthnCredentialsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	credentials, err := app.Models.WebAuthn.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	list := make([]webAuthnCredential, 0, len(credentials))
+	for _, credential := range credentials {
+		list = append(list, newWebAuthnCredential(credential))
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"credentials": list}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteWebAuthnCredentialHandler Function to remove a credential of the current user
+func (app *Application) deleteWebAuthnCredentialHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	id, err := webauthn.DecodeID(httprouter.ParamsFromContext(r.Context()).ByName("id"))
+	if err != nil || len(id) == 0 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.Models.WebAuthn.Delete(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "credential successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createWebAuthnLoginHandler Function to start a sign in with a passkey,
+// with an email the authenticator is asked for the credentials of the user,
+// without an email it offers its discoverable credentials
+func (app *Application) createWebAuthnLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email_t"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	userID := uuid.Nil
+	var allow []webauthn.Credential
+
+	if input.Email != "" {
+		v := validator.New()
+
+		if data.ValidateEmail(v, input.Email); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		// An unknown email gets the same response as a user without credentials,
+		// the user isn't disclosed by the opaque session token
+		user, err := app.Models.Users.GetByEmail(r.Context(), input.Email)
+		if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if user != nil {
+			credentials, err := app.Models.WebAuthn.GetAllForUser(user.ID)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			userID = user.ID
+			allow = toWebAuthnCredentials(credentials)
+		}
+	}
+
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	sessionToken, err := app.createWebAuthnSessionToken(userID, ScopeWebAuthnLogin, challenge)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	options := app.WebAuthn.RequestOptions(challenge, allow)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"public_key": options, "session_token": sessionToken}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// finishWebAuthnLoginHandler Function to verify the assertion of the authenticator,
+// and to send the same tokens as a sign in with a password
+func (app *Application) finishWebAuthnLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		SessionToken string                      `json:"session_token"`
+		Credential   *webauthn.AssertionResponse `json:"credential"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.SessionToken != "", "session_token", "must be provided")
+	v.Check(input.Credential != nil, "credential", "must be provided")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	session, ok, err := app.readWebAuthnSessionToken(input.SessionToken, ScopeWebAuthnLogin)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !ok {
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	credentialID, err := webauthn.DecodeID(input.Credential.RawID)
+	if err != nil {
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	credential, err := app.Models.WebAuthn.GetByID(credentialID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidCredentialsResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// A ceremony started with an email only accepts the credentials of that user
+	if session.UserID != uuid.Nil && session.UserID != credential.UserID {
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	assertion, err := app.WebAuthn.VerifyAssertion(session.Challenge, credential.PublicKey, input.Credential)
+	if err != nil {
+		app.audit(r, data.AuditLoginFailed, credential.UserID, nil, "webauthn")
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	if len(assertion.UserHandle) > 0 && !bytes.Equal(assertion.UserHandle, credential.UserID[:]) {
+		app.audit(r, data.AuditLoginFailed, credential.UserID, nil, "webauthn")
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	ok, err = app.Models.WebAuthn.UseSignCount(credential, assertion.SignCount)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !ok {
+		app.Logger.PrintInfo("webauthn sign count didn't increase, the authenticator may be cloned", map[string]string{
+			"credential_id": webauthn.EncodeID(credential.ID),
+			"user_id":       credential.UserID.String(),
+		})
+		app.audit(r, data.AuditLoginFailed, credential.UserID, nil, "webauthn")
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	user, err := app.Models.Users.GetByID(r.Context(), credential.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidCredentialsResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The challenge can only be used once
+	err = app.Models.RevokedTokens.Insert(session.ID, user.ID, session.ExpiresAt)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.audit(r, data.AuditLoginSucceeded, user.ID, &user.ID, "webauthn")
+
+	// Send an access token with a refresh token of a new token family
+	app.writeAuthenticationTokens(w, r, user, uuid.New(), data.AuditTokenIssued)
+}
@@ -0,0 +1,311 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
+	"github.com/e-inwork-com/go-user-service/internal/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+// generateWebhookSecret returns a random secret to sign the deliveries
+func generateWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func validateWebhookSecret(v *validator.Validator, secret string) {
+	v.Check(len(secret) >= 16, "secret_t", "must be at least 16 bytes long")
+	v.Check(len(secret) <= 256, "secret_t", "must not be more than 256 bytes long")
+}
+
+// readWebhook Function to get the subscription of the ID param,
+// it sends the error response when the subscription isn't found
+func (app *Application) readWebhook(w http.ResponseWriter, r *http.Request) (*data.WebhookSubscription, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	subscription, err := app.Models.Webhooks.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return subscription, true
+}
+
+// createWebhookHandler Function to subscribe a URL to the events of the users,
+// the secret signing the deliveries is generated when it isn't sent, and it is
+// only shown in the response
+func (app *Application) createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		URL    string   `json:"url_t"`
+		Events []string `json:"events"`
+		Secret string   `json:"secret_t"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	subscription := &data.WebhookSubscription{
+		URL:    input.URL,
+		Events: input.Events,
+		Active: true,
+	}
+
+	v := validator.New()
+
+	if data.ValidateWebhookSubscription(v, subscription); input.Secret != "" {
+		validateWebhookSecret(v, input.Secret)
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	secret := input.Secret
+	if secret == "" {
+		secret, err = generateWebhookSecret()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	subscription.Secret, err = app.WebhookCipher.Encrypt([]byte(secret))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.Models.Webhooks.Insert(subscription)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/service/users/webhooks/%s", subscription.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"webhook": subscription, "secret_t": secret}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listWebhooksHandler Function to list the webhook subscriptions
+func (app *Application) listWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	subscriptions, err := app.Models.Webhooks.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"webhooks": subscriptions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getWebhookHandler Function to get a webhook subscription
+func (app *Application) getWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	subscription, ok := app.readWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"webhook": subscription}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateWebhookHandler Function to change the URL, the event types, or the secret
+// of a webhook subscription, or to pause it with "active_b"
+func (app *Application) updateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	subscription, ok := app.readWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		URL    *string  `json:"url_t"`
+		Events []string `json:"events"`
+		Active *bool    `json:"active_b"`
+		Secret *string  `json:"secret_t"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.URL != nil {
+		subscription.URL = *input.URL
+	}
+	if input.Events != nil {
+		subscription.Events = input.Events
+	}
+	if input.Active != nil {
+		subscription.Active = *input.Active
+	}
+
+	v := validator.New()
+
+	if data.ValidateWebhookSubscription(v, subscription); input.Secret != nil {
+		validateWebhookSecret(v, *input.Secret)
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The pending deliveries are signed with the new secret
+	if input.Secret != nil {
+		subscription.Secret, err = app.WebhookCipher.Encrypt([]byte(*input.Secret))
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.Models.Webhooks.Update(subscription)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"webhook": subscription}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteWebhookHandler Function to remove a webhook subscription with its deliveries
+func (app *Application) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.Models.Webhooks.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "webhook successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listWebhookDeliveriesHandler Function to list the deliveries of a webhook subscription,
+// the latest first, filtered by the "status_t" pending, succeeded or dead
+func (app *Application) listWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	subscription, ok := app.readWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Status string
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Status = app.readString(qs, "status_t", "")
+	v.Check(validator.In(input.Status, "", data.WebhookDeliveryPending, data.WebhookDeliverySucceeded, data.WebhookDeliveryDead), "status_t", "must be pending, succeeded or dead")
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-id")
+	input.Filters.SortSafelist = []string{"-id"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	deliveries, metadata, err := app.Models.WebhookDeliveries.GetAllForSubscription(subscription.ID, input.Status, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"deliveries": deliveries, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// replayWebhookDeliveryHandler Function to send a delivery again from the first attempt,
+// like a dead delivery after the webhook is fixed
+func (app *Application) replayWebhookDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+	subscriptionID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	deliveryID, err := strconv.ParseInt(httprouter.ParamsFromContext(r.Context()).ByName("delivery_id"), 10, 64)
+	if err != nil || deliveryID < 1 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.Models.WebhookDeliveries.Replay(subscriptionID, deliveryID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"message": "the delivery will be sent again"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
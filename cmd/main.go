@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"expvar"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
@@ -29,17 +32,86 @@ func main() {
 	// Read environment  from a command line and OS
 	flag.IntVar(&cfg.Port, "port", 4001, "API server port")
 	flag.StringVar(&cfg.Env, "env", "development", "Environment (development|staging|production)")
-	flag.StringVar(&cfg.Db.Dsn, "db-dsn", os.Getenv("DBDSN"), "Database DSN")
+	flag.StringVar(&cfg.Store, "store", "database", "Store of the data (database|memory), the data in memory is lost on exit")
+	flag.StringVar(&cfg.Db.Dsn, "db-dsn", os.Getenv("DBDSN"), "Database DSN, a Postgres DSN or sqlite:<path> for a SQLite file")
 	flag.StringVar(&cfg.Auth.Secret, "auth-secret", os.Getenv("AUTHSECRET"), "Authentication Secret")
+	flag.StringVar(&cfg.Auth.SigningMethod, "auth-signing-method", "HS256", "Token signing method (HS256|RS256|EdDSA)")
+	flag.StringVar(&cfg.Auth.SigningKeyFile, "auth-signing-key", os.Getenv("AUTHSIGNINGKEY"), "PEM private key file to sign tokens with RS256 or EdDSA")
+	verificationKeys := flag.String("auth-verification-keys", os.Getenv("AUTHVERIFICATIONKEYS"), "Additional PEM key files to verify tokens (space separated)")
+	flag.DurationVar(&cfg.Auth.AccessTokenTTL, "auth-access-token-ttl", 15*time.Minute, "Access token lifetime")
+	flag.DurationVar(&cfg.Auth.RefreshTokenTTL, "auth-refresh-token-ttl", 7*24*time.Hour, "Refresh token lifetime")
 	flag.IntVar(&cfg.Db.MaxOpenConn, "db-max-open-conn", 25, "Database max open connections")
 	flag.IntVar(&cfg.Db.MaxIdleConn, "db-max-idle-conn", 25, "Database max idle connections")
 	flag.StringVar(&cfg.Db.MaxIdleTime, "db-max-idle-time", "15m", "Database max connection idle time")
+	flag.DurationVar(&cfg.Db.QueryTimeout, "db-query-timeout", 3*time.Second, "Database timeout of the queries of the users")
+	flag.BoolVar(&cfg.Db.AutoMigrate, "auto-migrate", false, "Apply the migrations of the database on startup")
+	flag.BoolVar(&cfg.Users.CaseSensitiveEmails, "email-case-sensitive", false, "Keep the case of the local part of the emails in the identity of the users, it is case-insensitive by default")
+	flag.StringVar(&cfg.Mfa.EncryptionKey, "mfa-encryption-key", os.Getenv("MFAENCRYPTIONKEY"), "Base64 encoded 32 bytes key to encrypt the TOTP secrets and the secrets of the webhooks")
+	flag.StringVar(&cfg.Mfa.Issuer, "mfa-issuer", "e-inwork", "Issuer shown by the authenticator apps")
+	flag.StringVar(&cfg.WebAuthn.RPID, "webauthn-rp-id", "localhost", "WebAuthn relying party ID, the domain of the passkeys")
+	flag.StringVar(&cfg.WebAuthn.RPName, "webauthn-rp-name", "e-inwork", "WebAuthn relying party name shown by the authenticators")
+	webauthnOrigins := flag.String("webauthn-origins", os.Getenv("WEBAUTHNORIGINS"), "Origins allowed to use the passkeys (space separated)")
+	flag.StringVar(&cfg.Smtp.Host, "smtp-host", os.Getenv("SMTPHOST"), "SMTP host")
+	flag.IntVar(&cfg.Smtp.Port, "smtp-port", 25, "SMTP port")
+	flag.StringVar(&cfg.Smtp.Username, "smtp-username", os.Getenv("SMTPUSERNAME"), "SMTP username")
+	flag.StringVar(&cfg.Smtp.Password, "smtp-password", os.Getenv("SMTPPASSWORD"), "SMTP password")
+	flag.StringVar(&cfg.Smtp.Sender, "smtp-sender", "e-inwork <no-reply@e-inwork.com>", "SMTP sender")
+	flag.StringVar(&cfg.Mailer.Backend, "mailer-backend", "smtp", "Mailer backend (smtp|file|memory)")
+	flag.StringVar(&cfg.Mailer.Dir, "mailer-dir", "./local/mail", "Directory of the emails written by the file mailer backend")
+	flag.IntVar(&cfg.Mailer.Attempts, "mailer-attempts", 3, "Mailer delivery attempts")
+	flag.DurationVar(&cfg.Mailer.Backoff, "mailer-backoff", 2*time.Second, "Mailer delay before the first retry, doubled on every retry")
+	flag.BoolVar(&cfg.Lockout.Enabled, "lockout-enabled", true, "Enable the throttling of the failed logins per account")
+	flag.StringVar(&cfg.Lockout.Store, "lockout-store", "", "Store of the failed logins (database|memory), the store of the data by default")
+	flag.IntVar(&cfg.Lockout.Threshold, "lockout-threshold", 10, "Failed logins before the account is locked")
+	flag.DurationVar(&cfg.Lockout.Duration, "lockout-duration", 15*time.Minute, "Lockout duration of an account")
+	flag.DurationVar(&cfg.Lockout.BaseDelay, "lockout-base-delay", time.Second, "Delay after the first failed login, doubled on every failed login")
+	flag.DurationVar(&cfg.Lockout.MaxDelay, "lockout-max-delay", time.Minute, "Maximum delay between the failed logins before the lockout")
+	flag.DurationVar(&cfg.Lockout.Window, "lockout-window", time.Hour, "Time after the last failed login before the failed logins are forgotten")
+	unlockAccount := flag.String("lockout-unlock", "", "Unlock the account of the email on the database store and exit")
+	flag.BoolVar(&cfg.Indexer.Enabled, "indexer-enabled", false, "Enable the indexing of the users in Solr")
+	flag.StringVar(&cfg.Indexer.URL, "indexer-url", os.Getenv("INDEXERURL"), "URL of the Solr collection of the users")
+	flag.IntVar(&cfg.Indexer.BatchSize, "indexer-batch-size", 100, "Indexer maximum changes sent in a request")
+	flag.DurationVar(&cfg.Indexer.FlushInterval, "indexer-flush-interval", time.Second, "Indexer maximum time before the queued changes are sent")
+	flag.IntVar(&cfg.Indexer.QueueSize, "indexer-queue-size", 10000, "Indexer maximum queued changes, the next changes are dropped until a reindex")
+	flag.DurationVar(&cfg.Indexer.CommitWithin, "indexer-commit-within", time.Second, "Time before the changes are searchable in Solr")
+	flag.IntVar(&cfg.Indexer.Attempts, "indexer-attempts", 5, "Indexer delivery attempts of a batch")
+	flag.DurationVar(&cfg.Indexer.Backoff, "indexer-backoff", time.Second, "Indexer delay before the first retry, doubled on every retry")
+	flag.DurationVar(&cfg.Indexer.Timeout, "indexer-timeout", 10*time.Second, "Indexer request timeout")
+	reindex := flag.Bool("indexer-reindex", false, "Add every user to the Solr collection, delete the users that don't exist anymore and exit")
+	flag.StringVar(&cfg.Events.Broker, "events-broker", "none", "Broker of the events of the users (none|webhook|nats|memory)")
+	flag.StringVar(&cfg.Events.WebhookURL, "events-webhook-url", os.Getenv("EVENTSWEBHOOKURL"), "URL receiving the events on the webhook broker")
+	flag.StringVar(&cfg.Events.NatsURL, "events-nats-url", os.Getenv("EVENTSNATSURL"), "NATS URL of the JetStream of the events on the nats broker")
+	flag.StringVar(&cfg.Events.NatsPrefix, "events-nats-prefix", "e-inwork", "Prefix of the NATS subjects of the events")
+	flag.DurationVar(&cfg.Events.Timeout, "events-timeout", 10*time.Second, "Timeout of the publishing of an event")
+	flag.IntVar(&cfg.Events.BatchSize, "events-batch-size", 100, "Events published from the outbox at a time")
+	flag.DurationVar(&cfg.Events.Interval, "events-interval", time.Second, "Interval between the checks of the outbox")
+	flag.DurationVar(&cfg.Events.MaxBackoff, "events-max-backoff", time.Minute, "Maximum delay between the attempts while the broker is unavailable")
+	flag.DurationVar(&cfg.Events.Retention, "events-retention", 7*24*time.Hour, "Time the published events are kept in the outbox, or every event without a broker")
+	flag.IntVar(&cfg.Webhooks.Workers, "webhooks-workers", 2, "Workers sending the webhook deliveries, 0 doesn't send them")
+	flag.IntVar(&cfg.Webhooks.MaxAttempts, "webhooks-max-attempts", 8, "Attempts of a webhook delivery before it is dead")
+	flag.DurationVar(&cfg.Webhooks.Backoff, "webhooks-backoff", 30*time.Second, "Delay before the second attempt of a webhook delivery, doubled on every attempt")
+	flag.DurationVar(&cfg.Webhooks.MaxBackoff, "webhooks-max-backoff", 6*time.Hour, "Maximum delay between the attempts of a webhook delivery")
+	flag.DurationVar(&cfg.Webhooks.Timeout, "webhooks-timeout", 10*time.Second, "Timeout of a webhook delivery")
+	flag.DurationVar(&cfg.Webhooks.Interval, "webhooks-interval", time.Second, "Interval between the checks of the pending webhook deliveries")
+	flag.DurationVar(&cfg.Deletion.GracePeriod, "deletion-grace-period", 30*24*time.Hour, "Time a deleted user can be restored before it is purged")
+	flag.DurationVar(&cfg.Deletion.PurgeInterval, "deletion-purge-interval", time.Hour, "Interval between the purges of the deleted users")
+	flag.IntVar(&cfg.Deletion.BatchSize, "deletion-batch-size", 100, "Maximum users purged in a batch")
+	flag.DurationVar(&cfg.Exports.TTL, "exports-ttl", 24*time.Hour, "Time the archive of a personal data export is kept")
+	flag.DurationVar(&cfg.Exports.LinkTTL, "exports-link-ttl", 15*time.Minute, "Time a download link of an export works")
+	flag.DurationVar(&cfg.Audit.Retention, "audit-retention", 365*24*time.Hour, "Time the audit events are kept, 0 keeps them forever")
+	flag.DurationVar(&cfg.Audit.PruneInterval, "audit-prune-interval", time.Hour, "Interval between the deletions of the expired audit events")
 	flag.BoolVar(&cfg.Limiter.Enabled, "limiter-enabled", true, "Enable rate limiter")
 	flag.Float64Var(&cfg.Limiter.Rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
 	flag.IntVar(&cfg.Limiter.Burst, "limiter-burst", 4, "Rate limiter maximum burst")
 	displayVersion := flag.Bool("version", false, "Display version and exit")
 	flag.Parse()
 
+	// Set the keys that are accepted while rotating the signing key
+	cfg.Auth.VerificationKeyFiles = strings.Fields(*verificationKeys)
+
+	// Set the origins of the WebAuthn ceremonies
+	cfg.WebAuthn.Origins = strings.Fields(*webauthnOrigins)
+
 	// Set CORS Trusted Origins
 	cfg.Cors.TrustedOrigins = strings.Fields(os.Getenv("CORS-TRUSTED-ORIGINS"))
 
@@ -53,33 +125,195 @@ func main() {
 	// Set logger
 	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
 
-	// Set Database
-	db, err := api.OpenDB(cfg)
+	// Set the models of the store, the database is nil in memory
+	models, db, err := api.OpenModels(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	if db != nil {
+		defer db.Close()
+
+		// Log a status of the database
+		logger.PrintInfo("database connection pool established", nil)
+	} else {
+		logger.PrintInfo("data kept in memory", nil)
+	}
+
+	// Run the migrate subcommand, like "./user migrate up"
+	if args := flag.Args(); len(args) > 0 {
+		if args[0] != "migrate" {
+			logger.PrintFatal(fmt.Errorf("unknown command %q", args[0]), nil)
+		}
+
+		if db == nil {
+			logger.PrintFatal(errors.New("the migrations require a database"), nil)
+		}
+
+		migrator, err := api.OpenMigrator(cfg, db)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+
+		err = runMigrate(context.Background(), migrator, args[1:], logger)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		os.Exit(0)
+	}
+
+	// The service only serves a schema with its migrations
+	if db != nil {
+		migrator, err := api.OpenMigrator(cfg, db)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+
+		if cfg.Db.AutoMigrate {
+			applied, err := migrator.Up(context.Background())
+			if err != nil {
+				logger.PrintFatal(err, nil)
+			}
+
+			logger.PrintInfo("schema migrated up", map[string]string{
+				"applied": strconv.Itoa(applied),
+			})
+		}
+
+		err = migrator.Check(context.Background())
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+
+		// Rebuild the canonical emails stored with the other case of the local parts
+		rekeyed, err := data.RekeyEmails(context.Background(), db)
+		if err != nil {
+			logger.PrintFatal(fmt.Errorf("canonical emails: %w, merge or rename the users", err), nil)
+		}
+
+		if rekeyed > 0 {
+			logger.PrintInfo("canonical emails rebuilt", map[string]string{
+				"users": strconv.FormatInt(rekeyed, 10),
+			})
+		}
+	}
+
+	// Set the keys of the JSON Web Tokens
+	keys, err := api.OpenKeySet(cfg)
 	if err != nil {
 		logger.PrintFatal(err, nil)
 	}
-	defer db.Close()
 
-	// Log a status of the database
-	logger.PrintInfo("database connection pool established", nil)
+	// Set the mailer
+	mailer, err := api.OpenMailer(cfg, logger)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	// Set the ciphers of the TOTP secrets and of the secrets of the webhooks
+	cipher, err := api.OpenCipher(cfg, api.CipherTOTP)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	webhookCipher, err := api.OpenCipher(cfg, api.CipherWebhooks)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	// Set the cipher of the "mfa" tokens and of the session tokens of the passkeys
+	sessionCipher, err := api.OpenCipher(cfg, api.CipherSessions)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	// Set the relying party of the passkeys
+	relyingParty, err := api.OpenRelyingParty(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	// Set the limiter of the failed logins
+	lockout, err := api.OpenLockout(cfg, db)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	// Unlock an account on the request of an administrator
+	if *unlockAccount != "" {
+		err = lockout.Reset(*unlockAccount)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+
+		logger.PrintInfo("account unlocked", map[string]string{
+			"email": *unlockAccount,
+		})
+		os.Exit(0)
+	}
+
+	// The changes of the users are sent to the index
+	indexer, err := api.OpenIndexer(cfg, logger)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	if indexer != nil {
+		models.Users = indexer.Users(models.Users)
+	}
+
+	// Reindex the users on the request of an administrator
+	if *reindex {
+		if indexer == nil {
+			logger.PrintFatal(errors.New("the reindex requires the indexer to be enabled"), nil)
+		}
+
+		total, err := indexer.Reindex(context.Background(), models.Users)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+
+		logger.PrintInfo("users reindexed", map[string]string{
+			"users": strconv.Itoa(total),
+		})
+		os.Exit(0)
+	}
+
+	// Set the broker of the events of the users
+	broker, err := api.OpenBroker(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
 
 	// Publish variables
 	expvar.NewString("version").Set(api.Version)
 	expvar.Publish("goroutines", expvar.Func(func() interface{} {
 		return runtime.NumGoroutine()
 	}))
-	expvar.Publish("database", expvar.Func(func() interface{} {
-		return db.Stats()
-	}))
+	if db != nil {
+		expvar.Publish("database", expvar.Func(func() interface{} {
+			return db.Stats()
+		}))
+	}
 	expvar.Publish("timestamp", expvar.Func(func() interface{} {
 		return time.Now().Unix()
 	}))
 
 	// Set the application
 	app := &api.Application{
-		Config: cfg,
-		Logger: logger,
-		Models: data.InitModels(db),
+		Config:   cfg,
+		Logger:   logger,
+		Models:   models,
+		Keys:     keys,
+		Mailer:   mailer,
+		Cipher:   cipher,
+		WebAuthn: relyingParty,
+		Lockout:  lockout,
+		Indexer:  indexer,
+		Events:   broker,
+
+		WebhookCipher: webhookCipher,
+		SessionCipher: sessionCipher,
 	}
 
 	// Run the application
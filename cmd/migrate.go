@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/e-inwork-com/go-user-service/internal/jsonlog"
+	"github.com/e-inwork-com/go-user-service/internal/migrate"
+)
+
+// migrateUsage is the usage of the migrate subcommand
+const migrateUsage = "usage: user [flags] migrate up | down [steps] | status | force version"
+
+// runMigrate runs the migrate subcommand with its arguments, "down" undoes
+// one migration by default, "force" sets the version after a failed migration
+func runMigrate(ctx context.Context, migrator *migrate.Migrator, args []string, logger *jsonlog.Logger) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	switch {
+	case args[0] == "up" && len(args) == 1:
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+
+		logger.PrintInfo("schema migrated up", map[string]string{
+			"applied": strconv.Itoa(applied),
+			"version": strconv.FormatUint(uint64(migrator.Latest()), 10),
+		})
+	case args[0] == "down" && len(args) <= 2:
+		steps := 1
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid steps %q", args[1])
+			}
+			steps = n
+		}
+
+		undone, err := migrator.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+
+		logger.PrintInfo("schema migrated down", map[string]string{
+			"undone": strconv.Itoa(undone),
+		})
+	case args[0] == "status" && len(args) == 1:
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		var pending []string
+		for _, migration := range status.Pending {
+			pending = append(pending, fmt.Sprintf("%06d_%s", migration.Version, migration.Name))
+		}
+
+		logger.PrintInfo("schema status", map[string]string{
+			"version": strconv.FormatUint(uint64(status.Version), 10),
+			"dirty":   strconv.FormatBool(status.Dirty),
+			"latest":  strconv.FormatUint(uint64(status.Latest), 10),
+			"pending": strings.Join(pending, " "),
+		})
+	case args[0] == "force" && len(args) == 2:
+		version, err := strconv.Atoi(args[1])
+		if err != nil || version < -1 {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+
+		err = migrator.Force(ctx, version)
+		if err != nil {
+			return err
+		}
+
+		logger.PrintInfo("schema version forced", map[string]string{
+			"version": args[1],
+		})
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	return nil
+}
@@ -0,0 +1,201 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/validator"
+	"github.com/google/uuid"
+)
+
+// The types of the audit events of the accounts
+const (
+	AuditLoginSucceeded  = "login.succeeded"
+	AuditLoginFailed     = "login.failed"
+	AuditTokenIssued     = "token.issued"
+	AuditTokenRefreshed  = "token.refreshed"
+	AuditPasswordChanged = "password.changed"
+	AuditEmailRequested  = "email.change_requested"
+	AuditEmailChanged    = "email.changed"
+	AuditUserActivated   = "user.activated"
+	AuditUserDeactivated = "user.deactivated"
+	AuditUserDeleted     = "user.deleted"
+	AuditUserRestored    = "user.restored"
+	AuditRoleAdded       = "role.added"
+	AuditRoleRemoved     = "role.removed"
+)
+
+// AuditEventTypes are the types of the audit events
+var AuditEventTypes = []string{
+	AuditLoginSucceeded,
+	AuditLoginFailed,
+	AuditTokenIssued,
+	AuditTokenRefreshed,
+	AuditPasswordChanged,
+	AuditEmailRequested,
+	AuditEmailChanged,
+	AuditUserActivated,
+	AuditUserDeactivated,
+	AuditUserDeleted,
+	AuditUserRestored,
+	AuditRoleAdded,
+	AuditRoleRemoved,
+}
+
+// AuditEventSortSafelist is the order of the events, the newest first
+var AuditEventSortSafelist = []string{"-created_at_dt"}
+
+type AuditEventModelInterface interface {
+	Insert(event *AuditEvent) error
+	GetAll(filters AuditEventFilters) ([]*AuditEvent, Metadata, error)
+	DeleteBefore(before time.Time) error
+}
+
+// AuditEvent is an event of the account of a user, the actor is the user
+// who did it, it is empty when it is unknown like for a failed login
+type AuditEvent struct {
+	ID        int64      `json:"id"`
+	UserID    uuid.UUID  `json:"user_id"`
+	ActorID   *uuid.UUID `json:"actor_id,omitempty"`
+	Type      string     `json:"type_t"`
+	Details   string     `json:"details_t,omitempty"`
+	IP        string     `json:"ip_t"`
+	UserAgent string     `json:"user_agent_t"`
+	CreatedAt time.Time  `json:"created_at_dt"`
+}
+
+// AuditEventFilters select the events of a user, the newest first
+type AuditEventFilters struct {
+	UserID        uuid.UUID
+	Type          string
+	IP            string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Filters
+}
+
+func ValidateAuditEventFilters(v *validator.Validator, f AuditEventFilters) {
+	if f.Type != "" {
+		v.Check(validator.In(f.Type, AuditEventTypes...), "type_t", "invalid event type")
+	}
+
+	if f.CreatedAfter != nil && f.CreatedBefore != nil {
+		v.Check(f.CreatedAfter.Before(*f.CreatedBefore), "created_before_dt", "must be after created_after_dt")
+	}
+
+	ValidateFilters(v, f.Filters)
+}
+
+type AuditEventModel struct {
+	DB *sql.DB
+}
+
+// Insert appends the event, the events are never updated
+func (m AuditEventModel) Insert(event *AuditEvent) error {
+	query := `
+        INSERT INTO user_audit_events (user_id, actor_id, type_t, details_t, ip_t, user_agent_t)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING id, created_at_dt`
+
+	args := []interface{}{event.UserID, event.ActorID, event.Type, event.Details, event.IP, event.UserAgent}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&event.ID, &event.CreatedAt)
+}
+
+// GetAll returns a page of the events of the user, the newest first,
+// with the total number of events
+func (m AuditEventModel) GetAll(filters AuditEventFilters) ([]*AuditEvent, Metadata, error) {
+	query := `
+        SELECT count(*) OVER(), id, user_id, actor_id, type_t, details_t, ip_t, user_agent_t, created_at_dt
+        FROM user_audit_events
+        WHERE user_id = $1
+        AND (type_t = $2 OR $2 = '')
+        AND (ip_t = $3 OR $3 = '')
+        AND (created_at_dt >= $4 OR $4 IS NULL)
+        AND (created_at_dt < $5 OR $5 IS NULL)
+        ORDER BY created_at_dt DESC, id DESC
+        LIMIT $6 OFFSET $7`
+
+	args := []interface{}{filters.UserID, filters.Type, filters.IP, filters.CreatedAfter, filters.CreatedBefore, filters.limit(), filters.offset()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	events := []*AuditEvent{}
+
+	for rows.Next() {
+		var event AuditEvent
+
+		err := rows.Scan(
+			&totalRecords,
+			&event.ID,
+			&event.UserID,
+			&event.ActorID,
+			&event.Type,
+			&event.Details,
+			&event.IP,
+			&event.UserAgent,
+			&event.CreatedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		events = append(events, &event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return events, metadata, nil
+}
+
+// DeleteBefore removes the events older than the retention, the events
+// are only deleted with the role of the pruner
+func (m AuditEventModel) DeleteBefore(before time.Time) error {
+	return m.deleteBefore(before, `SET LOCAL ROLE user_audit_pruner`, "")
+}
+
+// deleteBefore removes the events older than the retention in a transaction,
+// the transaction runs the enter query before the deletion and the leave query after
+func (m AuditEventModel) deleteBefore(before time.Time, enter string, leave string) error {
+	query := `
+        DELETE FROM user_audit_events
+        WHERE created_at_dt < $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	return inTx(ctx, m.DB, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, enter)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, query, before)
+		if err != nil {
+			return err
+		}
+
+		if leave == "" {
+			return nil
+		}
+
+		_, err = tx.ExecContext(ctx, leave)
+		return err
+	})
+}
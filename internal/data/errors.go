@@ -0,0 +1,112 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/sqlite"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrValueTooLong = errors.New("value too long")
+	ErrRetryable    = errors.New("transaction conflict, please try again")
+	ErrTimeout      = errors.New("query timeout")
+)
+
+// The SQLSTATE codes of the Postgres errors translated by translateError
+const (
+	codeStringDataRightTruncation = "22001"
+	codeUniqueViolation           = "23505"
+	codeSerializationFailure      = "40001"
+	codeDeadlockDetected          = "40P01"
+	codeQueryCanceled             = "57014"
+)
+
+// maxAttempts is the number of times a transaction runs when it fails to serialize
+const maxAttempts = 3
+
+// translateError returns the error of the data layer of a database error, the
+// error of the database is kept in the message. A query ended by the timeout of
+// ctx is ErrTimeout, and a query ended by a cancelled request stays
+// context.Canceled. The other errors are returned unchanged
+func translateError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var pqErr *pq.Error
+
+	switch {
+	case errors.Is(ctx.Err(), context.Canceled):
+		if errors.Is(err, context.Canceled) {
+			return err
+		}
+		return fmt.Errorf("%w: %v", context.Canceled, err)
+	case errors.Is(ctx.Err(), context.DeadlineExceeded), errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("%w: %v", ErrTimeout, err)
+	case errors.As(err, &pqErr):
+		switch pqErr.Code {
+		case codeStringDataRightTruncation:
+			return fmt.Errorf("%w: %v", ErrValueTooLong, err)
+		case codeSerializationFailure, codeDeadlockDetected:
+			return fmt.Errorf("%w: %v", ErrRetryable, err)
+		case codeQueryCanceled:
+			return fmt.Errorf("%w: %v", ErrTimeout, err)
+		}
+	case sqlite.IsBusy(err):
+		return fmt.Errorf("%w: %v", ErrRetryable, err)
+	}
+
+	return err
+}
+
+// isUniqueViolation reports whether err violates the unique constraint of the column,
+// the constraint is named by Postgres and the column is named by SQLite, or the
+// index when the constraint is a unique index on an expression of the column
+func isUniqueViolation(err error, constraint, table, column string) bool {
+	var pqErr *pq.Error
+
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == codeUniqueViolation && pqErr.Constraint == constraint
+	}
+
+	return sqlite.IsUniqueViolation(err, table+"."+column) || sqlite.IsUniqueViolation(err, "index '"+constraint+"'")
+}
+
+// inTx runs fn in a transaction and commits it, the error is translated by
+// translateError. A transaction that failed to serialize or deadlocked is
+// rolled back and run again, up to maxAttempts times
+func inTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	for attempt := 1; ; attempt++ {
+		err := translateError(ctx, runTx(ctx, db, fn))
+		if !errors.Is(err, ErrRetryable) || attempt == maxAttempts {
+			return err
+		}
+
+		// Wait a little longer after each attempt for the other transaction to end
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt) * 10 * time.Millisecond):
+		}
+	}
+}
+
+func runTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = fn(tx)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,128 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/e-inwork-com/go-user-service/internal/sqlite"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranslateError(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"Value Too Long", &pq.Error{Code: "22001"}, ErrValueTooLong},
+		{"Serialization Failure", &pq.Error{Code: "40001"}, ErrRetryable},
+		{"Deadlock", &pq.Error{Code: "40P01"}, ErrRetryable},
+		{"Statement Timeout", &pq.Error{Code: "57014"}, ErrTimeout},
+		{"Deadline", context.DeadlineExceeded, ErrTimeout},
+		{"Unique Violation", &pq.Error{Code: "23505"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := translateError(ctx, tt.err)
+
+			if tt.want == nil {
+				assert.Equal(t, tt.err, err)
+			} else {
+				assert.ErrorIs(t, err, tt.want)
+				assert.Contains(t, err.Error(), tt.err.Error())
+			}
+		})
+	}
+
+	t.Run("Cancelled Request", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		// The statement cancelled with the request isn't a timeout
+		err := translateError(ctx, &pq.Error{Code: "57014"})
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.NotErrorIs(t, err, ErrTimeout)
+	})
+
+	assert.Nil(t, translateError(ctx, nil))
+}
+
+func TestIsUniqueViolation(t *testing.T) {
+	err := &pq.Error{Code: "23505", Constraint: "users_email_canonical_key"}
+
+	assert.True(t, isUniqueViolation(err, "users_email_canonical_key", "users", "email_t"))
+	assert.False(t, isUniqueViolation(err, "webauthn_credentials_pkey", "webauthn_credentials", "id"))
+	assert.False(t, isUniqueViolation(&pq.Error{Code: "23503", Constraint: "users_email_canonical_key"}, "users_email_canonical_key", "users", "email_t"))
+	assert.False(t, isUniqueViolation(nil, "users_email_canonical_key", "users", "email_t"))
+}
+
+func TestInTx(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := sql.Open(sqlite.DriverName, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Every connection has its own database in memory
+	db.SetMaxOpenConns(1)
+
+	t.Run("Retried", func(t *testing.T) {
+		attempts := 0
+
+		err := inTx(ctx, db, func(tx *sql.Tx) error {
+			attempts++
+			if attempts < maxAttempts {
+				return &pq.Error{Code: "40001"}
+			}
+			return nil
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, maxAttempts, attempts)
+	})
+
+	t.Run("Too Many Attempts", func(t *testing.T) {
+		attempts := 0
+
+		err := inTx(ctx, db, func(tx *sql.Tx) error {
+			attempts++
+			return &pq.Error{Code: "40P01"}
+		})
+		assert.ErrorIs(t, err, ErrRetryable)
+		assert.Equal(t, maxAttempts, attempts)
+	})
+
+	t.Run("Not Retried", func(t *testing.T) {
+		attempts := 0
+
+		err := inTx(ctx, db, func(tx *sql.Tx) error {
+			attempts++
+			return ErrDuplicateEmail
+		})
+		assert.ErrorIs(t, err, ErrDuplicateEmail)
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("Rolled Back", func(t *testing.T) {
+		_, err := db.Exec(`CREATE TABLE t (id integer)`)
+		assert.Nil(t, err)
+
+		err = inTx(ctx, db, func(tx *sql.Tx) error {
+			_, err := tx.Exec(`INSERT INTO t (id) VALUES (1)`)
+			assert.Nil(t, err)
+			return errors.New("failed")
+		})
+		assert.NotNil(t, err)
+
+		var count int
+		assert.Nil(t, db.QueryRow(`SELECT count(*) FROM t`).Scan(&count))
+		assert.Equal(t, 0, count)
+	})
+}
@@ -0,0 +1,176 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The statuses of an export, the archive of a ready export is kept until it expires
+const (
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+type ExportModelInterface interface {
+	Insert(export *Export) error
+	Get(id uuid.UUID, userID uuid.UUID) (*Export, error)
+	GetArchive(id uuid.UUID, userID uuid.UUID) ([]byte, error)
+	Complete(id uuid.UUID, archive []byte) error
+	Fail(id uuid.UUID) error
+	DeleteExpired(before time.Time) error
+}
+
+// Export is a personal data export of a user, the archive
+// is generated in the background and read with GetArchive
+type Export struct {
+	ID          uuid.UUID  `json:"id"`
+	UserID      uuid.UUID  `json:"-"`
+	Status      string     `json:"status_t"`
+	CreatedAt   time.Time  `json:"created_at_dt"`
+	CompletedAt *time.Time `json:"completed_at_dt,omitempty"`
+	ExpiresAt   time.Time  `json:"expires_at_dt"`
+}
+
+// IsExpired reports whether the archive of the export can't be downloaded anymore
+func (e *Export) IsExpired() bool {
+	return time.Now().After(e.ExpiresAt)
+}
+
+type ExportModel struct {
+	DB *sql.DB
+}
+
+// Insert stores a pending export with a new ID
+func (m ExportModel) Insert(export *Export) error {
+	query := `
+        INSERT INTO user_exports (id, user_id, status_t, expires_at_dt)
+        VALUES ($1, $2, $3, $4)
+        RETURNING created_at_dt`
+
+	export.ID = uuid.New()
+	export.Status = ExportPending
+
+	args := []interface{}{export.ID, export.UserID, export.Status, export.ExpiresAt}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&export.CreatedAt)
+}
+
+// Get returns the export of the user without its archive
+func (m ExportModel) Get(id uuid.UUID, userID uuid.UUID) (*Export, error) {
+	query := `
+        SELECT id, user_id, status_t, created_at_dt, completed_at_dt, expires_at_dt
+        FROM user_exports
+        WHERE id = $1 AND user_id = $2`
+
+	var export Export
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(
+		&export.ID,
+		&export.UserID,
+		&export.Status,
+		&export.CreatedAt,
+		&export.CompletedAt,
+		&export.ExpiresAt,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &export, nil
+}
+
+// GetArchive returns the archive of a ready export of the user
+func (m ExportModel) GetArchive(id uuid.UUID, userID uuid.UUID) ([]byte, error) {
+	query := `
+        SELECT archive
+        FROM user_exports
+        WHERE id = $1 AND user_id = $2 AND status_t = $3`
+
+	var archive []byte
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, userID, ExportReady).Scan(&archive)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return archive, nil
+}
+
+// Complete stores the archive of a pending export
+func (m ExportModel) Complete(id uuid.UUID, archive []byte) error {
+	query := `
+        UPDATE user_exports
+        SET status_t = $1, archive = $2, completed_at_dt = $3
+        WHERE id = $4 AND status_t = $5`
+
+	return m.finish(query, ExportReady, archive, time.Now(), id, ExportPending)
+}
+
+// Fail marks a pending export as failed
+func (m ExportModel) Fail(id uuid.UUID) error {
+	query := `
+        UPDATE user_exports
+        SET status_t = $1, completed_at_dt = $2
+        WHERE id = $3 AND status_t = $4`
+
+	return m.finish(query, ExportFailed, time.Now(), id, ExportPending)
+}
+
+func (m ExportModel) finish(query string, args ...interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// DeleteExpired removes the exports that expired before the time with their archives
+func (m ExportModel) DeleteExpired(before time.Time) error {
+	query := `
+        DELETE FROM user_exports
+        WHERE expires_at_dt < $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, before)
+	return err
+}
@@ -0,0 +1,87 @@
+package memory
+
+import (
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
+)
+
+type AuditEventModel struct {
+	store *Store
+}
+
+func (m AuditEventModel) Insert(event *data.AuditEvent) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	if _, ok := m.store.users[event.UserID]; !ok {
+		if _, ok := m.store.deletedUsers[event.UserID]; !ok {
+			return data.ErrRecordNotFound
+		}
+	}
+
+	m.store.insertAuditEvent(event)
+
+	return nil
+}
+
+// GetAll returns a page of the events of the user, the newest first
+func (m AuditEventModel) GetAll(filters data.AuditEventFilters) ([]*data.AuditEvent, data.Metadata, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	var matches []*data.AuditEvent
+
+	// The events are stored in the order of their IDs
+	for i := len(m.store.auditEvents) - 1; i >= 0; i-- {
+		event := m.store.auditEvents[i]
+
+		switch {
+		case event.UserID != filters.UserID:
+		case filters.Type != "" && event.Type != filters.Type:
+		case filters.IP != "" && event.IP != filters.IP:
+		case filters.CreatedAfter != nil && event.CreatedAt.Before(*filters.CreatedAfter):
+		case filters.CreatedBefore != nil && !event.CreatedAt.Before(*filters.CreatedBefore):
+		default:
+			matches = append(matches, event)
+		}
+	}
+
+	events := []*data.AuditEvent{}
+	offset := (filters.Page - 1) * filters.PageSize
+
+	for i := offset; i < len(matches) && i < offset+filters.PageSize; i++ {
+		event := *matches[i]
+		events = append(events, &event)
+	}
+
+	metadata := calculateMetadata(len(matches), filters.Filters)
+
+	return events, metadata, nil
+}
+
+func (m AuditEventModel) DeleteBefore(before time.Time) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	events := m.store.auditEvents[:0]
+	for _, event := range m.store.auditEvents {
+		if !event.CreatedAt.Before(before) {
+			events = append(events, event)
+		}
+	}
+	m.store.auditEvents = events
+
+	return nil
+}
+
+// insertAuditEvent appends the event with a new ID, the store must be locked
+func (s *Store) insertAuditEvent(event *data.AuditEvent) {
+	s.lastAuditEventID++
+
+	event.ID = s.lastAuditEventID
+	event.CreatedAt = now()
+
+	stored := *event
+	s.auditEvents = append(s.auditEvents, &stored)
+}
@@ -0,0 +1,339 @@
+package memory
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
+	"github.com/google/uuid"
+)
+
+type OutboxModel struct {
+	store *Store
+}
+
+// Relay publishes the oldest unpublished events in order, and marks them as published.
+// The relay stops on the first event that fails, the event is sent again on the next
+// relay. It returns zero when another relay is running
+func (m OutboxModel) Relay(limit int, publish func(event *data.Event) error) (int, error) {
+	if !m.store.relayMu.TryLock() {
+		return 0, nil
+	}
+	defer m.store.relayMu.Unlock()
+
+	// The events are published without locking the store
+	m.store.mu.Lock()
+
+	var rows []*outboxEvent
+	for _, row := range m.store.outbox {
+		if len(rows) < limit && row.publishedAt == nil {
+			rows = append(rows, row)
+		}
+	}
+
+	events := make([]data.Event, len(rows))
+	for i, row := range rows {
+		events[i] = row.event
+	}
+
+	m.store.mu.Unlock()
+
+	published := 0
+
+	for i := range events {
+		err := publish(&events[i])
+
+		m.store.mu.Lock()
+		if err != nil {
+			rows[i].event.Attempts++
+			rows[i].lastError = err.Error()
+		} else {
+			publishedAt := time.Now()
+			rows[i].publishedAt = &publishedAt
+		}
+		m.store.mu.Unlock()
+
+		if err != nil {
+			return published, err
+		}
+
+		published++
+	}
+
+	return published, nil
+}
+
+// DeletePublished removes the events published before the time
+func (m OutboxModel) DeletePublished(before time.Time) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	outbox := m.store.outbox[:0]
+	for _, row := range m.store.outbox {
+		if row.publishedAt == nil || !row.publishedAt.Before(before) {
+			outbox = append(outbox, row)
+		}
+	}
+	m.store.outbox = outbox
+
+	return nil
+}
+
+// DeleteBefore removes the events created before the time, published or not
+func (m OutboxModel) DeleteBefore(before time.Time) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	outbox := m.store.outbox[:0]
+	for _, row := range m.store.outbox {
+		if !row.event.CreatedAt.Before(before) {
+			outbox = append(outbox, row)
+		}
+	}
+	m.store.outbox = outbox
+
+	return nil
+}
+
+type WebhookModel struct {
+	store *Store
+}
+
+func (m WebhookModel) Insert(subscription *data.WebhookSubscription) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	subscription.ID = uuid.New()
+	subscription.CreatedAt = now()
+	subscription.Version = 1
+
+	m.store.webhooks[subscription.ID] = cloneWebhook(*subscription)
+
+	return nil
+}
+
+func (m WebhookModel) Get(id uuid.UUID) (*data.WebhookSubscription, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	subscription, ok := m.store.webhooks[id]
+	if !ok {
+		return nil, data.ErrRecordNotFound
+	}
+
+	subscription = cloneWebhook(subscription)
+
+	return &subscription, nil
+}
+
+func (m WebhookModel) GetAll() ([]*data.WebhookSubscription, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	subscriptions := []*data.WebhookSubscription{}
+
+	for _, subscription := range m.store.webhooks {
+		subscription := cloneWebhook(subscription)
+		subscriptions = append(subscriptions, &subscription)
+	}
+
+	sort.Slice(subscriptions, func(i, j int) bool {
+		a, b := subscriptions[i], subscriptions[j]
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.ID.String() < b.ID.String()
+	})
+
+	return subscriptions, nil
+}
+
+func (m WebhookModel) Update(subscription *data.WebhookSubscription) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	current, ok := m.store.webhooks[subscription.ID]
+	if !ok || current.Version != subscription.Version {
+		return data.ErrEditConflict
+	}
+
+	subscription.Version++
+	m.store.webhooks[subscription.ID] = cloneWebhook(*subscription)
+
+	return nil
+}
+
+// Delete removes the subscription with its deliveries
+func (m WebhookModel) Delete(id uuid.UUID) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	if _, ok := m.store.webhooks[id]; !ok {
+		return data.ErrRecordNotFound
+	}
+
+	delete(m.store.webhooks, id)
+
+	deliveries := m.store.deliveries[:0]
+	for _, delivery := range m.store.deliveries {
+		if delivery.SubscriptionID != id {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	m.store.deliveries = deliveries
+
+	return nil
+}
+
+// cloneWebhook copies the subscription, so the stored events aren't shared
+func cloneWebhook(subscription data.WebhookSubscription) data.WebhookSubscription {
+	subscription.Events = append([]string(nil), subscription.Events...)
+	return subscription
+}
+
+// insertWebhookDeliveries queues the event to every active subscription
+// of its type, the store must be locked
+func (s *Store) insertWebhookDeliveries(event *data.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	for _, subscription := range s.webhooks {
+		if !subscription.Active || !subscribed(subscription.Events, event.Type) {
+			continue
+		}
+
+		s.lastDeliveryID++
+
+		s.deliveries = append(s.deliveries, &data.WebhookDelivery{
+			ID:             s.lastDeliveryID,
+			SubscriptionID: subscription.ID,
+			EventID:        event.ID,
+			Type:           event.Type,
+			Payload:        payload,
+			CreatedAt:      now(),
+			Status:         data.WebhookDeliveryPending,
+			NextAttemptAt:  time.Now(),
+		})
+	}
+
+	return nil
+}
+
+func subscribed(events []string, eventType string) bool {
+	for _, event := range events {
+		if event == eventType || event == data.WebhookAllEvents {
+			return true
+		}
+	}
+
+	return false
+}
+
+type WebhookDeliveryModel struct {
+	store *Store
+}
+
+// GetAllForSubscription returns a page of the deliveries of the subscription,
+// the latest first, an empty status doesn't filter
+func (m WebhookDeliveryModel) GetAllForSubscription(subscriptionID uuid.UUID, status string, filters data.Filters) ([]*data.WebhookDelivery, data.Metadata, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	var matches []*data.WebhookDelivery
+
+	// The deliveries are stored in the order of their IDs
+	for i := len(m.store.deliveries) - 1; i >= 0; i-- {
+		delivery := m.store.deliveries[i]
+		if delivery.SubscriptionID == subscriptionID && (status == "" || delivery.Status == status) {
+			matches = append(matches, delivery)
+		}
+	}
+
+	deliveries := []*data.WebhookDelivery{}
+	offset := (filters.Page - 1) * filters.PageSize
+
+	for i := offset; i < len(matches) && i < offset+filters.PageSize; i++ {
+		delivery := *matches[i]
+		deliveries = append(deliveries, &delivery)
+	}
+
+	metadata := calculateMetadata(len(matches), filters)
+
+	return deliveries, metadata, nil
+}
+
+// Replay sends the delivery again from the first attempt
+func (m WebhookDeliveryModel) Replay(subscriptionID uuid.UUID, id int64) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	for _, delivery := range m.store.deliveries {
+		if delivery.ID == id && delivery.SubscriptionID == subscriptionID {
+			delivery.Status = data.WebhookDeliveryPending
+			delivery.Attempts = 0
+			delivery.NextAttemptAt = time.Now()
+			return nil
+		}
+	}
+
+	return data.ErrRecordNotFound
+}
+
+// Claim returns the pending deliveries that are due, with the URL and the secret
+// of their subscription, the deliveries are postponed by the lease
+func (m WebhookDeliveryModel) Claim(limit int, lease time.Duration) ([]*data.WebhookDelivery, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	var due []*data.WebhookDelivery
+	for _, delivery := range m.store.deliveries {
+		if delivery.Status == data.WebhookDeliveryPending && !delivery.NextAttemptAt.After(time.Now()) {
+			due = append(due, delivery)
+		}
+	}
+
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+	})
+
+	deliveries := []*data.WebhookDelivery{}
+
+	for _, delivery := range due {
+		if len(deliveries) == limit {
+			break
+		}
+
+		delivery.NextAttemptAt = time.Now().Add(lease)
+
+		subscription := m.store.webhooks[delivery.SubscriptionID]
+
+		claimed := *delivery
+		claimed.URL = subscription.URL
+		claimed.Secret = subscription.Secret
+		deliveries = append(deliveries, &claimed)
+	}
+
+	return deliveries, nil
+}
+
+// Record writes the result of an attempt of the delivery
+func (m WebhookDeliveryModel) Record(delivery *data.WebhookDelivery) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	for _, stored := range m.store.deliveries {
+		if stored.ID == delivery.ID {
+			stored.Status = delivery.Status
+			stored.Attempts = delivery.Attempts
+			stored.NextAttemptAt = delivery.NextAttemptAt
+			stored.LastAttemptAt = delivery.LastAttemptAt
+			stored.LastStatus = delivery.LastStatus
+			stored.LastError = delivery.LastError
+		}
+	}
+
+	return nil
+}
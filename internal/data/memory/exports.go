@@ -0,0 +1,100 @@
+package memory
+
+import (
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
+	"github.com/google/uuid"
+)
+
+// userExport is a row of the exports with its archive
+type userExport struct {
+	data.Export
+	archive []byte
+}
+
+type ExportModel struct {
+	store *Store
+}
+
+func (m ExportModel) Insert(export *data.Export) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	if _, ok := m.store.users[export.UserID]; !ok {
+		return data.ErrRecordNotFound
+	}
+
+	export.ID = uuid.New()
+	export.Status = data.ExportPending
+	export.CreatedAt = now()
+
+	m.store.exports[export.ID] = userExport{Export: *export}
+
+	return nil
+}
+
+func (m ExportModel) Get(id uuid.UUID, userID uuid.UUID) (*data.Export, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	export, ok := m.store.exports[id]
+	if !ok || export.UserID != userID {
+		return nil, data.ErrRecordNotFound
+	}
+
+	return &export.Export, nil
+}
+
+func (m ExportModel) GetArchive(id uuid.UUID, userID uuid.UUID) ([]byte, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	export, ok := m.store.exports[id]
+	if !ok || export.UserID != userID || export.Status != data.ExportReady {
+		return nil, data.ErrRecordNotFound
+	}
+
+	return export.archive, nil
+}
+
+func (m ExportModel) Complete(id uuid.UUID, archive []byte) error {
+	return m.finish(id, data.ExportReady, archive)
+}
+
+func (m ExportModel) Fail(id uuid.UUID) error {
+	return m.finish(id, data.ExportFailed, nil)
+}
+
+func (m ExportModel) finish(id uuid.UUID, status string, archive []byte) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	export, ok := m.store.exports[id]
+	if !ok || export.Status != data.ExportPending {
+		return data.ErrRecordNotFound
+	}
+
+	completedAt := now()
+
+	export.Status = status
+	export.CompletedAt = &completedAt
+	export.archive = archive
+
+	m.store.exports[id] = export
+
+	return nil
+}
+
+func (m ExportModel) DeleteExpired(before time.Time) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	for id, export := range m.store.exports {
+		if export.ExpiresAt.Before(before) {
+			delete(m.store.exports, id)
+		}
+	}
+
+	return nil
+}
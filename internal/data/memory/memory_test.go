@@ -0,0 +1,302 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
+	"github.com/e-inwork-com/go-user-service/internal/data/mocks"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func testUser(email, firstName string) *data.User {
+	user := &data.User{Email: email, FirstName: firstName, LastName: "Doe"}
+	mocks.MockSetPassword(user)
+
+	return user
+}
+
+func TestUsers(t *testing.T) {
+	ctx := context.Background()
+	users := New().Models().Users
+
+	jon := testUser("jon@doe.com", "Jon")
+	assert.Nil(t, users.Insert(ctx, jon))
+	assert.NotEqual(t, uuid.Nil, jon.ID)
+	assert.Equal(t, 1, jon.Version)
+
+	nina := testUser("nina@doe.com", "Nina")
+	assert.Nil(t, users.Insert(ctx, nina))
+	assert.NotEqual(t, jon.ID, nina.ID)
+
+	t.Run("Duplicate Email", func(t *testing.T) {
+		assert.ErrorIs(t, users.Insert(ctx, testUser("jon@doe.com", "Other")), data.ErrDuplicateEmail)
+
+		user, err := users.GetByID(ctx, nina.ID)
+		assert.Nil(t, err)
+
+		user.Email = "jon@doe.com"
+		assert.ErrorIs(t, users.Update(ctx, user), data.ErrDuplicateEmail)
+	})
+
+	t.Run("Edit Conflict", func(t *testing.T) {
+		first, err := users.GetByEmail(ctx, "jon@doe.com")
+		assert.Nil(t, err)
+		second, err := users.GetByEmail(ctx, "jon@doe.com")
+		assert.Nil(t, err)
+
+		first.FirstName = "Jonathan"
+		assert.Nil(t, users.Update(ctx, first))
+		assert.Equal(t, 2, first.Version)
+
+		second.FirstName = "Johnny"
+		assert.ErrorIs(t, users.Update(ctx, second), data.ErrEditConflict)
+
+		user, err := users.GetByID(ctx, jon.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, "Jonathan", user.FirstName)
+
+		matches, err := user.Password.Matches("pa55word")
+		assert.Nil(t, err)
+		assert.True(t, matches)
+	})
+
+	t.Run("Stored Copies", func(t *testing.T) {
+		user, err := users.GetByID(ctx, nina.ID)
+		assert.Nil(t, err)
+
+		user.FirstName = "Changed"
+
+		user, err = users.GetByID(ctx, nina.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, "Nina", user.FirstName)
+	})
+
+	t.Run("Not Found", func(t *testing.T) {
+		_, err := users.GetByID(ctx, uuid.New())
+		assert.ErrorIs(t, err, data.ErrRecordNotFound)
+
+		_, err = users.GetByEmail(ctx, "nobody@doe.com")
+		assert.ErrorIs(t, err, data.ErrRecordNotFound)
+
+		assert.ErrorIs(t, users.Delete(ctx, uuid.New()), data.ErrRecordNotFound)
+		assert.ErrorIs(t, users.Update(ctx, &data.User{ID: uuid.New(), Version: 1}), data.ErrEditConflict)
+	})
+
+	t.Run("Cancelled Context", func(t *testing.T) {
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		_, err := users.GetByID(cancelled, jon.ID)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestGetForToken(t *testing.T) {
+	ctx := context.Background()
+	models := New().Models()
+
+	user := testUser("jon@doe.com", "Jon")
+	assert.Nil(t, models.Users.Insert(ctx, user))
+
+	token, err := models.Tokens.New(user.ID, time.Hour, data.ScopeActivation)
+	assert.Nil(t, err)
+
+	expired, err := models.Tokens.New(user.ID, -time.Hour, data.ScopeActivation)
+	assert.Nil(t, err)
+
+	found, err := models.Users.GetForToken(ctx, data.ScopeActivation, token.Plaintext)
+	assert.Nil(t, err)
+	assert.Equal(t, user.ID, found.ID)
+
+	_, err = models.Users.GetForToken(ctx, data.ScopePasswordReset, token.Plaintext)
+	assert.ErrorIs(t, err, data.ErrRecordNotFound)
+
+	_, err = models.Users.GetForToken(ctx, data.ScopeActivation, expired.Plaintext)
+	assert.ErrorIs(t, err, data.ErrRecordNotFound)
+
+	// The tokens are deleted with the user
+	assert.Nil(t, models.Users.Delete(ctx, user.ID))
+
+	_, err = models.Users.GetForToken(ctx, data.ScopeActivation, token.Plaintext)
+	assert.ErrorIs(t, err, data.ErrRecordNotFound)
+}
+
+func TestGetAll(t *testing.T) {
+	ctx := context.Background()
+	users := New().Models().Users
+
+	for _, name := range []string{"Carl", "Anna", "Bob", "Dora", "Eve"} {
+		assert.Nil(t, users.Insert(ctx, testUser(name+"@doe.com", name)))
+	}
+
+	filters := data.UserFilters{
+		Filters: data.Filters{Page: 2, PageSize: 2, Sort: "first_name_t", SortSafelist: data.UserSortSafelist},
+	}
+
+	page, metadata, err := users.GetAll(ctx, filters)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, metadata.TotalRecords)
+	assert.Equal(t, 3, metadata.LastPage)
+	assert.Len(t, page, 2)
+	assert.Equal(t, "Carl", page[0].FirstName)
+	assert.Equal(t, "Dora", page[1].FirstName)
+
+	filters.Page = 1
+	filters.Name = "A D"
+
+	page, metadata, err = users.GetAll(ctx, filters)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, metadata.TotalRecords)
+	assert.Equal(t, "Anna", page[0].FirstName)
+	assert.Equal(t, "Dora", page[1].FirstName)
+
+	// The cursors read every user once in the sort order
+	filters.Name = ""
+	filters.Sort = "-first_name_t"
+
+	var names []string
+
+	for {
+		page, metadata, err = users.GetAllAfter(ctx, filters)
+		assert.Nil(t, err)
+
+		for _, user := range page {
+			names = append(names, user.FirstName)
+		}
+
+		if metadata.NextCursor == "" {
+			break
+		}
+
+		filters.Cursor, err = data.DecodeCursor(metadata.NextCursor)
+		assert.Nil(t, err)
+	}
+
+	assert.Equal(t, []string{"Eve", "Dora", "Carl", "Bob", "Anna"}, names)
+}
+
+func TestEvents(t *testing.T) {
+	ctx := context.Background()
+	models := New().Models()
+
+	subscription := &data.WebhookSubscription{URL: "https://example.com", Events: []string{data.EventUserDeleted}, Active: true}
+	assert.Nil(t, models.Webhooks.Insert(subscription))
+
+	user := testUser("jon@doe.com", "Jon")
+	assert.Nil(t, models.Users.Insert(ctx, user))
+
+	user.Activated = true
+	user.Email = "jonathan@doe.com"
+	assert.Nil(t, models.Users.Update(ctx, user))
+	assert.Nil(t, models.Users.Delete(ctx, user.ID))
+
+	var types []string
+
+	published, err := models.Outbox.Relay(10, func(event *data.Event) error {
+		assert.Equal(t, user.ID, event.UserID)
+		types = append(types, event.Type)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 5, published)
+	assert.Equal(t, []string{
+		data.EventUserCreated,
+		data.EventUserUpdated,
+		data.EventUserActivated,
+		data.EventUserEmailChanged,
+		data.EventUserDeleted,
+	}, types)
+
+	// The events are only published once
+	published, err = models.Outbox.Relay(10, func(event *data.Event) error { return nil })
+	assert.Nil(t, err)
+	assert.Equal(t, 0, published)
+
+	// Only the event of the subscription is delivered
+	deliveries, err := models.WebhookDeliveries.Claim(10, time.Minute)
+	assert.Nil(t, err)
+	assert.Len(t, deliveries, 1)
+	assert.Equal(t, data.EventUserDeleted, deliveries[0].Type)
+	assert.Equal(t, subscription.URL, deliveries[0].URL)
+
+	// The claimed delivery waits for the lease
+	deliveries, err = models.WebhookDeliveries.Claim(10, time.Minute)
+	assert.Nil(t, err)
+	assert.Empty(t, deliveries)
+}
+
+func TestWebhooks(t *testing.T) {
+	ctx := context.Background()
+	models := New().Models()
+
+	urls := []string{"https://a.example.com", "https://b.example.com", "https://c.example.com"}
+
+	for _, url := range urls {
+		subscription := &data.WebhookSubscription{URL: url, Events: []string{"*"}, Active: true}
+		assert.Nil(t, models.Webhooks.Insert(subscription))
+	}
+
+	// Every subscription is listed once
+	subscriptions, err := models.Webhooks.GetAll()
+	assert.Nil(t, err)
+	assert.Len(t, subscriptions, len(urls))
+
+	ids := make(map[uuid.UUID]bool)
+	var listed []string
+
+	for _, subscription := range subscriptions {
+		ids[subscription.ID] = true
+		listed = append(listed, subscription.URL)
+	}
+
+	assert.Len(t, ids, len(urls))
+	assert.ElementsMatch(t, urls, listed)
+
+	// An event is delivered to every subscription
+	assert.Nil(t, models.Users.Insert(ctx, testUser("jon@doe.com", "Jon")))
+
+	deliveries, err := models.WebhookDeliveries.Claim(10, time.Minute)
+	assert.Nil(t, err)
+	assert.Len(t, deliveries, len(urls))
+
+	var delivered []string
+	for _, delivery := range deliveries {
+		delivered = append(delivered, delivery.URL)
+	}
+
+	assert.ElementsMatch(t, urls, delivered)
+}
+
+func TestConcurrentInsert(t *testing.T) {
+	users := New().Models().Users
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- users.Insert(context.Background(), testUser("jon@doe.com", "Jon"))
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	// Only one of the users with the same email is stored
+	inserted := 0
+	for err := range errs {
+		if err == nil {
+			inserted++
+		} else {
+			assert.ErrorIs(t, err, data.ErrDuplicateEmail)
+		}
+	}
+
+	assert.Equal(t, 1, inserted)
+}
@@ -0,0 +1,217 @@
+package memory
+
+import (
+	"sort"
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
+	"github.com/google/uuid"
+)
+
+type TOTPModel struct {
+	store *Store
+}
+
+// Upsert stores a new secret, the enrollment must be enabled again
+func (m TOTPModel) Upsert(totp *data.TOTP) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	if _, ok := m.store.users[totp.UserID]; !ok {
+		return data.ErrRecordNotFound
+	}
+
+	totp.CreatedAt = now()
+	totp.Enabled = false
+	totp.LastUsedStep = 0
+
+	m.store.totp[totp.UserID] = *totp
+
+	return nil
+}
+
+func (m TOTPModel) GetByUserID(userID uuid.UUID) (*data.TOTP, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	totp, ok := m.store.totp[userID]
+	if !ok {
+		return nil, data.ErrRecordNotFound
+	}
+
+	return &totp, nil
+}
+
+func (m TOTPModel) Enable(totp *data.TOTP) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	if stored, ok := m.store.totp[totp.UserID]; ok {
+		stored.Enabled = true
+		m.store.totp[totp.UserID] = stored
+	}
+
+	totp.Enabled = true
+	return nil
+}
+
+// UseStep records the time step of an accepted code, it returns false
+// if a code of the same or of a newer step was already used
+func (m TOTPModel) UseStep(totp *data.TOTP, step int64) (bool, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	stored, ok := m.store.totp[totp.UserID]
+	if !ok || stored.LastUsedStep >= step {
+		return false, nil
+	}
+
+	stored.LastUsedStep = step
+	m.store.totp[totp.UserID] = stored
+
+	totp.LastUsedStep = step
+	return true, nil
+}
+
+func (m TOTPModel) Delete(userID uuid.UUID) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	delete(m.store.totp, userID)
+
+	return nil
+}
+
+type RecoveryCodeModel struct {
+	store *Store
+}
+
+// Replace removes the existing recovery codes of the user,
+// and stores the hashes of the new codes
+func (m RecoveryCodeModel) Replace(userID uuid.UUID, codes []string) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	if _, ok := m.store.users[userID]; !ok {
+		return data.ErrRecordNotFound
+	}
+
+	// The value of a hash is whether the code is used
+	hashes := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		hashes[string(data.HashRecoveryCode(code))] = false
+	}
+
+	m.store.recoveryCodes[userID] = hashes
+
+	return nil
+}
+
+// Use marks the recovery code as used, it returns false
+// if the code doesn't exist or was already used
+func (m RecoveryCodeModel) Use(userID uuid.UUID, code string) (bool, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	hash := string(data.HashRecoveryCode(code))
+
+	used, ok := m.store.recoveryCodes[userID][hash]
+	if !ok || used {
+		return false, nil
+	}
+
+	m.store.recoveryCodes[userID][hash] = true
+
+	return true, nil
+}
+
+type WebAuthnCredentialModel struct {
+	store *Store
+}
+
+func (m WebAuthnCredentialModel) Insert(credential *data.WebAuthnCredential) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	if _, ok := m.store.credentials[string(credential.ID)]; ok {
+		return data.ErrDuplicateCredential
+	}
+
+	if _, ok := m.store.users[credential.UserID]; !ok {
+		return data.ErrRecordNotFound
+	}
+
+	credential.CreatedAt = now()
+	m.store.credentials[string(credential.ID)] = *credential
+
+	return nil
+}
+
+func (m WebAuthnCredentialModel) GetByID(id []byte) (*data.WebAuthnCredential, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	credential, ok := m.store.credentials[string(id)]
+	if !ok {
+		return nil, data.ErrRecordNotFound
+	}
+
+	return &credential, nil
+}
+
+func (m WebAuthnCredentialModel) GetAllForUser(userID uuid.UUID) ([]*data.WebAuthnCredential, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	credentials := []*data.WebAuthnCredential{}
+
+	for _, credential := range m.store.credentials {
+		if credential.UserID == userID {
+			credential := credential
+			credentials = append(credentials, &credential)
+		}
+	}
+
+	sort.Slice(credentials, func(i, j int) bool {
+		return credentials[i].CreatedAt.Before(credentials[j].CreatedAt)
+	})
+
+	return credentials, nil
+}
+
+// UseSignCount stores the sign count of an assertion, it returns false if the
+// sign count didn't increase, which is a sign of a cloned authenticator.
+// The authenticators that don't count the signatures always send zero
+func (m WebAuthnCredentialModel) UseSignCount(credential *data.WebAuthnCredential, signCount uint32) (bool, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	stored, ok := m.store.credentials[string(credential.ID)]
+	if !ok || !(stored.SignCount < signCount || (signCount == 0 && stored.SignCount == 0)) {
+		return false, nil
+	}
+
+	now := time.Now()
+
+	stored.SignCount = signCount
+	stored.LastUsedAt = &now
+	m.store.credentials[string(credential.ID)] = stored
+
+	credential.SignCount = signCount
+	credential.LastUsedAt = &now
+	return true, nil
+}
+
+func (m WebAuthnCredentialModel) Delete(id []byte, userID uuid.UUID) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	credential, ok := m.store.credentials[string(id)]
+	if !ok || credential.UserID != userID {
+		return data.ErrRecordNotFound
+	}
+
+	delete(m.store.credentials, string(id))
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
+)
+
+type UserSearchModel struct {
+	store *Store
+}
+
+// Search returns a page of the users with the query in the first name, the last name
+// or the email in any case, without the misspellings of the trigram search. The score
+// is the best share of a field matched by the query
+func (m UserSearchModel) Search(ctx context.Context, query string, filters data.Filters) ([]*data.UserSearchResult, data.Metadata, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, data.Metadata{}, err
+	}
+
+	m.store.mu.Lock()
+
+	query = strings.ToLower(query)
+
+	var results []*data.UserSearchResult
+
+	for _, user := range m.store.users {
+		score := 0.0
+
+		for _, field := range []string{user.FirstName, user.LastName, user.Email} {
+			if field != "" && strings.Contains(strings.ToLower(field), query) {
+				if s := float64(len(query)) / float64(len(field)); s > score {
+					score = s
+				}
+			}
+		}
+
+		if score > 0 {
+			user := user
+			results = append(results, &data.UserSearchResult{User: &user, Score: score})
+		}
+	}
+
+	m.store.mu.Unlock()
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return bytes.Compare(results[i].ID[:], results[j].ID[:]) < 0
+	})
+
+	page := []*data.UserSearchResult{}
+	offset := (filters.Page - 1) * filters.PageSize
+
+	for i := offset; i < len(results) && i < offset+filters.PageSize; i++ {
+		page = append(page, results[i])
+	}
+
+	metadata := calculateMetadata(len(results), filters)
+
+	return page, metadata, nil
+}
@@ -0,0 +1,222 @@
+// Package memory keeps the data of the service in memory, with the semantics
+// of the Postgres models, to run the service and its tests without a database
+package memory
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
+	"github.com/google/uuid"
+)
+
+// rolePermissions are the roles created by the migrations with their permissions
+var rolePermissions = map[string]data.Permissions{
+	"support": {data.PermissionUsersRead},
+	"admin":   {data.PermissionUsersAdmin, data.PermissionUsersRead, data.PermissionUsersWrite},
+}
+
+// outboxEvent is a row of the outbox
+type outboxEvent struct {
+	id          int64
+	event       data.Event
+	publishedAt *time.Time
+	lastError   string
+}
+
+// deletedUser is a user marked as deleted until it is purged
+type deletedUser struct {
+	user      data.User
+	deletedAt time.Time
+}
+
+// Store keeps the tables, the models of a store share its data,
+// and the data of a user is deleted with the user
+type Store struct {
+	mu sync.Mutex
+
+	users         map[uuid.UUID]data.User
+	deletedUsers  map[uuid.UUID]deletedUser
+	purges        []data.UserPurge
+	tokens        []data.Token
+	refreshTokens map[string]data.RefreshToken
+	revokedTokens map[string]revokedToken
+	userRoles     map[uuid.UUID]map[string]bool
+	totp          map[uuid.UUID]data.TOTP
+	recoveryCodes map[uuid.UUID]map[string]bool
+	credentials   map[string]data.WebAuthnCredential
+
+	outbox       []*outboxEvent
+	lastOutboxID int64
+
+	// relayMu is held by the relay like the advisory lock of Postgres
+	relayMu sync.Mutex
+
+	webhooks       map[uuid.UUID]data.WebhookSubscription
+	deliveries     []*data.WebhookDelivery
+	lastDeliveryID int64
+
+	exports map[uuid.UUID]userExport
+
+	auditEvents      []*data.AuditEvent
+	lastAuditEventID int64
+}
+
+func New() *Store {
+	return &Store{
+		users:         make(map[uuid.UUID]data.User),
+		deletedUsers:  make(map[uuid.UUID]deletedUser),
+		refreshTokens: make(map[string]data.RefreshToken),
+		revokedTokens: make(map[string]revokedToken),
+		userRoles:     make(map[uuid.UUID]map[string]bool),
+		totp:          make(map[uuid.UUID]data.TOTP),
+		recoveryCodes: make(map[uuid.UUID]map[string]bool),
+		credentials:   make(map[string]data.WebAuthnCredential),
+		webhooks:      make(map[uuid.UUID]data.WebhookSubscription),
+		exports:       make(map[uuid.UUID]userExport),
+	}
+}
+
+// Models returns the models of the store
+func (s *Store) Models() data.Models {
+	return data.Models{
+		Users:             UserModel{s},
+		Permissions:       PermissionModel{s},
+		RefreshTokens:     RefreshTokenModel{s},
+		RevokedTokens:     RevokedTokenModel{s},
+		Tokens:            TokenModel{s},
+		TOTP:              TOTPModel{s},
+		RecoveryCodes:     RecoveryCodeModel{s},
+		WebAuthn:          WebAuthnCredentialModel{s},
+		Search:            UserSearchModel{s},
+		Outbox:            OutboxModel{s},
+		Webhooks:          WebhookModel{s},
+		WebhookDeliveries: WebhookDeliveryModel{s},
+		Exports:           ExportModel{s},
+		AuditEvents:       AuditEventModel{s},
+	}
+}
+
+// now returns the time in the precision of the timestamp columns
+func now() time.Time {
+	return time.Now().Truncate(time.Second)
+}
+
+// calculateMetadata returns the metadata of a page like the Postgres models
+func calculateMetadata(totalRecords int, filters data.Filters) data.Metadata {
+	if totalRecords == 0 {
+		return data.Metadata{}
+	}
+
+	return data.Metadata{
+		CurrentPage:  filters.Page,
+		PageSize:     filters.PageSize,
+		FirstPage:    1,
+		LastPage:     (totalRecords + filters.PageSize - 1) / filters.PageSize,
+		TotalRecords: totalRecords,
+	}
+}
+
+// deleteUserData removes the rows referencing the user, like the cascades
+// of the foreign keys, the store must be locked. The audit events outlive
+// the user until their retention
+func (s *Store) deleteUserData(id uuid.UUID) {
+	tokens := s.tokens[:0]
+	for _, token := range s.tokens {
+		if token.UserID != id {
+			tokens = append(tokens, token)
+		}
+	}
+	s.tokens = tokens
+
+	for hash, token := range s.refreshTokens {
+		if token.UserID == id {
+			delete(s.refreshTokens, hash)
+		}
+	}
+
+	for jti, token := range s.revokedTokens {
+		if token.userID == id {
+			delete(s.revokedTokens, jti)
+		}
+	}
+
+	for key, credential := range s.credentials {
+		if credential.UserID == id {
+			delete(s.credentials, key)
+		}
+	}
+
+	for exportID, export := range s.exports {
+		if export.UserID == id {
+			delete(s.exports, exportID)
+		}
+	}
+
+	delete(s.userRoles, id)
+	delete(s.totp, id)
+	delete(s.recoveryCodes, id)
+}
+
+// scrubEvents replaces the data of the events of a purged user by its ID,
+// in the outbox and in the deliveries of the webhooks, the store must be locked
+func (s *Store) scrubEvents(userID uuid.UUID) {
+	scrubbed, _ := json.Marshal(map[string]uuid.UUID{"id": userID})
+
+	for _, row := range s.outbox {
+		if row.event.UserID == userID {
+			row.event.Data = scrubbed
+		}
+	}
+
+	for _, delivery := range s.deliveries {
+		var event data.Event
+
+		if json.Unmarshal(delivery.Payload, &event) != nil || event.UserID != userID {
+			continue
+		}
+
+		event.Data = scrubbed
+		delivery.Payload, _ = json.Marshal(event)
+	}
+}
+
+// insertEvents writes the events of the user to the outbox with their
+// deliveries to the webhooks, the store must be locked
+func (s *Store) insertEvents(user *data.User, types ...string) error {
+	payload, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+
+	return s.insertEventsData(user.ID, payload, types...)
+}
+
+// insertEventsData writes the events of the user like insertEvents,
+// with the data of the payload, the store must be locked
+func (s *Store) insertEventsData(userID uuid.UUID, payload []byte, types ...string) error {
+	for _, eventType := range types {
+		s.lastOutboxID++
+
+		row := &outboxEvent{
+			id: s.lastOutboxID,
+			event: data.Event{
+				ID:        uuid.New(),
+				Type:      eventType,
+				UserID:    userID,
+				CreatedAt: now(),
+				Data:      payload,
+			},
+		}
+
+		s.outbox = append(s.outbox, row)
+
+		err := s.insertWebhookDeliveries(&row.event)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
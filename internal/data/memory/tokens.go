@@ -0,0 +1,262 @@
+package memory
+
+import (
+	"crypto/sha256"
+	"sort"
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
+	"github.com/google/uuid"
+)
+
+type TokenModel struct {
+	store *Store
+}
+
+func (m TokenModel) New(userID uuid.UUID, ttl time.Duration, scope string) (*data.Token, error) {
+	token, err := data.GenerateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.Insert(token)
+	return token, err
+}
+
+func (m TokenModel) Insert(token *data.Token) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	if _, ok := m.store.users[token.UserID]; !ok {
+		return data.ErrRecordNotFound
+	}
+
+	m.store.tokens = append(m.store.tokens, *token)
+
+	return nil
+}
+
+func (m TokenModel) DeleteAllForUser(scope string, userID uuid.UUID) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	tokens := m.store.tokens[:0]
+	for _, token := range m.store.tokens {
+		if token.Scope != scope || token.UserID != userID {
+			tokens = append(tokens, token)
+		}
+	}
+	m.store.tokens = tokens
+
+	return nil
+}
+
+type RefreshTokenModel struct {
+	store *Store
+}
+
+func (m RefreshTokenModel) New(userID uuid.UUID, familyID uuid.UUID, ttl time.Duration) (*data.RefreshToken, error) {
+	token, err := data.GenerateRefreshToken(userID, familyID, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.Insert(token)
+	return token, err
+}
+
+func (m RefreshTokenModel) Insert(token *data.RefreshToken) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	if _, ok := m.store.users[token.UserID]; !ok {
+		return data.ErrRecordNotFound
+	}
+
+	stored := *token
+	stored.Plaintext = ""
+	stored.CreatedAt = now()
+	m.store.refreshTokens[string(token.Hash)] = stored
+
+	return nil
+}
+
+func (m RefreshTokenModel) GetByPlaintext(plaintext string) (*data.RefreshToken, error) {
+	hash := sha256.Sum256([]byte(plaintext))
+
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	token, ok := m.store.refreshTokens[string(hash[:])]
+	if !ok {
+		return nil, data.ErrRecordNotFound
+	}
+
+	return &token, nil
+}
+
+// MarkUsed flags the token as exchanged, it returns ErrRefreshTokenReused
+// if another request has already exchanged the same token
+func (m RefreshTokenModel) MarkUsed(token *data.RefreshToken) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	stored, ok := m.store.refreshTokens[string(token.Hash)]
+	if !ok || stored.Used {
+		return data.ErrRefreshTokenReused
+	}
+
+	stored.Used = true
+	m.store.refreshTokens[string(token.Hash)] = stored
+	token.Used = true
+
+	return nil
+}
+
+func (m RefreshTokenModel) RevokeFamily(familyID uuid.UUID) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	for hash, token := range m.store.refreshTokens {
+		if token.FamilyID == familyID {
+			token.Revoked = true
+			m.store.refreshTokens[hash] = token
+		}
+	}
+
+	return nil
+}
+
+// GetAllForUser returns the refresh tokens of the user in the order they were issued
+func (m RefreshTokenModel) GetAllForUser(userID uuid.UUID) ([]*data.RefreshToken, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	tokens := []*data.RefreshToken{}
+
+	for _, token := range m.store.refreshTokens {
+		if token.UserID == userID {
+			token := token
+			tokens = append(tokens, &token)
+		}
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		if !tokens[i].CreatedAt.Equal(tokens[j].CreatedAt) {
+			return tokens[i].CreatedAt.Before(tokens[j].CreatedAt)
+		}
+		return string(tokens[i].Hash) < string(tokens[j].Hash)
+	})
+
+	return tokens, nil
+}
+
+func (m RefreshTokenModel) DeleteAllForUser(userID uuid.UUID) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	for hash, token := range m.store.refreshTokens {
+		if token.UserID == userID {
+			delete(m.store.refreshTokens, hash)
+		}
+	}
+
+	return nil
+}
+
+// revokedToken is a row of the revoked access tokens
+type revokedToken struct {
+	userID uuid.UUID
+	expiry time.Time
+}
+
+type RevokedTokenModel struct {
+	store *Store
+}
+
+func (m RevokedTokenModel) Insert(jti string, userID uuid.UUID, expiry time.Time) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	if _, ok := m.store.revokedTokens[jti]; !ok {
+		m.store.revokedTokens[jti] = revokedToken{userID: userID, expiry: expiry}
+	}
+
+	return nil
+}
+
+func (m RevokedTokenModel) Exists(jti string) (bool, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	_, ok := m.store.revokedTokens[jti]
+
+	return ok, nil
+}
+
+// DeleteExpired removes the revoked tokens that can't be used anymore anyway
+func (m RevokedTokenModel) DeleteExpired() error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	for jti, token := range m.store.revokedTokens {
+		if token.expiry.Before(time.Now()) {
+			delete(m.store.revokedTokens, jti)
+		}
+	}
+
+	return nil
+}
+
+type PermissionModel struct {
+	store *Store
+}
+
+func (m PermissionModel) GetAllForUser(userID uuid.UUID) (data.Permissions, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	codes := make(map[string]bool)
+	for role := range m.store.userRoles[userID] {
+		for _, code := range rolePermissions[role] {
+			codes[code] = true
+		}
+	}
+
+	var permissions data.Permissions
+	for code := range codes {
+		permissions = append(permissions, code)
+	}
+
+	sort.Strings(permissions)
+
+	return permissions, nil
+}
+
+// AddRolesForUser gives the roles to the user, the unknown roles are ignored
+func (m PermissionModel) AddRolesForUser(userID uuid.UUID, roles ...string) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	if _, ok := m.store.users[userID]; !ok {
+		return data.ErrRecordNotFound
+	}
+
+	for _, role := range roles {
+		if _, ok := rolePermissions[role]; !ok {
+			continue
+		}
+
+		if m.store.userRoles[userID] == nil {
+			m.store.userRoles[userID] = make(map[string]bool)
+		}
+
+		// The roles given are recorded like the trigger of the database
+		if !m.store.userRoles[userID][role] {
+			m.store.insertAuditEvent(&data.AuditEvent{UserID: userID, Type: data.AuditRoleAdded, Details: role})
+		}
+		m.store.userRoles[userID][role] = true
+	}
+
+	return nil
+}
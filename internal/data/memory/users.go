@@ -0,0 +1,447 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
+	"github.com/google/uuid"
+)
+
+type UserModel struct {
+	store *Store
+}
+
+// Insert stores the user with a new ID and the "user.created" event,
+// it returns ErrDuplicateEmail if another user has the canonical email
+func (m UserModel) Insert(ctx context.Context, user *data.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	user.Email = data.NormalizeEmail(user.Email)
+
+	if m.store.emailTaken(user.Email, uuid.Nil) {
+		return data.ErrDuplicateEmail
+	}
+
+	user.ID = uuid.New()
+	user.CreatedAt = now()
+	user.Version = 1
+
+	if user.TokensValidAfter.IsZero() {
+		user.TokensValidAfter = time.Unix(0, 0)
+	}
+
+	m.store.users[user.ID] = *user
+
+	return m.store.insertEvents(user, data.EventUserCreated)
+}
+
+func (m UserModel) GetByEmail(ctx context.Context, email string) (*data.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	for _, user := range m.store.users {
+		if data.CanonicalEmail(user.Email) == data.CanonicalEmail(email) {
+			return &user, nil
+		}
+	}
+
+	return nil, data.ErrRecordNotFound
+}
+
+func (m UserModel) GetByID(ctx context.Context, id uuid.UUID) (*data.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	user, ok := m.store.users[id]
+	if !ok {
+		return nil, data.ErrRecordNotFound
+	}
+
+	return &user, nil
+}
+
+// Update stores the user if its version is the stored version, with the events
+// of the changes, it returns ErrEditConflict if the user was changed or deleted
+func (m UserModel) Update(ctx context.Context, user *data.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	current, ok := m.store.users[user.ID]
+	if !ok || current.Version != user.Version {
+		return data.ErrEditConflict
+	}
+
+	user.Email = data.NormalizeEmail(user.Email)
+	user.PendingEmail = data.NormalizeEmail(user.PendingEmail)
+
+	if m.store.emailTaken(user.Email, user.ID) {
+		return data.ErrDuplicateEmail
+	}
+
+	user.Version++
+	m.store.users[user.ID] = *user
+
+	events := []string{data.EventUserUpdated}
+	if user.Activated && !current.Activated {
+		events = append(events, data.EventUserActivated)
+	}
+	if user.Email != current.Email {
+		events = append(events, data.EventUserEmailChanged)
+	}
+
+	return m.store.insertEvents(user, events...)
+}
+
+// GetForToken gets the user of a token that has the scope and isn't expired
+func (m UserModel) GetForToken(ctx context.Context, tokenScope string, tokenPlaintext string) (*data.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	for _, token := range m.store.tokens {
+		if bytes.Equal(token.Hash, tokenHash[:]) && token.Scope == tokenScope && token.Expiry.After(time.Now()) {
+			// A restore token only gets a deleted user
+			if tokenScope == data.ScopeRestore {
+				deleted, ok := m.store.deletedUsers[token.UserID]
+				if ok {
+					return &deleted.user, nil
+				}
+				continue
+			}
+
+			user, ok := m.store.users[token.UserID]
+			if ok {
+				return &user, nil
+			}
+		}
+	}
+
+	return nil, data.ErrRecordNotFound
+}
+
+// Delete marks the user as deleted with the "user.deleted" event, the reads
+// ignore the deleted user and its tokens are revoked until it is purged
+func (m UserModel) Delete(ctx context.Context, id uuid.UUID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	user, ok := m.store.users[id]
+	if !ok {
+		return data.ErrRecordNotFound
+	}
+
+	deletedAt := now()
+
+	user.TokensValidAfter = deletedAt
+	user.Version++
+
+	delete(m.store.users, id)
+	m.store.deletedUsers[id] = deletedUser{user: user, deletedAt: deletedAt}
+
+	return m.store.insertEvents(&user, data.EventUserDeleted)
+}
+
+// Restore clears the deletion of a user deleted after the time with the "user.restored"
+// event, it returns ErrRecordNotFound if the user isn't deleted or was deleted before
+func (m UserModel) Restore(ctx context.Context, id uuid.UUID, deletedAfter time.Time) (*data.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	deleted, ok := m.store.deletedUsers[id]
+	if !ok || !deleted.deletedAt.After(deletedAfter) {
+		return nil, data.ErrRecordNotFound
+	}
+
+	user := deleted.user
+	user.Version++
+
+	delete(m.store.deletedUsers, id)
+	m.store.users[id] = user
+
+	err := m.store.insertEvents(&user, data.EventUserRestored)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// Purge removes the users deleted before the time with their data, the data
+// of their events is replaced by their ID, and the purges are recorded with
+// the "user.purged" event
+func (m UserModel) Purge(ctx context.Context, deletedBefore time.Time, limit int) ([]*data.UserPurge, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	var purges []*data.UserPurge
+
+	for id, deleted := range m.store.deletedUsers {
+		if deleted.deletedAt.Before(deletedBefore) {
+			purges = append(purges, &data.UserPurge{UserID: id, DeletedAt: deleted.deletedAt})
+		}
+	}
+
+	// The oldest deleted users are purged first
+	sort.Slice(purges, func(i, j int) bool {
+		return purges[i].DeletedAt.Before(purges[j].DeletedAt)
+	})
+
+	if len(purges) > limit {
+		purges = purges[:limit]
+	}
+
+	for _, purge := range purges {
+		delete(m.store.deletedUsers, purge.UserID)
+		m.store.deleteUserData(purge.UserID)
+		m.store.scrubEvents(purge.UserID)
+
+		purge.PurgedAt = now()
+		m.store.purges = append(m.store.purges, *purge)
+
+		payload, err := json.Marshal(purge)
+		if err != nil {
+			return nil, err
+		}
+
+		err = m.store.insertEventsData(purge.UserID, payload, data.EventUserPurged)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return purges, nil
+}
+
+// GetAll returns a page of the users, with the total number of users
+func (m UserModel) GetAll(ctx context.Context, filters data.UserFilters) ([]*data.User, data.Metadata, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, data.Metadata{}, err
+	}
+
+	users := m.store.filterUsers(filters)
+
+	sortUsers(users, filters.Sort, false)
+
+	totalRecords := len(users)
+	users = page(users, filters.Filters)
+
+	metadata := calculateMetadata(totalRecords, filters.Filters)
+
+	return users, metadata, nil
+}
+
+// GetAllAfter returns the users after the cursor of the filters,
+// the metadata has the cursor of the next page
+func (m UserModel) GetAllAfter(ctx context.Context, filters data.UserFilters) ([]*data.User, data.Metadata, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, data.Metadata{}, err
+	}
+
+	users := m.store.filterUsers(filters)
+
+	sortUsers(users, filters.Sort, true)
+
+	if filters.Cursor != nil {
+		after, err := cursorUser(filters.Cursor)
+		if err != nil {
+			return nil, data.Metadata{}, err
+		}
+
+		i := sort.Search(len(users), func(i int) bool {
+			return lessUsers(after, users[i], filters.Sort, true)
+		})
+		users = users[i:]
+	}
+
+	metadata := data.Metadata{PageSize: filters.PageSize}
+
+	if len(users) > filters.PageSize {
+		users = users[:filters.PageSize]
+		metadata.NextCursor = data.NewUserCursor(users[len(users)-1], filters.Sort).Encode()
+	}
+
+	return users, metadata, nil
+}
+
+// emailTaken reports whether a user other than the ID has the canonical email,
+// the deleted users keep their email until they are purged, the store must be locked
+func (s *Store) emailTaken(email string, id uuid.UUID) bool {
+	for _, user := range s.users {
+		if data.CanonicalEmail(user.Email) == data.CanonicalEmail(email) && user.ID != id {
+			return true
+		}
+	}
+
+	for _, deleted := range s.deletedUsers {
+		if data.CanonicalEmail(deleted.user.Email) == data.CanonicalEmail(email) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// filterUsers returns copies of the users matching the filters,
+// the email and the name match a part in any case like ILIKE
+func (s *Store) filterUsers(filters data.UserFilters) []*data.User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	email := strings.ToLower(filters.Email)
+	name := strings.ToLower(filters.Name)
+
+	users := []*data.User{}
+
+	for _, user := range s.users {
+		if !strings.Contains(strings.ToLower(user.Email), email) {
+			continue
+		}
+		if !strings.Contains(strings.ToLower(user.FirstName+" "+user.LastName), name) {
+			continue
+		}
+		if filters.Activated != nil && user.Activated != *filters.Activated {
+			continue
+		}
+		if filters.CreatedAfter != nil && user.CreatedAt.Before(*filters.CreatedAfter) {
+			continue
+		}
+		if filters.CreatedBefore != nil && !user.CreatedAt.Before(*filters.CreatedBefore) {
+			continue
+		}
+
+		user := user
+		users = append(users, &user)
+	}
+
+	return users
+}
+
+// page returns the users of the page of the filters
+func page(users []*data.User, filters data.Filters) []*data.User {
+	offset := (filters.Page - 1) * filters.PageSize
+	if offset >= len(users) {
+		return []*data.User{}
+	}
+
+	end := offset + filters.PageSize
+	if end > len(users) {
+		end = len(users)
+	}
+
+	return users[offset:end]
+}
+
+// sortUsers orders the users by the sort column, then by their ID
+// in ascending order, or in the sort direction for the cursors
+func sortUsers(users []*data.User, sortValue string, keyset bool) {
+	sort.Slice(users, func(i, j int) bool {
+		return lessUsers(users[i], users[j], sortValue, keyset)
+	})
+}
+
+func lessUsers(a, b *data.User, sortValue string, keyset bool) bool {
+	descending := strings.HasPrefix(sortValue, "-")
+
+	c := compareColumn(a, b, strings.TrimPrefix(sortValue, "-"))
+	if c == 0 {
+		c = bytes.Compare(a.ID[:], b.ID[:])
+		if !keyset {
+			return c < 0
+		}
+	}
+
+	if descending {
+		return c > 0
+	}
+
+	return c < 0
+}
+
+func compareColumn(a, b *data.User, column string) int {
+	switch column {
+	case "email_t":
+		return strings.Compare(a.Email, b.Email)
+	case "first_name_t":
+		return strings.Compare(a.FirstName, b.FirstName)
+	case "last_name_t":
+		return strings.Compare(a.LastName, b.LastName)
+	case "created_at_dt":
+		switch {
+		case a.CreatedAt.Before(b.CreatedAt):
+			return -1
+		case a.CreatedAt.After(b.CreatedAt):
+			return 1
+		}
+		return 0
+	default:
+		return bytes.Compare(a.ID[:], b.ID[:])
+	}
+}
+
+// cursorUser returns a user with the sort value and the ID of the cursor
+func cursorUser(cursor *data.Cursor) (*data.User, error) {
+	user := &data.User{ID: cursor.ID}
+
+	switch strings.TrimPrefix(cursor.Sort, "-") {
+	case "id":
+		id, err := uuid.Parse(cursor.Value)
+		if err != nil {
+			return nil, data.ErrInvalidCursor
+		}
+		user.ID = id
+	case "email_t":
+		user.Email = cursor.Value
+	case "first_name_t":
+		user.FirstName = cursor.Value
+	case "last_name_t":
+		user.LastName = cursor.Value
+	case "created_at_dt":
+		createdAt, err := time.Parse(time.RFC3339Nano, cursor.Value)
+		if err != nil {
+			return nil, data.ErrInvalidCursor
+		}
+		user.CreatedAt = createdAt
+	}
+
+	return user, nil
+}
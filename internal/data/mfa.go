@@ -0,0 +1,233 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type TOTPModelInterface interface {
+	Upsert(totp *TOTP) error
+	GetByUserID(userID uuid.UUID) (*TOTP, error)
+	Enable(totp *TOTP) error
+	UseStep(totp *TOTP, step int64) (bool, error)
+	Delete(userID uuid.UUID) error
+}
+
+type RecoveryCodeModelInterface interface {
+	Replace(userID uuid.UUID, codes []string) error
+	Use(userID uuid.UUID, code string) (bool, error)
+}
+
+// TOTP is the time-based one-time password enrollment of a user,
+// the secret is encrypted by the caller before it is stored
+type TOTP struct {
+	UserID           uuid.UUID
+	CreatedAt        time.Time
+	SecretCiphertext []byte
+	Enabled          bool
+	LastUsedStep     int64
+}
+
+// GenerateRecoveryCodes creates single-use codes in the form XXXXX-XXXXX
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+
+	for i := range codes {
+		randomBytes := make([]byte, 10)
+
+		_, err := rand.Read(randomBytes)
+		if err != nil {
+			return nil, err
+		}
+
+		code := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+	}
+
+	return codes, nil
+}
+
+// HashRecoveryCode returns the stored hash of the code,
+// it ignores the case and the dash of the code
+func HashRecoveryCode(code string) []byte {
+	normalized := strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+
+	hash := sha256.Sum256([]byte(normalized))
+	return hash[:]
+}
+
+type TOTPModel struct {
+	DB *sql.DB
+}
+
+// Upsert stores a new secret, the enrollment must be enabled again
+func (m TOTPModel) Upsert(totp *TOTP) error {
+	query := `
+        INSERT INTO user_totp (user_id, secret_ciphertext, created_at_dt)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (user_id) DO UPDATE
+        SET secret_ciphertext = EXCLUDED.secret_ciphertext, enabled_b = false, last_used_step = 0, created_at_dt = EXCLUDED.created_at_dt
+        RETURNING created_at_dt, enabled_b, last_used_step`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, totp.UserID, totp.SecretCiphertext, time.Now().Truncate(time.Second)).Scan(
+		&totp.CreatedAt,
+		&totp.Enabled,
+		&totp.LastUsedStep,
+	)
+}
+
+func (m TOTPModel) GetByUserID(userID uuid.UUID) (*TOTP, error) {
+	query := `
+        SELECT user_id, created_at_dt, secret_ciphertext, enabled_b, last_used_step
+        FROM user_totp
+        WHERE user_id = $1`
+
+	var totp TOTP
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(
+		&totp.UserID,
+		&totp.CreatedAt,
+		&totp.SecretCiphertext,
+		&totp.Enabled,
+		&totp.LastUsedStep,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &totp, nil
+}
+
+func (m TOTPModel) Enable(totp *TOTP) error {
+	query := `
+        UPDATE user_totp
+        SET enabled_b = true
+        WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, totp.UserID)
+	if err != nil {
+		return err
+	}
+
+	totp.Enabled = true
+	return nil
+}
+
+// UseStep records the time step of an accepted code, it returns false
+// if a code of the same or of a newer step was already used
+func (m TOTPModel) UseStep(totp *TOTP, step int64) (bool, error) {
+	query := `
+        UPDATE user_totp
+        SET last_used_step = $1
+        WHERE user_id = $2 AND last_used_step < $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, step, totp.UserID)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	if rows == 0 {
+		return false, nil
+	}
+
+	totp.LastUsedStep = step
+	return true, nil
+}
+
+func (m TOTPModel) Delete(userID uuid.UUID) error {
+	query := `
+        DELETE FROM user_totp
+        WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	return err
+}
+
+type RecoveryCodeModel struct {
+	DB *sql.DB
+}
+
+// Replace removes the existing recovery codes of the user,
+// and stores the hashes of the new codes
+func (m RecoveryCodeModel) Replace(userID uuid.UUID, codes []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, code := range codes {
+		_, err = tx.ExecContext(ctx, `INSERT INTO recovery_codes (hash, user_id) VALUES ($1, $2)`, HashRecoveryCode(code), userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Use marks the recovery code as used, it returns false
+// if the code doesn't exist or was already used
+func (m RecoveryCodeModel) Use(userID uuid.UUID, code string) (bool, error) {
+	query := `
+        UPDATE recovery_codes
+        SET used_at_dt = $3
+        WHERE hash = $1 AND user_id = $2 AND used_at_dt IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, HashRecoveryCode(code), userID, time.Now())
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows == 1, nil
+}
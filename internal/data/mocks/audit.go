@@ -0,0 +1,46 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
+)
+
+type AuditEventModel struct{}
+
+func (m AuditEventModel) Insert(event *data.AuditEvent) error {
+	event.ID = 1
+	event.CreatedAt = time.Now()
+
+	return nil
+}
+
+// GetAll returns a login of the first user
+func (m AuditEventModel) GetAll(filters data.AuditEventFilters) ([]*data.AuditEvent, data.Metadata, error) {
+	if filters.UserID != MockFirstUUID() || (filters.Type != "" && filters.Type != data.AuditLoginSucceeded) {
+		return []*data.AuditEvent{}, data.Metadata{}, nil
+	}
+
+	actorID := MockFirstUUID()
+
+	events := []*data.AuditEvent{
+		{
+			ID:        1,
+			UserID:    MockFirstUUID(),
+			ActorID:   &actorID,
+			Type:      data.AuditLoginSucceeded,
+			Details:   "password",
+			IP:        "127.0.0.1",
+			UserAgent: "Go-http-client/1.1",
+			CreatedAt: time.Now(),
+		},
+	}
+
+	metadata := data.Metadata{CurrentPage: 1, PageSize: filters.PageSize, FirstPage: 1, LastPage: 1, TotalRecords: 1}
+
+	return events, metadata, nil
+}
+
+func (m AuditEventModel) DeleteBefore(before time.Time) error {
+	return nil
+}
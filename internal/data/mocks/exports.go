@@ -0,0 +1,58 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
+	"github.com/google/uuid"
+)
+
+type ExportModel struct{}
+
+func (m ExportModel) Insert(export *data.Export) error {
+	export.ID = MockExportUUID()
+	export.Status = data.ExportPending
+	export.CreatedAt = time.Now()
+
+	return nil
+}
+
+// Get returns a ready export of the first user
+func (m ExportModel) Get(id uuid.UUID, userID uuid.UUID) (*data.Export, error) {
+	if id != MockExportUUID() || userID != MockFirstUUID() {
+		return nil, data.ErrRecordNotFound
+	}
+
+	completedAt := time.Now()
+
+	var export = &data.Export{
+		ID:          id,
+		UserID:      userID,
+		Status:      data.ExportReady,
+		CreatedAt:   time.Now(),
+		CompletedAt: &completedAt,
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}
+
+	return export, nil
+}
+
+func (m ExportModel) GetArchive(id uuid.UUID, userID uuid.UUID) ([]byte, error) {
+	if id != MockExportUUID() || userID != MockFirstUUID() {
+		return nil, data.ErrRecordNotFound
+	}
+
+	return []byte(`{"version": 1}`), nil
+}
+
+func (m ExportModel) Complete(id uuid.UUID, archive []byte) error {
+	return nil
+}
+
+func (m ExportModel) Fail(id uuid.UUID) error {
+	return nil
+}
+
+func (m ExportModel) DeleteExpired(before time.Time) error {
+	return nil
+}
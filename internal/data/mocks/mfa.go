@@ -0,0 +1,76 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
+	"github.com/e-inwork-com/go-user-service/internal/encryption"
+	"github.com/google/uuid"
+)
+
+type TOTPModel struct{}
+
+func (m TOTPModel) Upsert(totp *data.TOTP) error {
+	totp.CreatedAt = time.Now()
+	totp.Enabled = false
+	totp.LastUsedStep = 0
+
+	return nil
+}
+
+// GetByUserID returns a pending enrollment for the first user,
+// and an enabled enrollment for the second user
+func (m TOTPModel) GetByUserID(userID uuid.UUID) (*data.TOTP, error) {
+	if userID != MockFirstUUID() && userID != MockSecondUUID() {
+		return nil, data.ErrRecordNotFound
+	}
+
+	cipher, err := encryption.New(MockEncryptionKey())
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := cipher.Encrypt([]byte(MockTOTPSecret()))
+	if err != nil {
+		return nil, err
+	}
+
+	var totp = &data.TOTP{
+		UserID:           userID,
+		CreatedAt:        time.Now(),
+		SecretCiphertext: ciphertext,
+		Enabled:          userID == MockSecondUUID(),
+	}
+
+	return totp, nil
+}
+
+func (m TOTPModel) Enable(totp *data.TOTP) error {
+	totp.Enabled = true
+
+	return nil
+}
+
+func (m TOTPModel) UseStep(totp *data.TOTP, step int64) (bool, error) {
+	if step <= totp.LastUsedStep {
+		return false, nil
+	}
+
+	totp.LastUsedStep = step
+
+	return true, nil
+}
+
+func (m TOTPModel) Delete(userID uuid.UUID) error {
+	return nil
+}
+
+type RecoveryCodeModel struct{}
+
+func (m RecoveryCodeModel) Replace(userID uuid.UUID, codes []string) error {
+	return nil
+}
+
+func (m RecoveryCodeModel) Use(userID uuid.UUID, code string) (bool, error) {
+	return code == MockRecoveryCode(), nil
+}
@@ -0,0 +1,22 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
+)
+
+type OutboxModel struct{}
+
+// Relay doesn't have events to publish
+func (m OutboxModel) Relay(limit int, publish func(event *data.Event) error) (int, error) {
+	return 0, nil
+}
+
+func (m OutboxModel) DeletePublished(before time.Time) error {
+	return nil
+}
+
+func (m OutboxModel) DeleteBefore(before time.Time) error {
+	return nil
+}
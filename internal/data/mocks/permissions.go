@@ -0,0 +1,22 @@
+package mocks
+
+import (
+	"github.com/e-inwork-com/go-user-service/internal/data"
+	"github.com/google/uuid"
+)
+
+type PermissionModel struct{}
+
+// GetAllForUser returns every permission for the admin user,
+// the other users don't have a role
+func (m PermissionModel) GetAllForUser(userID uuid.UUID) (data.Permissions, error) {
+	if userID == MockAdminUUID() {
+		return data.Permissions{data.PermissionUsersAdmin, data.PermissionUsersRead, data.PermissionUsersWrite}, nil
+	}
+
+	return data.Permissions{}, nil
+}
+
+func (m PermissionModel) AddRolesForUser(userID uuid.UUID, roles ...string) error {
+	return nil
+}
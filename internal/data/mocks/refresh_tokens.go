@@ -0,0 +1,73 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
+	"github.com/google/uuid"
+)
+
+type RefreshTokenModel struct{}
+
+func (m RefreshTokenModel) New(userID uuid.UUID, familyID uuid.UUID, ttl time.Duration) (*data.RefreshToken, error) {
+	return data.GenerateRefreshToken(userID, familyID, ttl)
+}
+
+func (m RefreshTokenModel) Insert(token *data.RefreshToken) error {
+	return nil
+}
+
+func (m RefreshTokenModel) GetByPlaintext(plaintext string) (*data.RefreshToken, error) {
+	if plaintext == MockRefreshToken() {
+		var token = &data.RefreshToken{
+			Plaintext: plaintext,
+			UserID:    MockFirstUUID(),
+			FamilyID:  MockFirstUUID(),
+			Expiry:    time.Now().Add(time.Hour),
+		}
+		return token, nil
+	}
+
+	if plaintext == MockUsedRefreshToken() {
+		var token = &data.RefreshToken{
+			Plaintext: plaintext,
+			UserID:    MockFirstUUID(),
+			FamilyID:  MockFirstUUID(),
+			Expiry:    time.Now().Add(time.Hour),
+			Used:      true,
+		}
+		return token, nil
+	}
+
+	return nil, data.ErrRecordNotFound
+}
+
+func (m RefreshTokenModel) MarkUsed(token *data.RefreshToken) error {
+	token.Used = true
+
+	return nil
+}
+
+func (m RefreshTokenModel) RevokeFamily(familyID uuid.UUID) error {
+	return nil
+}
+
+func (m RefreshTokenModel) DeleteAllForUser(userID uuid.UUID) error {
+	return nil
+}
+
+// GetAllForUser returns the refresh token of the first user
+func (m RefreshTokenModel) GetAllForUser(userID uuid.UUID) ([]*data.RefreshToken, error) {
+	if userID != MockFirstUUID() {
+		return []*data.RefreshToken{}, nil
+	}
+
+	var token = &data.RefreshToken{
+		UserID:    MockFirstUUID(),
+		FamilyID:  MockFirstUUID(),
+		CreatedAt: time.Now(),
+		Expiry:    time.Now().Add(time.Hour),
+	}
+
+	return []*data.RefreshToken{token}, nil
+}
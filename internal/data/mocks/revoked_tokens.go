@@ -0,0 +1,21 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type RevokedTokenModel struct{}
+
+func (m RevokedTokenModel) Insert(jti string, userID uuid.UUID, expiry time.Time) error {
+	return nil
+}
+
+func (m RevokedTokenModel) Exists(jti string) (bool, error) {
+	return jti == MockRevokedTokenID(), nil
+}
+
+func (m RevokedTokenModel) DeleteExpired() error {
+	return nil
+}
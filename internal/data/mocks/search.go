@@ -0,0 +1,68 @@
+package mocks
+
+import (
+	"context"
+	"strings"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
+	"github.com/google/uuid"
+)
+
+type UserSearchModel struct{}
+
+// Search returns a page of the first and the second user containing the query in the first
+// name, the last name or the email, the score is the part of the longest match covered by the query
+func (m UserSearchModel) Search(ctx context.Context, query string, filters data.Filters) ([]*data.UserSearchResult, data.Metadata, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, data.Metadata{}, err
+	}
+
+	query = strings.ToLower(query)
+	results := []*data.UserSearchResult{}
+
+	for _, id := range []uuid.UUID{MockFirstUUID(), MockSecondUUID()} {
+		user, err := UserModel{}.GetByID(ctx, id)
+		if err != nil {
+			return nil, data.Metadata{}, err
+		}
+
+		score := 0.0
+		for _, field := range []string{user.FirstName, user.LastName, user.Email} {
+			field = strings.ToLower(field)
+			if strings.Contains(field, query) {
+				if s := float64(len(query)) / float64(len(field)); s > score {
+					score = s
+				}
+			}
+		}
+
+		if score > 0 {
+			results = append(results, &data.UserSearchResult{User: user, Score: score})
+		}
+	}
+
+	// The best match is the first
+	if len(results) == 2 && results[1].Score > results[0].Score {
+		results[0], results[1] = results[1], results[0]
+	}
+
+	page := []*data.UserSearchResult{}
+	offset := (filters.Page - 1) * filters.PageSize
+
+	for i := offset; i < len(results) && i < offset+filters.PageSize; i++ {
+		page = append(page, results[i])
+	}
+
+	metadata := data.Metadata{}
+	if len(results) > 0 {
+		metadata = data.Metadata{
+			CurrentPage:  filters.Page,
+			PageSize:     filters.PageSize,
+			FirstPage:    1,
+			LastPage:     (len(results) + filters.PageSize - 1) / filters.PageSize,
+			TotalRecords: len(results),
+		}
+	}
+
+	return page, metadata, nil
+}
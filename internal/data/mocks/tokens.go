@@ -0,0 +1,22 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
+	"github.com/google/uuid"
+)
+
+type TokenModel struct{}
+
+func (m TokenModel) New(userID uuid.UUID, ttl time.Duration, scope string) (*data.Token, error) {
+	return data.GenerateToken(userID, ttl, scope)
+}
+
+func (m TokenModel) Insert(token *data.Token) error {
+	return nil
+}
+
+func (m TokenModel) DeleteAllForUser(scope string, userID uuid.UUID) error {
+	return nil
+}
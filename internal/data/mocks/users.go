@@ -1,15 +1,22 @@
 package mocks
 
 import (
+	"context"
+	"strings"
 	"time"
 
 	"github.com/e-inwork-com/go-user-service/internal/data"
 	"github.com/google/uuid"
 )
 
+// UserModel returns the error of the context like a query of a cancelled request
 type UserModel struct{}
 
-func (m UserModel) Insert(user *data.User) error {
+func (m UserModel) Insert(ctx context.Context, user *data.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	user.ID = MockFirstUUID()
 	user.CreatedAt = time.Now()
 	user.Version = 1
@@ -17,7 +24,11 @@ func (m UserModel) Insert(user *data.User) error {
 	return nil
 }
 
-func (m UserModel) GetByID(id uuid.UUID) (*data.User, error) {
+func (m UserModel) GetByID(ctx context.Context, id uuid.UUID) (*data.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	if MockFirstUUID() == id {
 		var user = &data.User{
 			ID:        id,
@@ -28,6 +39,8 @@ func (m UserModel) GetByID(id uuid.UUID) (*data.User, error) {
 			Activated: true,
 			Version:   1,
 		}
+		MockSetPassword(user)
+
 		return user, nil
 	}
 
@@ -41,13 +54,34 @@ func (m UserModel) GetByID(id uuid.UUID) (*data.User, error) {
 			Activated: true,
 			Version:   1,
 		}
+		MockSetPassword(user)
+
+		return user, nil
+	}
+
+	if MockAdminUUID() == id {
+		var user = &data.User{
+			ID:        id,
+			CreatedAt: time.Now(),
+			Email:     "admin@doe.com",
+			FirstName: "Admin",
+			LastName:  "Doe",
+			Activated: true,
+			Version:   1,
+		}
+		MockSetPassword(user)
+
 		return user, nil
 	}
 
 	return nil, data.ErrRecordNotFound
 }
 
-func (m UserModel) GetByEmail(email string) (*data.User, error) {
+func (m UserModel) GetByEmail(ctx context.Context, email string) (*data.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	if email == "jon@doe.com" {
 		var user = &data.User{
 			ID:        MockFirstUUID(),
@@ -81,8 +115,169 @@ func (m UserModel) GetByEmail(email string) (*data.User, error) {
 	return nil, data.ErrRecordNotFound
 }
 
-func (m UserModel) Update(user *data.User) error {
+func (m UserModel) Update(ctx context.Context, user *data.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	user.Version += 1
 
 	return nil
 }
+
+func (m UserModel) GetForToken(ctx context.Context, tokenScope string, tokenPlaintext string) (*data.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if (tokenScope == data.ScopeActivation && tokenPlaintext == MockActivationToken()) ||
+		(tokenScope == data.ScopePasswordReset && tokenPlaintext == MockPasswordResetToken()) {
+		var user = &data.User{
+			ID:        MockFirstUUID(),
+			CreatedAt: time.Now(),
+			Email:     "jon@doe.com",
+			FirstName: "Jon",
+			LastName:  "Doe",
+			Activated: false,
+			Version:   1,
+		}
+		return user, nil
+	}
+
+	if tokenScope == data.ScopeEmailChange && tokenPlaintext == MockEmailChangeToken() {
+		var user = &data.User{
+			ID:           MockFirstUUID(),
+			CreatedAt:    time.Now(),
+			Email:        "jon@doe.com",
+			FirstName:    "Jon",
+			LastName:     "Doe",
+			Activated:    true,
+			Version:      1,
+			PendingEmail: "lee@doe.com",
+		}
+		return user, nil
+	}
+
+	if tokenScope == data.ScopeRestore && tokenPlaintext == MockRestoreToken() {
+		var user = &data.User{
+			ID:        MockFirstUUID(),
+			CreatedAt: time.Now(),
+			Email:     "jon@doe.com",
+			FirstName: "Jon",
+			LastName:  "Doe",
+			Activated: true,
+			Version:   2,
+		}
+		return user, nil
+	}
+
+	return nil, data.ErrRecordNotFound
+}
+
+func (m UserModel) Delete(ctx context.Context, id uuid.UUID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if id != MockFirstUUID() && id != MockSecondUUID() && id != MockAdminUUID() {
+		return data.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Restore restores the first user, the other users aren't deleted
+func (m UserModel) Restore(ctx context.Context, id uuid.UUID, deletedAfter time.Time) (*data.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if id != MockFirstUUID() {
+		return nil, data.ErrRecordNotFound
+	}
+
+	var user = &data.User{
+		ID:        MockFirstUUID(),
+		CreatedAt: time.Now(),
+		Email:     "jon@doe.com",
+		FirstName: "Jon",
+		LastName:  "Doe",
+		Activated: true,
+		Version:   3,
+	}
+
+	return user, nil
+}
+
+// Purge purges no user
+func (m UserModel) Purge(ctx context.Context, deletedBefore time.Time, limit int) ([]*data.UserPurge, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// GetAll returns the first and the second user,
+// they are only filtered by the email
+func (m UserModel) GetAll(ctx context.Context, filters data.UserFilters) ([]*data.User, data.Metadata, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, data.Metadata{}, err
+	}
+
+	users := []*data.User{}
+
+	for _, id := range []uuid.UUID{MockFirstUUID(), MockSecondUUID()} {
+		user, err := m.GetByID(ctx, id)
+		if err != nil {
+			return nil, data.Metadata{}, err
+		}
+
+		if strings.Contains(user.Email, filters.Email) {
+			users = append(users, user)
+		}
+	}
+
+	metadata := data.Metadata{
+		CurrentPage:  filters.Page,
+		PageSize:     filters.PageSize,
+		FirstPage:    1,
+		LastPage:     1,
+		TotalRecords: len(users),
+	}
+
+	return users, metadata, nil
+}
+
+// GetAllAfter returns the first user on the first page,
+// and the second user after the cursor of the first user,
+// a cursor without the ID of a user is invalid
+func (m UserModel) GetAllAfter(ctx context.Context, filters data.UserFilters) ([]*data.User, data.Metadata, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, data.Metadata{}, err
+	}
+
+	if filters.Cursor != nil && filters.Cursor.ID == uuid.Nil {
+		return nil, data.Metadata{}, data.ErrInvalidCursor
+	}
+
+	metadata := data.Metadata{PageSize: filters.PageSize}
+
+	if filters.Cursor != nil && filters.Cursor.ID == MockFirstUUID() {
+		user, err := m.GetByID(ctx, MockSecondUUID())
+		if err != nil {
+			return nil, data.Metadata{}, err
+		}
+
+		return []*data.User{user}, metadata, nil
+	}
+
+	user, err := m.GetByID(ctx, MockFirstUUID())
+	if err != nil {
+		return nil, data.Metadata{}, err
+	}
+
+	metadata.NextCursor = data.NewUserCursor(user, filters.Sort).Encode()
+
+	return []*data.User{user}, metadata, nil
+}
@@ -1,6 +1,30 @@
 package mocks
 
-import "github.com/google/uuid"
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"math/big"
+	"sync"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
+	"github.com/e-inwork-com/go-user-service/internal/webauthn/virtual"
+	"github.com/google/uuid"
+)
+
+var (
+	mockPasswordOnce sync.Once
+	mockPasswordUser data.User
+)
+
+// MockSetPassword sets the "pa55word" password of the mock users,
+// the hash is only computed once because bcrypt is slow on purpose
+func MockSetPassword(user *data.User) {
+	mockPasswordOnce.Do(func() {
+		mockPasswordUser.Password.Set("pa55word")
+	})
+
+	user.Password = mockPasswordUser.Password
+}
 
 func MockFirstUUID() uuid.UUID {
 	id, _ := uuid.Parse("77134e81-0cbe-4148-bb41-f0eecd56ac1d")
@@ -11,3 +35,90 @@ func MockSecondUUID() uuid.UUID {
 	id, _ := uuid.Parse("77134e81-0cbe-4148-bb41-f0eecd56ac11")
 	return id
 }
+
+func MockAdminUUID() uuid.UUID {
+	id, _ := uuid.Parse("77134e81-0cbe-4148-bb41-f0eecd56ac22")
+	return id
+}
+
+func MockWebhookUUID() uuid.UUID {
+	id, _ := uuid.Parse("77134e81-0cbe-4148-bb41-f0eecd56ac33")
+	return id
+}
+
+func MockExportUUID() uuid.UUID {
+	id, _ := uuid.Parse("77134e81-0cbe-4148-bb41-f0eecd56ac44")
+	return id
+}
+
+func MockWebhookDeliveryID() int64 {
+	return 1
+}
+
+func MockRefreshToken() string {
+	return "MOCKREFRESHTOKENAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"
+}
+
+func MockUsedRefreshToken() string {
+	return "MOCKUSEDREFRESHTOKENAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"
+}
+
+func MockRevokedTokenID() string {
+	return "77134e81-0cbe-4148-bb41-f0eecd56ac99"
+}
+
+func MockActivationToken() string {
+	return "MOCKACTIVATIONTOKENAAAAAAA"
+}
+
+func MockPasswordResetToken() string {
+	return "MOCKPASSWORDRESETTOKENAAAA"
+}
+
+func MockEmailChangeToken() string {
+	return "MOCKEMAILCHANGETOKENAAAAAA"
+}
+
+func MockRestoreToken() string {
+	return "MOCKRESTORETOKENAAAAAAAAAA"
+}
+
+func MockEncryptionKey() []byte {
+	return []byte("77134e810cbe4148bb41f0eecd56ac1d")
+}
+
+func MockTOTPSecret() string {
+	return "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"
+}
+
+func MockRecoveryCode() string {
+	return "MOCKR-ECOVE"
+}
+
+func MockWebAuthnCredentialID() []byte {
+	return []byte("77134e81-0cbe-4148-bb41-f0eecd56ac1d-passkey")
+}
+
+// MockWebAuthnAuthenticator returns a software authenticator that holds
+// the passkey of the first user, its sign count is the stored sign count
+func MockWebAuthnAuthenticator() *virtual.Authenticator {
+	curve := elliptic.P256()
+
+	d := new(big.Int).SetBytes([]byte("77134e810cbe4148bb41f0eecd56ac1d"))
+	d.Mod(d, curve.Params().N)
+
+	key := &ecdsa.PrivateKey{D: d}
+	key.Curve = curve
+	key.X, key.Y = curve.ScalarBaseMult(d.Bytes())
+
+	id := MockFirstUUID()
+
+	return &virtual.Authenticator{
+		RPID:         "localhost",
+		Origin:       "https://localhost",
+		CredentialID: MockWebAuthnCredentialID(),
+		Key:          key,
+		UserHandle:   id[:],
+		SignCount:    5,
+	}
+}
@@ -0,0 +1,76 @@
+package mocks
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
+	"github.com/google/uuid"
+)
+
+type WebAuthnCredentialModel struct{}
+
+func (m WebAuthnCredentialModel) Insert(credential *data.WebAuthnCredential) error {
+	if bytes.Equal(credential.ID, MockWebAuthnCredentialID()) {
+		return data.ErrDuplicateCredential
+	}
+
+	credential.CreatedAt = time.Now()
+
+	return nil
+}
+
+// GetByID returns the passkey of the first user
+func (m WebAuthnCredentialModel) GetByID(id []byte) (*data.WebAuthnCredential, error) {
+	if !bytes.Equal(id, MockWebAuthnCredentialID()) {
+		return nil, data.ErrRecordNotFound
+	}
+
+	authenticator := MockWebAuthnAuthenticator()
+
+	var credential = &data.WebAuthnCredential{
+		ID:         id,
+		UserID:     MockFirstUUID(),
+		CreatedAt:  time.Now(),
+		Name:       "Laptop",
+		PublicKey:  authenticator.PublicKey(),
+		SignCount:  authenticator.SignCount,
+		AAGUID:     make([]byte, 16),
+		Transports: []string{"internal"},
+	}
+
+	return credential, nil
+}
+
+func (m WebAuthnCredentialModel) GetAllForUser(userID uuid.UUID) ([]*data.WebAuthnCredential, error) {
+	if userID != MockFirstUUID() {
+		return []*data.WebAuthnCredential{}, nil
+	}
+
+	credential, err := m.GetByID(MockWebAuthnCredentialID())
+	if err != nil {
+		return nil, err
+	}
+
+	return []*data.WebAuthnCredential{credential}, nil
+}
+
+func (m WebAuthnCredentialModel) UseSignCount(credential *data.WebAuthnCredential, signCount uint32) (bool, error) {
+	if signCount <= credential.SignCount && (signCount != 0 || credential.SignCount != 0) {
+		return false, nil
+	}
+
+	now := time.Now()
+	credential.SignCount = signCount
+	credential.LastUsedAt = &now
+
+	return true, nil
+}
+
+func (m WebAuthnCredentialModel) Delete(id []byte, userID uuid.UUID) error {
+	if !bytes.Equal(id, MockWebAuthnCredentialID()) || userID != MockFirstUUID() {
+		return data.ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package mocks
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
+	"github.com/google/uuid"
+)
+
+type WebhookModel struct{}
+
+func (m WebhookModel) Insert(subscription *data.WebhookSubscription) error {
+	subscription.ID = MockWebhookUUID()
+	subscription.CreatedAt = time.Now()
+	subscription.Version = 1
+
+	return nil
+}
+
+// Get returns a subscription of every event type
+func (m WebhookModel) Get(id uuid.UUID) (*data.WebhookSubscription, error) {
+	if id != MockWebhookUUID() {
+		return nil, data.ErrRecordNotFound
+	}
+
+	var subscription = &data.WebhookSubscription{
+		ID:        id,
+		CreatedAt: time.Now(),
+		URL:       "https://example.com/webhooks",
+		Events:    []string{data.WebhookAllEvents},
+		Active:    true,
+		Version:   1,
+	}
+
+	return subscription, nil
+}
+
+func (m WebhookModel) GetAll() ([]*data.WebhookSubscription, error) {
+	subscription, err := m.Get(MockWebhookUUID())
+	if err != nil {
+		return nil, err
+	}
+
+	return []*data.WebhookSubscription{subscription}, nil
+}
+
+func (m WebhookModel) Update(subscription *data.WebhookSubscription) error {
+	subscription.Version++
+
+	return nil
+}
+
+func (m WebhookModel) Delete(id uuid.UUID) error {
+	if id != MockWebhookUUID() {
+		return data.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+type WebhookDeliveryModel struct{}
+
+// GetAllForSubscription returns a dead delivery of the subscription
+func (m WebhookDeliveryModel) GetAllForSubscription(subscriptionID uuid.UUID, status string, filters data.Filters) ([]*data.WebhookDelivery, data.Metadata, error) {
+	deliveries := []*data.WebhookDelivery{}
+
+	if subscriptionID == MockWebhookUUID() && (status == "" || status == data.WebhookDeliveryDead) {
+		lastAttemptAt := time.Now()
+		lastStatus := http.StatusInternalServerError
+
+		deliveries = append(deliveries, &data.WebhookDelivery{
+			ID:             MockWebhookDeliveryID(),
+			SubscriptionID: subscriptionID,
+			EventID:        uuid.New(),
+			Type:           data.EventUserCreated,
+			Payload:        json.RawMessage(`{}`),
+			CreatedAt:      time.Now(),
+			Status:         data.WebhookDeliveryDead,
+			Attempts:       8,
+			NextAttemptAt:  lastAttemptAt,
+			LastAttemptAt:  &lastAttemptAt,
+			LastStatus:     &lastStatus,
+			LastError:      "webhook answered with status 500",
+		})
+	}
+
+	metadata := data.Metadata{}
+	if len(deliveries) > 0 {
+		metadata = data.Metadata{
+			CurrentPage:  filters.Page,
+			PageSize:     filters.PageSize,
+			FirstPage:    1,
+			LastPage:     1,
+			TotalRecords: len(deliveries),
+		}
+	}
+
+	return deliveries, metadata, nil
+}
+
+func (m WebhookDeliveryModel) Replay(subscriptionID uuid.UUID, id int64) error {
+	if subscriptionID != MockWebhookUUID() || id != MockWebhookDeliveryID() {
+		return data.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Claim doesn't have deliveries to send
+func (m WebhookDeliveryModel) Claim(limit int, lease time.Duration) ([]*data.WebhookDelivery, error) {
+	return []*data.WebhookDelivery{}, nil
+}
+
+func (m WebhookDeliveryModel) Record(delivery *data.WebhookDelivery) error {
+	return nil
+}
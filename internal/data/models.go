@@ -3,6 +3,7 @@ package data
 import (
 	"database/sql"
 	"errors"
+	"time"
 )
 
 var (
@@ -11,11 +12,54 @@ var (
 )
 
 type Models struct {
-	Users UserModelInterface
+	Users             UserModelInterface
+	Permissions       PermissionModelInterface
+	RefreshTokens     RefreshTokenModelInterface
+	RevokedTokens     RevokedTokenModelInterface
+	Tokens            TokenModelInterface
+	TOTP              TOTPModelInterface
+	RecoveryCodes     RecoveryCodeModelInterface
+	WebAuthn          WebAuthnCredentialModelInterface
+	Search            UserSearcher
+	Outbox            OutboxModelInterface
+	Webhooks          WebhookModelInterface
+	WebhookDeliveries WebhookDeliveryModelInterface
+	Exports           ExportModelInterface
+	AuditEvents       AuditEventModelInterface
 }
 
-func InitModels(db *sql.DB) Models {
+// InitModels returns the models of the database, the queries of the users
+// end after the query timeout
+func InitModels(db *sql.DB, queryTimeout time.Duration) Models {
 	return Models{
-		Users: UserModel{DB: db},
+		Users:             UserModel{DB: db, QueryTimeout: queryTimeout},
+		Permissions:       PermissionModel{DB: db},
+		RefreshTokens:     RefreshTokenModel{DB: db},
+		RevokedTokens:     RevokedTokenModel{DB: db},
+		Tokens:            TokenModel{DB: db},
+		TOTP:              TOTPModel{DB: db},
+		RecoveryCodes:     RecoveryCodeModel{DB: db},
+		WebAuthn:          WebAuthnCredentialModel{DB: db},
+		Search:            UserSearchModel{DB: db, QueryTimeout: queryTimeout},
+		Outbox:            OutboxModel{DB: db},
+		Webhooks:          WebhookModel{DB: db},
+		WebhookDeliveries: WebhookDeliveryModel{DB: db},
+		Exports:           ExportModel{DB: db},
+		AuditEvents:       AuditEventModel{DB: db},
 	}
 }
+
+// InitSQLiteModels returns the models of a SQLite database, the models
+// with queries that only run on Postgres are replaced by their SQLite version
+func InitSQLiteModels(db *sql.DB, queryTimeout time.Duration) Models {
+	models := InitModels(db, queryTimeout)
+
+	models.Users = SQLiteUserModel{UserModel{DB: db, QueryTimeout: queryTimeout}}
+	models.Search = SQLiteUserSearchModel{UserSearchModel{DB: db, QueryTimeout: queryTimeout}}
+	models.Outbox = SQLiteOutboxModel{OutboxModel{DB: db}}
+	models.Webhooks = SQLiteWebhookModel{DB: db}
+	models.WebhookDeliveries = SQLiteWebhookDeliveryModel{WebhookDeliveryModel{DB: db}}
+	models.AuditEvents = SQLiteAuditEventModel{AuditEventModel{DB: db}}
+
+	return models
+}
@@ -0,0 +1,220 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The types of the events of the users
+const (
+	EventUserCreated      = "user.created"
+	EventUserUpdated      = "user.updated"
+	EventUserActivated    = "user.activated"
+	EventUserEmailChanged = "user.email_changed"
+	EventUserDeleted      = "user.deleted"
+	EventUserRestored     = "user.restored"
+	EventUserPurged       = "user.purged"
+)
+
+// outboxLockKey is the advisory lock of the relay, so the events
+// are published in order by one instance of the service at a time
+const outboxLockKey = 0x6f7574626f78
+
+// Event is a change of a user written to the outbox with the change,
+// the ID is the idempotency key of the event, it is the same on every delivery
+type Event struct {
+	ID        uuid.UUID       `json:"id"`
+	Type      string          `json:"type"`
+	UserID    uuid.UUID       `json:"user_id"`
+	CreatedAt time.Time       `json:"created_at_dt"`
+	Data      json.RawMessage `json:"data"`
+
+	// Attempts are the failed deliveries of the event
+	Attempts int `json:"-"`
+}
+
+type OutboxModelInterface interface {
+	Relay(limit int, publish func(event *Event) error) (int, error)
+	DeletePublished(before time.Time) error
+	DeleteBefore(before time.Time) error
+}
+
+type OutboxModel struct {
+	DB *sql.DB
+}
+
+// insertEvents writes the events of the user in the transaction of the change,
+// with their deliveries to the webhooks queued by the query of the database,
+// the data of the events is the user
+func insertEvents(ctx context.Context, tx *sql.Tx, deliveriesQuery string, user *User, types ...string) error {
+	payload, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+
+	return insertEventsData(ctx, tx, deliveriesQuery, user.ID, payload, types...)
+}
+
+// insertEventsData writes the events of the user like insertEvents, with the data of the payload
+func insertEventsData(ctx context.Context, tx *sql.Tx, deliveriesQuery string, userID uuid.UUID, payload []byte, types ...string) error {
+	query := `
+        INSERT INTO outbox (event_id, type_t, user_id, created_at_dt, payload)
+        VALUES ($1, $2, $3, $4, $5)`
+
+	for _, eventType := range types {
+		event := Event{
+			ID:        uuid.New(),
+			Type:      eventType,
+			UserID:    userID,
+			CreatedAt: time.Now().Truncate(time.Second),
+			Data:      payload,
+		}
+
+		_, err := tx.ExecContext(ctx, query, event.ID, event.Type, event.UserID, event.CreatedAt, payload)
+		if err != nil {
+			return err
+		}
+
+		deliveryPayload, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, deliveriesQuery, event.ID, event.Type, deliveryPayload)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Relay publishes the oldest unpublished events in order, and marks them as published.
+// The relay stops on the first event that fails, the event is sent again on the
+// next relay, so every event is published at least once. It returns the number
+// of published events, or zero when another instance is relaying
+func (m OutboxModel) Relay(limit int, publish func(event *Event) error) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// The lock is held by a connection outside of a transaction,
+	// so no transaction stays open while the broker is called
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	var locked bool
+
+	err = conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, outboxLockKey).Scan(&locked)
+	if err != nil || !locked {
+		return 0, err
+	}
+
+	defer func() {
+		unlockCtx, unlockCancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer unlockCancel()
+
+		// A connection that keeps the lock is closed instead of going back to the pool
+		_, err := conn.ExecContext(unlockCtx, `SELECT pg_advisory_unlock($1)`, outboxLockKey)
+		if err != nil {
+			conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		}
+	}()
+
+	return relayEvents(ctx, conn, limit, publish)
+}
+
+// outboxConn runs the statements of the relay on a connection or on the pool
+type outboxConn interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// relayEvents publishes a batch of the unpublished events, every event is marked
+// as published by its own statement once the broker accepted it, so a failure
+// only sends again the events that weren't marked yet
+func relayEvents(ctx context.Context, conn outboxConn, limit int, publish func(event *Event) error) (int, error) {
+	query := `
+        SELECT id, event_id, type_t, user_id, created_at_dt, payload, attempts
+        FROM outbox
+        WHERE published_at_dt IS NULL
+        ORDER BY id
+        LIMIT $1`
+
+	rows, err := conn.QueryContext(ctx, query, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	var ids []int64
+	var events []*Event
+
+	for rows.Next() {
+		var id int64
+		var event Event
+
+		err := rows.Scan(&id, &event.ID, &event.Type, &event.UserID, &event.CreatedAt, &event.Data, &event.Attempts)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		ids = append(ids, id)
+		events = append(events, &event)
+	}
+
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	published := 0
+
+	for i, event := range events {
+		err = publish(event)
+		if err != nil {
+			_, updateErr := conn.ExecContext(ctx, `UPDATE outbox SET attempts = attempts + 1, last_error_t = $1 WHERE id = $2`, err.Error(), ids[i])
+			if updateErr != nil {
+				return published, updateErr
+			}
+
+			return published, err
+		}
+
+		_, err = conn.ExecContext(ctx, `UPDATE outbox SET published_at_dt = $1 WHERE id = $2`, time.Now(), ids[i])
+		if err != nil {
+			return published, err
+		}
+
+		published++
+	}
+
+	return published, nil
+}
+
+// DeletePublished removes the events published before the time
+func (m OutboxModel) DeletePublished(before time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM outbox WHERE published_at_dt < $1`, before)
+
+	return err
+}
+
+// DeleteBefore removes the events created before the time, published or not
+func (m OutboxModel) DeleteBefore(before time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM outbox WHERE created_at_dt < $1`, before)
+
+	return err
+}
@@ -0,0 +1,97 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The permissions of the roles, a user doesn't need a permission
+// to read and to update the own user
+const (
+	PermissionUsersRead  = "users:read"
+	PermissionUsersWrite = "users:write"
+	PermissionUsersAdmin = "users:admin"
+)
+
+type PermissionModelInterface interface {
+	GetAllForUser(userID uuid.UUID) (Permissions, error)
+	AddRolesForUser(userID uuid.UUID, roles ...string) error
+}
+
+// Permissions are the codes of the permissions of the roles of a user
+type Permissions []string
+
+func (p Permissions) Include(code string) bool {
+	for i := range p {
+		if code == p[i] {
+			return true
+		}
+	}
+
+	return false
+}
+
+type PermissionModel struct {
+	DB *sql.DB
+}
+
+func (m PermissionModel) GetAllForUser(userID uuid.UUID) (Permissions, error) {
+	query := `
+        SELECT DISTINCT permissions.code
+        FROM permissions
+        INNER JOIN roles_permissions ON roles_permissions.permission_id = permissions.id
+        INNER JOIN users_roles ON users_roles.role_id = roles_permissions.role_id
+        WHERE users_roles.user_id = $1
+        ORDER BY permissions.code`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var permissions Permissions
+
+	for rows.Next() {
+		var permission string
+
+		err := rows.Scan(&permission)
+		if err != nil {
+			return nil, err
+		}
+
+		permissions = append(permissions, permission)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+// AddRolesForUser gives the roles to the user, the unknown roles are ignored
+func (m PermissionModel) AddRolesForUser(userID uuid.UUID, roles ...string) error {
+	query := `
+        INSERT INTO users_roles (user_id, role_id)
+        SELECT $1, roles.id FROM roles WHERE roles.name_t = $2
+        ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	for _, role := range roles {
+		_, err := m.DB.ExecContext(ctx, query, userID, role)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
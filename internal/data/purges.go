@@ -0,0 +1,138 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserPurge is the record of a deleted user purged after the grace period,
+// it keeps no personal data of the user
+type UserPurge struct {
+	UserID    uuid.UUID `json:"user_id"`
+	DeletedAt time.Time `json:"deleted_at_dt"`
+	PurgedAt  time.Time `json:"purged_at_dt"`
+}
+
+// The queries replacing the data of the events of a purged user by the ID of the user,
+// the data of the events in the outbox and in the deliveries of the webhooks is the user
+const (
+	scrubOutboxQuery = `
+        UPDATE outbox SET payload = jsonb_build_object('id', user_id)
+        WHERE user_id = $1`
+
+	scrubWebhookDeliveriesQuery = `
+        UPDATE webhook_deliveries SET payload = jsonb_set(payload, '{data}', jsonb_build_object('id', payload->>'user_id'))
+        WHERE payload->>'user_id' = $1`
+
+	// The payloads are stored as blobs like the payloads of the inserts
+	sqliteScrubOutboxQuery = `
+        UPDATE outbox SET payload = CAST(json_object('id', user_id) AS BLOB)
+        WHERE user_id = $1`
+
+	sqliteScrubWebhookDeliveriesQuery = `
+        UPDATE webhook_deliveries
+        SET payload = CAST(json_set(CAST(payload AS TEXT), '$.data', json_object('id', json_extract(CAST(payload AS TEXT), '$.user_id'))) AS BLOB)
+        WHERE json_extract(CAST(payload AS TEXT), '$.user_id') = $1`
+)
+
+// Purge deletes the users deleted before the time with their data, at most limit
+// users in a transaction. The data of their events is replaced by their ID, and
+// every purge is recorded in user_purges with the "user.purged" event. The users
+// locked by another purge are skipped
+func (m UserModel) Purge(ctx context.Context, deletedBefore time.Time, limit int) ([]*UserPurge, error) {
+	query := `
+        SELECT id, deleted_at_dt
+        FROM users
+        WHERE deleted_at_dt < $1
+        ORDER BY deleted_at_dt
+        LIMIT $2
+        FOR UPDATE SKIP LOCKED`
+
+	return m.purge(ctx, query, deletedBefore, limit, webhookDeliveriesQuery, scrubOutboxQuery, scrubWebhookDeliveriesQuery)
+}
+
+func (m UserModel) purge(ctx context.Context, query string, deletedBefore time.Time, limit int, deliveriesQuery string, scrubQueries ...string) ([]*UserPurge, error) {
+	var purges []*UserPurge
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	err := inTx(ctx, m.DB, func(tx *sql.Tx) error {
+		purges = nil
+
+		rows, err := tx.QueryContext(ctx, query, deletedBefore, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var purge UserPurge
+
+			err := rows.Scan(&purge.UserID, &purge.DeletedAt)
+			if err != nil {
+				return err
+			}
+
+			purges = append(purges, &purge)
+		}
+
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		rows.Close()
+
+		for _, purge := range purges {
+			err = purgeUser(ctx, tx, purge, deliveriesQuery, scrubQueries...)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return purges, nil
+}
+
+// purgeUser deletes the user with its data in the transaction, the related
+// records are deleted by the foreign keys
+func purgeUser(ctx context.Context, tx *sql.Tx, purge *UserPurge, deliveriesQuery string, scrubQueries ...string) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, purge.UserID)
+	if err != nil {
+		return err
+	}
+
+	for _, query := range scrubQueries {
+		_, err = tx.ExecContext(ctx, query, purge.UserID.String())
+		if err != nil {
+			return err
+		}
+	}
+
+	purge.PurgedAt = time.Now().Truncate(time.Second)
+
+	query := `
+        INSERT INTO user_purges (user_id, deleted_at_dt, purged_at_dt)
+        VALUES ($1, $2, $3)`
+
+	_, err = tx.ExecContext(ctx, query, purge.UserID, purge.DeletedAt, purge.PurgedAt)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(purge)
+	if err != nil {
+		return err
+	}
+
+	return insertEventsData(ctx, tx, deliveriesQuery, purge.UserID, payload, EventUserPurged)
+}
@@ -0,0 +1,236 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/validator"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+type RefreshTokenModelInterface interface {
+	New(userID uuid.UUID, familyID uuid.UUID, ttl time.Duration) (*RefreshToken, error)
+	Insert(token *RefreshToken) error
+	GetByPlaintext(plaintext string) (*RefreshToken, error)
+	MarkUsed(token *RefreshToken) error
+	RevokeFamily(familyID uuid.UUID) error
+	DeleteAllForUser(userID uuid.UUID) error
+	GetAllForUser(userID uuid.UUID) ([]*RefreshToken, error)
+}
+
+// RefreshToken is an opaque token that can be exchanged once
+// for a new access token. Every token that is issued by rotating
+// another one shares the same FamilyID as the first token of the login.
+type RefreshToken struct {
+	Plaintext string    `json:"refresh_token"`
+	Hash      []byte    `json:"-"`
+	UserID    uuid.UUID `json:"-"`
+	FamilyID  uuid.UUID `json:"-"`
+	Expiry    time.Time `json:"refresh_token_expiry_dt"`
+	CreatedAt time.Time `json:"-"`
+	Used      bool      `json:"-"`
+	Revoked   bool      `json:"-"`
+}
+
+// IsExpired reports whether the token can't be exchanged anymore
+func (t *RefreshToken) IsExpired() bool {
+	return time.Now().After(t.Expiry)
+}
+
+// GenerateRefreshToken creates a random token, only the hash
+// of the plaintext is stored in the database
+func GenerateRefreshToken(userID uuid.UUID, familyID uuid.UUID, ttl time.Duration) (*RefreshToken, error) {
+	token := &RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		Expiry:    time.Now().Add(ttl),
+		CreatedAt: time.Now(),
+	}
+
+	randomBytes := make([]byte, 32)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	token.Plaintext = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+
+	hash := sha256.Sum256([]byte(token.Plaintext))
+	token.Hash = hash[:]
+
+	return token, nil
+}
+
+func ValidateRefreshTokenPlaintext(v *validator.Validator, refreshTokenPlaintext string) {
+	v.Check(refreshTokenPlaintext != "", "refresh_token", "must be provided")
+	v.Check(len(refreshTokenPlaintext) == 52, "refresh_token", "must be 52 bytes long")
+}
+
+type RefreshTokenModel struct {
+	DB *sql.DB
+}
+
+func (m RefreshTokenModel) New(userID uuid.UUID, familyID uuid.UUID, ttl time.Duration) (*RefreshToken, error) {
+	token, err := GenerateRefreshToken(userID, familyID, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.Insert(token)
+	return token, err
+}
+
+func (m RefreshTokenModel) Insert(token *RefreshToken) error {
+	query := `
+        INSERT INTO refresh_tokens (hash, user_id, family_id, expiry_dt)
+        VALUES ($1, $2, $3, $4)`
+
+	args := []interface{}{token.Hash, token.UserID, token.FamilyID, token.Expiry}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (m RefreshTokenModel) GetByPlaintext(plaintext string) (*RefreshToken, error) {
+	query := `
+        SELECT hash, user_id, family_id, expiry_dt, used_b, revoked_b
+        FROM refresh_tokens
+        WHERE hash = $1`
+
+	hash := sha256.Sum256([]byte(plaintext))
+
+	var token RefreshToken
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, hash[:]).Scan(
+		&token.Hash,
+		&token.UserID,
+		&token.FamilyID,
+		&token.Expiry,
+		&token.Used,
+		&token.Revoked,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &token, nil
+}
+
+// MarkUsed flags the token as exchanged, it returns ErrRefreshTokenReused
+// if another request has already exchanged the same token
+func (m RefreshTokenModel) MarkUsed(token *RefreshToken) error {
+	query := `
+        UPDATE refresh_tokens
+        SET used_b = true
+        WHERE hash = $1 AND used_b = false
+        RETURNING used_b`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, token.Hash).Scan(&token.Used)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRefreshTokenReused
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m RefreshTokenModel) RevokeFamily(familyID uuid.UUID) error {
+	query := `
+        UPDATE refresh_tokens
+        SET revoked_b = true
+        WHERE family_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, familyID)
+	return err
+}
+
+func (m RefreshTokenModel) DeleteAllForUser(userID uuid.UUID) error {
+	query := `
+        DELETE FROM refresh_tokens
+        WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	return err
+}
+
+// GetAllForUser returns the refresh tokens of the user in the order they were issued,
+// without their plaintext
+func (m RefreshTokenModel) GetAllForUser(userID uuid.UUID) ([]*RefreshToken, error) {
+	query := `
+        SELECT hash, user_id, family_id, created_at_dt, expiry_dt, used_b, revoked_b
+        FROM refresh_tokens
+        WHERE user_id = $1
+        ORDER BY created_at_dt, hash`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*RefreshToken{}
+
+	for rows.Next() {
+		var token RefreshToken
+
+		err := rows.Scan(
+			&token.Hash,
+			&token.UserID,
+			&token.FamilyID,
+			&token.CreatedAt,
+			&token.Expiry,
+			&token.Used,
+			&token.Revoked,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, &token)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
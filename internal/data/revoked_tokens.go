@@ -0,0 +1,60 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type RevokedTokenModelInterface interface {
+	Insert(jti string, userID uuid.UUID, expiry time.Time) error
+	Exists(jti string) (bool, error)
+	DeleteExpired() error
+}
+
+// RevokedTokenModel keeps the IDs (jti) of access tokens
+// that were logged out before they expired
+type RevokedTokenModel struct {
+	DB *sql.DB
+}
+
+func (m RevokedTokenModel) Insert(jti string, userID uuid.UUID, expiry time.Time) error {
+	query := `
+        INSERT INTO revoked_tokens (jti, user_id, expiry_dt)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (jti) DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, jti, userID, expiry)
+	return err
+}
+
+func (m RevokedTokenModel) Exists(jti string) (bool, error) {
+	query := `
+        SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE jti = $1)`
+
+	var exists bool
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, jti).Scan(&exists)
+	return exists, err
+}
+
+// DeleteExpired removes the revoked tokens that can't be used anymore anyway
+func (m RevokedTokenModel) DeleteExpired() error {
+	query := `
+        DELETE FROM revoked_tokens
+        WHERE expiry_dt < $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, time.Now())
+	return err
+}
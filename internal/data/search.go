@@ -0,0 +1,117 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/validator"
+)
+
+// UserSearcher searches the users by a partial or misspelled name or email,
+// the results are ordered by their relevance
+type UserSearcher interface {
+	Search(ctx context.Context, query string, filters Filters) ([]*UserSearchResult, Metadata, error)
+}
+
+// UserSearchResult is a user found by a search with the relevance score of the match
+type UserSearchResult struct {
+	*User
+	Score float64 `json:"score"`
+}
+
+// UserSearchSortSafelist are the sort values of a search, the results are ordered by relevance
+var UserSearchSortSafelist = []string{"-score"}
+
+func ValidateSearchQuery(v *validator.Validator, query string) {
+	v.Check(query != "", "q", "must be provided")
+	v.Check(len(query) <= 100, "q", "must not be more than 100 bytes long")
+}
+
+type UserSearchModel struct {
+	DB *sql.DB
+
+	// QueryTimeout limits the search on top of the context of the caller,
+	// the default is three seconds
+	QueryTimeout time.Duration
+}
+
+func (m UserSearchModel) queryTimeout() time.Duration {
+	if m.QueryTimeout <= 0 {
+		return 3 * time.Second
+	}
+
+	return m.QueryTimeout
+}
+
+// userSearchDocument is the text of a user matched by the full-text search,
+// it is the expression of the "users_search_idx" index
+const userSearchDocument = `to_tsvector('simple', first_name_t || ' ' || last_name_t || ' ' || email_t)`
+
+// Search returns a page of the users matching the query with the full-text search
+// on the words, or with the trigram similarity on a part or a misspelling of the
+// first name, the last name or the email. The score adds the rank of the words
+// to the best similarity
+func (m UserSearchModel) Search(ctx context.Context, query string, filters Filters) ([]*UserSearchResult, Metadata, error) {
+	searchQuery := `
+        SELECT count(*) OVER(), id, created_at_dt, email_t, password_hash, first_name_t, last_name_t, activated_b, version, tokens_valid_after_dt, COALESCE(pending_email_t, ''), score
+        FROM (
+            SELECT *,
+                ts_rank(` + userSearchDocument + `, plainto_tsquery('simple', $1)) +
+                GREATEST(word_similarity($1, first_name_t), word_similarity($1, last_name_t), word_similarity($1, email_t)) AS score
+            FROM users
+            WHERE deleted_at_dt IS NULL
+            AND (` + userSearchDocument + ` @@ plainto_tsquery('simple', $1)
+                OR $1 <% first_name_t
+                OR $1 <% last_name_t
+                OR $1 <% email_t)
+        ) AS results
+        ORDER BY score DESC, id ASC
+        LIMIT $2 OFFSET $3`
+
+	args := []interface{}{query, filters.limit(), filters.offset()}
+
+	ctx, cancel := context.WithTimeout(ctx, m.queryTimeout())
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, searchQuery, args...)
+	if err != nil {
+		return nil, Metadata{}, translateError(ctx, err)
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	results := []*UserSearchResult{}
+
+	for rows.Next() {
+		result := UserSearchResult{User: &User{}}
+
+		err := rows.Scan(
+			&totalRecords,
+			&result.ID,
+			&result.CreatedAt,
+			&result.Email,
+			&result.Password.hash,
+			&result.FirstName,
+			&result.LastName,
+			&result.Activated,
+			&result.Version,
+			&result.TokensValidAfter,
+			&result.PendingEmail,
+			&result.Score,
+		)
+		if err != nil {
+			return nil, Metadata{}, translateError(ctx, err)
+		}
+
+		results = append(results, &result)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, translateError(ctx, err)
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return results, metadata, nil
+}
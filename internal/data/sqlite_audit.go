@@ -0,0 +1,14 @@
+package data
+
+import "time"
+
+// SQLiteAuditEventModel stores the audit events in SQLite, SQLite has no roles
+// so the pruner marks its transaction with a row of user_audit_pruner
+type SQLiteAuditEventModel struct {
+	AuditEventModel
+}
+
+// DeleteBefore removes the events older than the retention
+func (m SQLiteAuditEventModel) DeleteBefore(before time.Time) error {
+	return m.deleteBefore(before, `INSERT INTO user_audit_pruner (id) VALUES (1)`, `DELETE FROM user_audit_pruner`)
+}
@@ -0,0 +1,33 @@
+package data
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sqliteRelayMu stands for the advisory lock of the relay, a SQLite
+// database is only used by the instance of the service on its host
+var sqliteRelayMu sync.Mutex
+
+// SQLiteOutboxModel relays the events of a SQLite database, the relay
+// is locked in the process instead of with an advisory lock
+type SQLiteOutboxModel struct {
+	OutboxModel
+}
+
+// Relay publishes the oldest unpublished events in order, and marks them as published.
+// The relay stops on the first event that fails, the event is sent again on the
+// next relay, so every event is published at least once. It returns the number
+// of published events, or zero when another relay is running
+func (m SQLiteOutboxModel) Relay(limit int, publish func(event *Event) error) (int, error) {
+	if !sqliteRelayMu.TryLock() {
+		return 0, nil
+	}
+	defer sqliteRelayMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	return relayEvents(ctx, m.DB, limit, publish)
+}
@@ -0,0 +1,76 @@
+package data
+
+import (
+	"context"
+)
+
+// SQLiteUserSearchModel searches the users in SQLite with the query timeout of UserSearchModel
+type SQLiteUserSearchModel struct {
+	UserSearchModel
+}
+
+// Search returns a page of the users with the query in the first name, the last name
+// or the email in any case of the ASCII letters, SQLite has no full-text or trigram
+// search of the misspellings. The score is the best share of a field matched by the query
+func (m SQLiteUserSearchModel) Search(ctx context.Context, query string, filters Filters) ([]*UserSearchResult, Metadata, error) {
+	searchQuery := `
+        SELECT count(*) OVER(), id, created_at_dt, email_t, password_hash, first_name_t, last_name_t, activated_b, version, tokens_valid_after_dt, COALESCE(pending_email_t, ''), score
+        FROM (
+            SELECT *, max(
+                CASE WHEN first_name_t LIKE $1 ESCAPE '\' THEN CAST(length($2) AS REAL) / length(first_name_t) ELSE 0 END,
+                CASE WHEN last_name_t LIKE $1 ESCAPE '\' THEN CAST(length($2) AS REAL) / length(last_name_t) ELSE 0 END,
+                CASE WHEN email_t LIKE $1 ESCAPE '\' THEN CAST(length($2) AS REAL) / length(email_t) ELSE 0 END
+            ) AS score
+            FROM users
+            WHERE deleted_at_dt IS NULL
+        ) AS results
+        WHERE score > 0
+        ORDER BY score DESC, id ASC
+        LIMIT $3 OFFSET $4`
+
+	args := []interface{}{"%" + escapeLike(query) + "%", query, filters.limit(), filters.offset()}
+
+	ctx, cancel := context.WithTimeout(ctx, m.queryTimeout())
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, searchQuery, args...)
+	if err != nil {
+		return nil, Metadata{}, translateError(ctx, err)
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	results := []*UserSearchResult{}
+
+	for rows.Next() {
+		result := UserSearchResult{User: &User{}}
+
+		err := rows.Scan(
+			&totalRecords,
+			&result.ID,
+			&result.CreatedAt,
+			&result.Email,
+			&result.Password.hash,
+			&result.FirstName,
+			&result.LastName,
+			&result.Activated,
+			&result.Version,
+			&result.TokensValidAfter,
+			&result.PendingEmail,
+			&result.Score,
+		)
+		if err != nil {
+			return nil, Metadata{}, translateError(ctx, err)
+		}
+
+		results = append(results, &result)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, translateError(ctx, err)
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return results, metadata, nil
+}
@@ -0,0 +1,580 @@
+package data_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
+	"github.com/e-inwork-com/go-user-service/internal/data/mocks"
+	"github.com/e-inwork-com/go-user-service/internal/migrate"
+	"github.com/e-inwork-com/go-user-service/internal/sqlite"
+	"github.com/e-inwork-com/go-user-service/migrations"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// testSQLite returns a new SQLite database migrated up
+func testSQLite(t *testing.T) *sql.DB {
+	dsn := "file:" + filepath.Join(t.TempDir(), "user.db") + "?_foreign_keys=on&_txlock=immediate&_busy_timeout=5000"
+
+	db, err := sql.Open(sqlite.DriverName, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migrate.New(db, sqlite.DriverName, migrations.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = migrator.Up(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func testUser(email, firstName string) *data.User {
+	user := &data.User{Email: email, FirstName: firstName, LastName: "Doe"}
+	mocks.MockSetPassword(user)
+
+	return user
+}
+
+func TestSQLiteUsers(t *testing.T) {
+	ctx := context.Background()
+	users := data.InitSQLiteModels(testSQLite(t), 0).Users
+
+	jon := testUser("jon@doe.com", "Jon")
+	assert.Nil(t, users.Insert(ctx, jon))
+	assert.NotEqual(t, uuid.Nil, jon.ID)
+	assert.Equal(t, 1, jon.Version)
+
+	nina := testUser("nina@doe.com", "Nina")
+	assert.Nil(t, users.Insert(ctx, nina))
+
+	t.Run("Duplicate Email", func(t *testing.T) {
+		assert.ErrorIs(t, users.Insert(ctx, testUser("jon@doe.com", "Other")), data.ErrDuplicateEmail)
+
+		user, err := users.GetByID(ctx, nina.ID)
+		assert.Nil(t, err)
+
+		user.Email = "jon@doe.com"
+		assert.ErrorIs(t, users.Update(ctx, user), data.ErrDuplicateEmail)
+	})
+
+	t.Run("Email Case", func(t *testing.T) {
+		assert.ErrorIs(t, users.Insert(ctx, testUser(" JON@doe.com", "Other")), data.ErrDuplicateEmail)
+
+		user, err := users.GetByEmail(ctx, "Nina@DOE.com ")
+		assert.Nil(t, err)
+		assert.Equal(t, nina.ID, user.ID)
+		assert.Equal(t, "Nina", user.FirstName)
+		assert.Equal(t, "Doe", user.LastName)
+
+		// The domain is stored in lowercase, the local part keeps its case
+		anna := testUser(" Anna@DOE.com", "Anna")
+		assert.Nil(t, users.Insert(ctx, anna))
+		assert.Equal(t, "Anna@doe.com", anna.Email)
+
+		user, err = users.GetByID(ctx, anna.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, "Anna@doe.com", user.Email)
+
+		user.Email = "NINA@doe.com"
+		assert.ErrorIs(t, users.Update(ctx, user), data.ErrDuplicateEmail)
+	})
+
+	t.Run("Edit Conflict", func(t *testing.T) {
+		first, err := users.GetByEmail(ctx, "jon@doe.com")
+		assert.Nil(t, err)
+		second, err := users.GetByID(ctx, jon.ID)
+		assert.Nil(t, err)
+
+		first.FirstName = "Jonathan"
+		assert.Nil(t, users.Update(ctx, first))
+		assert.Equal(t, 2, first.Version)
+
+		second.FirstName = "Johnny"
+		assert.ErrorIs(t, users.Update(ctx, second), data.ErrEditConflict)
+
+		user, err := users.GetByID(ctx, jon.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, "Jonathan", user.FirstName)
+		assert.True(t, jon.CreatedAt.Equal(user.CreatedAt))
+
+		matches, err := user.Password.Matches("pa55word")
+		assert.Nil(t, err)
+		assert.True(t, matches)
+	})
+
+	t.Run("Time Zone", func(t *testing.T) {
+		user, err := users.GetByID(ctx, nina.ID)
+		assert.Nil(t, err)
+
+		// The times are stored in UTC whatever their location
+		validAfter := time.Date(2023, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600))
+		user.TokensValidAfter = validAfter
+		assert.Nil(t, users.Update(ctx, user))
+
+		user, err = users.GetByID(ctx, nina.ID)
+		assert.Nil(t, err)
+		assert.True(t, validAfter.Equal(user.TokensValidAfter))
+	})
+
+	t.Run("Not Found", func(t *testing.T) {
+		_, err := users.GetByID(ctx, uuid.New())
+		assert.ErrorIs(t, err, data.ErrRecordNotFound)
+
+		assert.ErrorIs(t, users.Delete(ctx, uuid.New()), data.ErrRecordNotFound)
+		assert.ErrorIs(t, users.Update(ctx, &data.User{ID: uuid.New(), Version: 1}), data.ErrEditConflict)
+	})
+}
+
+func TestSQLiteCaseSensitiveEmails(t *testing.T) {
+	ctx := context.Background()
+	db := testSQLite(t)
+	users := data.InitSQLiteModels(db, 0).Users
+
+	jon := testUser("Jon@doe.com", "Jon")
+	assert.Nil(t, users.Insert(ctx, jon))
+
+	data.CaseSensitiveEmails = true
+	t.Cleanup(func() { data.CaseSensitiveEmails = false })
+
+	// The canonical emails of the case-insensitive emails are rebuilt
+	rekeyed, err := data.RekeyEmails(ctx, db)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), rekeyed)
+
+	_, err = users.GetByEmail(ctx, "jon@doe.com")
+	assert.ErrorIs(t, err, data.ErrRecordNotFound)
+
+	user, err := users.GetByEmail(ctx, "Jon@DOE.com")
+	assert.Nil(t, err)
+	assert.Equal(t, jon.ID, user.ID)
+
+	// The emails with another case are other users
+	assert.Nil(t, users.Insert(ctx, testUser("jon@doe.com", "Other")))
+	assert.ErrorIs(t, users.Insert(ctx, testUser("Jon@DOE.com", "Other")), data.ErrDuplicateEmail)
+
+	// They are the same user again once the emails are case-insensitive
+	data.CaseSensitiveEmails = false
+
+	_, err = data.RekeyEmails(ctx, db)
+	assert.ErrorIs(t, err, data.ErrDuplicateEmail)
+}
+
+func TestSQLiteGetForToken(t *testing.T) {
+	ctx := context.Background()
+	models := data.InitSQLiteModels(testSQLite(t), 0)
+
+	user := testUser("jon@doe.com", "Jon")
+	assert.Nil(t, models.Users.Insert(ctx, user))
+
+	token, err := models.Tokens.New(user.ID, time.Hour, data.ScopeActivation)
+	assert.Nil(t, err)
+
+	expired, err := models.Tokens.New(user.ID, -time.Hour, data.ScopeActivation)
+	assert.Nil(t, err)
+
+	found, err := models.Users.GetForToken(ctx, data.ScopeActivation, token.Plaintext)
+	assert.Nil(t, err)
+	assert.Equal(t, user.ID, found.ID)
+
+	_, err = models.Users.GetForToken(ctx, data.ScopeActivation, expired.Plaintext)
+	assert.ErrorIs(t, err, data.ErrRecordNotFound)
+
+	// The tokens of a deleted user are ignored, but its restore tokens
+	restore, err := models.Tokens.New(user.ID, time.Hour, data.ScopeRestore)
+	assert.Nil(t, err)
+
+	_, err = models.Users.GetForToken(ctx, data.ScopeRestore, restore.Plaintext)
+	assert.ErrorIs(t, err, data.ErrRecordNotFound)
+
+	assert.Nil(t, models.Users.Delete(ctx, user.ID))
+
+	_, err = models.Users.GetForToken(ctx, data.ScopeActivation, token.Plaintext)
+	assert.ErrorIs(t, err, data.ErrRecordNotFound)
+
+	found, err = models.Users.GetForToken(ctx, data.ScopeRestore, restore.Plaintext)
+	assert.Nil(t, err)
+	assert.Equal(t, user.ID, found.ID)
+}
+
+func TestSQLiteGetAll(t *testing.T) {
+	ctx := context.Background()
+	users := data.InitSQLiteModels(testSQLite(t), 0).Users
+
+	for _, name := range []string{"Carl", "Anna", "Bob", "Dora", "Eve"} {
+		assert.Nil(t, users.Insert(ctx, testUser(name+"@doe.com", name)))
+	}
+
+	filters := data.UserFilters{
+		Filters: data.Filters{Page: 2, PageSize: 2, Sort: "first_name_t", SortSafelist: data.UserSortSafelist},
+	}
+
+	page, metadata, err := users.GetAll(ctx, filters)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, metadata.TotalRecords)
+	assert.Len(t, page, 2)
+	assert.Equal(t, "Carl", page[0].FirstName)
+	assert.Equal(t, "Dora", page[1].FirstName)
+
+	filters.Page = 1
+	filters.Name = "a d"
+
+	page, metadata, err = users.GetAll(ctx, filters)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, metadata.TotalRecords)
+	assert.Equal(t, "Anna", page[0].FirstName)
+	assert.Equal(t, "Dora", page[1].FirstName)
+
+	// The wildcards of LIKE are matched as text
+	filters.Name = "%"
+
+	_, metadata, err = users.GetAll(ctx, filters)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, metadata.TotalRecords)
+
+	// The cursors read every user once in the sort order
+	filters.Name = ""
+
+	for _, sort := range []string{"-first_name_t", "created_at_dt", "id"} {
+		filters.Sort = sort
+		filters.Cursor = nil
+
+		seen := map[uuid.UUID]bool{}
+
+		for {
+			page, metadata, err = users.GetAllAfter(ctx, filters)
+			assert.Nil(t, err)
+
+			for _, user := range page {
+				assert.False(t, seen[user.ID])
+				seen[user.ID] = true
+			}
+
+			if metadata.NextCursor == "" {
+				break
+			}
+
+			filters.Cursor, err = data.DecodeCursor(metadata.NextCursor)
+			assert.Nil(t, err)
+		}
+
+		assert.Len(t, seen, 5, sort)
+	}
+
+	// A cursor with a value of the wrong type is invalid
+	filters.Sort = "created_at_dt"
+	filters.Cursor = &data.Cursor{Sort: "created_at_dt", Value: "x", ID: uuid.New()}
+
+	_, _, err = users.GetAllAfter(ctx, filters)
+	assert.ErrorIs(t, err, data.ErrInvalidCursor)
+}
+
+func TestSQLiteSearch(t *testing.T) {
+	ctx := context.Background()
+	models := data.InitSQLiteModels(testSQLite(t), 0)
+
+	for _, name := range []string{"Anna", "Bob"} {
+		assert.Nil(t, models.Users.Insert(ctx, testUser(name+"@doe.com", name)))
+	}
+
+	filters := data.Filters{Page: 1, PageSize: 10, Sort: "-score", SortSafelist: data.UserSearchSortSafelist}
+
+	results, metadata, err := models.Search.Search(ctx, "ann", filters)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, metadata.TotalRecords)
+	assert.Equal(t, "Anna", results[0].FirstName)
+
+	// The search ends with the request
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	_, _, err = models.Search.Search(cancelled, "ann", filters)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestSQLiteEvents(t *testing.T) {
+	ctx := context.Background()
+	models := data.InitSQLiteModels(testSQLite(t), 0)
+
+	subscription := &data.WebhookSubscription{URL: "https://example.com", Events: []string{data.EventUserDeleted}, Secret: []byte("secret"), Active: true}
+	assert.Nil(t, models.Webhooks.Insert(subscription))
+
+	found, err := models.Webhooks.Get(subscription.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, subscription.Events, found.Events)
+
+	user := testUser("jon@doe.com", "Jon")
+	assert.Nil(t, models.Users.Insert(ctx, user))
+
+	user.Activated = true
+	user.Email = "jonathan@doe.com"
+	assert.Nil(t, models.Users.Update(ctx, user))
+	assert.Nil(t, models.Users.Delete(ctx, user.ID))
+
+	var types []string
+
+	published, err := models.Outbox.Relay(10, func(event *data.Event) error {
+		assert.Equal(t, user.ID, event.UserID)
+		types = append(types, event.Type)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 5, published)
+	assert.Equal(t, []string{
+		data.EventUserCreated,
+		data.EventUserUpdated,
+		data.EventUserActivated,
+		data.EventUserEmailChanged,
+		data.EventUserDeleted,
+	}, types)
+
+	// The events are only published once
+	published, err = models.Outbox.Relay(10, func(event *data.Event) error { return nil })
+	assert.Nil(t, err)
+	assert.Equal(t, 0, published)
+
+	// Only the event of the subscription is delivered
+	deliveries, err := models.WebhookDeliveries.Claim(10, time.Minute)
+	assert.Nil(t, err)
+	assert.Len(t, deliveries, 1)
+	assert.Equal(t, data.EventUserDeleted, deliveries[0].Type)
+	assert.Equal(t, subscription.URL, deliveries[0].URL)
+
+	// The claimed delivery waits for the lease
+	deliveries, err = models.WebhookDeliveries.Claim(10, time.Minute)
+	assert.Nil(t, err)
+	assert.Empty(t, deliveries)
+
+	// The unpublished events are deleted without a broker
+	assert.Nil(t, models.Users.Insert(ctx, testUser("nina@doe.com", "Nina")))
+	assert.Nil(t, models.Outbox.DeleteBefore(time.Now().Add(time.Minute)))
+
+	published, err = models.Outbox.Relay(10, func(event *data.Event) error { return nil })
+	assert.Nil(t, err)
+	assert.Equal(t, 0, published)
+}
+
+func TestSQLitePurge(t *testing.T) {
+	ctx := context.Background()
+	db := testSQLite(t)
+	models := data.InitSQLiteModels(db, 0)
+
+	subscription := &data.WebhookSubscription{URL: "https://example.com", Events: data.EventTypes, Secret: []byte("secret"), Active: true}
+	assert.Nil(t, models.Webhooks.Insert(subscription))
+
+	user := testUser("jon@doe.com", "Jon")
+	assert.Nil(t, models.Users.Insert(ctx, user))
+	assert.Nil(t, models.AuditEvents.Insert(&data.AuditEvent{UserID: user.ID, Type: data.AuditUserDeleted}))
+	assert.Nil(t, models.Users.Delete(ctx, user.ID))
+
+	// The deleted user keeps its email until it is purged
+	_, err := models.Users.GetByID(ctx, user.ID)
+	assert.ErrorIs(t, err, data.ErrRecordNotFound)
+	assert.ErrorIs(t, models.Users.Insert(ctx, testUser("jon@doe.com", "Jon")), data.ErrDuplicateEmail)
+
+	// The user is restored during the grace period
+	_, err = models.Users.Restore(ctx, user.ID, time.Now().Add(time.Hour))
+	assert.ErrorIs(t, err, data.ErrRecordNotFound)
+
+	restored, err := models.Users.Restore(ctx, user.ID, time.Now().Add(-time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, user.Email, restored.Email)
+
+	_, err = models.Users.GetByID(ctx, user.ID)
+	assert.Nil(t, err)
+
+	assert.Nil(t, models.Users.Delete(ctx, user.ID))
+
+	// The user is purged after the grace period
+	purges, err := models.Users.Purge(ctx, time.Now().Add(-time.Hour), 10)
+	assert.Nil(t, err)
+	assert.Empty(t, purges)
+
+	purges, err = models.Users.Purge(ctx, time.Now().Add(time.Second), 10)
+	assert.Nil(t, err)
+	assert.Len(t, purges, 1)
+	assert.Equal(t, user.ID, purges[0].UserID)
+
+	_, err = models.Users.Restore(ctx, user.ID, time.Time{})
+	assert.ErrorIs(t, err, data.ErrRecordNotFound)
+
+	var count int
+
+	err = db.QueryRow(`SELECT count(*) FROM user_purges WHERE user_id = $1`, user.ID).Scan(&count)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+
+	// The audit events outlive the purged user until their retention
+	err = db.QueryRow(`SELECT count(*) FROM user_audit_events WHERE user_id = $1`, user.ID).Scan(&count)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+
+	// The events keep no personal data of the purged user
+	err = db.QueryRow(`SELECT count(*) FROM outbox WHERE CAST(payload AS TEXT) LIKE '%jon@doe.com%'`).Scan(&count)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+
+	err = db.QueryRow(`SELECT count(*) FROM webhook_deliveries WHERE CAST(payload AS TEXT) LIKE '%jon@doe.com%'`).Scan(&count)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+
+	var types []string
+
+	_, err = models.Outbox.Relay(10, func(event *data.Event) error {
+		types = append(types, event.Type)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, data.EventUserPurged, types[len(types)-1])
+
+	deliveries, err := models.WebhookDeliveries.Claim(10, time.Minute)
+	assert.Nil(t, err)
+	assert.Len(t, deliveries, len(types))
+
+	// The email is free once the user is purged
+	assert.Nil(t, models.Users.Insert(ctx, testUser("jon@doe.com", "Jon")))
+}
+
+func TestSQLiteExports(t *testing.T) {
+	ctx := context.Background()
+	models := data.InitSQLiteModels(testSQLite(t), 0)
+
+	user := testUser("jon@doe.com", "Jon")
+	assert.Nil(t, models.Users.Insert(ctx, user))
+
+	export := &data.Export{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}
+	assert.Nil(t, models.Exports.Insert(export))
+	assert.Equal(t, data.ExportPending, export.Status)
+
+	// The archive is only read once the export is ready
+	_, err := models.Exports.GetArchive(export.ID, user.ID)
+	assert.ErrorIs(t, err, data.ErrRecordNotFound)
+
+	assert.Nil(t, models.Exports.Complete(export.ID, []byte(`{"version":1}`)))
+	assert.ErrorIs(t, models.Exports.Fail(export.ID), data.ErrRecordNotFound)
+
+	found, err := models.Exports.Get(export.ID, user.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, data.ExportReady, found.Status)
+	assert.NotNil(t, found.CompletedAt)
+
+	archive, err := models.Exports.GetArchive(export.ID, user.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"version":1}`, string(archive))
+
+	// The exports only belong to their user
+	_, err = models.Exports.Get(export.ID, uuid.New())
+	assert.ErrorIs(t, err, data.ErrRecordNotFound)
+
+	failed := &data.Export{UserID: user.ID, ExpiresAt: time.Now().Add(-time.Hour)}
+	assert.Nil(t, models.Exports.Insert(failed))
+	assert.Nil(t, models.Exports.Fail(failed.ID))
+
+	// The expired exports are deleted
+	assert.Nil(t, models.Exports.DeleteExpired(time.Now()))
+
+	_, err = models.Exports.Get(failed.ID, user.ID)
+	assert.ErrorIs(t, err, data.ErrRecordNotFound)
+
+	_, err = models.Exports.Get(export.ID, user.ID)
+	assert.Nil(t, err)
+}
+
+func TestSQLiteAuditEvents(t *testing.T) {
+	ctx := context.Background()
+	db := testSQLite(t)
+	models := data.InitSQLiteModels(db, 0)
+
+	user := testUser("jon@doe.com", "Jon")
+	assert.Nil(t, models.Users.Insert(ctx, user))
+
+	failed := &data.AuditEvent{UserID: user.ID, Type: data.AuditLoginFailed, Details: "password", IP: "10.0.0.1", UserAgent: "curl"}
+	assert.Nil(t, models.AuditEvents.Insert(failed))
+	assert.NotZero(t, failed.ID)
+
+	succeeded := &data.AuditEvent{UserID: user.ID, ActorID: &user.ID, Type: data.AuditLoginSucceeded, IP: "10.0.0.2"}
+	assert.Nil(t, models.AuditEvents.Insert(succeeded))
+
+	// The roles given and removed are recorded by the triggers
+	assert.Nil(t, models.Permissions.AddRolesForUser(user.ID, "support"))
+
+	_, err := db.Exec(`DELETE FROM users_roles WHERE user_id = $1`, user.ID)
+	assert.Nil(t, err)
+
+	filters := data.AuditEventFilters{
+		UserID:  user.ID,
+		Filters: data.Filters{Page: 1, PageSize: 10, Sort: "-created_at_dt", SortSafelist: data.AuditEventSortSafelist},
+	}
+
+	events, metadata, err := models.AuditEvents.GetAll(filters)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, metadata.TotalRecords)
+	assert.Equal(t, data.AuditRoleRemoved, events[0].Type)
+	assert.Equal(t, "support", events[0].Details)
+	assert.Equal(t, data.AuditRoleAdded, events[1].Type)
+	assert.Equal(t, user.ID, *events[2].ActorID)
+	assert.Nil(t, events[3].ActorID)
+
+	filters.IP = "10.0.0.1"
+
+	events, _, err = models.AuditEvents.GetAll(filters)
+	assert.Nil(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, failed.ID, events[0].ID)
+
+	after := time.Now().Add(time.Minute)
+	filters.IP = ""
+	filters.CreatedAfter = &after
+
+	events, _, err = models.AuditEvents.GetAll(filters)
+	assert.Nil(t, err)
+	assert.Empty(t, events)
+
+	// The events are append-only
+	_, err = db.Exec(`UPDATE user_audit_events SET ip_t = '' WHERE id = $1`, failed.ID)
+	assert.NotNil(t, err)
+
+	_, err = db.Exec(`DELETE FROM user_audit_events WHERE id = $1`, failed.ID)
+	assert.NotNil(t, err)
+
+	// The events older than the retention are deleted
+	assert.Nil(t, models.AuditEvents.DeleteBefore(time.Now().Add(time.Minute)))
+
+	filters.CreatedAfter = nil
+
+	_, metadata, err = models.AuditEvents.GetAll(filters)
+	assert.Nil(t, err)
+	assert.Zero(t, metadata.TotalRecords)
+}
+
+func TestSQLiteCredentials(t *testing.T) {
+	ctx := context.Background()
+	models := data.InitSQLiteModels(testSQLite(t), 0)
+
+	user := testUser("jon@doe.com", "Jon")
+	assert.Nil(t, models.Users.Insert(ctx, user))
+
+	credential := &data.WebAuthnCredential{ID: []byte("credential"), UserID: user.ID, PublicKey: []byte("key"), AAGUID: []byte("aaguid")}
+	assert.Nil(t, models.WebAuthn.Insert(credential))
+	assert.ErrorIs(t, models.WebAuthn.Insert(credential), data.ErrDuplicateCredential)
+
+	// The arguments are bound by the numbers of the placeholders
+	used, err := models.WebAuthn.UseSignCount(credential, 5)
+	assert.Nil(t, err)
+	assert.True(t, used)
+
+	found, err := models.WebAuthn.GetByID(credential.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(5), found.SignCount)
+	assert.NotNil(t, found.LastUsedAt)
+}
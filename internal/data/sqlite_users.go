@@ -0,0 +1,305 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SQLiteUserModel stores the users in SQLite, the IDs and the creation times
+// are set by the model instead of the defaults of Postgres. The reads of a user
+// are the queries of UserModel
+type SQLiteUserModel struct {
+	UserModel
+}
+
+// Insert writes the user with the "user.created" event in a transaction
+func (m SQLiteUserModel) Insert(ctx context.Context, user *User) error {
+	query := `
+        INSERT INTO users (id, created_at_dt, email_t, email_canonical_t, password_hash, first_name_t, last_name_t, activated_b)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+        RETURNING version`
+
+	id := uuid.New()
+	createdAt := time.Now().Truncate(time.Second)
+
+	user.Email = NormalizeEmail(user.Email)
+
+	args := []interface{}{id, createdAt, user.Email, CanonicalEmail(user.Email), user.Password.hash, user.FirstName, user.LastName, user.Activated}
+
+	ctx, cancel := context.WithTimeout(ctx, m.queryTimeout())
+	defer cancel()
+
+	return inTx(ctx, m.DB, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, query, args...).Scan(&user.Version)
+		if err != nil {
+			switch {
+			case isDuplicateEmail(err):
+				return ErrDuplicateEmail
+			default:
+				return err
+			}
+		}
+
+		user.ID = id
+		user.CreatedAt = createdAt
+
+		return insertEvents(ctx, tx, sqliteWebhookDeliveriesQuery, user, EventUserCreated)
+	})
+}
+
+// Update writes the user with the "user.updated" event in a transaction,
+// with the "user.activated" and "user.email_changed" events of the changes.
+// The transactions of SQLite lock the database when they begin, so the
+// current user is read without a lock of the row
+func (m SQLiteUserModel) Update(ctx context.Context, user *User) error {
+	query := `
+        UPDATE users
+        SET email_t = $1, first_name_t = $2, last_name_t = $3,  password_hash = $4, activated_b = $5, tokens_valid_after_dt = $6, pending_email_t = NULLIF($7, ''), email_canonical_t = $8, version = version + 1
+        WHERE id = $9 AND version = $10
+        RETURNING version`
+
+	user.Email = NormalizeEmail(user.Email)
+	user.PendingEmail = NormalizeEmail(user.PendingEmail)
+
+	args := []interface{}{
+		user.Email,
+		user.FirstName,
+		user.LastName,
+		user.Password.hash,
+		user.Activated,
+		user.TokensValidAfter,
+		user.PendingEmail,
+		CanonicalEmail(user.Email),
+		user.ID,
+		user.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.queryTimeout())
+	defer cancel()
+
+	// A retried transaction reads the user of the version before the update
+	version := user.Version
+
+	return inTx(ctx, m.DB, func(tx *sql.Tx) error {
+		var email string
+		var activated bool
+
+		err := tx.QueryRowContext(ctx, `SELECT email_t, activated_b FROM users WHERE id = $1 AND version = $2 AND deleted_at_dt IS NULL`, user.ID, version).Scan(&email, &activated)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrEditConflict
+			default:
+				return err
+			}
+		}
+
+		err = tx.QueryRowContext(ctx, query, args...).Scan(&user.Version)
+		if err != nil {
+			switch {
+			case isDuplicateEmail(err):
+				return ErrDuplicateEmail
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrEditConflict
+			default:
+				return err
+			}
+		}
+
+		events := []string{EventUserUpdated}
+		if user.Activated && !activated {
+			events = append(events, EventUserActivated)
+		}
+		if user.Email != email {
+			events = append(events, EventUserEmailChanged)
+		}
+
+		return insertEvents(ctx, tx, sqliteWebhookDeliveriesQuery, user, events...)
+	})
+}
+
+// Delete marks the user as deleted with the "user.deleted" event in a transaction,
+// the reads ignore the deleted user and its tokens are revoked
+func (m SQLiteUserModel) Delete(ctx context.Context, id uuid.UUID) error {
+	return m.softDelete(ctx, id, sqliteWebhookDeliveriesQuery)
+}
+
+// Restore clears the deletion of a user deleted after the time,
+// with the "user.restored" event in a transaction
+func (m SQLiteUserModel) Restore(ctx context.Context, id uuid.UUID, deletedAfter time.Time) (*User, error) {
+	return m.restore(ctx, id, deletedAfter, sqliteWebhookDeliveriesQuery)
+}
+
+// Purge deletes the users deleted before the time with their data, the transactions
+// of SQLite lock the database so the users are selected without a lock
+func (m SQLiteUserModel) Purge(ctx context.Context, deletedBefore time.Time, limit int) ([]*UserPurge, error) {
+	query := `
+        SELECT id, deleted_at_dt
+        FROM users
+        WHERE deleted_at_dt < $1
+        ORDER BY deleted_at_dt
+        LIMIT $2`
+
+	return m.purge(ctx, query, deletedBefore, limit, sqliteWebhookDeliveriesQuery, sqliteScrubOutboxQuery, sqliteScrubWebhookDeliveriesQuery)
+}
+
+// sqliteUserFiltersWhere is the condition of UserFilters, with the arguments $1 to $5,
+// LIKE ignores the case of the ASCII letters like ILIKE, the deleted users are never listed
+const sqliteUserFiltersWhere = `
+        WHERE deleted_at_dt IS NULL
+        AND (email_t LIKE '%' || $1 || '%' ESCAPE '\' OR $1 = '')
+        AND ((first_name_t || ' ' || last_name_t) LIKE '%' || $2 || '%' ESCAPE '\' OR $2 = '')
+        AND (activated_b = $3 OR $3 IS NULL)
+        AND (created_at_dt >= $4 OR $4 IS NULL)
+        AND (created_at_dt < $5 OR $5 IS NULL)`
+
+// GetAll returns a page of the users, with the total number of users
+func (m SQLiteUserModel) GetAll(ctx context.Context, filters UserFilters) ([]*User, Metadata, error) {
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(), id, created_at_dt, email_t, password_hash, first_name_t, last_name_t, activated_b, version, tokens_valid_after_dt, COALESCE(pending_email_t, '')
+        FROM users %s
+        ORDER BY %s %s, id ASC
+        LIMIT $6 OFFSET $7`, sqliteUserFiltersWhere, filters.sortColumn(), filters.sortDirection())
+
+	args := append(filters.args(), filters.limit(), filters.offset())
+
+	ctx, cancel := context.WithTimeout(ctx, m.queryTimeout())
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, translateError(ctx, err)
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	users := []*User{}
+
+	for rows.Next() {
+		var user User
+
+		err := rows.Scan(
+			&totalRecords,
+			&user.ID,
+			&user.CreatedAt,
+			&user.Email,
+			&user.Password.hash,
+			&user.FirstName,
+			&user.LastName,
+			&user.Activated,
+			&user.Version,
+			&user.TokensValidAfter,
+			&user.PendingEmail,
+		)
+		if err != nil {
+			return nil, Metadata{}, translateError(ctx, err)
+		}
+
+		users = append(users, &user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, translateError(ctx, err)
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return users, metadata, nil
+}
+
+// GetAllAfter returns the users after the cursor of the filters, the metadata
+// has the cursor of the next page
+func (m SQLiteUserModel) GetAllAfter(ctx context.Context, filters UserFilters) ([]*User, Metadata, error) {
+	column := filters.sortColumn()
+	direction := filters.sortDirection()
+
+	// One more user is read to know if there is a next page
+	args := append(filters.args(), filters.limit()+1)
+	keyset := ""
+
+	if filters.Cursor != nil {
+		// The values are compared as stored, the times are stored as text in UTC
+		var value interface{} = filters.Cursor.Value
+
+		switch column {
+		case "id":
+			id, err := uuid.Parse(filters.Cursor.Value)
+			if err != nil {
+				return nil, Metadata{}, ErrInvalidCursor
+			}
+			value = id
+		case "created_at_dt":
+			createdAt, err := time.Parse(time.RFC3339Nano, filters.Cursor.Value)
+			if err != nil {
+				return nil, Metadata{}, ErrInvalidCursor
+			}
+			value = createdAt
+		}
+
+		operator := ">"
+		if direction == "DESC" {
+			operator = "<"
+		}
+
+		keyset = fmt.Sprintf("AND (%s, id) %s ($7, $8)", column, operator)
+		args = append(args, value, filters.Cursor.ID)
+	}
+
+	query := fmt.Sprintf(`
+        SELECT id, created_at_dt, email_t, password_hash, first_name_t, last_name_t, activated_b, version, tokens_valid_after_dt, COALESCE(pending_email_t, '')
+        FROM users %s
+        %s
+        ORDER BY %s %s, id %s
+        LIMIT $6`, sqliteUserFiltersWhere, keyset, column, direction, direction)
+
+	ctx, cancel := context.WithTimeout(ctx, m.queryTimeout())
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, translateError(ctx, err)
+	}
+	defer rows.Close()
+
+	users := []*User{}
+
+	for rows.Next() {
+		var user User
+
+		err := rows.Scan(
+			&user.ID,
+			&user.CreatedAt,
+			&user.Email,
+			&user.Password.hash,
+			&user.FirstName,
+			&user.LastName,
+			&user.Activated,
+			&user.Version,
+			&user.TokensValidAfter,
+			&user.PendingEmail,
+		)
+		if err != nil {
+			return nil, Metadata{}, translateError(ctx, err)
+		}
+
+		users = append(users, &user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, translateError(ctx, err)
+	}
+
+	metadata := Metadata{PageSize: filters.PageSize}
+
+	if len(users) > filters.limit() {
+		users = users[:filters.limit()]
+		metadata.NextCursor = NewUserCursor(users[len(users)-1], filters.Sort).Encode()
+	}
+
+	return users, metadata, nil
+}
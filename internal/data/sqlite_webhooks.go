@@ -0,0 +1,243 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SQLiteWebhookModel stores the subscriptions in SQLite,
+// the event types are stored as a JSON array
+type SQLiteWebhookModel struct {
+	DB *sql.DB
+}
+
+// scanSQLiteWebhookSubscription scans the columns of the subscription
+func scanSQLiteWebhookSubscription(scanner interface{ Scan(...interface{}) error }, subscription *WebhookSubscription) error {
+	var events string
+
+	err := scanner.Scan(
+		&subscription.ID,
+		&subscription.CreatedAt,
+		&subscription.URL,
+		&events,
+		&subscription.Secret,
+		&subscription.Active,
+		&subscription.Version,
+	)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal([]byte(events), &subscription.Events)
+}
+
+func (m SQLiteWebhookModel) Insert(subscription *WebhookSubscription) error {
+	query := `
+        INSERT INTO webhook_subscriptions (id, created_at_dt, url_t, events, secret, active_b)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING version`
+
+	events, err := json.Marshal(subscription.Events)
+	if err != nil {
+		return err
+	}
+
+	id := uuid.New()
+	createdAt := time.Now().Truncate(time.Second)
+
+	args := []interface{}{id, createdAt, subscription.URL, string(events), subscription.Secret, subscription.Active}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&subscription.Version)
+	if err != nil {
+		return err
+	}
+
+	subscription.ID = id
+	subscription.CreatedAt = createdAt
+
+	return nil
+}
+
+func (m SQLiteWebhookModel) Get(id uuid.UUID) (*WebhookSubscription, error) {
+	query := `
+        SELECT id, created_at_dt, url_t, events, secret, active_b, version
+        FROM webhook_subscriptions
+        WHERE id = $1`
+
+	var subscription WebhookSubscription
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := scanSQLiteWebhookSubscription(m.DB.QueryRowContext(ctx, query, id), &subscription)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &subscription, nil
+}
+
+func (m SQLiteWebhookModel) GetAll() ([]*WebhookSubscription, error) {
+	query := `
+        SELECT id, created_at_dt, url_t, events, secret, active_b, version
+        FROM webhook_subscriptions
+        ORDER BY created_at_dt, id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscriptions := []*WebhookSubscription{}
+
+	for rows.Next() {
+		var subscription WebhookSubscription
+
+		err := scanSQLiteWebhookSubscription(rows, &subscription)
+		if err != nil {
+			return nil, err
+		}
+
+		subscriptions = append(subscriptions, &subscription)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return subscriptions, nil
+}
+
+func (m SQLiteWebhookModel) Update(subscription *WebhookSubscription) error {
+	query := `
+        UPDATE webhook_subscriptions
+        SET url_t = $1, events = $2, secret = $3, active_b = $4, version = version + 1
+        WHERE id = $5 AND version = $6
+        RETURNING version`
+
+	events, err := json.Marshal(subscription.Events)
+	if err != nil {
+		return err
+	}
+
+	args := []interface{}{
+		subscription.URL,
+		string(events),
+		subscription.Secret,
+		subscription.Active,
+		subscription.ID,
+		subscription.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&subscription.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete removes the subscription with its deliveries
+func (m SQLiteWebhookModel) Delete(id uuid.UUID) error {
+	return WebhookModel{DB: m.DB}.Delete(id)
+}
+
+// sqliteWebhookDeliveriesQuery queues the event $1 of the type $2 with the payload $3
+// to every active subscription of its type, in the transaction of the event
+const sqliteWebhookDeliveriesQuery = `
+        INSERT INTO webhook_deliveries (subscription_id, event_id, type_t, payload)
+        SELECT id, $1, $2, $3
+        FROM webhook_subscriptions
+        WHERE active_b AND EXISTS (SELECT 1 FROM json_each(events) WHERE value IN ($2, '*'))`
+
+// SQLiteWebhookDeliveryModel claims the deliveries of a SQLite database,
+// the other queries are the queries of WebhookDeliveryModel
+type SQLiteWebhookDeliveryModel struct {
+	WebhookDeliveryModel
+}
+
+// Claim returns the pending deliveries that are due, with the URL and the secret
+// of their subscription. The deliveries are postponed by the lease in the same
+// transaction, the transactions of SQLite lock the database when they begin
+func (m SQLiteWebhookDeliveryModel) Claim(limit int, lease time.Duration) ([]*WebhookDelivery, error) {
+	query := `
+        SELECT ` + webhookDeliveryColumns + `, webhook_subscriptions.url_t, webhook_subscriptions.secret
+        FROM webhook_deliveries
+        INNER JOIN webhook_subscriptions
+        ON webhook_subscriptions.id = webhook_deliveries.subscription_id
+        WHERE status_t = 'pending' AND next_attempt_at_dt <= $1
+        ORDER BY next_attempt_at_dt, webhook_deliveries.id
+        LIMIT $2`
+
+	now := time.Now()
+	nextAttemptAt := now.Add(lease)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, now, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := []*WebhookDelivery{}
+
+	for rows.Next() {
+		var delivery WebhookDelivery
+
+		err := scanWebhookDelivery(rows, &delivery, &delivery.URL, &delivery.Secret)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		deliveries = append(deliveries, &delivery)
+	}
+
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, delivery := range deliveries {
+		_, err = tx.ExecContext(ctx, `UPDATE webhook_deliveries SET next_attempt_at_dt = $1 WHERE id = $2`, nextAttemptAt, delivery.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		delivery.NextAttemptAt = nextAttemptAt
+	}
+
+	return deliveries, tx.Commit()
+}
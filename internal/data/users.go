@@ -2,8 +2,12 @@ package data
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/e-inwork-com/go-user-service/internal/validator"
@@ -19,10 +23,32 @@ var (
 var AnonymousUser = &User{}
 
 type UserModelInterface interface {
-	Insert(user *User) error
-	GetByID(id uuid.UUID) (*User, error)
-	GetByEmail(email string) (*User, error)
-	Update(user *User) error
+	Insert(ctx context.Context, user *User) error
+	GetByID(ctx context.Context, id uuid.UUID) (*User, error)
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	Update(ctx context.Context, user *User) error
+	GetForToken(ctx context.Context, tokenScope string, tokenPlaintext string) (*User, error)
+	Delete(ctx context.Context, id uuid.UUID) error
+	Restore(ctx context.Context, id uuid.UUID, deletedAfter time.Time) (*User, error)
+	Purge(ctx context.Context, deletedBefore time.Time, limit int) ([]*UserPurge, error)
+	GetAll(ctx context.Context, filters UserFilters) ([]*User, Metadata, error)
+	GetAllAfter(ctx context.Context, filters UserFilters) ([]*User, Metadata, error)
+}
+
+// UserFilters filter the users of a listing, an empty field doesn't filter
+type UserFilters struct {
+	Email         string
+	Name          string
+	Activated     *bool
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Filters
+}
+
+// UserSortSafelist are the sort values of a listing of the users
+var UserSortSafelist = []string{
+	"id", "email_t", "first_name_t", "last_name_t", "created_at_dt",
+	"-id", "-email_t", "-first_name_t", "-last_name_t", "-created_at_dt",
 }
 
 type User struct {
@@ -34,6 +60,21 @@ type User struct {
 	LastName  string    `json:"last_name_t"`
 	Activated bool      `json:"activated_b"`
 	Version   int       `json:"-"`
+
+	// PendingEmail is the new email waiting to be confirmed
+	PendingEmail string `json:"pending_email_t,omitempty"`
+
+	// TokensValidAfter rejects every token issued before it
+	TokensValidAfter time.Time `json:"-"`
+
+	// Permissions are loaded with the authenticated user
+	Permissions Permissions `json:"-"`
+}
+
+// RevokeTokens invalidates every token issued to the user so far,
+// the change is persisted with Update
+func (u *User) RevokeTokens() {
+	u.TokensValidAfter = time.Now().Truncate(time.Second)
 }
 
 func (u *User) IsAnonymous() bool {
@@ -71,7 +112,97 @@ func (p *password) Matches(plaintextPassword string) (bool, error) {
 	return true, nil
 }
 
+var (
+	dummyPasswordOnce sync.Once
+	dummyPassword     password
+)
+
+// DummyPasswordMatches takes the time of a password check, so a login
+// of an email that doesn't exist can't be told apart by its duration
+func DummyPasswordMatches(plaintextPassword string) {
+	dummyPasswordOnce.Do(func() {
+		dummyPassword.Set("dummy-password")
+	})
+
+	dummyPassword.Matches(plaintextPassword)
+}
+
+// CaseSensitiveEmails keeps the case of the local part of the emails in their identity,
+// the local part is case-sensitive by the RFC but not by the mail providers, so it is
+// case-insensitive by default. It is set once on startup, the canonical emails stored
+// with the other case are rebuilt by RekeyEmails
+var CaseSensitiveEmails bool
+
+// NormalizeEmail returns the email as it is stored, without the spaces around
+// it and with the domain in lowercase, the local part keeps its case
+func NormalizeEmail(email string) string {
+	email = strings.TrimSpace(email)
+
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return email
+	}
+
+	return email[:at+1] + strings.ToLower(email[at+1:])
+}
+
+// CanonicalEmail returns the identity of the email, the normalized email with
+// the local part in lowercase too unless the emails are case-sensitive, so the
+// emails with the same canonical email are the same account. The emails are
+// ASCII, so the case is the case of lower() in SQL
+func CanonicalEmail(email string) string {
+	if CaseSensitiveEmails {
+		return NormalizeEmail(email)
+	}
+
+	return strings.ToLower(NormalizeEmail(email))
+}
+
+// canonicalEmailSQL returns the SQL expression of CanonicalEmail for the
+// normalized email of the column
+func canonicalEmailSQL(column string) string {
+	if CaseSensitiveEmails {
+		return column
+	}
+
+	return "lower(" + column + ")"
+}
+
+// isDuplicateEmail reports whether err violates the uniqueness of the emails, SQLite
+// also keeps the unique constraint of the email before the canonical emails
+func isDuplicateEmail(err error) bool {
+	return isUniqueViolation(err, "users_email_canonical_key", "users", "email_canonical_t") ||
+		isUniqueViolation(err, "users_email_key", "users", "email_t")
+}
+
+// RekeyEmails rebuilds the canonical emails of the users stored with the other case
+// of the local parts, ErrDuplicateEmail is returned if two users get the same one
+func RekeyEmails(ctx context.Context, db *sql.DB) (int64, error) {
+	query := fmt.Sprintf(`
+        UPDATE users
+        SET email_canonical_t = %[1]s
+        WHERE email_canonical_t <> %[1]s`, canonicalEmailSQL("email_t"))
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, query)
+	if err != nil {
+		switch {
+		case isDuplicateEmail(err):
+			return 0, ErrDuplicateEmail
+		default:
+			return 0, err
+		}
+	}
+
+	return result.RowsAffected()
+}
+
+// ValidateEmail validates the normalized email, the spaces around it are ignored
 func ValidateEmail(v *validator.Validator, email string) {
+	email = NormalizeEmail(email)
+
 	v.Check(email != "", "email_t", "must be provided")
 	v.Check(validator.Matches(email, validator.EmailRX), "email", "must be a valid email address")
 }
@@ -106,50 +237,73 @@ func ValidateUser(v *validator.Validator, user *User) {
 
 type UserModel struct {
 	DB *sql.DB
+
+	// QueryTimeout limits every query on top of the context of the caller,
+	// the default is three seconds
+	QueryTimeout time.Duration
+}
+
+func (m UserModel) queryTimeout() time.Duration {
+	if m.QueryTimeout <= 0 {
+		return 3 * time.Second
+	}
+
+	return m.QueryTimeout
 }
 
-func (m UserModel) Insert(user *User) error {
+// Insert writes the user with the "user.created" event in a transaction,
+// the email is stored normalized
+func (m UserModel) Insert(ctx context.Context, user *User) error {
 	query := `
-        INSERT INTO users (email_t, password_hash, first_name_t, last_name_t, activated_b)
-        VALUES ($1, $2, $3, $4, $5)
+        INSERT INTO users (email_t, email_canonical_t, password_hash, first_name_t, last_name_t, activated_b)
+        VALUES ($1, $2, $3, $4, $5, $6)
         RETURNING id, created_at_dt, version`
 
-	args := []interface{}{user.Email, user.Password.hash, user.FirstName, user.LastName, user.Activated}
+	user.Email = NormalizeEmail(user.Email)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	args := []interface{}{user.Email, CanonicalEmail(user.Email), user.Password.hash, user.FirstName, user.LastName, user.Activated}
+
+	ctx, cancel := context.WithTimeout(ctx, m.queryTimeout())
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
-	if err != nil {
-		switch {
-		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
-			return ErrDuplicateEmail
-		default:
-			return err
+	return inTx(ctx, m.DB, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
+		if err != nil {
+			switch {
+			case isDuplicateEmail(err):
+				return ErrDuplicateEmail
+			default:
+				return err
+			}
 		}
-	}
 
-	return nil
+		return insertEvents(ctx, tx, webhookDeliveriesQuery, user, EventUserCreated)
+	})
 }
 
-func (m UserModel) GetByEmail(email string) (*User, error) {
+// GetByEmail gets the user of the email in any case, by the canonical email
+func (m UserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
 	query := `
-        SELECT id, created_at_dt, email_t, password_hash, activated_b, version
+        SELECT id, created_at_dt, email_t, password_hash, first_name_t, last_name_t, activated_b, version, tokens_valid_after_dt, COALESCE(pending_email_t, '')
         FROM users
-        WHERE email_t = $1`
+        WHERE email_canonical_t = $1 AND deleted_at_dt IS NULL`
 
 	var user User
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, m.queryTimeout())
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, email).Scan(
+	err := m.DB.QueryRowContext(ctx, query, CanonicalEmail(email)).Scan(
 		&user.ID,
 		&user.CreatedAt,
 		&user.Email,
 		&user.Password.hash,
+		&user.FirstName,
+		&user.LastName,
 		&user.Activated,
 		&user.Version,
+		&user.TokensValidAfter,
+		&user.PendingEmail,
 	)
 
 	if err != nil {
@@ -157,22 +311,22 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 		case errors.Is(err, sql.ErrNoRows):
 			return nil, ErrRecordNotFound
 		default:
-			return nil, err
+			return nil, translateError(ctx, err)
 		}
 	}
 
 	return &user, nil
 }
 
-func (m UserModel) GetByID(id uuid.UUID) (*User, error) {
+func (m UserModel) GetByID(ctx context.Context, id uuid.UUID) (*User, error) {
 	query := `
-        SELECT id, created_at_dt, email_t, password_hash, first_name_t, last_name_t, activated_b, version
+        SELECT id, created_at_dt, email_t, password_hash, first_name_t, last_name_t, activated_b, version, tokens_valid_after_dt, COALESCE(pending_email_t, '')
         FROM users
-        WHERE id = $1`
+        WHERE id = $1 AND deleted_at_dt IS NULL`
 
 	var user User
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, m.queryTimeout())
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, id).Scan(
@@ -184,6 +338,8 @@ func (m UserModel) GetByID(id uuid.UUID) (*User, error) {
 		&user.LastName,
 		&user.Activated,
 		&user.Version,
+		&user.TokensValidAfter,
+		&user.PendingEmail,
 	)
 
 	if err != nil {
@@ -191,44 +347,392 @@ func (m UserModel) GetByID(id uuid.UUID) (*User, error) {
 		case errors.Is(err, sql.ErrNoRows):
 			return nil, ErrRecordNotFound
 		default:
-			return nil, err
+			return nil, translateError(ctx, err)
 		}
 	}
 
 	return &user, nil
 }
 
-func (m UserModel) Update(user *User) error {
+// Update writes the user with the "user.updated" event in a transaction,
+// with the "user.activated" and "user.email_changed" events of the changes
+func (m UserModel) Update(ctx context.Context, user *User) error {
 	query := `
         UPDATE users
-        SET email_t = $1, first_name_t = $2, last_name_t = $3,  password_hash = $4, activated_b = $5, version = version + 1
-        WHERE id = $6 AND version = $7
+        SET email_t = $1, first_name_t = $2, last_name_t = $3,  password_hash = $4, activated_b = $5, tokens_valid_after_dt = $6, pending_email_t = NULLIF($7, ''), email_canonical_t = $8, version = version + 1
+        WHERE id = $9 AND version = $10
         RETURNING version`
 
+	user.Email = NormalizeEmail(user.Email)
+	user.PendingEmail = NormalizeEmail(user.PendingEmail)
+
 	args := []interface{}{
 		user.Email,
 		user.FirstName,
 		user.LastName,
 		user.Password.hash,
 		user.Activated,
+		user.TokensValidAfter,
+		user.PendingEmail,
+		CanonicalEmail(user.Email),
 		user.ID,
 		user.Version,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, m.queryTimeout())
+	defer cancel()
+
+	// A retried transaction reads the user of the version before the update
+	version := user.Version
+
+	return inTx(ctx, m.DB, func(tx *sql.Tx) error {
+		// Lock the current user to know what is changed
+		var email string
+		var activated bool
+
+		err := tx.QueryRowContext(ctx, `SELECT email_t, activated_b FROM users WHERE id = $1 AND version = $2 AND deleted_at_dt IS NULL FOR UPDATE`, user.ID, version).Scan(&email, &activated)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrEditConflict
+			default:
+				return err
+			}
+		}
+
+		err = tx.QueryRowContext(ctx, query, args...).Scan(&user.Version)
+		if err != nil {
+			switch {
+			case isDuplicateEmail(err):
+				return ErrDuplicateEmail
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrEditConflict
+			default:
+				return err
+			}
+		}
+
+		events := []string{EventUserUpdated}
+		if user.Activated && !activated {
+			events = append(events, EventUserActivated)
+		}
+		if user.Email != email {
+			events = append(events, EventUserEmailChanged)
+		}
+
+		return insertEvents(ctx, tx, webhookDeliveriesQuery, user, events...)
+	})
+}
+
+// GetForToken gets the user of a token that has the scope and isn't expired,
+// a restore token only gets a deleted user and the other tokens an active user
+func (m UserModel) GetForToken(ctx context.Context, tokenScope string, tokenPlaintext string) (*User, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+        SELECT users.id, users.created_at_dt, users.email_t, users.password_hash, users.first_name_t, users.last_name_t, users.activated_b, users.version, users.tokens_valid_after_dt, COALESCE(users.pending_email_t, '')
+        FROM users
+        INNER JOIN tokens
+        ON users.id = tokens.user_id
+        WHERE tokens.hash = $1
+        AND tokens.scope = $2
+        AND tokens.expiry_dt > $3
+        AND (users.deleted_at_dt IS NULL) = (tokens.scope <> $4)`
+
+	args := []interface{}{tokenHash[:], tokenScope, time.Now(), ScopeRestore}
+
+	var user User
+
+	ctx, cancel := context.WithTimeout(ctx, m.queryTimeout())
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.Version)
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Email,
+		&user.Password.hash,
+		&user.FirstName,
+		&user.LastName,
+		&user.Activated,
+		&user.Version,
+		&user.TokensValidAfter,
+		&user.PendingEmail,
+	)
+
 	if err != nil {
 		switch {
-		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
-			return ErrDuplicateEmail
 		case errors.Is(err, sql.ErrNoRows):
-			return ErrEditConflict
+			return nil, ErrRecordNotFound
 		default:
-			return err
+			return nil, translateError(ctx, err)
 		}
 	}
 
-	return nil
+	return &user, nil
+}
+
+// Delete marks the user as deleted with the "user.deleted" event in a transaction,
+// the reads ignore the deleted user and its tokens are revoked. The user keeps its
+// email until it is purged, the data of the event is the deleted user
+func (m UserModel) Delete(ctx context.Context, id uuid.UUID) error {
+	return m.softDelete(ctx, id, webhookDeliveriesQuery)
+}
+
+func (m UserModel) softDelete(ctx context.Context, id uuid.UUID, deliveriesQuery string) error {
+	query := `
+        UPDATE users
+        SET deleted_at_dt = $2, tokens_valid_after_dt = $2, version = version + 1
+        WHERE id = $1 AND deleted_at_dt IS NULL
+        RETURNING id, created_at_dt, email_t, first_name_t, last_name_t, activated_b`
+
+	deletedAt := time.Now().Truncate(time.Second)
+
+	ctx, cancel := context.WithTimeout(ctx, m.queryTimeout())
+	defer cancel()
+
+	return inTx(ctx, m.DB, func(tx *sql.Tx) error {
+		var user User
+
+		err := tx.QueryRowContext(ctx, query, id, deletedAt).Scan(
+			&user.ID,
+			&user.CreatedAt,
+			&user.Email,
+			&user.FirstName,
+			&user.LastName,
+			&user.Activated,
+		)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrRecordNotFound
+			default:
+				return err
+			}
+		}
+
+		return insertEvents(ctx, tx, deliveriesQuery, &user, EventUserDeleted)
+	})
+}
+
+// Restore clears the deletion of a user deleted after the time, with the
+// "user.restored" event in a transaction. It returns ErrRecordNotFound if the
+// user isn't deleted or was deleted before, the tokens issued before the
+// deletion stay revoked
+func (m UserModel) Restore(ctx context.Context, id uuid.UUID, deletedAfter time.Time) (*User, error) {
+	return m.restore(ctx, id, deletedAfter, webhookDeliveriesQuery)
+}
+
+func (m UserModel) restore(ctx context.Context, id uuid.UUID, deletedAfter time.Time, deliveriesQuery string) (*User, error) {
+	query := `
+        UPDATE users
+        SET deleted_at_dt = NULL, version = version + 1
+        WHERE id = $1 AND deleted_at_dt > $2
+        RETURNING id, created_at_dt, email_t, password_hash, first_name_t, last_name_t, activated_b, version, tokens_valid_after_dt, COALESCE(pending_email_t, '')`
+
+	var user User
+
+	ctx, cancel := context.WithTimeout(ctx, m.queryTimeout())
+	defer cancel()
+
+	err := inTx(ctx, m.DB, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, query, id, deletedAfter).Scan(
+			&user.ID,
+			&user.CreatedAt,
+			&user.Email,
+			&user.Password.hash,
+			&user.FirstName,
+			&user.LastName,
+			&user.Activated,
+			&user.Version,
+			&user.TokensValidAfter,
+			&user.PendingEmail,
+		)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrRecordNotFound
+			default:
+				return err
+			}
+		}
+
+		return insertEvents(ctx, tx, deliveriesQuery, &user, EventUserRestored)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// userFiltersWhere is the condition of UserFilters, with the arguments $1 to $5,
+// the deleted users are never listed
+const userFiltersWhere = `
+        WHERE deleted_at_dt IS NULL
+        AND (email_t ILIKE '%' || $1 || '%' OR $1 = '')
+        AND ((first_name_t || ' ' || last_name_t) ILIKE '%' || $2 || '%' OR $2 = '')
+        AND (activated_b = $3 OR $3 IS NULL)
+        AND (created_at_dt >= $4 OR $4 IS NULL)
+        AND (created_at_dt < $5 OR $5 IS NULL)`
+
+func (f UserFilters) args() []interface{} {
+	return []interface{}{escapeLike(f.Email), escapeLike(f.Name), f.Activated, f.CreatedAfter, f.CreatedBefore}
+}
+
+// GetAll returns a page of the users, with the total number of users
+func (m UserModel) GetAll(ctx context.Context, filters UserFilters) ([]*User, Metadata, error) {
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(), id, created_at_dt, email_t, password_hash, first_name_t, last_name_t, activated_b, version, tokens_valid_after_dt, COALESCE(pending_email_t, '')
+        FROM users %s
+        ORDER BY %s %s, id ASC
+        LIMIT $6 OFFSET $7`, userFiltersWhere, filters.sortColumn(), filters.sortDirection())
+
+	args := append(filters.args(), filters.limit(), filters.offset())
+
+	ctx, cancel := context.WithTimeout(ctx, m.queryTimeout())
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, translateError(ctx, err)
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	users := []*User{}
+
+	for rows.Next() {
+		var user User
+
+		err := rows.Scan(
+			&totalRecords,
+			&user.ID,
+			&user.CreatedAt,
+			&user.Email,
+			&user.Password.hash,
+			&user.FirstName,
+			&user.LastName,
+			&user.Activated,
+			&user.Version,
+			&user.TokensValidAfter,
+			&user.PendingEmail,
+		)
+		if err != nil {
+			return nil, Metadata{}, translateError(ctx, err)
+		}
+
+		users = append(users, &user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, translateError(ctx, err)
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return users, metadata, nil
+}
+
+// GetAllAfter returns the users after the cursor of the filters, the users are
+// found with the index of the sort column instead of being skipped with an offset,
+// the metadata has the cursor of the next page
+func (m UserModel) GetAllAfter(ctx context.Context, filters UserFilters) ([]*User, Metadata, error) {
+	column := filters.sortColumn()
+	direction := filters.sortDirection()
+
+	// One more user is read to know if there is a next page
+	args := append(filters.args(), filters.limit()+1)
+	keyset := ""
+
+	if filters.Cursor != nil {
+		// The cursor value is sent as text and cast to the type of the column
+		columnType := "text"
+		switch column {
+		case "id":
+			columnType = "uuid"
+		case "created_at_dt":
+			columnType = "timestamp with time zone"
+		}
+
+		operator := ">"
+		if direction == "DESC" {
+			operator = "<"
+		}
+
+		keyset = fmt.Sprintf("AND (%s, id) %s (CAST($7 AS %s), $8)", column, operator, columnType)
+		args = append(args, filters.Cursor.Value, filters.Cursor.ID)
+	}
+
+	query := fmt.Sprintf(`
+        SELECT id, created_at_dt, email_t, password_hash, first_name_t, last_name_t, activated_b, version, tokens_valid_after_dt, COALESCE(pending_email_t, '')
+        FROM users %s
+        %s
+        ORDER BY %s %s, id %s
+        LIMIT $6`, userFiltersWhere, keyset, column, direction, direction)
+
+	ctx, cancel := context.WithTimeout(ctx, m.queryTimeout())
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, translateError(ctx, err)
+	}
+	defer rows.Close()
+
+	users := []*User{}
+
+	for rows.Next() {
+		var user User
+
+		err := rows.Scan(
+			&user.ID,
+			&user.CreatedAt,
+			&user.Email,
+			&user.Password.hash,
+			&user.FirstName,
+			&user.LastName,
+			&user.Activated,
+			&user.Version,
+			&user.TokensValidAfter,
+			&user.PendingEmail,
+		)
+		if err != nil {
+			return nil, Metadata{}, translateError(ctx, err)
+		}
+
+		users = append(users, &user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, translateError(ctx, err)
+	}
+
+	metadata := Metadata{PageSize: filters.PageSize}
+
+	if len(users) > filters.limit() {
+		users = users[:filters.limit()]
+		metadata.NextCursor = NewUserCursor(users[len(users)-1], filters.Sort).Encode()
+	}
+
+	return users, metadata, nil
+}
+
+// NewUserCursor creates the cursor after the user for the sort
+func NewUserCursor(user *User, sort string) *Cursor {
+	cursor := &Cursor{Sort: sort, ID: user.ID}
+
+	switch strings.TrimPrefix(sort, "-") {
+	case "id":
+		cursor.Value = user.ID.String()
+	case "email_t":
+		cursor.Value = user.Email
+	case "first_name_t":
+		cursor.Value = user.FirstName
+	case "last_name_t":
+		cursor.Value = user.LastName
+	case "created_at_dt":
+		cursor.Value = user.CreatedAt.Format(time.RFC3339Nano)
+	}
+
+	return cursor
 }
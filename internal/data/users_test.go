@@ -0,0 +1,51 @@
+package data_test
+
+import (
+	"testing"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
+	"github.com/e-inwork-com/go-user-service/internal/validator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanonicalEmail(t *testing.T) {
+	tests := []struct {
+		email      string
+		normalized string
+		canonical  string
+	}{
+		{"jon@doe.com", "jon@doe.com", "jon@doe.com"},
+		{" Jon.Doe@Example.COM\t", "Jon.Doe@example.com", "jon.doe@example.com"},
+		{"JON@DOE.COM", "JON@doe.com", "jon@doe.com"},
+		{"no-domain", "no-domain", "no-domain"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.email, func(t *testing.T) {
+			assert.Equal(t, tt.normalized, data.NormalizeEmail(tt.email))
+			assert.Equal(t, tt.canonical, data.CanonicalEmail(tt.email))
+		})
+	}
+
+	t.Run("Case-Sensitive Emails", func(t *testing.T) {
+		data.CaseSensitiveEmails = true
+		t.Cleanup(func() { data.CaseSensitiveEmails = false })
+
+		assert.Equal(t, "Jon.Doe@example.com", data.CanonicalEmail(" Jon.Doe@Example.COM\t"))
+	})
+}
+
+func TestValidateEmail(t *testing.T) {
+	for email, valid := range map[string]bool{
+		"jon@doe.com":     true,
+		"  Jon@Doe.com  ": true,
+		"":                false,
+		"   ":             false,
+		"jon@":            false,
+		"jon doe@doe.com": false,
+	} {
+		v := validator.New()
+		data.ValidateEmail(v, email)
+		assert.Equal(t, valid, v.Valid(), email)
+	}
+}
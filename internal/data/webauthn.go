@@ -0,0 +1,215 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrDuplicateCredential = errors.New("duplicate credential")
+
+type WebAuthnCredentialModelInterface interface {
+	Insert(credential *WebAuthnCredential) error
+	GetByID(id []byte) (*WebAuthnCredential, error)
+	GetAllForUser(userID uuid.UUID) ([]*WebAuthnCredential, error)
+	UseSignCount(credential *WebAuthnCredential, signCount uint32) (bool, error)
+	Delete(id []byte, userID uuid.UUID) error
+}
+
+// WebAuthnCredential is a passkey or a security key of a user,
+// the public key is stored in the COSE_Key format
+type WebAuthnCredential struct {
+	ID         []byte
+	UserID     uuid.UUID
+	CreatedAt  time.Time
+	Name       string
+	PublicKey  []byte
+	SignCount  uint32
+	AAGUID     []byte
+	Transports []string
+	LastUsedAt *time.Time
+}
+
+type WebAuthnCredentialModel struct {
+	DB *sql.DB
+}
+
+func (m WebAuthnCredentialModel) Insert(credential *WebAuthnCredential) error {
+	query := `
+        INSERT INTO webauthn_credentials (id, user_id, name_t, public_key, sign_count, aaguid, transports_t)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+        RETURNING created_at_dt`
+
+	args := []interface{}{
+		credential.ID,
+		credential.UserID,
+		credential.Name,
+		credential.PublicKey,
+		int64(credential.SignCount),
+		credential.AAGUID,
+		strings.Join(credential.Transports, " "),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&credential.CreatedAt)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err, "webauthn_credentials_pkey", "webauthn_credentials", "id"):
+			return ErrDuplicateCredential
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m WebAuthnCredentialModel) GetByID(id []byte) (*WebAuthnCredential, error) {
+	query := `
+        SELECT id, user_id, created_at_dt, name_t, public_key, sign_count, aaguid, transports_t, last_used_at_dt
+        FROM webauthn_credentials
+        WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	credential, err := scanWebAuthnCredential(m.DB.QueryRowContext(ctx, query, id))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return credential, nil
+}
+
+func (m WebAuthnCredentialModel) GetAllForUser(userID uuid.UUID) ([]*WebAuthnCredential, error) {
+	query := `
+        SELECT id, user_id, created_at_dt, name_t, public_key, sign_count, aaguid, transports_t, last_used_at_dt
+        FROM webauthn_credentials
+        WHERE user_id = $1
+        ORDER BY created_at_dt`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credentials := []*WebAuthnCredential{}
+
+	for rows.Next() {
+		credential, err := scanWebAuthnCredential(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		credentials = append(credentials, credential)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return credentials, nil
+}
+
+// UseSignCount stores the sign count of an assertion, it returns false if the
+// sign count didn't increase, which is a sign of a cloned authenticator.
+// The authenticators that don't count the signatures always send zero
+func (m WebAuthnCredentialModel) UseSignCount(credential *WebAuthnCredential, signCount uint32) (bool, error) {
+	query := `
+        UPDATE webauthn_credentials
+        SET sign_count = $1, last_used_at_dt = $3
+        WHERE id = $2 AND (sign_count < $1 OR ($1 = 0 AND sign_count = 0))`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, int64(signCount), credential.ID, time.Now())
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	if rows == 0 {
+		return false, nil
+	}
+
+	now := time.Now()
+	credential.SignCount = signCount
+	credential.LastUsedAt = &now
+	return true, nil
+}
+
+func (m WebAuthnCredentialModel) Delete(id []byte, userID uuid.UUID) error {
+	query := `
+        DELETE FROM webauthn_credentials
+        WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// scanWebAuthnCredential scans a row of a *sql.Row or of *sql.Rows
+func scanWebAuthnCredential(row interface{ Scan(...interface{}) error }) (*WebAuthnCredential, error) {
+	var credential WebAuthnCredential
+	var signCount int64
+	var transports string
+	var lastUsedAt sql.NullTime
+
+	err := row.Scan(
+		&credential.ID,
+		&credential.UserID,
+		&credential.CreatedAt,
+		&credential.Name,
+		&credential.PublicKey,
+		&signCount,
+		&credential.AAGUID,
+		&transports,
+		&lastUsedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	credential.SignCount = uint32(signCount)
+	credential.Transports = strings.Fields(transports)
+	if lastUsedAt.Valid {
+		credential.LastUsedAt = &lastUsedAt.Time
+	}
+
+	return &credential, nil
+}
@@ -0,0 +1,435 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/validator"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// The statuses of a webhook delivery, a dead delivery
+// failed every attempt and is only sent again by a replay
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryDead      = "dead"
+)
+
+// WebhookAllEvents subscribes a webhook to every event type
+const WebhookAllEvents = "*"
+
+// EventTypes are the types of the events a webhook can subscribe to
+var EventTypes = []string{
+	EventUserCreated,
+	EventUserUpdated,
+	EventUserActivated,
+	EventUserEmailChanged,
+	EventUserDeleted,
+	EventUserRestored,
+	EventUserPurged,
+}
+
+type WebhookModelInterface interface {
+	Insert(subscription *WebhookSubscription) error
+	Get(id uuid.UUID) (*WebhookSubscription, error)
+	GetAll() ([]*WebhookSubscription, error)
+	Update(subscription *WebhookSubscription) error
+	Delete(id uuid.UUID) error
+}
+
+type WebhookDeliveryModelInterface interface {
+	GetAllForSubscription(subscriptionID uuid.UUID, status string, filters Filters) ([]*WebhookDelivery, Metadata, error)
+	Replay(subscriptionID uuid.UUID, id int64) error
+	Claim(limit int, lease time.Duration) ([]*WebhookDelivery, error)
+	Record(delivery *WebhookDelivery) error
+}
+
+// WebhookSubscription sends the events of the types to the URL,
+// the secret signing the deliveries is stored encrypted
+type WebhookSubscription struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at_dt"`
+	URL       string    `json:"url_t"`
+	Events    []string  `json:"events"`
+	Secret    []byte    `json:"-"`
+	Active    bool      `json:"active_b"`
+	Version   int       `json:"-"`
+}
+
+func ValidateWebhookSubscription(v *validator.Validator, subscription *WebhookSubscription) {
+	u, err := url.Parse(subscription.URL)
+	v.Check(subscription.URL != "", "url_t", "must be provided")
+	v.Check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "url_t", "must be an HTTP or HTTPS URL")
+	v.Check(len(subscription.URL) <= 2048, "url_t", "must not be more than 2048 bytes long")
+
+	v.Check(len(subscription.Events) > 0, "events", "must contain at least one event type")
+	v.Check(validator.Unique(subscription.Events), "events", "must not contain duplicate values")
+	for _, event := range subscription.Events {
+		v.Check(event == WebhookAllEvents || validator.In(event, EventTypes...), "events", "must only contain known event types or *")
+	}
+}
+
+// WebhookDelivery is an event sent to a subscription, with the result of the last attempt
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	SubscriptionID uuid.UUID       `json:"subscription_id"`
+	EventID        uuid.UUID       `json:"event_id"`
+	Type           string          `json:"type"`
+	Payload        json.RawMessage `json:"payload"`
+	CreatedAt      time.Time       `json:"created_at_dt"`
+	Status         string          `json:"status_t"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at_dt"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at_dt,omitempty"`
+	LastStatus     *int            `json:"last_status,omitempty"`
+	LastError      string          `json:"last_error_t,omitempty"`
+
+	// URL and Secret are the subscription of a claimed delivery
+	URL    string `json:"-"`
+	Secret []byte `json:"-"`
+}
+
+type WebhookModel struct {
+	DB *sql.DB
+}
+
+func (m WebhookModel) Insert(subscription *WebhookSubscription) error {
+	query := `
+        INSERT INTO webhook_subscriptions (url_t, events, secret, active_b)
+        VALUES ($1, $2, $3, $4)
+        RETURNING id, created_at_dt, version`
+
+	args := []interface{}{subscription.URL, pq.Array(subscription.Events), subscription.Secret, subscription.Active}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&subscription.ID, &subscription.CreatedAt, &subscription.Version)
+}
+
+func (m WebhookModel) Get(id uuid.UUID) (*WebhookSubscription, error) {
+	query := `
+        SELECT id, created_at_dt, url_t, events, secret, active_b, version
+        FROM webhook_subscriptions
+        WHERE id = $1`
+
+	var subscription WebhookSubscription
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&subscription.ID,
+		&subscription.CreatedAt,
+		&subscription.URL,
+		pq.Array(&subscription.Events),
+		&subscription.Secret,
+		&subscription.Active,
+		&subscription.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &subscription, nil
+}
+
+func (m WebhookModel) GetAll() ([]*WebhookSubscription, error) {
+	query := `
+        SELECT id, created_at_dt, url_t, events, secret, active_b, version
+        FROM webhook_subscriptions
+        ORDER BY created_at_dt, id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscriptions := []*WebhookSubscription{}
+
+	for rows.Next() {
+		var subscription WebhookSubscription
+
+		err := rows.Scan(
+			&subscription.ID,
+			&subscription.CreatedAt,
+			&subscription.URL,
+			pq.Array(&subscription.Events),
+			&subscription.Secret,
+			&subscription.Active,
+			&subscription.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		subscriptions = append(subscriptions, &subscription)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return subscriptions, nil
+}
+
+func (m WebhookModel) Update(subscription *WebhookSubscription) error {
+	query := `
+        UPDATE webhook_subscriptions
+        SET url_t = $1, events = $2, secret = $3, active_b = $4, version = version + 1
+        WHERE id = $5 AND version = $6
+        RETURNING version`
+
+	args := []interface{}{
+		subscription.URL,
+		pq.Array(subscription.Events),
+		subscription.Secret,
+		subscription.Active,
+		subscription.ID,
+		subscription.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&subscription.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete removes the subscription with its deliveries
+func (m WebhookModel) Delete(id uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM webhook_subscriptions WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// webhookDeliveriesQuery queues the event $1 of the type $2 with the payload $3
+// to every active subscription of its type, in the transaction of the event
+const webhookDeliveriesQuery = `
+        INSERT INTO webhook_deliveries (subscription_id, event_id, type_t, payload)
+        SELECT id, $1, $2, $3
+        FROM webhook_subscriptions
+        WHERE active_b AND ($2 = ANY(events) OR '*' = ANY(events))`
+
+type WebhookDeliveryModel struct {
+	DB *sql.DB
+}
+
+const webhookDeliveryColumns = `webhook_deliveries.id, subscription_id, event_id, type_t, payload, webhook_deliveries.created_at_dt,
+        status_t, attempts, next_attempt_at_dt, last_attempt_at_dt, last_status, COALESCE(last_error_t, '')`
+
+// scanWebhookDelivery scans the columns of the delivery, then the columns of dest
+func scanWebhookDelivery(scanner interface{ Scan(...interface{}) error }, delivery *WebhookDelivery, dest ...interface{}) error {
+	var lastStatus sql.NullInt64
+
+	columns := []interface{}{
+		&delivery.ID,
+		&delivery.SubscriptionID,
+		&delivery.EventID,
+		&delivery.Type,
+		&delivery.Payload,
+		&delivery.CreatedAt,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.NextAttemptAt,
+		&delivery.LastAttemptAt,
+		&lastStatus,
+		&delivery.LastError,
+	}
+
+	err := scanner.Scan(append(columns, dest...)...)
+	if err != nil {
+		return err
+	}
+
+	if lastStatus.Valid {
+		status := int(lastStatus.Int64)
+		delivery.LastStatus = &status
+	}
+
+	return nil
+}
+
+// GetAllForSubscription returns a page of the deliveries of the subscription,
+// the latest first, an empty status doesn't filter
+func (m WebhookDeliveryModel) GetAllForSubscription(subscriptionID uuid.UUID, status string, filters Filters) ([]*WebhookDelivery, Metadata, error) {
+	query := `
+        SELECT ` + webhookDeliveryColumns + `, count(*) OVER()
+        FROM webhook_deliveries
+        WHERE subscription_id = $1
+        AND (status_t = $2 OR $2 = '')
+        ORDER BY id DESC
+        LIMIT $3 OFFSET $4`
+
+	args := []interface{}{subscriptionID, status, filters.limit(), filters.offset()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	deliveries := []*WebhookDelivery{}
+
+	for rows.Next() {
+		var delivery WebhookDelivery
+
+		err := scanWebhookDelivery(rows, &delivery, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		deliveries = append(deliveries, &delivery)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return deliveries, metadata, nil
+}
+
+// Replay sends the delivery again from the first attempt
+func (m WebhookDeliveryModel) Replay(subscriptionID uuid.UUID, id int64) error {
+	query := `
+        UPDATE webhook_deliveries
+        SET status_t = $1, attempts = 0, next_attempt_at_dt = $4
+        WHERE id = $2 AND subscription_id = $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, WebhookDeliveryPending, id, subscriptionID, time.Now())
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Claim returns the pending deliveries that are due, with the URL and the secret
+// of their subscription. The deliveries are postponed by the lease, so another
+// worker doesn't claim them, and they are sent again if the worker stops
+func (m WebhookDeliveryModel) Claim(limit int, lease time.Duration) ([]*WebhookDelivery, error) {
+	query := `
+        UPDATE webhook_deliveries
+        SET next_attempt_at_dt = NOW() + $2 * interval '1 millisecond'
+        FROM webhook_subscriptions
+        WHERE webhook_subscriptions.id = webhook_deliveries.subscription_id
+        AND webhook_deliveries.id IN (
+            SELECT id FROM webhook_deliveries
+            WHERE status_t = 'pending' AND next_attempt_at_dt <= NOW()
+            ORDER BY next_attempt_at_dt, id
+            LIMIT $1
+            FOR UPDATE SKIP LOCKED
+        )
+        RETURNING ` + webhookDeliveryColumns + `, webhook_subscriptions.url_t, webhook_subscriptions.secret`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, limit, lease.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*WebhookDelivery{}
+
+	for rows.Next() {
+		var delivery WebhookDelivery
+
+		err := scanWebhookDelivery(rows, &delivery, &delivery.URL, &delivery.Secret)
+		if err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, &delivery)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// Record writes the result of an attempt of the delivery
+func (m WebhookDeliveryModel) Record(delivery *WebhookDelivery) error {
+	query := `
+        UPDATE webhook_deliveries
+        SET status_t = $1, attempts = $2, next_attempt_at_dt = $3, last_attempt_at_dt = $4, last_status = $5, last_error_t = NULLIF($6, '')
+        WHERE id = $7`
+
+	args := []interface{}{
+		delivery.Status,
+		delivery.Attempts,
+		delivery.NextAttemptAt,
+		delivery.LastAttemptAt,
+		delivery.LastStatus,
+		delivery.LastError,
+		delivery.ID,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, args...)
+
+	return err
+}
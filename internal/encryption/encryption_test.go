@@ -0,0 +1,41 @@
+package encryption
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCipher(t *testing.T) {
+	c, err := New(bytes.Repeat([]byte("k"), 32))
+	assert.Nil(t, err)
+
+	ciphertext, err := c.Encrypt([]byte("JBSWY3DPEHPK3PXP"))
+	assert.Nil(t, err)
+	assert.NotContains(t, string(ciphertext), "JBSWY3DPEHPK3PXP")
+
+	plaintext, err := c.Decrypt(ciphertext)
+	assert.Nil(t, err)
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", string(plaintext))
+
+	// A ciphertext encrypted with another key is rejected
+	other, err := New(bytes.Repeat([]byte("o"), 32))
+	assert.Nil(t, err)
+
+	_, err = other.Decrypt(ciphertext)
+	assert.ErrorIs(t, err, ErrInvalidCiphertext)
+
+	_, err = New([]byte("short"))
+	assert.ErrorIs(t, err, ErrInvalidKey)
+
+	// A key derived for a purpose doesn't decrypt the secrets of the key
+	webhooks, err := NewForPurpose(bytes.Repeat([]byte("k"), 32), "webhooks")
+	assert.Nil(t, err)
+
+	_, err = webhooks.Decrypt(ciphertext)
+	assert.ErrorIs(t, err, ErrInvalidCiphertext)
+
+	_, err = NewForPurpose([]byte("short"), "webhooks")
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
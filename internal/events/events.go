@@ -0,0 +1,93 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
+)
+
+// Broker publishes the events of the users to the other services,
+// an event can be published more than once, so the consumers must
+// skip the events with an ID they already received
+type Broker interface {
+	Publish(event *data.Event) error
+}
+
+// Memory keeps the published events, to test the publishing of the events
+type Memory struct {
+	mu     sync.Mutex
+	events []*data.Event
+}
+
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+func (b *Memory) Publish(event *data.Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.events = append(b.events, event)
+
+	return nil
+}
+
+// Events returns the published events in order
+func (b *Memory) Events() []*data.Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]*data.Event(nil), b.events...)
+}
+
+// Webhook posts every event as JSON to a URL, the ID of the event
+// is sent in the "Idempotency-Key" header
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+func NewWebhook(url string, timeout time.Duration) *Webhook {
+	return &Webhook{
+		URL:    url,
+		Client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Publish succeeds when the webhook answers with a 2xx status
+func (b *Webhook) Publish(event *data.Event) error {
+	js, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, b.URL, bytes.NewReader(js))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", event.ID.String())
+	req.Header.Set("X-Event-Type", event.Type)
+
+	res, err := b.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// Read the body so the connection is reused
+	io.Copy(io.Discard, io.LimitReader(res.Body, 4096))
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered with status %d to the event %s", res.StatusCode, event.ID)
+	}
+
+	return nil
+}
@@ -0,0 +1,306 @@
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
+	"github.com/e-inwork-com/go-user-service/internal/jsonlog"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func testEvent(eventType string) *data.Event {
+	return &data.Event{
+		ID:        uuid.New(),
+		Type:      eventType,
+		UserID:    uuid.New(),
+		CreatedAt: time.Now(),
+		Data:      json.RawMessage(`{"email_t":"jon@doe.com"}`),
+	}
+}
+
+// testOutbox keeps the events in memory like the outbox table
+type testOutbox struct {
+	mu        sync.Mutex
+	events    []*data.Event
+	published int
+}
+
+func (o *testOutbox) Relay(limit int, publish func(event *data.Event) error) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	n := 0
+	for o.published < len(o.events) && n < limit {
+		err := publish(o.events[o.published])
+		if err != nil {
+			o.events[o.published].Attempts++
+			return n, err
+		}
+		o.published++
+		n++
+	}
+
+	return n, nil
+}
+
+func (o *testOutbox) DeletePublished(before time.Time) error {
+	return nil
+}
+
+// DeleteBefore removes every event, the test events are all older than the retention
+func (o *testOutbox) DeleteBefore(before time.Time) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.events = nil
+	o.published = 0
+
+	return nil
+}
+
+// failingBroker fails the first events
+type failingBroker struct {
+	*Memory
+	failures int
+}
+
+func (b *failingBroker) Publish(event *data.Event) error {
+	if b.failures > 0 {
+		b.failures--
+		return errors.New("broker unavailable")
+	}
+	return b.Memory.Publish(event)
+}
+
+func TestRelay(t *testing.T) {
+	outbox := &testOutbox{}
+	for i := 0; i < 5; i++ {
+		outbox.events = append(outbox.events, testEvent(data.EventUserCreated))
+	}
+
+	broker := &failingBroker{Memory: NewMemory(), failures: 2}
+
+	relay := &Relay{
+		Outbox:     outbox,
+		Broker:     broker,
+		Logger:     jsonlog.New(io.Discard, jsonlog.LevelOff),
+		BatchSize:  2,
+		Interval:   time.Millisecond,
+		MaxBackoff: 4 * time.Millisecond,
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		relay.Run(stop)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool {
+		return len(broker.Events()) == 5
+	}, 2*time.Second, time.Millisecond)
+
+	close(stop)
+	<-done
+
+	// The events are published in order after the failures
+	for i, event := range broker.Events() {
+		assert.Equal(t, outbox.events[i].ID, event.ID)
+	}
+	assert.Equal(t, 2, outbox.events[0].Attempts)
+}
+
+func TestPruner(t *testing.T) {
+	outbox := &testOutbox{}
+	for i := 0; i < 3; i++ {
+		outbox.events = append(outbox.events, testEvent(data.EventUserCreated))
+	}
+
+	pruner := &Pruner{
+		Outbox:    outbox,
+		Logger:    jsonlog.New(io.Discard, jsonlog.LevelOff),
+		Retention: time.Hour,
+		Interval:  time.Millisecond,
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		pruner.Run(stop)
+		close(done)
+	}()
+
+	// The unpublished events are deleted without a broker
+	assert.Eventually(t, func() bool {
+		outbox.mu.Lock()
+		defer outbox.mu.Unlock()
+
+		return len(outbox.events) == 0
+	}, 2*time.Second, time.Millisecond)
+
+	close(stop)
+	<-done
+}
+
+func TestWebhook(t *testing.T) {
+	event := testEvent(data.EventUserActivated)
+	status := http.StatusAccepted
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, event.ID.String(), r.Header.Get("Idempotency-Key"))
+		assert.Equal(t, "user.activated", r.Header.Get("X-Event-Type"))
+
+		var received data.Event
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&received))
+		assert.Equal(t, event.ID, received.ID)
+		assert.JSONEq(t, string(event.Data), string(received.Data))
+
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+
+	broker := NewWebhook(ts.URL, time.Second)
+	assert.Nil(t, broker.Publish(event))
+
+	status = http.StatusInternalServerError
+	assert.NotNil(t, broker.Publish(event))
+}
+
+// testJetStream stands in for a NATS server with a JetStream stream of the subjects
+// of the prefix, the stream skips the messages with an ID it already has
+type testJetStream struct {
+	listener net.Listener
+	prefix   string
+
+	mu       sync.Mutex
+	messages []string
+	ids      map[string]bool
+}
+
+func newTestJetStream(t *testing.T, prefix string) *testJetStream {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	s := &testJetStream{listener: listener, prefix: prefix, ids: make(map[string]bool)}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+
+	return s
+}
+
+func (s *testJetStream) serve(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	fmt.Fprintf(conn, "INFO {\"server_id\":\"test\",\"headers\":true,\"jetstream\":true}\r\n")
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "PING":
+			fmt.Fprintf(conn, "PONG\r\n")
+		case "HPUB":
+			subject, reply := fields[1], fields[2]
+			headerSize, _ := strconv.Atoi(fields[3])
+			total, _ := strconv.Atoi(fields[4])
+
+			buf := make([]byte, total+2)
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return
+			}
+
+			if !strings.HasPrefix(subject, s.prefix+".") {
+				fmt.Fprintf(conn, "HMSG %s 1 16 16\r\nNATS/1.0 503\r\n\r\n\r\n", reply)
+				continue
+			}
+
+			id := ""
+			for _, header := range strings.Split(string(buf[:headerSize]), "\r\n") {
+				if strings.HasPrefix(header, "Nats-Msg-Id: ") {
+					id = strings.TrimPrefix(header, "Nats-Msg-Id: ")
+				}
+			}
+
+			s.mu.Lock()
+			duplicate := s.ids[id]
+			if !duplicate {
+				s.ids[id] = true
+				s.messages = append(s.messages, subject)
+			}
+			seq := len(s.messages)
+			s.mu.Unlock()
+
+			ack := fmt.Sprintf(`{"stream":"USERS","seq":%d,"duplicate":%t}`, seq, duplicate)
+			fmt.Fprintf(conn, "MSG %s 1 %d\r\n%s\r\n", reply, len(ack), ack)
+		}
+	}
+}
+
+func (s *testJetStream) Messages() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.messages...)
+}
+
+func TestNATS(t *testing.T) {
+	s := newTestJetStream(t, "e-inwork")
+
+	broker, err := NewNATS("nats://user:secret@"+s.listener.Addr().String(), "e-inwork", time.Second)
+	assert.Nil(t, err)
+	defer broker.Close()
+
+	created := testEvent(data.EventUserCreated)
+	deleted := testEvent(data.EventUserDeleted)
+
+	assert.Nil(t, broker.Publish(created))
+	assert.Nil(t, broker.Publish(deleted))
+
+	// The stream skips the event published again
+	assert.Nil(t, broker.Publish(created))
+	assert.Equal(t, []string{"e-inwork.user.created", "e-inwork.user.deleted"}, s.Messages())
+
+	// The subjects of another prefix don't have a stream
+	other, err := NewNATS("nats://"+s.listener.Addr().String(), "other", time.Second)
+	assert.Nil(t, err)
+	defer other.Close()
+
+	assert.ErrorIs(t, other.Publish(created), ErrNoStream)
+
+	_, err = NewNATS("http://localhost:4222", "e-inwork", time.Second)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,121 @@
+package events
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
+	"github.com/e-inwork-com/go-user-service/internal/jsonlog"
+)
+
+// Relay publishes the events of the outbox to the broker
+type Relay struct {
+	Outbox data.OutboxModelInterface
+	Broker Broker
+	Logger *jsonlog.Logger
+
+	// BatchSize events are published every Interval, the next batch
+	// is published at once while the outbox has more events
+	BatchSize int
+	Interval  time.Duration
+
+	// MaxBackoff is the longest delay after the failures of the broker,
+	// the delay doubles from Interval on every failure
+	MaxBackoff time.Duration
+
+	// Retention is the time the published events are kept in the outbox
+	Retention time.Duration
+}
+
+// Run publishes the events until the stop channel is closed
+func (r *Relay) Run(stop <-chan struct{}) {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	batchSize := r.BatchSize
+	if batchSize < 1 {
+		batchSize = 100
+	}
+
+	backoff := interval
+	lastCleanup := time.Now()
+
+	for {
+		published, err := r.Outbox.Relay(batchSize, r.Broker.Publish)
+
+		delay := interval
+
+		switch {
+		case err != nil:
+			// Wait longer after every failure
+			delay = backoff
+			backoff *= 2
+			if r.MaxBackoff > 0 && backoff > r.MaxBackoff {
+				backoff = r.MaxBackoff
+			}
+
+			r.Logger.PrintError(err, map[string]string{
+				"published": strconv.Itoa(published),
+				"retry_in":  delay.String(),
+			})
+		case published >= batchSize:
+			delay = 0
+			backoff = interval
+		default:
+			backoff = interval
+		}
+
+		if r.Retention > 0 && time.Since(lastCleanup) > time.Hour {
+			err = r.Outbox.DeletePublished(time.Now().Add(-r.Retention))
+			if err != nil {
+				r.Logger.PrintError(err, nil)
+			}
+			lastCleanup = time.Now()
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// Pruner deletes the events of the outbox older than the retention when no broker
+// is configured, the events are never published then, so they would be kept forever
+type Pruner struct {
+	Outbox data.OutboxModelInterface
+	Logger *jsonlog.Logger
+
+	// Retention is the time the events are kept in the outbox, they are deleted every Interval
+	Retention time.Duration
+	Interval  time.Duration
+}
+
+// Run deletes the old events until the stop channel is closed, the events are
+// kept forever without a retention
+func (p *Pruner) Run(stop <-chan struct{}) {
+	if p.Retention <= 0 {
+		return
+	}
+
+	interval := p.Interval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	for {
+		err := p.Outbox.DeleteBefore(time.Now().Add(-p.Retention))
+		if err != nil {
+			p.Logger.PrintError(err, nil)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,161 @@
+// Package export builds the archive of the personal data of a user, the format
+// of the archive is versioned and described by the JSON schema of its version
+package export
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
+	"github.com/e-inwork-com/go-user-service/internal/webauthn"
+	"github.com/google/uuid"
+)
+
+// Version is the version of the format of the archives, it changes
+// when a field is removed or changes its meaning
+const Version = 1
+
+// Schema is the JSON schema of the current version of the archives
+//
+//go:embed schema/v1.json
+var Schema []byte
+
+// Archive is everything the service holds about a user, the secrets
+// like the password hash, the token hashes and the TOTP secret are left out
+type Archive struct {
+	Version     int       `json:"version"`
+	GeneratedAt time.Time `json:"generated_at_dt"`
+	User        User      `json:"user"`
+	Permissions []string  `json:"permissions"`
+	Sessions    []Session `json:"sessions"`
+	TOTP        *TOTP     `json:"totp"`
+	Passkeys    []Passkey `json:"passkeys"`
+}
+
+type User struct {
+	ID           uuid.UUID `json:"id"`
+	CreatedAt    time.Time `json:"created_at_dt"`
+	Email        string    `json:"email_t"`
+	PendingEmail string    `json:"pending_email_t,omitempty"`
+	FirstName    string    `json:"first_name_t"`
+	LastName     string    `json:"last_name_t"`
+	Activated    bool      `json:"activated_b"`
+}
+
+// Session is a login with the refresh tokens issued by rotating its first token
+type Session struct {
+	ID              uuid.UUID `json:"id"`
+	CreatedAt       time.Time `json:"created_at_dt"`
+	LastRefreshedAt time.Time `json:"last_refreshed_at_dt"`
+	ExpiresAt       time.Time `json:"expires_at_dt"`
+	Revoked         bool      `json:"revoked_b"`
+}
+
+type TOTP struct {
+	CreatedAt time.Time `json:"created_at_dt"`
+	Enabled   bool      `json:"enabled_b"`
+}
+
+type Passkey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name_t"`
+	CreatedAt  time.Time  `json:"created_at_dt"`
+	LastUsedAt *time.Time `json:"last_used_at_dt,omitempty"`
+	Transports []string   `json:"transports"`
+}
+
+// Build reads the personal data of the user from the models
+func Build(ctx context.Context, models data.Models, userID uuid.UUID) (*Archive, error) {
+	user, err := models.Users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	archive := &Archive{
+		Version:     Version,
+		GeneratedAt: time.Now().UTC(),
+		User: User{
+			ID:           user.ID,
+			CreatedAt:    user.CreatedAt,
+			Email:        user.Email,
+			PendingEmail: user.PendingEmail,
+			FirstName:    user.FirstName,
+			LastName:     user.LastName,
+			Activated:    user.Activated,
+		},
+		Permissions: []string{},
+		Sessions:    []Session{},
+		Passkeys:    []Passkey{},
+	}
+
+	permissions, err := models.Permissions.GetAllForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	archive.Permissions = append(archive.Permissions, permissions...)
+
+	tokens, err := models.RefreshTokens.GetAllForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	archive.Sessions = sessions(tokens)
+
+	totp, err := models.TOTP.GetByUserID(userID)
+	switch {
+	case err == nil:
+		archive.TOTP = &TOTP{CreatedAt: totp.CreatedAt, Enabled: totp.Enabled}
+	case !errors.Is(err, data.ErrRecordNotFound):
+		return nil, err
+	}
+
+	credentials, err := models.WebAuthn.GetAllForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, credential := range credentials {
+		archive.Passkeys = append(archive.Passkeys, Passkey{
+			ID:         webauthn.EncodeID(credential.ID),
+			Name:       credential.Name,
+			CreatedAt:  credential.CreatedAt,
+			LastUsedAt: credential.LastUsedAt,
+			Transports: append([]string{}, credential.Transports...),
+		})
+	}
+
+	return archive, nil
+}
+
+// Marshal returns the JSON document of the archive
+func (a *Archive) Marshal() ([]byte, error) {
+	return json.MarshalIndent(a, "", "\t")
+}
+
+// sessions groups the refresh tokens by their family, in the order the sessions were created
+func sessions(tokens []*data.RefreshToken) []Session {
+	list := []Session{}
+	index := make(map[uuid.UUID]int)
+
+	for _, token := range tokens {
+		i, ok := index[token.FamilyID]
+		if !ok {
+			index[token.FamilyID] = len(list)
+			list = append(list, Session{ID: token.FamilyID, CreatedAt: token.CreatedAt})
+			i = len(list) - 1
+		}
+
+		// The tokens issued in the same second are in any order
+		if token.CreatedAt.After(list[i].LastRefreshedAt) {
+			list[i].LastRefreshedAt = token.CreatedAt
+		}
+		if token.Expiry.After(list[i].ExpiresAt) {
+			list[i].ExpiresAt = token.Expiry
+		}
+		list[i].Revoked = list[i].Revoked || token.Revoked
+	}
+
+	return list
+}
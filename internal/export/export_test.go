@@ -0,0 +1,133 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
+	"github.com/e-inwork-com/go-user-service/internal/data/memory"
+	"github.com/e-inwork-com/go-user-service/internal/data/mocks"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// validate checks the document against the keywords of the schema used by
+// the archives: type, const, required, additionalProperties, properties and items
+func validate(t *testing.T, schema map[string]interface{}, document interface{}, path string) {
+	t.Helper()
+
+	if document == nil {
+		types, _ := schema["type"].([]interface{})
+		assert.Contains(t, types, "null", "%s is null", path)
+		return
+	}
+
+	if value, ok := schema["const"]; ok {
+		assert.Equal(t, value, document, path)
+	}
+
+	switch document := document.(type) {
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+
+		required, _ := schema["required"].([]interface{})
+		for _, key := range required {
+			assert.Contains(t, document, key, "%s has %s", path, key)
+		}
+
+		for key, value := range document {
+			property, ok := properties[key].(map[string]interface{})
+			if !ok {
+				assert.NotEqual(t, false, schema["additionalProperties"], "%s has the unknown %s", path, key)
+				continue
+			}
+			validate(t, property, value, path+"."+key)
+		}
+	case []interface{}:
+		items, _ := schema["items"].(map[string]interface{})
+		for i, value := range document {
+			validate(t, items, value, fmt.Sprintf("%s[%d]", path, i))
+		}
+	}
+}
+
+func TestBuild(t *testing.T) {
+	ctx := context.Background()
+	models := memory.New().Models()
+
+	user := &data.User{Email: "jon@doe.com", FirstName: "Jon", LastName: "Doe", Activated: true}
+	mocks.MockSetPassword(user)
+	assert.Nil(t, models.Users.Insert(ctx, user))
+	assert.Nil(t, models.Permissions.AddRolesForUser(user.ID, "support"))
+
+	// A session rotated once, and a revoked session
+	first := uuid.New()
+	_, err := models.RefreshTokens.New(user.ID, first, time.Hour)
+	assert.Nil(t, err)
+	_, err = models.RefreshTokens.New(user.ID, first, 2*time.Hour)
+	assert.Nil(t, err)
+
+	second := uuid.New()
+	_, err = models.RefreshTokens.New(user.ID, second, time.Hour)
+	assert.Nil(t, err)
+	assert.Nil(t, models.RefreshTokens.RevokeFamily(second))
+
+	assert.Nil(t, models.TOTP.Upsert(&data.TOTP{UserID: user.ID, SecretCiphertext: []byte("secret")}))
+
+	credential := &data.WebAuthnCredential{ID: []byte("credential"), UserID: user.ID, Name: "Laptop", PublicKey: []byte("key")}
+	assert.Nil(t, models.WebAuthn.Insert(credential))
+
+	archive, err := Build(ctx, models, user.ID)
+	assert.Nil(t, err)
+
+	assert.Equal(t, Version, archive.Version)
+	assert.Equal(t, user.Email, archive.User.Email)
+	assert.Equal(t, []string{data.PermissionUsersRead}, archive.Permissions)
+	assert.Len(t, archive.Sessions, 2)
+	assert.False(t, archive.Sessions[0].ExpiresAt.Before(archive.Sessions[0].CreatedAt.Add(time.Hour)))
+	assert.True(t, archive.Sessions[0].Revoked != archive.Sessions[1].Revoked)
+	assert.NotNil(t, archive.TOTP)
+	assert.False(t, archive.TOTP.Enabled)
+	assert.Len(t, archive.Passkeys, 1)
+
+	document, err := archive.Marshal()
+	assert.Nil(t, err)
+
+	// No secret is exported
+	assert.NotContains(t, string(document), "secret")
+	assert.NotContains(t, string(document), "password")
+
+	var schema map[string]interface{}
+	assert.Nil(t, json.Unmarshal(Schema, &schema))
+
+	var decoded interface{}
+	assert.Nil(t, json.Unmarshal(document, &decoded))
+
+	validate(t, schema, decoded, "archive")
+
+	t.Run("Without Data", func(t *testing.T) {
+		other := &data.User{Email: "nina@doe.com", FirstName: "Nina", LastName: "Doe"}
+		mocks.MockSetPassword(other)
+		assert.Nil(t, models.Users.Insert(ctx, other))
+
+		archive, err := Build(ctx, models, other.ID)
+		assert.Nil(t, err)
+		assert.Nil(t, archive.TOTP)
+
+		document, err := archive.Marshal()
+		assert.Nil(t, err)
+
+		var decoded interface{}
+		assert.Nil(t, json.Unmarshal(document, &decoded))
+
+		validate(t, schema, decoded, "archive")
+	})
+
+	t.Run("Unknown User", func(t *testing.T) {
+		_, err := Build(ctx, models, uuid.New())
+		assert.ErrorIs(t, err, data.ErrRecordNotFound)
+	})
+}
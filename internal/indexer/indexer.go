@@ -0,0 +1,355 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
+	"github.com/e-inwork-com/go-user-service/internal/jsonlog"
+	"github.com/google/uuid"
+)
+
+// solrTime is the date format of the "_dt" fields of Solr
+const solrTime = "2006-01-02T15:04:05.000Z"
+
+var ErrQueueFull = errors.New("index queue is full")
+
+// Document is a user in the search index, the fields follow
+// the dynamic fields of Solr like the JSON of the user
+type Document struct {
+	ID        string `json:"id"`
+	Email     string `json:"email_t"`
+	FirstName string `json:"first_name_t"`
+	LastName  string `json:"last_name_t"`
+	Activated bool   `json:"activated_b"`
+	CreatedAt string `json:"created_at_dt"`
+
+	// IndexedAt finds the documents that weren't updated by a reindex
+	IndexedAt string `json:"indexed_at_dt"`
+}
+
+func NewDocument(user *data.User, indexedAt time.Time) Document {
+	return Document{
+		ID:        user.ID.String(),
+		Email:     user.Email,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Activated: user.Activated,
+		CreatedAt: user.CreatedAt.UTC().Format(solrTime),
+		IndexedAt: indexedAt.UTC().Format(solrTime),
+	}
+}
+
+// Config sets the update endpoint of the index and how the changes are sent
+type Config struct {
+	// URL is the collection, like "http://localhost:8983/solr/users",
+	// the changes are posted to its "/update" handler
+	URL string
+
+	// The changes are sent when BatchSize changes are queued, or after FlushInterval
+	BatchSize     int
+	FlushInterval time.Duration
+
+	// QueueSize is the number of changes waiting to be sent,
+	// a change is dropped when the queue is full
+	QueueSize int
+
+	// CommitWithin is the time before the changes are searchable
+	CommitWithin time.Duration
+
+	// A failed batch is sent again Attempts times, after Backoff doubled on every retry
+	Attempts int
+	Backoff  time.Duration
+
+	Timeout time.Duration
+}
+
+// change is an update of a document, or a delete without a document
+type change struct {
+	id  string
+	doc *Document
+}
+
+// Indexer sends the changes of the users to a Solr-compatible update endpoint,
+// the changes are sent in batches from a goroutine, and sent again when they fail
+type Indexer struct {
+	config Config
+	client *http.Client
+	logger *jsonlog.Logger
+
+	queue     chan change
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func New(cfg Config, logger *jsonlog.Logger) *Indexer {
+	if cfg.BatchSize < 1 {
+		cfg.BatchSize = 1
+	}
+	if cfg.QueueSize < cfg.BatchSize {
+		cfg.QueueSize = cfg.BatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+	if cfg.Attempts < 1 {
+		cfg.Attempts = 1
+	}
+
+	ix := &Indexer{
+		config: cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+		logger: logger,
+		queue:  make(chan change, cfg.QueueSize),
+		done:   make(chan struct{}),
+	}
+
+	go ix.run()
+
+	return ix
+}
+
+// Add queues the user to be added, or updated in the index
+func (ix *Indexer) Add(user *data.User) {
+	doc := NewDocument(user, time.Now())
+	ix.enqueue(change{id: doc.ID, doc: &doc})
+}
+
+// Delete queues the user to be deleted from the index
+func (ix *Indexer) Delete(id uuid.UUID) {
+	ix.enqueue(change{id: id.String()})
+}
+
+// enqueue doesn't wait while the index is unavailable,
+// a dropped change is fixed by the next reindex
+func (ix *Indexer) enqueue(c change) {
+	select {
+	case ix.queue <- c:
+	default:
+		ix.logger.PrintError(ErrQueueFull, map[string]string{
+			"id": c.id,
+		})
+	}
+}
+
+// Close sends the queued changes and stops the indexer
+func (ix *Indexer) Close() {
+	ix.closeOnce.Do(func() {
+		close(ix.queue)
+	})
+
+	<-ix.done
+}
+
+func (ix *Indexer) run() {
+	defer close(ix.done)
+
+	ticker := time.NewTicker(ix.config.FlushInterval)
+	defer ticker.Stop()
+
+	// The last change of a user replaces the previous ones of the batch
+	var order []string
+	pending := make(map[string]change)
+
+	flush := func() {
+		if len(order) == 0 {
+			return
+		}
+
+		batch := make([]change, 0, len(order))
+		for _, id := range order {
+			batch = append(batch, pending[id])
+		}
+
+		err := ix.send(batch)
+		if err != nil {
+			ix.logger.PrintError(err, map[string]string{
+				"changes": strconv.Itoa(len(batch)),
+			})
+		}
+
+		order = order[:0]
+		pending = make(map[string]change)
+	}
+
+	for {
+		select {
+		case c, ok := <-ix.queue:
+			if !ok {
+				flush()
+				return
+			}
+
+			if _, found := pending[c.id]; !found {
+				order = append(order, c.id)
+			}
+			pending[c.id] = c
+
+			if len(order) >= ix.config.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// send posts the deleted users, then the updated users of the batch
+func (ix *Indexer) send(batch []change) error {
+	var deletes []string
+	var docs []Document
+
+	for _, c := range batch {
+		if c.doc == nil {
+			deletes = append(deletes, c.id)
+		} else {
+			docs = append(docs, *c.doc)
+		}
+	}
+
+	if len(deletes) > 0 {
+		err := ix.post(map[string]interface{}{"delete": deletes}, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(docs) > 0 {
+		err := ix.post(docs, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Reindex adds every user to the index, then deletes the documents
+// of the users that don't exist anymore, and returns the number of users
+func (ix *Indexer) Reindex(ctx context.Context, users data.UserModelInterface) (int, error) {
+	// The documents indexed before the start weren't added by the reindex
+	start := time.Now().UTC().Truncate(time.Millisecond)
+
+	filters := data.UserFilters{
+		Filters: data.Filters{
+			Page:         1,
+			PageSize:     ix.config.BatchSize,
+			Sort:         "id",
+			SortSafelist: data.UserSortSafelist,
+		},
+	}
+
+	total := 0
+
+	for {
+		page, metadata, err := users.GetAllAfter(ctx, filters)
+		if err != nil {
+			return total, err
+		}
+
+		if len(page) > 0 {
+			docs := make([]Document, 0, len(page))
+			for _, user := range page {
+				docs = append(docs, NewDocument(user, start))
+			}
+
+			err = ix.post(docs, false)
+			if err != nil {
+				return total, err
+			}
+
+			total += len(docs)
+		}
+
+		if metadata.NextCursor == "" {
+			break
+		}
+
+		filters.Cursor, err = data.DecodeCursor(metadata.NextCursor)
+		if err != nil {
+			return total, err
+		}
+	}
+
+	stale := map[string]interface{}{
+		"delete": map[string]string{
+			"query": fmt.Sprintf("indexed_at_dt:[* TO %s}", start.Format(solrTime)),
+		},
+	}
+
+	err := ix.post(stale, true)
+	if err != nil {
+		return total, err
+	}
+
+	return total, nil
+}
+
+// post sends the body to the update handler, and sends it again after
+// an exponential backoff when the index is unavailable
+func (ix *Indexer) post(body interface{}, commit bool) error {
+	js, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{}
+	if commit {
+		query.Set("commit", "true")
+	} else if ix.config.CommitWithin > 0 {
+		query.Set("commitWithin", strconv.FormatInt(ix.config.CommitWithin.Milliseconds(), 10))
+	}
+
+	endpoint := ix.config.URL + "/update"
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	delay := ix.config.Backoff
+
+	for attempt := 1; ; attempt++ {
+		retry, err := ix.postOnce(endpoint, js)
+		if err == nil || !retry || attempt >= ix.config.Attempts {
+			return err
+		}
+
+		ix.logger.PrintError(err, map[string]string{
+			"attempt":  strconv.Itoa(attempt),
+			"retry_in": delay.String(),
+		})
+
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// postOnce returns if the request can be sent again, a rejected
+// request fails the same way every time so it isn't sent again
+func (ix *Indexer) postOnce(endpoint string, js []byte) (bool, error) {
+	res, err := ix.client.Post(endpoint, "application/json", bytes.NewReader(js))
+	if err != nil {
+		return true, err
+	}
+	defer res.Body.Close()
+
+	// Read the body so the connection is reused
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		return false, nil
+	case res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500:
+		return true, fmt.Errorf("index update failed with status %d: %s", res.StatusCode, bytes.TrimSpace(body))
+	default:
+		return false, fmt.Errorf("index update rejected with status %d: %s", res.StatusCode, bytes.TrimSpace(body))
+	}
+}
@@ -0,0 +1,225 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
+	"github.com/e-inwork-com/go-user-service/internal/data/mocks"
+	"github.com/e-inwork-com/go-user-service/internal/jsonlog"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type request struct {
+	Query string
+	Body  string
+}
+
+// testSolr stands in for the update handler of a Solr collection,
+// it fails the first requests with the status of failures
+type testSolr struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []request
+	failures []int
+	received chan struct{}
+}
+
+func newTestSolr(t *testing.T, failures ...int) *testSolr {
+	s := &testSolr{failures: failures, received: make(chan struct{}, 100)}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/solr/users/update", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		body, _ := io.ReadAll(r.Body)
+
+		s.mu.Lock()
+		s.requests = append(s.requests, request{Query: r.URL.RawQuery, Body: string(body)})
+		status := http.StatusOK
+		if len(s.failures) > 0 {
+			status, s.failures = s.failures[0], s.failures[1:]
+		}
+		s.mu.Unlock()
+
+		w.WriteHeader(status)
+		s.received <- struct{}{}
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// wait returns the requests after n requests are received
+func (s *testSolr) wait(t *testing.T, n int) []request {
+	for i := 0; i < n; i++ {
+		select {
+		case <-s.received:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("received %d requests, expected %d", i, n)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]request(nil), s.requests...)
+}
+
+func testIndexer(s *testSolr, cfg Config) *Indexer {
+	cfg.URL = s.URL + "/solr/users"
+	if cfg.BatchSize == 0 {
+		cfg.BatchSize = 10
+	}
+	if cfg.FlushInterval == 0 {
+		cfg.FlushInterval = time.Hour
+	}
+
+	return New(cfg, jsonlog.New(io.Discard, jsonlog.LevelOff))
+}
+
+func testUser(t *testing.T, id func() uuid.UUID) *data.User {
+	user, err := mocks.UserModel{}.GetByID(context.Background(), id())
+	assert.Nil(t, err)
+	return user
+}
+
+func TestDocument(t *testing.T) {
+	user := testUser(t, mocks.MockFirstUUID)
+	user.CreatedAt = time.Date(2023, 1, 2, 3, 4, 5, 0, time.FixedZone("WIB", 7*3600))
+
+	js, err := json.Marshal(NewDocument(user, time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC)))
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{
+		"id": "`+user.ID.String()+`",
+		"email_t": "jon@doe.com",
+		"first_name_t": "Jon",
+		"last_name_t": "Doe",
+		"activated_b": true,
+		"created_at_dt": "2023-01-01T20:04:05.000Z",
+		"indexed_at_dt": "2023-02-01T00:00:00.000Z"
+	}`, string(js))
+}
+
+func TestBatch(t *testing.T) {
+	s := newTestSolr(t)
+	ix := testIndexer(s, Config{BatchSize: 2, CommitWithin: time.Second})
+	defer ix.Close()
+
+	ix.Add(testUser(t, mocks.MockFirstUUID))
+	ix.Add(testUser(t, mocks.MockSecondUUID))
+
+	requests := s.wait(t, 1)
+	assert.Len(t, requests, 1)
+	assert.Equal(t, "commitWithin=1000", requests[0].Query)
+
+	var docs []Document
+	assert.Nil(t, json.Unmarshal([]byte(requests[0].Body), &docs))
+	assert.Len(t, docs, 2)
+	assert.Equal(t, "jon@doe.com", docs[0].Email)
+	assert.Equal(t, "nina@doe.com", docs[1].Email)
+}
+
+func TestFlushInterval(t *testing.T) {
+	s := newTestSolr(t)
+	ix := testIndexer(s, Config{FlushInterval: 10 * time.Millisecond})
+	defer ix.Close()
+
+	ix.Add(testUser(t, mocks.MockFirstUUID))
+
+	requests := s.wait(t, 1)
+	assert.Contains(t, requests[0].Body, "jon@doe.com")
+}
+
+func TestLastChangeWins(t *testing.T) {
+	s := newTestSolr(t)
+	ix := testIndexer(s, Config{})
+
+	first := testUser(t, mocks.MockFirstUUID)
+	second := testUser(t, mocks.MockSecondUUID)
+
+	ix.Add(first)
+	ix.Delete(first.ID)
+	ix.Delete(second.ID)
+	ix.Add(second)
+
+	// Close sends the queued changes
+	ix.Close()
+
+	requests := s.wait(t, 2)
+	assert.Len(t, requests, 2)
+	assert.JSONEq(t, `{"delete": ["`+first.ID.String()+`"]}`, requests[0].Body)
+
+	var docs []Document
+	assert.Nil(t, json.Unmarshal([]byte(requests[1].Body), &docs))
+	assert.Len(t, docs, 1)
+	assert.Equal(t, second.ID.String(), docs[0].ID)
+}
+
+func TestRetry(t *testing.T) {
+	s := newTestSolr(t, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	ix := testIndexer(s, Config{Attempts: 3, Backoff: time.Millisecond})
+
+	ix.Add(testUser(t, mocks.MockFirstUUID))
+	ix.Close()
+
+	requests := s.wait(t, 3)
+	assert.Len(t, requests, 3)
+	assert.Equal(t, requests[0].Body, requests[2].Body)
+}
+
+func TestRejected(t *testing.T) {
+	s := newTestSolr(t, http.StatusBadRequest)
+	ix := testIndexer(s, Config{Attempts: 3, Backoff: time.Millisecond})
+
+	err := ix.post([]Document{}, false)
+	assert.NotNil(t, err)
+	assert.Len(t, s.wait(t, 1), 1)
+
+	ix.Close()
+}
+
+func TestReindex(t *testing.T) {
+	s := newTestSolr(t)
+	ix := testIndexer(s, Config{BatchSize: 1})
+	defer ix.Close()
+
+	total, err := ix.Reindex(context.Background(), mocks.UserModel{})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, total)
+
+	// A page of users per request, then the delete of the stale documents
+	requests := s.wait(t, 3)
+	assert.Contains(t, requests[0].Body, "jon@doe.com")
+	assert.Contains(t, requests[1].Body, "nina@doe.com")
+	assert.Contains(t, requests[2].Body, `"query":"indexed_at_dt:[* TO `)
+	assert.Equal(t, "commit=true", requests[2].Query)
+}
+
+func TestUserModel(t *testing.T) {
+	s := newTestSolr(t)
+	ix := testIndexer(s, Config{})
+
+	users := ix.Users(mocks.UserModel{})
+
+	user := testUser(t, mocks.MockFirstUUID)
+	assert.Nil(t, users.Update(context.Background(), user))
+	assert.Nil(t, users.Delete(context.Background(), mocks.MockSecondUUID()))
+
+	// A user that wasn't deleted isn't deleted from the index
+	assert.ErrorIs(t, users.Delete(context.Background(), uuid.Nil), data.ErrRecordNotFound)
+
+	ix.Close()
+
+	requests := s.wait(t, 2)
+	assert.JSONEq(t, `{"delete": ["`+mocks.MockSecondUUID().String()+`"]}`, requests[0].Body)
+	assert.Contains(t, requests[1].Body, "jon@doe.com")
+}
@@ -0,0 +1,65 @@
+package indexer
+
+import (
+	"context"
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
+	"github.com/google/uuid"
+)
+
+// UserModel queues the users written by another model to the indexer,
+// the changes are queued after they are written to the database
+type UserModel struct {
+	data.UserModelInterface
+	Indexer *Indexer
+}
+
+// Users returns the model queuing the changes of the users to the indexer
+func (ix *Indexer) Users(users data.UserModelInterface) data.UserModelInterface {
+	return UserModel{UserModelInterface: users, Indexer: ix}
+}
+
+func (m UserModel) Insert(ctx context.Context, user *data.User) error {
+	err := m.UserModelInterface.Insert(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	m.Indexer.Add(user)
+
+	return nil
+}
+
+func (m UserModel) Update(ctx context.Context, user *data.User) error {
+	err := m.UserModelInterface.Update(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	m.Indexer.Add(user)
+
+	return nil
+}
+
+func (m UserModel) Delete(ctx context.Context, id uuid.UUID) error {
+	err := m.UserModelInterface.Delete(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	m.Indexer.Delete(id)
+
+	return nil
+}
+
+func (m UserModel) Restore(ctx context.Context, id uuid.UUID, deletedAfter time.Time) (*data.User, error) {
+	user, err := m.UserModelInterface.Restore(ctx, id, deletedAfter)
+	if err != nil {
+		return nil, err
+	}
+
+	m.Indexer.Add(user)
+
+	return user, nil
+}
@@ -0,0 +1,228 @@
+package lockout
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Record is the failed logins of an account
+type Record struct {
+	Failures    int
+	LastFailure time.Time
+}
+
+// Store keeps the records of the accounts, the records must be shared
+// by every instance of the service to count the failures across them
+type Store interface {
+	Get(key string) (Record, error)
+
+	// Fail adds a failure, a record older than the window starts again from zero
+	Fail(key string, now time.Time, window time.Duration) (Record, error)
+
+	// Reserve adds a failure like Fail if the record of the key is still the record
+	// read before, it returns false if the record was changed in between
+	Reserve(key string, record Record, now time.Time, window time.Duration) (bool, error)
+
+	// Release removes a failure added by Reserve
+	Release(key string) error
+
+	Reset(key string) error
+	DeleteExpired(before time.Time) error
+}
+
+// Policy sets the delay after each failure, the delay doubles from BaseDelay
+// up to MaxDelay, and the account is locked for Duration after Threshold failures.
+// A zero policy never slows down the logins
+type Policy struct {
+	Threshold int
+	Duration  time.Duration
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// Window is the time after the last failure before the failures are forgotten
+	Window time.Duration
+}
+
+// delay returns the time after the last failure before the next attempt
+func (p Policy) delay(failures int) time.Duration {
+	if failures == 0 {
+		return 0
+	}
+
+	if p.Threshold > 0 && failures >= p.Threshold {
+		return p.Duration
+	}
+
+	if p.BaseDelay <= 0 {
+		return 0
+	}
+
+	d := p.BaseDelay
+	for i := 1; i < failures && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+
+	return d
+}
+
+// window returns the time the failures are kept, at least as long as the lockout
+func (p Policy) window() time.Duration {
+	window := p.Window
+
+	if p.Duration > window {
+		window = p.Duration
+	}
+	if p.MaxDelay > window {
+		window = p.MaxDelay
+	}
+
+	return window
+}
+
+// Limiter slows down the password guesses on an account,
+// whatever the number of clients the guesses come from
+type Limiter struct {
+	store  Store
+	policy Policy
+	now    func() time.Time
+
+	mu          sync.Mutex
+	lastCleanup time.Time
+}
+
+func New(store Store, policy Policy) *Limiter {
+	return &Limiter{store: store, policy: policy, now: time.Now}
+}
+
+// key ignores the case and the spaces around an email
+func key(account string) string {
+	return strings.ToLower(strings.TrimSpace(account))
+}
+
+// Wait returns the time left before the next login of the account is allowed,
+// it is zero if the login is allowed
+func (l *Limiter) Wait(account string) (time.Duration, error) {
+	record, err := l.store.Get(key(account))
+	if err != nil {
+		return 0, err
+	}
+
+	return l.wait(record), nil
+}
+
+// Failures returns the number of failures of the account that aren't forgotten yet
+func (l *Limiter) Failures(account string) (int, error) {
+	record, err := l.store.Get(key(account))
+	if err != nil {
+		return 0, err
+	}
+
+	if record.Failures == 0 || l.now().Sub(record.LastFailure) > l.policy.window() {
+		return 0, nil
+	}
+
+	return record.Failures, nil
+}
+
+func (l *Limiter) wait(record Record) time.Duration {
+	if record.Failures == 0 {
+		return 0
+	}
+
+	now := l.now()
+
+	if now.Sub(record.LastFailure) > l.policy.window() {
+		return 0
+	}
+
+	until := record.LastFailure.Add(l.policy.delay(record.Failures))
+	if !until.After(now) {
+		return 0
+	}
+
+	return until.Sub(now)
+}
+
+// Attempt reserves a login of the account before the password is checked, the
+// login is counted as a failure in the same atomic step as the check of the wait,
+// so parallel guesses can't all be checked before their failures are counted.
+// It returns the time left before a login is allowed if the login isn't reserved.
+// A successful login forgets the failures with Reset, or gives back its
+// reservation with Release
+func (l *Limiter) Attempt(account string) (time.Duration, error) {
+	for {
+		record, err := l.store.Get(key(account))
+		if err != nil {
+			return 0, err
+		}
+
+		wait := l.wait(record)
+		if wait > 0 {
+			return wait, nil
+		}
+
+		now := l.now()
+
+		// Another login changed the record since it was read, check it again
+		reserved, err := l.store.Reserve(key(account), record, now, l.policy.window())
+		if err != nil {
+			return 0, err
+		}
+		if !reserved {
+			continue
+		}
+
+		return 0, l.cleanup(now)
+	}
+}
+
+// Release gives back the login reserved by Attempt without forgetting the other
+// failures, when the password was right but the login isn't finished yet
+func (l *Limiter) Release(account string) error {
+	return l.store.Release(key(account))
+}
+
+// Fail counts a failed login of the account,
+// and returns the time before the next login is allowed
+func (l *Limiter) Fail(account string) (time.Duration, error) {
+	now := l.now()
+
+	record, err := l.store.Fail(key(account), now, l.policy.window())
+	if err != nil {
+		return 0, err
+	}
+
+	err = l.cleanup(now)
+	if err != nil {
+		return 0, err
+	}
+
+	return l.wait(record), nil
+}
+
+// cleanup forgets the old records once in a while
+func (l *Limiter) cleanup(now time.Time) error {
+	l.mu.Lock()
+	cleanup := now.Sub(l.lastCleanup) > time.Minute
+	if cleanup {
+		l.lastCleanup = now
+	}
+	l.mu.Unlock()
+
+	if !cleanup {
+		return nil
+	}
+
+	return l.store.DeleteExpired(now.Add(-l.policy.window()))
+}
+
+// Reset forgets the failures of the account, after a successful login,
+// or to unlock the account
+func (l *Limiter) Reset(account string) error {
+	return l.store.Reset(key(account))
+}
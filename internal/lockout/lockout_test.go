@@ -0,0 +1,194 @@
+package lockout
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/migrate"
+	"github.com/e-inwork-com/go-user-service/internal/sqlite"
+	"github.com/e-inwork-com/go-user-service/migrations"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Now()
+
+	limiter := New(NewMemory(), Policy{
+		Threshold: 5,
+		Duration:  15 * time.Minute,
+		BaseDelay: time.Second,
+		MaxDelay:  4 * time.Second,
+		Window:    time.Hour,
+	})
+	limiter.now = func() time.Time { return now }
+
+	wait, err := limiter.Wait("jon@doe.com")
+	assert.Nil(t, err)
+	assert.Zero(t, wait)
+
+	// The delay doubles after each failure, up to the maximum delay
+	for _, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		wait, err = limiter.Fail("jon@doe.com")
+		assert.Nil(t, err)
+		assert.Equal(t, expected, wait)
+
+		now = now.Add(wait)
+	}
+
+	// The account is locked after the threshold, whatever the case of the email
+	wait, err = limiter.Fail("Jon@Doe.com ")
+	assert.Nil(t, err)
+	assert.Equal(t, 15*time.Minute, wait)
+
+	now = now.Add(time.Minute)
+
+	wait, err = limiter.Wait("jon@doe.com")
+	assert.Nil(t, err)
+	assert.Equal(t, 14*time.Minute, wait)
+
+	failures, err := limiter.Failures("jon@doe.com")
+	assert.Nil(t, err)
+	assert.Equal(t, 5, failures)
+
+	// The failures of an account don't slow down the other accounts
+	wait, err = limiter.Wait("nina@doe.com")
+	assert.Nil(t, err)
+	assert.Zero(t, wait)
+
+	failures, err = limiter.Failures("nina@doe.com")
+	assert.Nil(t, err)
+	assert.Zero(t, failures)
+
+	// The account is unlocked by a reset
+	assert.Nil(t, limiter.Reset("jon@doe.com"))
+
+	wait, err = limiter.Wait("jon@doe.com")
+	assert.Nil(t, err)
+	assert.Zero(t, wait)
+}
+
+func TestLimiterWindow(t *testing.T) {
+	now := time.Now()
+
+	limiter := New(NewMemory(), Policy{Threshold: 2, Duration: time.Minute, Window: time.Hour})
+	limiter.now = func() time.Time { return now }
+
+	wait, err := limiter.Fail("jon@doe.com")
+	assert.Nil(t, err)
+	assert.Zero(t, wait)
+
+	// The failures are forgotten after the window
+	now = now.Add(2 * time.Hour)
+
+	wait, err = limiter.Fail("jon@doe.com")
+	assert.Nil(t, err)
+	assert.Zero(t, wait)
+
+	wait, err = limiter.Fail("jon@doe.com")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Minute, wait)
+}
+
+func TestZeroPolicy(t *testing.T) {
+	limiter := New(NewMemory(), Policy{})
+
+	for i := 0; i < 100; i++ {
+		wait, err := limiter.Fail("jon@doe.com")
+		assert.Nil(t, err)
+		assert.Zero(t, wait)
+	}
+}
+
+func TestAttempt(t *testing.T) {
+	stores := []struct {
+		name  string
+		store func(t *testing.T) Store
+	}{
+		{"Memory", func(t *testing.T) Store { return NewMemory() }},
+		{"SQLite", testSQLite},
+	}
+
+	for _, store := range stores {
+		t.Run(store.name, func(t *testing.T) {
+			limiter := New(store.store(t), Policy{Threshold: 3, Duration: time.Minute})
+
+			// The parallel guesses are reserved up to the threshold
+			var wg sync.WaitGroup
+			var reserved int32
+
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+
+					wait, err := limiter.Attempt("jon@doe.com")
+					assert.Nil(t, err)
+					if wait == 0 {
+						atomic.AddInt32(&reserved, 1)
+					}
+				}()
+			}
+
+			wg.Wait()
+			assert.Equal(t, int32(3), reserved)
+
+			wait, err := limiter.Attempt("jon@doe.com")
+			assert.Nil(t, err)
+			assert.Equal(t, time.Minute, wait.Round(time.Minute))
+
+			// A released login gives back its reservation only
+			assert.Nil(t, limiter.Reset("jon@doe.com"))
+
+			for i := 0; i < 2; i++ {
+				wait, err = limiter.Attempt("jon@doe.com")
+				assert.Nil(t, err)
+				assert.Zero(t, wait)
+			}
+
+			assert.Nil(t, limiter.Release("jon@doe.com"))
+
+			failures, err := limiter.Failures("jon@doe.com")
+			assert.Nil(t, err)
+			assert.Equal(t, 1, failures)
+
+			// A record released to zero is reserved again
+			assert.Nil(t, limiter.Release("jon@doe.com"))
+
+			wait, err = limiter.Attempt("jon@doe.com")
+			assert.Nil(t, err)
+			assert.Zero(t, wait)
+
+			failures, err = limiter.Failures("jon@doe.com")
+			assert.Nil(t, err)
+			assert.Equal(t, 1, failures)
+		})
+	}
+}
+
+// testSQLite returns the store of the failures on a new SQLite database migrated up
+func testSQLite(t *testing.T) Store {
+	dsn := "file:" + filepath.Join(t.TempDir(), "user.db") + "?_foreign_keys=on&_txlock=immediate&_busy_timeout=5000"
+
+	db, err := sql.Open(sqlite.DriverName, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migrate.New(db, sqlite.DriverName, migrations.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = migrator.Up(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewPostgres(db)
+}
@@ -0,0 +1,101 @@
+package lockout
+
+import (
+	"sync"
+	"time"
+)
+
+// Memory keeps the records in the memory of the process,
+// the failures are counted per instance of the service
+type Memory struct {
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+func NewMemory() *Memory {
+	return &Memory{records: make(map[string]Record)}
+}
+
+func (m *Memory) Get(key string) (Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.records[key], nil
+}
+
+func (m *Memory) Fail(key string, now time.Time, window time.Duration) (Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record := m.records[key]
+	if now.Sub(record.LastFailure) > window {
+		record.Failures = 0
+	}
+
+	record.Failures++
+	record.LastFailure = now
+	m.records[key] = record
+
+	return record, nil
+}
+
+func (m *Memory) Reserve(key string, record Record, now time.Time, window time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.records[key] != record {
+		return false, nil
+	}
+
+	if now.Sub(record.LastFailure) > window {
+		record.Failures = 0
+	}
+
+	record.Failures++
+	record.LastFailure = now
+	m.records[key] = record
+
+	return true, nil
+}
+
+func (m *Memory) Release(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record, ok := m.records[key]
+	if !ok {
+		return nil
+	}
+
+	record.Failures--
+	if record.Failures <= 0 {
+		delete(m.records, key)
+		return nil
+	}
+
+	m.records[key] = record
+
+	return nil
+}
+
+func (m *Memory) Reset(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.records, key)
+
+	return nil
+}
+
+func (m *Memory) DeleteExpired(before time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, record := range m.records {
+		if record.LastFailure.Before(before) {
+			delete(m.records, key)
+		}
+	}
+
+	return nil
+}
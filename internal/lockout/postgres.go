@@ -0,0 +1,143 @@
+package lockout
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Postgres keeps the records in the login_failures table,
+// the failures are counted across the instances of the service.
+// The queries also run on the SQLite database of the service
+type Postgres struct {
+	DB *sql.DB
+}
+
+func NewPostgres(db *sql.DB) *Postgres {
+	return &Postgres{DB: db}
+}
+
+func (p *Postgres) Get(key string) (Record, error) {
+	query := `
+        SELECT failures, last_failure_dt
+        FROM login_failures
+        WHERE key_t = $1`
+
+	var record Record
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := p.DB.QueryRowContext(ctx, query, key).Scan(&record.Failures, &record.LastFailure)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return Record{}, err
+	}
+
+	return record, nil
+}
+
+func (p *Postgres) Fail(key string, now time.Time, window time.Duration) (Record, error) {
+	query := `
+        INSERT INTO login_failures (key_t, failures, last_failure_dt)
+        VALUES ($1, 1, $2)
+        ON CONFLICT (key_t) DO UPDATE
+        SET failures = CASE
+                WHEN login_failures.last_failure_dt < $3 THEN 1
+                ELSE login_failures.failures + 1
+            END,
+            last_failure_dt = EXCLUDED.last_failure_dt
+        RETURNING failures, last_failure_dt`
+
+	var record Record
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := p.DB.QueryRowContext(ctx, query, key, now, now.Add(-window)).Scan(&record.Failures, &record.LastFailure)
+	if err != nil {
+		return Record{}, err
+	}
+
+	return record, nil
+}
+
+// Reserve compares the record with the failures and the time of the last failure,
+// a record without failures is inserted, or replaces a record released to zero
+func (p *Postgres) Reserve(key string, record Record, now time.Time, window time.Duration) (bool, error) {
+	query := `
+        UPDATE login_failures
+        SET failures = CASE
+                WHEN last_failure_dt < $3 THEN 1
+                ELSE failures + 1
+            END,
+            last_failure_dt = $2
+        WHERE key_t = $1 AND failures = $4 AND last_failure_dt = $5`
+
+	args := []interface{}{key, now, now.Add(-window), record.Failures, record.LastFailure}
+
+	if record.Failures == 0 {
+		query = `
+            INSERT INTO login_failures (key_t, failures, last_failure_dt)
+            VALUES ($1, 1, $2)
+            ON CONFLICT (key_t) DO UPDATE
+            SET failures = 1,
+                last_failure_dt = EXCLUDED.last_failure_dt
+            WHERE login_failures.failures = 0`
+
+		args = []interface{}{key, now}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := p.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows == 1, nil
+}
+
+// Release keeps a record released to zero, it is deleted with the expired records
+func (p *Postgres) Release(key string) error {
+	query := `
+        UPDATE login_failures
+        SET failures = failures - 1
+        WHERE key_t = $1 AND failures > 0`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := p.DB.ExecContext(ctx, query, key)
+	return err
+}
+
+func (p *Postgres) Reset(key string) error {
+	query := `
+        DELETE FROM login_failures
+        WHERE key_t = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := p.DB.ExecContext(ctx, query, key)
+	return err
+}
+
+func (p *Postgres) DeleteExpired(before time.Time) error {
+	query := `
+        DELETE FROM login_failures
+        WHERE last_failure_dt < $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := p.DB.ExecContext(ctx, query, before)
+	return err
+}
@@ -0,0 +1,94 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Memory keeps the rendered emails in memory instead of sending them,
+// it is meant for the tests
+type Memory struct {
+	mu       sync.Mutex
+	messages []*Message
+}
+
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+func (m *Memory) Send(recipient string, templateFile string, data interface{}) error {
+	msg, err := Render(recipient, templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, msg)
+
+	return nil
+}
+
+// Messages returns the emails sent so far
+func (m *Memory) Messages() []*Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]*Message(nil), m.messages...)
+}
+
+// Last returns the last email sent to the recipient, or nil
+func (m *Memory) Last(recipient string) *Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].Recipient == recipient {
+			return m.messages[i]
+		}
+	}
+
+	return nil
+}
+
+// File writes every email as an .eml file in a directory instead of sending it,
+// it is meant for the local development
+type File struct {
+	Dir    string
+	Sender string
+
+	mu  sync.Mutex
+	seq int
+}
+
+func NewFile(dir string, sender string) (*File, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &File{Dir: dir, Sender: sender}, nil
+}
+
+func (m *File) Send(recipient string, templateFile string, data interface{}) error {
+	msg, err := Render(recipient, templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	body, err := msg.Bytes(m.Sender)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.seq++
+	name := fmt.Sprintf("%s-%04d-%s.eml", time.Now().UTC().Format("20060102T150405"), m.seq, filepath.Base(recipient))
+	m.mu.Unlock()
+
+	return os.WriteFile(filepath.Join(m.Dir, name), body, 0644)
+}
@@ -0,0 +1,73 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	"strings"
+	"text/template"
+)
+
+//go:embed "templates"
+var templateFS embed.FS
+
+// Mailer sends an email rendered from one of the embedded templates
+type Mailer interface {
+	Send(recipient string, templateFile string, data interface{}) error
+}
+
+// Message is a rendered email
+type Message struct {
+	Recipient    string
+	TemplateFile string
+	Data         interface{}
+	Subject      string
+	PlainBody    string
+	HTMLBody     string
+}
+
+// Render executes the "subject", "plainBody" and the optional "htmlBody"
+// templates of the template file, the HTML body is escaped by html/template
+func Render(recipient string, templateFile string, data interface{}) (*Message, error) {
+	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	subject := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(subject, "subject", data)
+	if err != nil {
+		return nil, err
+	}
+
+	plainBody := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(plainBody, "plainBody", data)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &Message{
+		Recipient:    recipient,
+		TemplateFile: templateFile,
+		Data:         data,
+		Subject:      strings.TrimSpace(subject.String()),
+		PlainBody:    strings.TrimSpace(plainBody.String()) + "\n",
+	}
+
+	htmlTmpl, err := htmltemplate.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if htmlTmpl.Lookup("htmlBody") != nil {
+		htmlBody := new(bytes.Buffer)
+		err = htmlTmpl.ExecuteTemplate(htmlBody, "htmlBody", data)
+		if err != nil {
+			return nil, err
+		}
+
+		msg.HTMLBody = strings.TrimSpace(htmlBody.String()) + "\n"
+	}
+
+	return msg, nil
+}
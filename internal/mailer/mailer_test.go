@@ -0,0 +1,91 @@
+package mailer
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/jsonlog"
+	"github.com/stretchr/testify/assert"
+)
+
+type failingMailer struct {
+	failures int
+	calls    int
+}
+
+func (m *failingMailer) Send(recipient string, templateFile string, data interface{}) error {
+	m.calls++
+	if m.calls <= m.failures {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func testData() map[string]interface{} {
+	return map[string]interface{}{
+		"activationToken": "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+		"firstName":       "<Jon>",
+	}
+}
+
+func TestRender(t *testing.T) {
+	msg, err := Render("jon@doe.com", "user_welcome.tmpl", testData())
+	assert.Nil(t, err)
+	assert.Equal(t, "Welcome to e-inwork!", msg.Subject)
+	assert.Contains(t, msg.PlainBody, "Hi <Jon>,")
+	assert.Contains(t, msg.HTMLBody, "Hi &lt;Jon&gt;,")
+
+	body, err := msg.Bytes("e-inwork <no-reply@e-inwork.com>")
+	assert.Nil(t, err)
+	assert.Contains(t, string(body), "Content-Type: multipart/alternative")
+
+	_, err = Render("jon@doe.com", "unknown.tmpl", testData())
+	assert.NotNil(t, err)
+}
+
+func TestMemory(t *testing.T) {
+	m := NewMemory()
+
+	assert.Nil(t, m.Send("jon@doe.com", "user_welcome.tmpl", testData()))
+	assert.Nil(t, m.Send("nina@doe.com", "user_activation.tmpl", testData()))
+
+	assert.Len(t, m.Messages(), 2)
+	assert.Equal(t, "user_welcome.tmpl", m.Last("jon@doe.com").TemplateFile)
+	assert.Nil(t, m.Last("lee@doe.com"))
+}
+
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+
+	m, err := NewFile(dir, "e-inwork <no-reply@e-inwork.com>")
+	assert.Nil(t, err)
+	assert.Nil(t, m.Send("jon@doe.com", "user_welcome.tmpl", testData()))
+
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+	assert.True(t, strings.HasSuffix(entries[0].Name(), "jon@doe.com.eml"))
+}
+
+func TestRetry(t *testing.T) {
+	logger := jsonlog.New(os.Stdout, jsonlog.LevelOff)
+
+	t.Run("Succeed after failures", func(t *testing.T) {
+		failing := &failingMailer{failures: 2}
+		m := NewRetry(failing, 3, time.Millisecond, logger)
+
+		assert.Nil(t, m.Send("jon@doe.com", "user_welcome.tmpl", testData()))
+		assert.Equal(t, 3, failing.calls)
+	})
+
+	t.Run("Give up", func(t *testing.T) {
+		failing := &failingMailer{failures: 5}
+		m := NewRetry(failing, 3, time.Millisecond, logger)
+
+		assert.NotNil(t, m.Send("jon@doe.com", "user_welcome.tmpl", testData()))
+		assert.Equal(t, 3, failing.calls)
+	})
+}
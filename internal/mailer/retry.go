@@ -0,0 +1,53 @@
+package mailer
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/jsonlog"
+)
+
+// Retry sends the emails with another mailer, and tries again
+// with an exponential backoff when the delivery fails
+type Retry struct {
+	Mailer   Mailer
+	Attempts int
+	Backoff  time.Duration
+	Logger   *jsonlog.Logger
+}
+
+func NewRetry(m Mailer, attempts int, backoff time.Duration, logger *jsonlog.Logger) *Retry {
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	return &Retry{
+		Mailer:   m,
+		Attempts: attempts,
+		Backoff:  backoff,
+		Logger:   logger,
+	}
+}
+
+// Send returns the error of the last attempt, the failed attempts
+// before it are logged with the delay until the next attempt
+func (m *Retry) Send(recipient string, templateFile string, data interface{}) error {
+	delay := m.Backoff
+
+	for attempt := 1; ; attempt++ {
+		err := m.Mailer.Send(recipient, templateFile, data)
+		if err == nil || attempt >= m.Attempts {
+			return err
+		}
+
+		m.Logger.PrintError(err, map[string]string{
+			"recipient": recipient,
+			"template":  templateFile,
+			"attempt":   strconv.Itoa(attempt),
+			"retry_in":  delay.String(),
+		})
+
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
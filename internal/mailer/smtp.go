@@ -0,0 +1,114 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"time"
+)
+
+// Bytes encodes the message in the Internet Message Format,
+// a message with a HTML body is sent as multipart/alternative
+func (msg *Message) Bytes(sender string) ([]byte, error) {
+	buf := new(bytes.Buffer)
+
+	fmt.Fprintf(buf, "From: %s\r\n", sender)
+	fmt.Fprintf(buf, "To: %s\r\n", msg.Recipient)
+	fmt.Fprintf(buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(buf, "MIME-Version: 1.0\r\n")
+
+	if msg.HTMLBody == "" {
+		fmt.Fprintf(buf, "Content-Type: text/plain; charset=UTF-8\r\n")
+		fmt.Fprintf(buf, "Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+		err := writeQuotedPrintable(buf, msg.PlainBody)
+		return buf.Bytes(), err
+	}
+
+	mw := multipart.NewWriter(buf)
+
+	fmt.Fprintf(buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", mw.Boundary())
+
+	parts := []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain; charset=UTF-8", msg.PlainBody},
+		{"text/html; charset=UTF-8", msg.HTMLBody},
+	}
+
+	for _, part := range parts {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		err = writeQuotedPrintable(pw, part.body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := mw.Close()
+	return buf.Bytes(), err
+}
+
+func writeQuotedPrintable(w interface{ Write([]byte) (int, error) }, body string) error {
+	qw := quotedprintable.NewWriter(w)
+
+	_, err := qw.Write([]byte(body))
+	if err != nil {
+		return err
+	}
+
+	return qw.Close()
+}
+
+// SMTP sends the emails through a SMTP server
+type SMTP struct {
+	Addr   string
+	Auth   smtp.Auth
+	Sender string
+}
+
+func NewSMTP(host string, port int, username, password, sender string) *SMTP {
+	m := &SMTP{
+		Addr:   fmt.Sprintf("%s:%d", host, port),
+		Sender: sender,
+	}
+
+	if username != "" {
+		m.Auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return m
+}
+
+func (m *SMTP) Send(recipient string, templateFile string, data interface{}) error {
+	msg, err := Render(recipient, templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	body, err := msg.Bytes(m.Sender)
+	if err != nil {
+		return err
+	}
+
+	// The envelope sender is the address without the display name
+	from, err := mail.ParseAddress(m.Sender)
+	if err != nil {
+		return err
+	}
+
+	return smtp.SendMail(m.Addr, m.Auth, from.Address, []string{msg.Recipient}, body)
+}
@@ -0,0 +1,345 @@
+// Package migrate applies the SQL migrations of the service. The version of the
+// schema is kept in the schema_migrations table of golang-migrate, so a database
+// migrated by the migrate/migrate container is migrated on from its version
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+var (
+	ErrDirty         = errors.New("the schema is dirty, fix it and force the version")
+	ErrSchemaBehind  = errors.New("the schema is behind the service, migrate it up")
+	ErrNoMigration   = errors.New("no migration to apply")
+	ErrUnknownDriver = errors.New("unknown migration driver")
+)
+
+// lockKey is the advisory lock of the migrations on Postgres,
+// so only one instance of the service migrates the schema
+const lockKey = 0x6d696772617465
+
+// Migration is a change of the schema with the SQL to undo it
+type Migration struct {
+	Version uint
+	Name    string
+	Up      string
+	Down    string
+}
+
+var fileRX = regexp.MustCompile(`^([0-9]+)_(.+)\.(up|down)\.sql$`)
+
+// Load reads the migrations of the root of fsys in the order of their versions,
+// the files are named "<version>_<name>.up.sql" and "<version>_<name>.down.sql"
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := map[uint]*Migration{}
+
+	for _, entry := range entries {
+		match := fileRX.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+
+		query, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := migrations[uint(version)]
+		if !ok {
+			migration = &Migration{Version: uint(version), Name: match[2]}
+			migrations[uint(version)] = migration
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(query)
+		} else {
+			migration.Down = string(query)
+		}
+	}
+
+	sorted := make([]Migration, 0, len(migrations))
+	for _, migration := range migrations {
+		sorted = append(sorted, *migration)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+
+	return sorted, nil
+}
+
+// Migrator applies the migrations on a Postgres or a SQLite database, every
+// migration is applied in a transaction with the change of the version
+type Migrator struct {
+	DB         *sql.DB
+	Driver     string
+	Migrations []Migration
+}
+
+// New returns the migrator of the migrations of fsys on the database
+// of the driver, "postgres" or "sqlite"
+func New(db *sql.DB, driver string, fsys fs.FS) (*Migrator, error) {
+	if driver != "postgres" && driver != "sqlite" {
+		return nil, fmt.Errorf("%w %q", ErrUnknownDriver, driver)
+	}
+
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{DB: db, Driver: driver, Migrations: migrations}, nil
+}
+
+// Latest returns the version of the last migration, the version the service expects
+func (m *Migrator) Latest() uint {
+	if len(m.Migrations) == 0 {
+		return 0
+	}
+
+	return m.Migrations[len(m.Migrations)-1].Version
+}
+
+// Status is the version of the schema with the migrations that are not applied
+type Status struct {
+	Version uint
+	Dirty   bool
+	Latest  uint
+	Pending []Migration
+}
+
+// Status returns the version of the schema, a schema without a version is zero
+func (m *Migrator) Status(ctx context.Context) (Status, error) {
+	version, dirty, err := m.version(ctx, m.DB)
+	if err != nil {
+		return Status{}, err
+	}
+
+	status := Status{Version: version, Dirty: dirty, Latest: m.Latest()}
+
+	for _, migration := range m.Migrations {
+		if migration.Version > version {
+			status.Pending = append(status.Pending, migration)
+		}
+	}
+
+	return status, nil
+}
+
+// Check returns ErrSchemaBehind when a migration of the service isn't applied,
+// a schema ahead of the service is allowed while the instances are updated
+func (m *Migrator) Check(ctx context.Context) error {
+	status, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	if status.Dirty {
+		return fmt.Errorf("%w: version %d", ErrDirty, status.Version)
+	}
+
+	if status.Version < status.Latest {
+		return fmt.Errorf("%w: version %d, expected %d", ErrSchemaBehind, status.Version, status.Latest)
+	}
+
+	return nil
+}
+
+// Up applies the migrations after the version of the schema,
+// it returns the number of applied migrations
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	applied := 0
+
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		version, dirty, err := m.version(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		if dirty {
+			return fmt.Errorf("%w: version %d", ErrDirty, version)
+		}
+
+		for _, migration := range m.Migrations {
+			if migration.Version <= version {
+				continue
+			}
+
+			err = m.apply(ctx, conn, migration.Up, int(migration.Version))
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			applied++
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down undoes the last steps migrations of the schema,
+// it returns the number of undone migrations
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	undone := 0
+
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		version, dirty, err := m.version(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		if dirty {
+			return fmt.Errorf("%w: version %d", ErrDirty, version)
+		}
+
+		if version > m.Latest() {
+			return fmt.Errorf("the schema version %d is ahead of the migrations", version)
+		}
+
+		for i := len(m.Migrations) - 1; i >= 0 && undone < steps; i-- {
+			migration := m.Migrations[i]
+			if migration.Version > version {
+				continue
+			}
+
+			// The previous version is the version of the schema, zero has no version
+			previous := -1
+			if i > 0 {
+				previous = int(m.Migrations[i-1].Version)
+			}
+
+			err = m.apply(ctx, conn, migration.Down, previous)
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			undone++
+		}
+
+		if undone == 0 {
+			return ErrNoMigration
+		}
+
+		return nil
+	})
+
+	return undone, err
+}
+
+// Force sets the version of the schema without a migration and clears the dirty
+// flag, after a failed migration was fixed by hand. The version -1 has no version
+func (m *Migrator) Force(ctx context.Context, version int) error {
+	return m.locked(ctx, func(conn *sql.Conn) error {
+		_, _, err := m.version(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		return m.apply(ctx, conn, "", version)
+	})
+}
+
+// locked runs fn on a connection holding the advisory lock of the
+// migrations on Postgres, the transactions of SQLite lock the database
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if m.Driver == "postgres" {
+		_, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockKey)
+		if err != nil {
+			return err
+		}
+		defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockKey)
+	}
+
+	return fn(conn)
+}
+
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// version returns the version of the schema, the table
+// of the versions is created on the first migration
+func (m *Migrator) version(ctx context.Context, db queryer) (uint, bool, error) {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version bigint NOT NULL PRIMARY KEY, dirty boolean NOT NULL)`)
+	if err != nil {
+		return 0, false, err
+	}
+
+	var version int64
+	var dirty bool
+
+	err = db.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, false, nil
+		default:
+			return 0, false, err
+		}
+	}
+
+	// golang-migrate writes -1 when the schema has no version
+	if version < 0 {
+		return 0, dirty, nil
+	}
+
+	return uint(version), dirty, nil
+}
+
+// apply runs the query and sets the version in a transaction,
+// the version -1 removes the version
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, query string, version int) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if query != "" {
+		_, err = tx.ExecContext(ctx, query)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM schema_migrations`)
+	if err != nil {
+		return err
+	}
+
+	if version >= 0 {
+		_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES ($1, false)`, version)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
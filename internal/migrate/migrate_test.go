@@ -0,0 +1,207 @@
+package migrate_test
+
+import (
+	"context"
+	"database/sql"
+	"io/fs"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/e-inwork-com/go-user-service/internal/migrate"
+	"github.com/e-inwork-com/go-user-service/internal/sqlite"
+	"github.com/e-inwork-com/go-user-service/migrations"
+	"github.com/stretchr/testify/assert"
+)
+
+// testMigrator returns the migrator of the migrations of fsys on a new SQLite database
+func testMigrator(t *testing.T, fsys fstest.MapFS) (*migrate.Migrator, *sql.DB) {
+	db, err := sql.Open(sqlite.DriverName, "file:"+filepath.Join(t.TempDir(), "user.db")+"?_txlock=immediate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migrate.New(db, sqlite.DriverName, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return migrator, db
+}
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"000001_create_a.up.sql":   {Data: []byte(`CREATE TABLE a (id integer);`)},
+		"000001_create_a.down.sql": {Data: []byte(`DROP TABLE a;`)},
+		"000002_create_b.up.sql":   {Data: []byte(`CREATE TABLE b (id integer);`)},
+		"000002_create_b.down.sql": {Data: []byte(`DROP TABLE b;`)},
+		"000003_create_c.up.sql":   {Data: []byte(`CREATE TABLE c (id integer);`)},
+		"000003_create_c.down.sql": {Data: []byte(`DROP TABLE c;`)},
+		"README.md":                {Data: []byte(`not a migration`)},
+	}
+}
+
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	var count int
+	err := db.QueryRow(`SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = $1`, name).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return count == 1
+}
+
+func TestLoad(t *testing.T) {
+	for name, fsys := range map[string]fs.FS{"Postgres": migrations.Postgres, "SQLite": migrations.SQLite} {
+		t.Run(name, func(t *testing.T) {
+			loaded, err := migrate.Load(fsys)
+			assert.Nil(t, err)
+			assert.Len(t, loaded, 16)
+
+			for i, migration := range loaded {
+				assert.Equal(t, uint(i+1), migration.Version)
+				assert.NotEmpty(t, migration.Up, migration.Name)
+				assert.NotEmpty(t, migration.Down, migration.Name)
+			}
+		})
+	}
+
+	_, err := migrate.New(nil, "mysql", testFS())
+	assert.ErrorIs(t, err, migrate.ErrUnknownDriver)
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+	migrator, db := testMigrator(t, testFS())
+
+	assert.Equal(t, uint(3), migrator.Latest())
+	assert.ErrorIs(t, migrator.Check(ctx), migrate.ErrSchemaBehind)
+
+	status, err := migrator.Status(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, uint(0), status.Version)
+	assert.Len(t, status.Pending, 3)
+
+	t.Run("Up", func(t *testing.T) {
+		applied, err := migrator.Up(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, 3, applied)
+		assert.True(t, tableExists(t, db, "c"))
+		assert.Nil(t, migrator.Check(ctx))
+
+		// The applied migrations are not applied again
+		applied, err = migrator.Up(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, applied)
+	})
+
+	t.Run("Down", func(t *testing.T) {
+		undone, err := migrator.Down(ctx, 2)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, undone)
+		assert.False(t, tableExists(t, db, "b"))
+		assert.True(t, tableExists(t, db, "a"))
+
+		status, err := migrator.Status(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, uint(1), status.Version)
+		assert.Len(t, status.Pending, 2)
+		assert.ErrorIs(t, migrator.Check(ctx), migrate.ErrSchemaBehind)
+
+		undone, err = migrator.Down(ctx, 5)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, undone)
+		assert.False(t, tableExists(t, db, "a"))
+
+		_, err = migrator.Down(ctx, 1)
+		assert.ErrorIs(t, err, migrate.ErrNoMigration)
+	})
+
+	t.Run("Force", func(t *testing.T) {
+		assert.Nil(t, migrator.Force(ctx, 3))
+		assert.Nil(t, migrator.Check(ctx))
+
+		assert.Nil(t, migrator.Force(ctx, -1))
+
+		status, err := migrator.Status(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, uint(0), status.Version)
+	})
+}
+
+func TestMigratorFailed(t *testing.T) {
+	ctx := context.Background()
+
+	fsys := testFS()
+	fsys["000002_create_b.up.sql"] = &fstest.MapFile{Data: []byte(`CREATE TABLE b (id integer); CREATE TABLE a (id integer);`)}
+
+	migrator, db := testMigrator(t, fsys)
+
+	applied, err := migrator.Up(ctx)
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, applied)
+
+	// The failed migration is rolled back with its version
+	assert.False(t, tableExists(t, db, "b"))
+
+	status, err := migrator.Status(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, uint(1), status.Version)
+	assert.False(t, status.Dirty)
+
+	// A schema ahead of the service is allowed
+	assert.Nil(t, migrator.Force(ctx, 4))
+	assert.Nil(t, migrator.Check(ctx))
+
+	_, err = migrator.Down(ctx, 1)
+	assert.NotNil(t, err)
+}
+
+func TestCanonicalEmailMigration(t *testing.T) {
+	ctx := context.Background()
+
+	// The SQLite migrations before the canonical emails
+	before := fstest.MapFS{}
+	entries, err := fs.ReadDir(migrations.SQLite, ".")
+	assert.Nil(t, err)
+
+	for _, entry := range entries {
+		if entry.Name() < "000013" {
+			content, err := fs.ReadFile(migrations.SQLite, entry.Name())
+			assert.Nil(t, err)
+			before[entry.Name()] = &fstest.MapFile{Data: content}
+		}
+	}
+
+	migrator, db := testMigrator(t, before)
+
+	_, err = migrator.Up(ctx)
+	assert.Nil(t, err)
+
+	for i, email := range []string{"jon@doe.com", "Jon@Doe.com", "Nina@DOE.com"} {
+		_, err = db.Exec(`INSERT INTO users (id, email_t, password_hash, first_name_t, last_name_t) VALUES ($1, $2, x'00', 'Jon', 'Doe')`, i, email)
+		assert.Nil(t, err)
+	}
+
+	migrator, err = migrate.New(db, sqlite.DriverName, migrations.SQLite)
+	assert.Nil(t, err)
+
+	// The users with the same canonical email fail the migration
+	_, err = migrator.Up(ctx)
+	assert.ErrorContains(t, err, "users.email_canonical_t")
+
+	status, err := migrator.Status(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, uint(12), status.Version)
+
+	_, err = db.Exec(`DELETE FROM users WHERE email_t = 'Jon@Doe.com'`)
+	assert.Nil(t, err)
+
+	_, err = migrator.Up(ctx)
+	assert.Nil(t, err)
+
+	var email string
+	assert.Nil(t, db.QueryRow(`SELECT email_t FROM users WHERE id = '2'`).Scan(&email))
+	assert.Equal(t, "Nina@doe.com", email)
+}
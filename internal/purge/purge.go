@@ -0,0 +1,76 @@
+package purge
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
+	"github.com/e-inwork-com/go-user-service/internal/jsonlog"
+)
+
+// Purger removes the users deleted for longer than the grace period
+type Purger struct {
+	Users  data.UserModelInterface
+	Logger *jsonlog.Logger
+
+	// GracePeriod is the time a deleted user can be restored before it is purged
+	GracePeriod time.Duration
+
+	// BatchSize users are purged every Interval, the next batch
+	// is purged at once while more users are due
+	BatchSize int
+	Interval  time.Duration
+}
+
+// Run purges the users until the stop channel is closed
+func (p *Purger) Run(stop <-chan struct{}) {
+	interval := p.Interval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	batchSize := p.BatchSize
+	if batchSize < 1 {
+		batchSize = 100
+	}
+
+	for {
+		delay := interval
+
+		n, err := p.Purge(batchSize)
+		switch {
+		case err != nil:
+			p.Logger.PrintError(err, map[string]string{
+				"purged": strconv.Itoa(n),
+			})
+		case n >= batchSize:
+			delay = 0
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// Purge purges a batch of the users deleted before the grace period,
+// every purge is logged, it returns the number of purged users
+func (p *Purger) Purge(limit int) (int, error) {
+	purges, err := p.Users.Purge(context.Background(), time.Now().Add(-p.GracePeriod), limit)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, purge := range purges {
+		p.Logger.PrintInfo("purged user", map[string]string{
+			"user_id":    purge.UserID.String(),
+			"deleted_at": purge.DeletedAt.Format(time.RFC3339),
+			"purged_at":  purge.PurgedAt.Format(time.RFC3339),
+		})
+	}
+
+	return len(purges), nil
+}
@@ -0,0 +1,112 @@
+package purge
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
+	"github.com/e-inwork-com/go-user-service/internal/data/memory"
+	"github.com/e-inwork-com/go-user-service/internal/jsonlog"
+	"github.com/stretchr/testify/assert"
+)
+
+func testPurger(t *testing.T, gracePeriod time.Duration) (*Purger, data.Models, *bytes.Buffer) {
+	t.Helper()
+
+	var logs bytes.Buffer
+
+	models := memory.New().Models()
+
+	purger := &Purger{
+		Users:       models.Users,
+		Logger:      jsonlog.New(&logs, jsonlog.LevelInfo),
+		GracePeriod: gracePeriod,
+		BatchSize:   10,
+		Interval:    10 * time.Millisecond,
+	}
+
+	return purger, models, &logs
+}
+
+func testDeletedUser(t *testing.T, models data.Models, email string) *data.User {
+	t.Helper()
+
+	user := &data.User{Email: email, FirstName: "Jon", LastName: "Doe"}
+	err := user.Password.Set("pa55word")
+	assert.Nil(t, err)
+
+	ctx := context.Background()
+
+	err = models.Users.Insert(ctx, user)
+	assert.Nil(t, err)
+
+	err = models.Users.Delete(ctx, user.ID)
+	assert.Nil(t, err)
+
+	return user
+}
+
+func TestPurge(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Purge after the Grace Period", func(t *testing.T) {
+		purger, models, logs := testPurger(t, 0)
+
+		user := testDeletedUser(t, models, "jon@doe.com")
+		testDeletedUser(t, models, "lee@doe.com")
+
+		n, err := purger.Purge(1)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, n)
+
+		n, err = purger.Purge(10)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, n)
+
+		_, err = models.Users.Restore(ctx, user.ID, time.Time{})
+		assert.True(t, errors.Is(err, data.ErrRecordNotFound))
+
+		assert.Contains(t, logs.String(), `"message":"purged user"`)
+		assert.Contains(t, logs.String(), user.ID.String())
+		assert.NotContains(t, logs.String(), "jon@doe.com")
+	})
+
+	t.Run("Keep during the Grace Period", func(t *testing.T) {
+		purger, models, _ := testPurger(t, time.Hour)
+
+		user := testDeletedUser(t, models, "jon@doe.com")
+
+		n, err := purger.Purge(10)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, n)
+
+		_, err = models.Users.Restore(ctx, user.ID, time.Now().Add(-time.Hour))
+		assert.Nil(t, err)
+	})
+
+	t.Run("Run until Stopped", func(t *testing.T) {
+		purger, models, _ := testPurger(t, 0)
+
+		testDeletedUser(t, models, "jon@doe.com")
+
+		stop := make(chan struct{})
+		done := make(chan struct{})
+
+		go func() {
+			purger.Run(stop)
+			close(done)
+		}()
+
+		// The email of the deleted user is free once it is purged
+		assert.Eventually(t, func() bool {
+			user := &data.User{Email: "jon@doe.com", FirstName: "Jon", LastName: "Doe"}
+			return models.Users.Insert(ctx, user) == nil
+		}, time.Second, 10*time.Millisecond)
+
+		close(stop)
+		<-done
+	})
+}
@@ -0,0 +1,205 @@
+package signing
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var (
+	ErrUnknownKey       = errors.New("unknown signing key")
+	ErrUnexpectedMethod = errors.New("unexpected signing method")
+	ErrUnsupportedKey   = errors.New("unsupported key type")
+)
+
+// Key is a key to sign or to verify JSON Web Tokens,
+// a verification only key doesn't have a private key
+type Key struct {
+	ID         string
+	Method     jwt.SigningMethod
+	PrivateKey crypto.PrivateKey
+	PublicKey  crypto.PublicKey
+}
+
+// NewHMACKey creates a key from a shared secret, the key doesn't have an ID
+// so the tokens signed before the key IDs were introduced are still valid
+func NewHMACKey(secret string) *Key {
+	return &Key{
+		Method:     jwt.SigningMethodHS256,
+		PrivateKey: []byte(secret),
+		PublicKey:  []byte(secret),
+	}
+}
+
+// LoadKey reads a PEM encoded RSA or Ed25519 key from the file,
+// a private key can sign and verify, a public key can only verify.
+// The ID of the key is the file name without the extension.
+func LoadKey(path string) (*Key, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+
+	var parsed interface{}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	key := &Key{
+		ID: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method = jwt.SigningMethodRS256
+		key.PrivateKey = k
+		key.PublicKey = &k.PublicKey
+	case *rsa.PublicKey:
+		key.Method = jwt.SigningMethodRS256
+		key.PublicKey = k
+	case ed25519.PrivateKey:
+		key.Method = jwt.SigningMethodEdDSA
+		key.PrivateKey = k
+		key.PublicKey = k.Public()
+	case ed25519.PublicKey:
+		key.Method = jwt.SigningMethodEdDSA
+		key.PublicKey = k
+	default:
+		return nil, fmt.Errorf("%s: %w", path, ErrUnsupportedKey)
+	}
+
+	return key, nil
+}
+
+// KeySet signs tokens with the active key, and verifies tokens
+// with any of its keys, so a new key can be introduced (or an old one
+// kept) while the tokens signed by another key are still in use
+type KeySet struct {
+	active *Key
+	keys   map[string]*Key
+}
+
+func NewKeySet(active *Key, verification ...*Key) (*KeySet, error) {
+	if active.PrivateKey == nil {
+		return nil, fmt.Errorf("signing key %q doesn't have a private key", active.ID)
+	}
+
+	ks := &KeySet{
+		active: active,
+		keys:   map[string]*Key{active.ID: active},
+	}
+
+	for _, key := range verification {
+		if _, exists := ks.keys[key.ID]; exists {
+			return nil, fmt.Errorf("duplicate key id %q", key.ID)
+		}
+		ks.keys[key.ID] = key
+	}
+
+	return ks, nil
+}
+
+// Sign creates a signed token with the active key, and stamps the key ID in the header
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.active.Method, claims)
+
+	if ks.active.ID != "" {
+		token.Header["kid"] = ks.active.ID
+	}
+
+	return token.SignedString(ks.active.PrivateKey)
+}
+
+// Keyfunc picks the verification key by the key ID of the token,
+// it is meant to be used with jwt.ParseWithClaims
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, ErrUnexpectedMethod
+	}
+
+	return key.PublicKey, nil
+}
+
+// JWK is a public key in the JSON Web Key format (RFC 7517)
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+// JWKS returns the public keys of the set,
+// the shared secret of the HMAC keys is never published
+func (ks *KeySet) JWKS() []JWK {
+	jwks := []JWK{}
+
+	for _, key := range ks.keys {
+		switch k := key.PublicKey.(type) {
+		case *rsa.PublicKey:
+			jwks = append(jwks, JWK{
+				KeyType:   "RSA",
+				KeyID:     key.ID,
+				Use:       "sig",
+				Algorithm: key.Method.Alg(),
+				N:         base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+				E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			jwks = append(jwks, JWK{
+				KeyType:   "OKP",
+				KeyID:     key.ID,
+				Use:       "sig",
+				Algorithm: key.Method.Alg(),
+				Curve:     "Ed25519",
+				X:         base64.RawURLEncoding.EncodeToString(k),
+			})
+		}
+	}
+
+	sort.Slice(jwks, func(i, j int) bool {
+		return jwks[i].KeyID < jwks[j].KeyID
+	})
+
+	return jwks
+}
@@ -0,0 +1,137 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func writePEM(t *testing.T, dir string, name string, blockType string, der []byte) string {
+	path := filepath.Join(dir, name)
+
+	err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func testRSAKey(t *testing.T, dir string, name string) string {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return writePEM(t, dir, name, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key))
+}
+
+func testEd25519Key(t *testing.T, dir string, name string) string {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return writePEM(t, dir, name, "PRIVATE KEY", der)
+}
+
+func testVerify(ks *KeySet, token string) error {
+	_, err := jwt.ParseWithClaims(token, &jwt.RegisteredClaims{}, ks.Keyfunc)
+	return err
+}
+
+func TestKeySet(t *testing.T) {
+	dir := t.TempDir()
+
+	oldKey, err := LoadKey(testRSAKey(t, dir, "2023-01.pem"))
+	assert.Nil(t, err)
+	assert.Equal(t, "2023-01", oldKey.ID)
+	assert.Equal(t, "RS256", oldKey.Method.Alg())
+
+	newKey, err := LoadKey(testEd25519Key(t, dir, "2023-02.pem"))
+	assert.Nil(t, err)
+	assert.Equal(t, "EdDSA", newKey.Method.Alg())
+
+	claims := &jwt.RegisteredClaims{Subject: "jon@doe.com"}
+
+	t.Run("Sign with kid", func(t *testing.T) {
+		ks, err := NewKeySet(oldKey)
+		assert.Nil(t, err)
+
+		token, err := ks.Sign(claims)
+		assert.Nil(t, err)
+
+		parsed, _ := jwt.Parse(token, ks.Keyfunc)
+		assert.Equal(t, "2023-01", parsed.Header["kid"])
+		assert.Nil(t, testVerify(ks, token))
+	})
+
+	t.Run("Rotate Key", func(t *testing.T) {
+		before, err := NewKeySet(oldKey)
+		assert.Nil(t, err)
+
+		oldToken, err := before.Sign(claims)
+		assert.Nil(t, err)
+
+		after, err := NewKeySet(newKey, oldKey)
+		assert.Nil(t, err)
+
+		newToken, err := after.Sign(claims)
+		assert.Nil(t, err)
+
+		assert.Nil(t, testVerify(after, oldToken))
+		assert.Nil(t, testVerify(after, newToken))
+		assert.NotNil(t, testVerify(before, newToken))
+	})
+
+	t.Run("HMAC Key", func(t *testing.T) {
+		ks, err := NewKeySet(NewHMACKey("secret"))
+		assert.Nil(t, err)
+
+		token, err := ks.Sign(claims)
+		assert.Nil(t, err)
+		assert.Nil(t, testVerify(ks, token))
+
+		other, err := NewKeySet(NewHMACKey("other"))
+		assert.Nil(t, err)
+		assert.NotNil(t, testVerify(other, token))
+		assert.Empty(t, ks.JWKS())
+	})
+
+	t.Run("Unexpected Method", func(t *testing.T) {
+		ks, err := NewKeySet(NewHMACKey("secret"), &Key{ID: "2023-01", Method: oldKey.Method, PublicKey: oldKey.PublicKey})
+		assert.Nil(t, err)
+
+		// A HS256 token signed with the public key must not be accepted
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		token.Header["kid"] = "2023-01"
+		signed, err := token.SignedString([]byte("secret"))
+		assert.Nil(t, err)
+		assert.NotNil(t, testVerify(ks, signed))
+	})
+
+	t.Run("JWKS", func(t *testing.T) {
+		ks, err := NewKeySet(newKey, oldKey)
+		assert.Nil(t, err)
+
+		jwks := ks.JWKS()
+		assert.Len(t, jwks, 2)
+		assert.Equal(t, "RSA", jwks[0].KeyType)
+		assert.Equal(t, "AQAB", jwks[0].E)
+		assert.Equal(t, "OKP", jwks[1].KeyType)
+		assert.Equal(t, "Ed25519", jwks[1].Curve)
+	})
+}
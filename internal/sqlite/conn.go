@@ -0,0 +1,54 @@
+//go:build cgo
+
+package sqlite
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// conn is a connection of the driver converting the times of the queries
+type conn struct {
+	*sqlite3.SQLiteConn
+}
+
+func wrapConn(c driver.Conn) driver.Conn {
+	return &conn{c.(*sqlite3.SQLiteConn)}
+}
+
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	return checkNamedValue(nv)
+}
+
+// IsUniqueViolation reports whether err violates the unique index or the
+// primary key of the column, in the form "table.column", or the unique index
+// on an expression, in the form "index 'name'"
+func IsUniqueViolation(err error, column string) bool {
+	var sqliteErr sqlite3.Error
+
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+
+	if sqliteErr.ExtendedCode != sqlite3.ErrConstraintUnique && sqliteErr.ExtendedCode != sqlite3.ErrConstraintPrimaryKey {
+		return false
+	}
+
+	// The message lists the columns of the constraint
+	return strings.HasSuffix(sqliteErr.Error(), " "+column)
+}
+
+// IsBusy reports whether err is a lock of the database by another connection
+// that outlasted the busy timeout, the transaction can be run again
+func IsBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+
+	return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+}
@@ -0,0 +1,18 @@
+//go:build !cgo
+
+package sqlite
+
+import "database/sql/driver"
+
+// The driver requires cgo, without cgo it fails to open the connections
+func wrapConn(c driver.Conn) driver.Conn {
+	return c
+}
+
+func IsUniqueViolation(err error, column string) bool {
+	return false
+}
+
+func IsBusy(err error) bool {
+	return false
+}
@@ -0,0 +1,58 @@
+// Package sqlite registers the SQLite driver of the service, it is the driver of
+// github.com/mattn/go-sqlite3 with the times of the queries converted to UTC, so
+// the times stored as text are compared in the same time zone. The arguments are
+// bound to the $1, $2... placeholders of Postgres by their number, SQLite numbers
+// them in the order they first appear in the query
+package sqlite
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"strconv"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// DriverName is the name of the driver for sql.Open
+const DriverName = "sqlite"
+
+func init() {
+	sql.Register(DriverName, &Driver{})
+}
+
+type Driver struct {
+	sqlite3.SQLiteDriver
+}
+
+func (d *Driver) Open(dsn string) (driver.Conn, error) {
+	c, err := d.SQLiteDriver.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	return wrapConn(c), nil
+}
+
+// checkNamedValue names the argument by its number and converts the times
+// to UTC, the other values are converted by the default converter
+func checkNamedValue(nv *driver.NamedValue) error {
+	if nv.Name == "" {
+		nv.Name = strconv.Itoa(nv.Ordinal)
+	}
+
+	switch v := nv.Value.(type) {
+	case time.Time:
+		nv.Value = v.UTC()
+		return nil
+	case *time.Time:
+		if v == nil {
+			nv.Value = nil
+		} else {
+			nv.Value = v.UTC()
+		}
+		return nil
+	}
+
+	return driver.ErrSkip
+}
@@ -0,0 +1,127 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+// The COSE algorithms of the public keys (RFC 9053), the same as
+// the algorithms of PublicKeyCredentialParameters in the options
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// The COSE key types and curves
+const (
+	coseKeyTypeOKP = 1
+	coseKeyTypeEC2 = 2
+	coseKeyTypeRSA = 3
+
+	coseCurveP256    = 1
+	coseCurveEd25519 = 6
+)
+
+var ErrUnsupportedKey = errors.New("unsupported public key")
+
+// publicKey verifies the signatures of a credential
+type publicKey interface {
+	verify(message []byte, signature []byte) bool
+}
+
+type ecdsaKey struct {
+	key *ecdsa.PublicKey
+}
+
+func (k ecdsaKey) verify(message []byte, signature []byte) bool {
+	digest := sha256.Sum256(message)
+	return ecdsa.VerifyASN1(k.key, digest[:], signature)
+}
+
+type rsaKey struct {
+	key *rsa.PublicKey
+}
+
+func (k rsaKey) verify(message []byte, signature []byte) bool {
+	digest := sha256.Sum256(message)
+	return rsa.VerifyPKCS1v15(k.key, crypto.SHA256, digest[:], signature) == nil
+}
+
+type ed25519Key struct {
+	key ed25519.PublicKey
+}
+
+func (k ed25519Key) verify(message []byte, signature []byte) bool {
+	return ed25519.Verify(k.key, message, signature)
+}
+
+// parsePublicKey parses a public key in the COSE_Key format,
+// as stored with the credential
+func parsePublicKey(cose []byte) (publicKey, error) {
+	value, rest, err := decodeCBOR(cose)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errInvalidCBOR
+	}
+
+	key, ok := value.(map[interface{}]interface{})
+	if !ok {
+		return nil, ErrUnsupportedKey
+	}
+
+	kty, _ := key[int64(1)].(int64)
+	alg, _ := key[int64(3)].(int64)
+
+	switch {
+	case kty == coseKeyTypeEC2 && alg == AlgES256:
+		crv, _ := key[int64(-1)].(int64)
+		x, _ := key[int64(-2)].([]byte)
+		y, _ := key[int64(-3)].([]byte)
+		if crv != coseCurveP256 || len(x) != 32 || len(y) != 32 {
+			return nil, ErrUnsupportedKey
+		}
+
+		pub := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, ErrUnsupportedKey
+		}
+
+		return ecdsaKey{key: pub}, nil
+	case kty == coseKeyTypeOKP && alg == AlgEdDSA:
+		crv, _ := key[int64(-1)].(int64)
+		x, _ := key[int64(-2)].([]byte)
+		if crv != coseCurveEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, ErrUnsupportedKey
+		}
+
+		return ed25519Key{key: ed25519.PublicKey(x)}, nil
+	case kty == coseKeyTypeRSA && alg == AlgRS256:
+		n, _ := key[int64(-1)].([]byte)
+		e, _ := key[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, ErrUnsupportedKey
+		}
+
+		exponent := 0
+		for _, b := range e {
+			exponent = exponent<<8 | int(b)
+		}
+
+		return rsaKey{key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}}, nil
+	default:
+		return nil, ErrUnsupportedKey
+	}
+}
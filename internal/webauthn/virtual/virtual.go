@@ -0,0 +1,184 @@
+// Package virtual is a software WebAuthn authenticator,
+// it runs the ceremonies in the tests without any hardware
+package virtual
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+
+	"github.com/e-inwork-com/go-user-service/internal/webauthn"
+)
+
+// Authenticator holds a single ES256 credential, the sign count is increased
+// on every assertion, and every ceremony is done with user verification
+type Authenticator struct {
+	RPID         string
+	Origin       string
+	CredentialID []byte
+	Key          *ecdsa.PrivateKey
+	UserHandle   []byte
+	SignCount    uint32
+}
+
+// New creates an authenticator with a random credential
+func New(rpID string, origin string) (*Authenticator, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	credentialID := make([]byte, 32)
+
+	_, err = rand.Read(credentialID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Authenticator{RPID: rpID, Origin: origin, CredentialID: credentialID, Key: key}, nil
+}
+
+// PublicKey returns the public key of the credential in the COSE_Key format
+func (a *Authenticator) PublicKey() []byte {
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	a.Key.X.FillBytes(x)
+	a.Key.Y.FillBytes(y)
+
+	var key []byte
+	key = appendHead(key, 5, 5)
+	key = appendInt(key, 1)
+	key = appendInt(key, 2)
+	key = appendInt(key, 3)
+	key = appendInt(key, webauthn.AlgES256)
+	key = appendInt(key, -1)
+	key = appendInt(key, 1)
+	key = appendInt(key, -2)
+	key = appendBytes(key, x)
+	key = appendInt(key, -3)
+	key = appendBytes(key, y)
+
+	return key
+}
+
+// Register answers the options of a registration ceremony with a "none" attestation
+func (a *Authenticator) Register(options webauthn.CreationOptions) (*webauthn.RegistrationResponse, error) {
+	userHandle, err := webauthn.DecodeID(options.User.ID)
+	if err != nil {
+		return nil, err
+	}
+	a.UserHandle = userHandle
+
+	clientData, err := a.clientData("webauthn.create", options.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	authData := a.authenticatorData(0x45)
+	authData = append(authData, make([]byte, 16)...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.CredentialID)))
+	authData = append(authData, a.CredentialID...)
+	authData = append(authData, a.PublicKey()...)
+
+	var attestation []byte
+	attestation = appendHead(attestation, 5, 3)
+	attestation = appendText(attestation, "fmt")
+	attestation = appendText(attestation, "none")
+	attestation = appendText(attestation, "attStmt")
+	attestation = appendHead(attestation, 5, 0)
+	attestation = appendText(attestation, "authData")
+	attestation = appendBytes(attestation, authData)
+
+	response := &webauthn.RegistrationResponse{
+		ID:    webauthn.EncodeID(a.CredentialID),
+		RawID: webauthn.EncodeID(a.CredentialID),
+		Type:  "public-key",
+	}
+	response.Response.ClientDataJSON = webauthn.EncodeID(clientData)
+	response.Response.AttestationObject = webauthn.EncodeID(attestation)
+	response.Response.Transports = []string{"internal"}
+
+	return response, nil
+}
+
+// Assert answers the options of an authentication ceremony
+func (a *Authenticator) Assert(options webauthn.RequestOptions) (*webauthn.AssertionResponse, error) {
+	clientData, err := a.clientData("webauthn.get", options.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	a.SignCount++
+	authData := a.authenticatorData(0x05)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+
+	signature, err := ecdsa.SignASN1(rand.Reader, a.Key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	response := &webauthn.AssertionResponse{
+		ID:    webauthn.EncodeID(a.CredentialID),
+		RawID: webauthn.EncodeID(a.CredentialID),
+		Type:  "public-key",
+	}
+	response.Response.ClientDataJSON = webauthn.EncodeID(clientData)
+	response.Response.AuthenticatorData = webauthn.EncodeID(authData)
+	response.Response.Signature = webauthn.EncodeID(signature)
+	response.Response.UserHandle = webauthn.EncodeID(a.UserHandle)
+
+	return response, nil
+}
+
+func (a *Authenticator) clientData(ceremony string, challenge string) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"type":        ceremony,
+		"challenge":   challenge,
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+}
+
+func (a *Authenticator) authenticatorData(flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.RPID))
+
+	authData := append([]byte(nil), rpIDHash[:]...)
+	authData = append(authData, flags)
+	authData = binary.BigEndian.AppendUint32(authData, a.SignCount)
+
+	return authData
+}
+
+// appendHead appends the initial bytes of a CBOR item
+func appendHead(b []byte, major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return append(b, major<<5|byte(n))
+	case n <= 0xff:
+		return append(b, major<<5|24, byte(n))
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16(append(b, major<<5|25), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, major<<5|26), uint32(n))
+	}
+}
+
+func appendInt(b []byte, n int64) []byte {
+	if n < 0 {
+		return appendHead(b, 1, uint64(-1-n))
+	}
+	return appendHead(b, 0, uint64(n))
+}
+
+func appendBytes(b []byte, value []byte) []byte {
+	return append(appendHead(b, 2, uint64(len(value))), value...)
+}
+
+func appendText(b []byte, value string) []byte {
+	return append(appendHead(b, 3, uint64(len(value))), value...)
+}
@@ -0,0 +1,415 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	// Timeout is the time given to the user to complete a ceremony
+	Timeout = 5 * time.Minute
+
+	// The flags of the authenticator data
+	flagUserPresent            = 0x01
+	flagUserVerified           = 0x04
+	flagAttestedCredentialData = 0x40
+)
+
+var (
+	ErrInvalidResponse  = errors.New("invalid authenticator response")
+	ErrInvalidChallenge = errors.New("the challenge doesn't match")
+	ErrInvalidOrigin    = errors.New("the origin isn't allowed")
+	ErrInvalidRPID      = errors.New("the relying party ID doesn't match")
+	ErrUserNotVerified  = errors.New("the user wasn't verified by the authenticator")
+	ErrInvalidSignature = errors.New("invalid signature")
+)
+
+// RelyingParty runs the WebAuthn ceremonies of the service,
+// the ID is the domain of the origins that use the credentials
+type RelyingParty struct {
+	ID      string
+	Name    string
+	Origins []string
+}
+
+// User is the user entity of the credentials,
+// the ID is the user handle returned by discoverable credentials
+type User struct {
+	ID          []byte
+	Name        string
+	DisplayName string
+}
+
+// Credential is a public key credential created by an authenticator
+type Credential struct {
+	ID         []byte
+	PublicKey  []byte
+	SignCount  uint32
+	AAGUID     []byte
+	Transports []string
+}
+
+// Assertion is the result of a verified authentication ceremony
+type Assertion struct {
+	CredentialID []byte
+	UserHandle   []byte
+	SignCount    uint32
+}
+
+// The options are sent as the JSON form of PublicKeyCredentialCreationOptions
+// and PublicKeyCredentialRequestOptions, a browser reads them with
+// PublicKeyCredential.parseCreationOptionsFromJSON() and parseRequestOptionsFromJSON()
+type CreationOptions struct {
+	Challenge              string                 `json:"challenge"`
+	RP                     RPEntity               `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	PubKeyCredParams       []CredentialParameters `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+type RPEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type UserEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type CredentialParameters struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// The responses are the JSON form of PublicKeyCredential, as sent by
+// PublicKeyCredential.toJSON(), the binary values are base64url encoded
+type RegistrationResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string   `json:"clientDataJSON"`
+		AttestationObject string   `json:"attestationObject"`
+		Transports        []string `json:"transports,omitempty"`
+	} `json:"response"`
+}
+
+type AssertionResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle,omitempty"`
+	} `json:"response"`
+}
+
+// EncodeID encodes a binary value in base64url without padding
+func EncodeID(id []byte) string {
+	return base64.RawURLEncoding.EncodeToString(id)
+}
+
+// DecodeID decodes a base64url value with or without padding
+func DecodeID(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// NewChallenge creates a random challenge of 256 bits
+func NewChallenge() (string, error) {
+	challenge := make([]byte, 32)
+
+	_, err := rand.Read(challenge)
+	if err != nil {
+		return "", err
+	}
+
+	return EncodeID(challenge), nil
+}
+
+func descriptors(credentials []Credential) []CredentialDescriptor {
+	list := make([]CredentialDescriptor, 0, len(credentials))
+
+	for _, credential := range credentials {
+		list = append(list, CredentialDescriptor{
+			Type:       "public-key",
+			ID:         EncodeID(credential.ID),
+			Transports: credential.Transports,
+		})
+	}
+
+	return list
+}
+
+// CreationOptions creates the options of a registration ceremony, a discoverable
+// credential with user verification is required to sign in without a password,
+// and the existing credentials of the user are excluded
+func (rp *RelyingParty) CreationOptions(challenge string, user User, exclude []Credential) CreationOptions {
+	return CreationOptions{
+		Challenge: challenge,
+		RP:        RPEntity{ID: rp.ID, Name: rp.Name},
+		User: UserEntity{
+			ID:          EncodeID(user.ID),
+			Name:        user.Name,
+			DisplayName: user.DisplayName,
+		},
+		PubKeyCredParams: []CredentialParameters{
+			{Type: "public-key", Alg: AlgES256},
+			{Type: "public-key", Alg: AlgEdDSA},
+			{Type: "public-key", Alg: AlgRS256},
+		},
+		Timeout:            Timeout.Milliseconds(),
+		ExcludeCredentials: descriptors(exclude),
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "required",
+			UserVerification: "required",
+		},
+		Attestation: "none",
+	}
+}
+
+// RequestOptions creates the options of an authentication ceremony,
+// without allowed credentials the authenticator offers its discoverable credentials
+func (rp *RelyingParty) RequestOptions(challenge string, allow []Credential) RequestOptions {
+	return RequestOptions{
+		Challenge:        challenge,
+		Timeout:          Timeout.Milliseconds(),
+		RPID:             rp.ID,
+		AllowCredentials: descriptors(allow),
+		UserVerification: "required",
+	}
+}
+
+// VerifyRegistration verifies the response of a registration ceremony, and returns
+// the new credential. The service asks for no attestation, so the attestation
+// statement isn't verified and any authenticator is accepted
+func (rp *RelyingParty) VerifyRegistration(challenge string, response *RegistrationResponse) (*Credential, error) {
+	if response.Type != "public-key" {
+		return nil, ErrInvalidResponse
+	}
+
+	clientData, err := DecodeID(response.Response.ClientDataJSON)
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+
+	err = rp.verifyClientData(clientData, "webauthn.create", challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	attestation, err := DecodeID(response.Response.AttestationObject)
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+
+	value, _, err := decodeCBOR(attestation)
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+
+	object, ok := value.(map[interface{}]interface{})
+	if !ok {
+		return nil, ErrInvalidResponse
+	}
+
+	authData, ok := object["authData"].([]byte)
+	if !ok {
+		return nil, ErrInvalidResponse
+	}
+
+	flags, signCount, rest, err := rp.parseAuthenticatorData(authData)
+	if err != nil {
+		return nil, err
+	}
+
+	if flags&flagAttestedCredentialData == 0 || len(rest) < 18 {
+		return nil, ErrInvalidResponse
+	}
+
+	// The attested credential data is the AAGUID, the length of the credential ID,
+	// the credential ID, and the public key, it can be followed by extensions
+	aaguid := rest[:16]
+	length := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+
+	if length == 0 || length > 1023 || len(rest) < length {
+		return nil, ErrInvalidResponse
+	}
+
+	credentialID := rest[:length]
+	rest = rest[length:]
+
+	_, extensions, err := decodeCBOR(rest)
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+
+	cose := rest[:len(rest)-len(extensions)]
+
+	_, err = parsePublicKey(cose)
+	if err != nil {
+		return nil, err
+	}
+
+	// The ID of the response must be the attested credential
+	rawID, err := DecodeID(response.RawID)
+	if err != nil || !bytes.Equal(rawID, credentialID) {
+		return nil, ErrInvalidResponse
+	}
+
+	credential := &Credential{
+		ID:         append([]byte(nil), credentialID...),
+		PublicKey:  append([]byte(nil), cose...),
+		SignCount:  signCount,
+		AAGUID:     append([]byte(nil), aaguid...),
+		Transports: response.Response.Transports,
+	}
+
+	return credential, nil
+}
+
+// VerifyAssertion verifies the response of an authentication ceremony with the public key
+// of the credential, the caller checks the sign count against the stored sign count
+func (rp *RelyingParty) VerifyAssertion(challenge string, publicKey []byte, response *AssertionResponse) (*Assertion, error) {
+	if response.Type != "public-key" {
+		return nil, ErrInvalidResponse
+	}
+
+	clientData, err := DecodeID(response.Response.ClientDataJSON)
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+
+	err = rp.verifyClientData(clientData, "webauthn.get", challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	authData, err := DecodeID(response.Response.AuthenticatorData)
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+
+	_, signCount, _, err := rp.parseAuthenticatorData(authData)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := DecodeID(response.Response.Signature)
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+
+	key, err := parsePublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// The signature is over the authenticator data and the hash of the client data
+	clientDataHash := sha256.Sum256(clientData)
+	message := append(append([]byte(nil), authData...), clientDataHash[:]...)
+
+	if !key.verify(message, signature) {
+		return nil, ErrInvalidSignature
+	}
+
+	credentialID, err := DecodeID(response.RawID)
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+
+	userHandle, err := DecodeID(response.Response.UserHandle)
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+
+	assertion := &Assertion{
+		CredentialID: credentialID,
+		UserHandle:   userHandle,
+		SignCount:    signCount,
+	}
+
+	return assertion, nil
+}
+
+// verifyClientData checks the type, the challenge and the origin of the client data
+func (rp *RelyingParty) verifyClientData(clientData []byte, ceremony string, challenge string) error {
+	var data struct {
+		Type      string `json:"type"`
+		Challenge string `json:"challenge"`
+		Origin    string `json:"origin"`
+	}
+
+	err := json.Unmarshal(clientData, &data)
+	if err != nil || data.Type != ceremony {
+		return ErrInvalidResponse
+	}
+
+	if challenge == "" || subtle.ConstantTimeCompare([]byte(data.Challenge), []byte(challenge)) != 1 {
+		return ErrInvalidChallenge
+	}
+
+	for _, origin := range rp.Origins {
+		if data.Origin == origin {
+			return nil
+		}
+	}
+
+	return ErrInvalidOrigin
+}
+
+// parseAuthenticatorData checks the hash of the relying party ID, and that the user
+// was present and verified, it returns the flags, the sign count and the remaining data
+func (rp *RelyingParty) parseAuthenticatorData(authData []byte) (byte, uint32, []byte, error) {
+	if len(authData) < 37 {
+		return 0, 0, nil, ErrInvalidResponse
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if subtle.ConstantTimeCompare(authData[:32], rpIDHash[:]) != 1 {
+		return 0, 0, nil, ErrInvalidRPID
+	}
+
+	flags := authData[32]
+	if flags&flagUserPresent == 0 || flags&flagUserVerified == 0 {
+		return 0, 0, nil, ErrUserNotVerified
+	}
+
+	signCount := binary.BigEndian.Uint32(authData[33:37])
+
+	return flags, signCount, authData[37:], nil
+}
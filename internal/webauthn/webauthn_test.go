@@ -0,0 +1,88 @@
+package webauthn_test
+
+import (
+	"testing"
+
+	"github.com/e-inwork-com/go-user-service/internal/webauthn"
+	"github.com/e-inwork-com/go-user-service/internal/webauthn/virtual"
+	"github.com/stretchr/testify/assert"
+)
+
+func testRelyingParty() *webauthn.RelyingParty {
+	return &webauthn.RelyingParty{
+		ID:      "localhost",
+		Name:    "e-inwork",
+		Origins: []string{"https://localhost"},
+	}
+}
+
+func TestRegistration(t *testing.T) {
+	rp := testRelyingParty()
+
+	authenticator, err := virtual.New("localhost", "https://localhost")
+	assert.Nil(t, err)
+
+	challenge, err := webauthn.NewChallenge()
+	assert.Nil(t, err)
+
+	options := rp.CreationOptions(challenge, webauthn.User{ID: []byte("user"), Name: "jon@doe.com"}, nil)
+
+	response, err := authenticator.Register(options)
+	assert.Nil(t, err)
+
+	credential, err := rp.VerifyRegistration(challenge, response)
+	assert.Nil(t, err)
+	assert.Equal(t, authenticator.CredentialID, credential.ID)
+	assert.Equal(t, authenticator.PublicKey(), credential.PublicKey)
+	assert.Equal(t, []string{"internal"}, credential.Transports)
+
+	// The challenge of another ceremony is rejected
+	other, err := webauthn.NewChallenge()
+	assert.Nil(t, err)
+
+	_, err = rp.VerifyRegistration(other, response)
+	assert.ErrorIs(t, err, webauthn.ErrInvalidChallenge)
+
+	// The credential is scoped to the relying party ID
+	rp.ID = "example.com"
+	_, err = rp.VerifyRegistration(challenge, response)
+	assert.ErrorIs(t, err, webauthn.ErrInvalidRPID)
+}
+
+func TestAssertion(t *testing.T) {
+	rp := testRelyingParty()
+
+	authenticator, err := virtual.New("localhost", "https://localhost")
+	assert.Nil(t, err)
+	authenticator.UserHandle = []byte("user")
+
+	challenge, err := webauthn.NewChallenge()
+	assert.Nil(t, err)
+
+	options := rp.RequestOptions(challenge, nil)
+
+	response, err := authenticator.Assert(options)
+	assert.Nil(t, err)
+
+	assertion, err := rp.VerifyAssertion(challenge, authenticator.PublicKey(), response)
+	assert.Nil(t, err)
+	assert.Equal(t, authenticator.CredentialID, assertion.CredentialID)
+	assert.Equal(t, []byte("user"), assertion.UserHandle)
+	assert.Equal(t, uint32(1), assertion.SignCount)
+
+	// The signature of another credential is rejected
+	other, err := virtual.New("localhost", "https://localhost")
+	assert.Nil(t, err)
+
+	_, err = rp.VerifyAssertion(challenge, other.PublicKey(), response)
+	assert.ErrorIs(t, err, webauthn.ErrInvalidSignature)
+
+	// An origin that isn't allowed is rejected
+	authenticator.Origin = "https://example.com"
+
+	response, err = authenticator.Assert(options)
+	assert.Nil(t, err)
+
+	_, err = rp.VerifyAssertion(challenge, authenticator.PublicKey(), response)
+	assert.ErrorIs(t, err, webauthn.ErrInvalidOrigin)
+}
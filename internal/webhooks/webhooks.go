@@ -0,0 +1,193 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
+	"github.com/e-inwork-com/go-user-service/internal/encryption"
+	"github.com/e-inwork-com/go-user-service/internal/jsonlog"
+)
+
+// The headers of a delivery, the receiver checks the signature of the
+// timestamp and the body, and skips the event IDs it already received
+const (
+	HeaderEventID   = "X-Webhook-Id"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Sign returns the signature of a delivery, the HMAC-SHA256
+// of "<timestamp>.<body>" with the secret of the subscription
+func Sign(secret []byte, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatcher sends the pending deliveries to the webhooks, a failed delivery is
+// sent again after Backoff doubled on every attempt up to MaxBackoff, and it is
+// dead after MaxAttempts attempts
+type Dispatcher struct {
+	Deliveries data.WebhookDeliveryModelInterface
+	Cipher     *encryption.Cipher
+	Client     *http.Client
+	Logger     *jsonlog.Logger
+
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+
+	// BatchSize deliveries are claimed at a time, and are sent again
+	// after Lease if the worker stops before sending them
+	BatchSize int
+	Lease     time.Duration
+
+	// Interval is the wait of a worker without pending deliveries
+	Interval time.Duration
+}
+
+// Work sends the deliveries until the stop channel is closed,
+// the deliveries are shared by the workers of every instance
+func (d *Dispatcher) Work(stop <-chan struct{}) {
+	batchSize := d.BatchSize
+	if batchSize < 1 {
+		batchSize = 10
+	}
+
+	interval := d.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	for {
+		deliveries, err := d.Deliveries.Claim(batchSize, d.Lease)
+		if err != nil {
+			d.Logger.PrintError(err, nil)
+		}
+
+		for _, delivery := range deliveries {
+			// The deliveries left are sent again after the lease
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			err = d.Deliver(delivery)
+			if err != nil {
+				d.Logger.PrintError(err, map[string]string{
+					"delivery": strconv.FormatInt(delivery.ID, 10),
+				})
+			}
+		}
+
+		// Claim the next deliveries at once after a full batch
+		if len(deliveries) >= batchSize {
+			select {
+			case <-stop:
+				return
+			default:
+				continue
+			}
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Deliver sends the delivery, and records the result of the attempt
+func (d *Dispatcher) Deliver(delivery *data.WebhookDelivery) error {
+	now := time.Now()
+
+	status, err := d.send(delivery, now)
+
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	delivery.LastStatus = nil
+	delivery.LastError = ""
+
+	if status != 0 {
+		delivery.LastStatus = &status
+	}
+
+	switch {
+	case err == nil:
+		delivery.Status = data.WebhookDeliverySucceeded
+	case delivery.Attempts >= d.MaxAttempts:
+		delivery.Status = data.WebhookDeliveryDead
+		delivery.LastError = err.Error()
+	default:
+		delivery.Status = data.WebhookDeliveryPending
+		delivery.NextAttemptAt = now.Add(d.backoff(delivery.Attempts))
+		delivery.LastError = err.Error()
+	}
+
+	return d.Deliveries.Record(delivery)
+}
+
+// backoff returns the delay after the failed attempts
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.Backoff
+	for i := 1; i < attempts && (d.MaxBackoff <= 0 || delay < d.MaxBackoff); i++ {
+		delay *= 2
+	}
+
+	if d.MaxBackoff > 0 && delay > d.MaxBackoff {
+		delay = d.MaxBackoff
+	}
+
+	return delay
+}
+
+// send posts the payload signed with the secret of the subscription,
+// and returns the status of the response
+func (d *Dispatcher) send(delivery *data.WebhookDelivery, now time.Time) (int, error) {
+	secret, err := d.Cipher.Decrypt(delivery.Secret)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := now.Unix()
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEventID, delivery.EventID.String())
+	req.Header.Set(HeaderEvent, delivery.Type)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(secret, timestamp, delivery.Payload))
+
+	res, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	// Read the body so the connection is reused
+	io.Copy(io.Discard, io.LimitReader(res.Body, 4096))
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, fmt.Errorf("webhook answered with status %d", res.StatusCode)
+	}
+
+	return res.StatusCode, nil
+}
@@ -0,0 +1,204 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/e-inwork-com/go-user-service/internal/data"
+	"github.com/e-inwork-com/go-user-service/internal/encryption"
+	"github.com/e-inwork-com/go-user-service/internal/jsonlog"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// testDeliveries keeps the deliveries in memory like the deliveries table
+type testDeliveries struct {
+	mu         sync.Mutex
+	deliveries []*data.WebhookDelivery
+}
+
+func (m *testDeliveries) GetAllForSubscription(subscriptionID uuid.UUID, status string, filters data.Filters) ([]*data.WebhookDelivery, data.Metadata, error) {
+	return nil, data.Metadata{}, nil
+}
+
+func (m *testDeliveries) Replay(subscriptionID uuid.UUID, id int64) error {
+	return nil
+}
+
+func (m *testDeliveries) Claim(limit int, lease time.Duration) ([]*data.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var claimed []*data.WebhookDelivery
+
+	for _, delivery := range m.deliveries {
+		if len(claimed) < limit && delivery.Status == data.WebhookDeliveryPending && !delivery.NextAttemptAt.After(time.Now()) {
+			delivery.NextAttemptAt = time.Now().Add(lease)
+			c := *delivery
+			claimed = append(claimed, &c)
+		}
+	}
+
+	return claimed, nil
+}
+
+func (m *testDeliveries) Record(delivery *data.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.deliveries {
+		if m.deliveries[i].ID == delivery.ID {
+			c := *delivery
+			m.deliveries[i] = &c
+		}
+	}
+
+	return nil
+}
+
+func (m *testDeliveries) get(id int64) data.WebhookDelivery {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, delivery := range m.deliveries {
+		if delivery.ID == id {
+			return *delivery
+		}
+	}
+
+	return data.WebhookDelivery{}
+}
+
+func testDispatcher(t *testing.T, deliveries data.WebhookDeliveryModelInterface) *Dispatcher {
+	cipher, err := encryption.New(make([]byte, 32))
+	assert.Nil(t, err)
+
+	return &Dispatcher{
+		Deliveries:  deliveries,
+		Cipher:      cipher,
+		Client:      &http.Client{Timeout: time.Second},
+		Logger:      jsonlog.New(io.Discard, jsonlog.LevelOff),
+		MaxAttempts: 3,
+		Backoff:     time.Millisecond,
+		MaxBackoff:  4 * time.Millisecond,
+		BatchSize:   10,
+		Lease:       time.Minute,
+		Interval:    time.Millisecond,
+	}
+}
+
+func testDelivery(t *testing.T, d *Dispatcher, id int64, url string) *data.WebhookDelivery {
+	secret, err := d.Cipher.Encrypt([]byte("secret"))
+	assert.Nil(t, err)
+
+	return &data.WebhookDelivery{
+		ID:            id,
+		EventID:       uuid.New(),
+		Type:          data.EventUserCreated,
+		Payload:       json.RawMessage(`{"type":"user.created"}`),
+		Status:        data.WebhookDeliveryPending,
+		NextAttemptAt: time.Now(),
+		URL:           url,
+		Secret:        secret,
+	}
+}
+
+func TestSign(t *testing.T) {
+	// echo -n '1700000000.{}' | openssl dgst -sha256 -hmac secret
+	assert.Equal(t, "sha256=b8569b78799ff9e3cbff0fc2d63a33a2b57f3282abd07c37ae5e8e7d79a5f163", Sign([]byte("secret"), 1700000000, []byte("{}")))
+	assert.NotEqual(t, Sign([]byte("secret"), 1700000000, []byte("{}")), Sign([]byte("secret"), 1700000001, []byte("{}")))
+	assert.NotEqual(t, Sign([]byte("secret"), 1700000000, []byte("{}")), Sign([]byte("other"), 1700000000, []byte("{}")))
+}
+
+func TestDeliver(t *testing.T) {
+	store := &testDeliveries{}
+	d := testDispatcher(t, store)
+
+	var delivery *data.WebhookDelivery
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		timestamp, err := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+		assert.Nil(t, err)
+		assert.InDelta(t, time.Now().Unix(), timestamp, 5)
+		assert.Equal(t, Sign([]byte("secret"), timestamp, body), r.Header.Get(HeaderSignature))
+		assert.Equal(t, delivery.EventID.String(), r.Header.Get(HeaderEventID))
+		assert.Equal(t, "user.created", r.Header.Get(HeaderEvent))
+		assert.JSONEq(t, `{"type":"user.created"}`, string(body))
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	delivery = testDelivery(t, d, 1, ts.URL)
+	store.deliveries = append(store.deliveries, delivery)
+
+	assert.Nil(t, d.Deliver(delivery))
+
+	recorded := store.get(1)
+	assert.Equal(t, data.WebhookDeliverySucceeded, recorded.Status)
+	assert.Equal(t, 1, recorded.Attempts)
+	assert.Equal(t, http.StatusNoContent, *recorded.LastStatus)
+	assert.Empty(t, recorded.LastError)
+}
+
+func TestDeadLetter(t *testing.T) {
+	store := &testDeliveries{}
+	d := testDispatcher(t, store)
+
+	var mu sync.Mutex
+	requests := 0
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer ts.Close()
+
+	store.deliveries = append(store.deliveries, testDelivery(t, d, 1, ts.URL))
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		d.Work(stop)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool {
+		return store.get(1).Status == data.WebhookDeliveryDead
+	}, 2*time.Second, time.Millisecond)
+
+	close(stop)
+	<-done
+
+	// The delivery is dead after the maximum attempts
+	recorded := store.get(1)
+	assert.Equal(t, 3, recorded.Attempts)
+	assert.Equal(t, http.StatusBadGateway, *recorded.LastStatus)
+	assert.Contains(t, recorded.LastError, "502")
+
+	mu.Lock()
+	assert.Equal(t, 3, requests)
+	mu.Unlock()
+}
+
+func TestBackoff(t *testing.T) {
+	d := &Dispatcher{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+
+	assert.Equal(t, time.Second, d.backoff(1))
+	assert.Equal(t, 2*time.Second, d.backoff(2))
+	assert.Equal(t, 4*time.Second, d.backoff(3))
+	assert.Equal(t, 5*time.Second, d.backoff(4))
+	assert.Equal(t, 5*time.Second, d.backoff(10))
+}
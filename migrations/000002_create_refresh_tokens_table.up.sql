@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    hash bytea PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+    family_id UUID NOT NULL,
+    created_at_dt timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    expiry_dt timestamp(0) with time zone NOT NULL,
+    used_b bool NOT NULL DEFAULT false,
+    revoked_b bool NOT NULL DEFAULT false
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+CREATE INDEX IF NOT EXISTS refresh_tokens_user_id_idx ON refresh_tokens (user_id);
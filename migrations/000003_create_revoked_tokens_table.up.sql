@@ -0,0 +1,9 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tokens_valid_after_dt timestamp(0) with time zone NOT NULL DEFAULT to_timestamp(0);
+
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    jti text PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+    expiry_dt timestamp(0) with time zone NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS revoked_tokens_expiry_dt_idx ON revoked_tokens (expiry_dt);
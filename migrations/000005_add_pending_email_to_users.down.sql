@@ -0,0 +1 @@
+ALTER TABLE users DROP COLUMN IF EXISTS pending_email_t;
\ No newline at end of file
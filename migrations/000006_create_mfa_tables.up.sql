@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id UUID PRIMARY KEY REFERENCES users ON DELETE CASCADE,
+    created_at_dt timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    secret_ciphertext bytea NOT NULL,
+    enabled_b bool NOT NULL DEFAULT false,
+    last_used_step bigint NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    hash bytea PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+    used_at_dt timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS recovery_codes_user_id_idx ON recovery_codes (user_id);
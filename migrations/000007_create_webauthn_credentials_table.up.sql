@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+    id bytea PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at_dt timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name_t text NOT NULL DEFAULT '',
+    public_key bytea NOT NULL,
+    sign_count bigint NOT NULL DEFAULT 0,
+    aaguid bytea NOT NULL,
+    transports_t text NOT NULL DEFAULT '',
+    last_used_at_dt timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS webauthn_credentials_user_id_idx ON webauthn_credentials (user_id);
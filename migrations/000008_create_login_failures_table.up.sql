@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS login_failures (
+    key_t text PRIMARY KEY,
+    failures integer NOT NULL DEFAULT 0,
+    last_failure_dt timestamp with time zone NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS login_failures_last_failure_dt_idx ON login_failures (last_failure_dt);
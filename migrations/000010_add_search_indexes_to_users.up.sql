@@ -0,0 +1,6 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS users_search_idx ON users USING GIN (to_tsvector('simple', first_name_t || ' ' || last_name_t || ' ' || email_t));
+CREATE INDEX IF NOT EXISTS users_first_name_trgm_idx ON users USING GIN (first_name_t gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS users_last_name_trgm_idx ON users USING GIN (last_name_t gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS users_email_trgm_idx ON users USING GIN (email_t gin_trgm_ops);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS outbox (
+    id bigserial PRIMARY KEY,
+    event_id UUID UNIQUE NOT NULL DEFAULT gen_random_uuid(),
+    type_t text NOT NULL,
+    user_id UUID NOT NULL,
+    created_at_dt timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    payload jsonb NOT NULL,
+    published_at_dt timestamp(0) with time zone,
+    attempts integer NOT NULL DEFAULT 0,
+    last_error_t text
+);
+
+CREATE INDEX IF NOT EXISTS outbox_unpublished_idx ON outbox (id) WHERE published_at_dt IS NULL;
+CREATE INDEX IF NOT EXISTS outbox_published_at_dt_idx ON outbox (published_at_dt);
@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id UUID PRIMARY KEY NOT NULL DEFAULT gen_random_uuid(),
+    created_at_dt timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    url_t text NOT NULL,
+    events text[] NOT NULL,
+    secret bytea NOT NULL,
+    active_b bool NOT NULL DEFAULT true,
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id bigserial PRIMARY KEY,
+    subscription_id UUID NOT NULL REFERENCES webhook_subscriptions ON DELETE CASCADE,
+    event_id UUID NOT NULL,
+    type_t text NOT NULL,
+    payload jsonb NOT NULL,
+    created_at_dt timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    status_t text NOT NULL DEFAULT 'pending',
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at_dt timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    last_attempt_at_dt timestamp(0) with time zone,
+    last_status integer,
+    last_error_t text,
+    UNIQUE (subscription_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_pending_idx ON webhook_deliveries (next_attempt_at_dt) WHERE status_t = 'pending';
+CREATE INDEX IF NOT EXISTS webhook_deliveries_subscription_id_idx ON webhook_deliveries (subscription_id, id);
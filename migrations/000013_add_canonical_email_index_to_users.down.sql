@@ -0,0 +1,3 @@
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email_t);
+DROP INDEX IF EXISTS users_email_canonical_key;
+ALTER TABLE users DROP COLUMN IF EXISTS email_canonical_t;
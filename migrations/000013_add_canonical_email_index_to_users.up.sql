@@ -0,0 +1,32 @@
+-- The emails are unique by their canonical email, the email with the domain and
+-- the local part in lowercase. The users with the same canonical email are reported
+-- and the migration fails until they are merged or renamed. The service keeps the
+-- canonical emails, and rebuilds them on startup when the local parts are case-sensitive
+DO $$
+DECLARE
+    collisions text;
+BEGIN
+    SELECT string_agg(emails, '; ') INTO collisions
+    FROM (
+        SELECT string_agg(email_t, ', ' ORDER BY created_at_dt) AS emails
+        FROM users
+        GROUP BY lower(email_t)
+        HAVING count(*) > 1
+    ) AS canonical;
+
+    IF collisions IS NOT NULL THEN
+        RAISE EXCEPTION 'users with the same canonical email: %', collisions
+            USING HINT = 'merge or rename the users, then migrate again';
+    END IF;
+END $$;
+
+-- The domains are stored in lowercase
+UPDATE users SET email_t = split_part(email_t, '@', 1) || '@' || lower(split_part(email_t, '@', 2))
+WHERE split_part(email_t, '@', 2) <> lower(split_part(email_t, '@', 2));
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_canonical_t text;
+UPDATE users SET email_canonical_t = lower(email_t);
+ALTER TABLE users ALTER COLUMN email_canonical_t SET NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_canonical_key ON users (email_canonical_t);
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
@@ -0,0 +1,10 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at_dt timestamp(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS users_deleted_at_dt_idx ON users (deleted_at_dt) WHERE deleted_at_dt IS NOT NULL;
+
+-- The purged users are recorded without their personal data
+CREATE TABLE IF NOT EXISTS user_purges (
+    user_id UUID PRIMARY KEY NOT NULL,
+    deleted_at_dt timestamp(0) with time zone NOT NULL,
+    purged_at_dt timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
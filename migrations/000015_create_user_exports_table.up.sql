@@ -0,0 +1,13 @@
+-- The archives of the personal data exports, kept until they expire
+CREATE TABLE IF NOT EXISTS user_exports (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+    status_t text NOT NULL,
+    created_at_dt timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    completed_at_dt timestamp(0) with time zone,
+    expires_at_dt timestamp(0) with time zone NOT NULL,
+    archive bytea
+);
+
+CREATE INDEX IF NOT EXISTS user_exports_user_id_idx ON user_exports (user_id);
+CREATE INDEX IF NOT EXISTS user_exports_expires_at_dt_idx ON user_exports (expires_at_dt);
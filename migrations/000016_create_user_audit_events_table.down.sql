@@ -0,0 +1,6 @@
+DROP TRIGGER IF EXISTS users_roles_audit ON users_roles;
+DROP FUNCTION IF EXISTS users_roles_audit();
+DROP TABLE IF EXISTS user_audit_events;
+DROP FUNCTION IF EXISTS user_audit_events_append_only();
+
+-- The user_audit_pruner role is kept, the other databases of the cluster may use it
@@ -0,0 +1,70 @@
+-- The events of the accounts are only appended, they outlive the purge
+-- of their user and are only deleted after their retention
+CREATE TABLE IF NOT EXISTS user_audit_events (
+    id bigserial PRIMARY KEY,
+    user_id UUID NOT NULL,
+    actor_id UUID,
+    type_t text NOT NULL,
+    details_t text NOT NULL DEFAULT '',
+    ip_t text NOT NULL DEFAULT '',
+    user_agent_t text NOT NULL DEFAULT '',
+    created_at_dt timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS user_audit_events_user_id_idx ON user_audit_events (user_id, created_at_dt DESC, id DESC);
+CREATE INDEX IF NOT EXISTS user_audit_events_created_at_dt_idx ON user_audit_events (created_at_dt);
+
+-- Only the pruner of the retention deletes the events, the service
+-- takes its role for the deletion. The role is shared by the databases
+-- of the cluster, so it may already exist
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = 'user_audit_pruner') THEN
+        CREATE ROLE user_audit_pruner NOLOGIN;
+    END IF;
+END
+$$;
+
+GRANT SELECT, DELETE ON user_audit_events TO user_audit_pruner;
+GRANT user_audit_pruner TO CURRENT_USER;
+
+CREATE OR REPLACE FUNCTION user_audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' AND current_user = 'user_audit_pruner' THEN
+        RETURN OLD;
+    END IF;
+
+    RAISE EXCEPTION 'user_audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER user_audit_events_append_only BEFORE UPDATE OR DELETE ON user_audit_events
+FOR EACH ROW EXECUTE FUNCTION user_audit_events_append_only();
+
+CREATE TRIGGER user_audit_events_truncate BEFORE TRUNCATE ON user_audit_events
+FOR EACH STATEMENT EXECUTE FUNCTION user_audit_events_append_only();
+
+-- The roles are given in SQL, so their changes are recorded by a trigger,
+-- the roles removed with a purged user aren't recorded
+CREATE OR REPLACE FUNCTION users_roles_audit() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO user_audit_events (user_id, type_t, details_t)
+        SELECT NEW.user_id, 'role.added', roles.name_t
+        FROM roles
+        WHERE roles.id = NEW.role_id;
+
+        RETURN NEW;
+    END IF;
+
+    INSERT INTO user_audit_events (user_id, type_t, details_t)
+    SELECT OLD.user_id, 'role.removed', roles.name_t
+    FROM roles, users
+    WHERE roles.id = OLD.role_id AND users.id = OLD.user_id;
+
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER users_roles_audit AFTER INSERT OR DELETE ON users_roles
+FOR EACH ROW EXECUTE FUNCTION users_roles_audit();
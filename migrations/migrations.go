@@ -0,0 +1,17 @@
+// Package migrations embeds the SQL migrations in the service, the migrations
+// of Postgres are in this directory and the migrations of SQLite in sqlite
+package migrations
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed *.sql sqlite/*.sql
+var files embed.FS
+
+// Postgres are the migrations of Postgres
+var Postgres fs.FS = files
+
+// SQLite are the migrations of SQLite
+var SQLite, _ = fs.Sub(files, "sqlite")
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS users (
+    id text PRIMARY KEY NOT NULL,
+    created_at_dt timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+    email_t text UNIQUE NOT NULL,
+    password_hash blob NOT NULL,
+    first_name_t varchar(100) NOT NULL,
+    last_name_t varchar(100) NOT NULL,
+    activated_b boolean NOT NULL DEFAULT false,
+    version integer NOT NULL DEFAULT 1
+);
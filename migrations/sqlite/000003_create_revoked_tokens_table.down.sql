@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS revoked_tokens;
+
+ALTER TABLE users DROP COLUMN tokens_valid_after_dt;
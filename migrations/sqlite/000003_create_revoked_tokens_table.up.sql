@@ -0,0 +1,9 @@
+ALTER TABLE users ADD COLUMN tokens_valid_after_dt timestamp NOT NULL DEFAULT '1970-01-01 00:00:00+00:00';
+
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    jti text PRIMARY KEY,
+    user_id text NOT NULL REFERENCES users ON DELETE CASCADE,
+    expiry_dt timestamp NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS revoked_tokens_expiry_dt_idx ON revoked_tokens (expiry_dt);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+    id blob PRIMARY KEY,
+    user_id text NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at_dt timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+    name_t text NOT NULL DEFAULT '',
+    public_key blob NOT NULL,
+    sign_count integer NOT NULL DEFAULT 0,
+    aaguid blob NOT NULL,
+    transports_t text NOT NULL DEFAULT '',
+    last_used_at_dt timestamp
+);
+
+CREATE INDEX IF NOT EXISTS webauthn_credentials_user_id_idx ON webauthn_credentials (user_id);
@@ -0,0 +1,36 @@
+CREATE TABLE IF NOT EXISTS permissions (
+    id integer PRIMARY KEY,
+    code text UNIQUE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS roles (
+    id integer PRIMARY KEY,
+    name_t text UNIQUE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS roles_permissions (
+    role_id integer NOT NULL REFERENCES roles ON DELETE CASCADE,
+    permission_id integer NOT NULL REFERENCES permissions ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS users_roles (
+    user_id text NOT NULL REFERENCES users ON DELETE CASCADE,
+    role_id integer NOT NULL REFERENCES roles ON DELETE CASCADE,
+    PRIMARY KEY (user_id, role_id)
+);
+
+INSERT INTO permissions (code)
+VALUES ('users:read'), ('users:write'), ('users:admin')
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO roles (name_t)
+VALUES ('support'), ('admin')
+ON CONFLICT (name_t) DO NOTHING;
+
+INSERT INTO roles_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles, permissions
+WHERE (roles.name_t = 'support' AND permissions.code = 'users:read')
+   OR roles.name_t = 'admin'
+ON CONFLICT DO NOTHING;
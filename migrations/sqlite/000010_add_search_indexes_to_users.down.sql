@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS users_last_name_idx;
+DROP INDEX IF EXISTS users_first_name_idx;
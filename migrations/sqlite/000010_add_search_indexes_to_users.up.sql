@@ -0,0 +1,3 @@
+-- SQLite has no trigram indexes, the search scans the users
+CREATE INDEX IF NOT EXISTS users_first_name_idx ON users (first_name_t);
+CREATE INDEX IF NOT EXISTS users_last_name_idx ON users (last_name_t);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS outbox (
+    id integer PRIMARY KEY,
+    event_id text UNIQUE NOT NULL,
+    type_t text NOT NULL,
+    user_id text NOT NULL,
+    created_at_dt timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+    payload blob NOT NULL,
+    published_at_dt timestamp,
+    attempts integer NOT NULL DEFAULT 0,
+    last_error_t text
+);
+
+CREATE INDEX IF NOT EXISTS outbox_unpublished_idx ON outbox (id) WHERE published_at_dt IS NULL;
+CREATE INDEX IF NOT EXISTS outbox_published_at_dt_idx ON outbox (published_at_dt);
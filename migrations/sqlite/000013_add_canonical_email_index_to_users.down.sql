@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS users_email_canonical_key;
+ALTER TABLE users DROP COLUMN email_canonical_t;
@@ -0,0 +1,16 @@
+-- The emails are unique by their canonical email, the email with the domain and
+-- the local part in lowercase. SQLite can't report the users with the same
+-- canonical email, the index fails on them and they are listed by:
+--   SELECT group_concat(email_t, ', ') FROM users GROUP BY lower(email_t) HAVING count(*) > 1;
+-- The service keeps the canonical emails, and rebuilds them on startup when the
+-- local parts are case-sensitive. The unique constraint of the column stays,
+-- SQLite only drops it by copying the table
+
+-- The domains are stored in lowercase
+UPDATE users SET email_t = substr(email_t, 1, instr(email_t, '@')) || lower(substr(email_t, instr(email_t, '@') + 1))
+WHERE substr(email_t, instr(email_t, '@') + 1) <> lower(substr(email_t, instr(email_t, '@') + 1));
+
+ALTER TABLE users ADD COLUMN email_canonical_t text NOT NULL DEFAULT '';
+UPDATE users SET email_canonical_t = lower(email_t);
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_canonical_key ON users (email_canonical_t);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS user_purges;
+DROP INDEX IF EXISTS users_deleted_at_dt_idx;
+ALTER TABLE users DROP COLUMN deleted_at_dt;
@@ -0,0 +1,10 @@
+ALTER TABLE users ADD COLUMN deleted_at_dt timestamp;
+
+CREATE INDEX IF NOT EXISTS users_deleted_at_dt_idx ON users (deleted_at_dt) WHERE deleted_at_dt IS NOT NULL;
+
+-- The purged users are recorded without their personal data
+CREATE TABLE IF NOT EXISTS user_purges (
+    user_id text PRIMARY KEY NOT NULL,
+    deleted_at_dt timestamp NOT NULL,
+    purged_at_dt timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now'))
+);
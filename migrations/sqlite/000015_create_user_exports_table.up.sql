@@ -0,0 +1,13 @@
+-- The archives of the personal data exports, kept until they expire
+CREATE TABLE IF NOT EXISTS user_exports (
+    id text PRIMARY KEY,
+    user_id text NOT NULL REFERENCES users ON DELETE CASCADE,
+    status_t text NOT NULL,
+    created_at_dt timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+    completed_at_dt timestamp,
+    expires_at_dt timestamp NOT NULL,
+    archive blob
+);
+
+CREATE INDEX IF NOT EXISTS user_exports_user_id_idx ON user_exports (user_id);
+CREATE INDEX IF NOT EXISTS user_exports_expires_at_dt_idx ON user_exports (expires_at_dt);
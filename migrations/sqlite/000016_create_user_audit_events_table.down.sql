@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS users_roles_audit_delete;
+DROP TRIGGER IF EXISTS users_roles_audit_insert;
+DROP TABLE IF EXISTS user_audit_events;
+DROP TABLE IF EXISTS user_audit_pruner;
@@ -0,0 +1,50 @@
+-- The events of the accounts are only appended, they outlive the purge
+-- of their user and are only deleted after their retention
+CREATE TABLE IF NOT EXISTS user_audit_events (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id text NOT NULL,
+    actor_id text,
+    type_t text NOT NULL,
+    details_t text NOT NULL DEFAULT '',
+    ip_t text NOT NULL DEFAULT '',
+    user_agent_t text NOT NULL DEFAULT '',
+    created_at_dt timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now'))
+);
+
+CREATE INDEX IF NOT EXISTS user_audit_events_user_id_idx ON user_audit_events (user_id, created_at_dt DESC, id DESC);
+CREATE INDEX IF NOT EXISTS user_audit_events_created_at_dt_idx ON user_audit_events (created_at_dt);
+
+CREATE TRIGGER IF NOT EXISTS user_audit_events_append_only BEFORE UPDATE ON user_audit_events
+BEGIN
+    SELECT RAISE(ABORT, 'user_audit_events is append-only');
+END;
+
+-- SQLite has no roles, the pruner of the retention marks its transaction
+-- with a row of user_audit_pruner to delete the events
+CREATE TABLE IF NOT EXISTS user_audit_pruner (
+    id integer PRIMARY KEY
+);
+
+CREATE TRIGGER IF NOT EXISTS user_audit_events_delete BEFORE DELETE ON user_audit_events
+WHEN NOT EXISTS (SELECT 1 FROM user_audit_pruner)
+BEGIN
+    SELECT RAISE(ABORT, 'user_audit_events is append-only');
+END;
+
+-- The roles are given in SQL, so their changes are recorded by triggers,
+-- the roles removed with a purged user aren't recorded
+CREATE TRIGGER IF NOT EXISTS users_roles_audit_insert AFTER INSERT ON users_roles
+BEGIN
+    INSERT INTO user_audit_events (user_id, type_t, details_t)
+    SELECT NEW.user_id, 'role.added', roles.name_t
+    FROM roles
+    WHERE roles.id = NEW.role_id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS users_roles_audit_delete AFTER DELETE ON users_roles
+BEGIN
+    INSERT INTO user_audit_events (user_id, type_t, details_t)
+    SELECT OLD.user_id, 'role.removed', roles.name_t
+    FROM roles, users
+    WHERE roles.id = OLD.role_id AND users.id = OLD.user_id;
+END;